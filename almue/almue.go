@@ -15,6 +15,8 @@ import (
 	"github.com/go-chi/chi/middleware"
 	"github.com/go-chi/docgen"
 	"github.com/go-chi/render"
+	"github.com/he4d/almue-backend/board"
+	"github.com/he4d/almue-backend/metrics"
 	"github.com/he4d/simplejack"
 	"github.com/rs/cors"
 )
@@ -25,14 +27,18 @@ type Almue struct {
 	server           *http.Server
 	store            DeviceStore
 	deviceController DeviceController
+	board            *board.Profile
 	simulate         bool
 	publicAPI        bool
+	calendarDir      string
+	started          time.Time
 	logger           *simplejack.Logger
 }
 
 // New initializes a new Almue struct, initializes it and return it
-func New(store DeviceStore, deviceController DeviceController, logger *simplejack.Logger, publicAPI bool) (*Almue, error) {
-	app := &Almue{store: store, deviceController: deviceController, logger: logger, publicAPI: publicAPI}
+func New(store DeviceStore, deviceController DeviceController, board *board.Profile, logger *simplejack.Logger, publicAPI bool) (*Almue, error) {
+	app := &Almue{store: store, deviceController: deviceController, board: board, logger: logger, publicAPI: publicAPI,
+		calendarDir: "./calendars", started: time.Now()}
 	if err := app.initialize(); err != nil {
 		return nil, err
 	}
@@ -107,25 +113,24 @@ func (a *Almue) feedDeviceController() error {
 	if err := a.deviceController.RegisterLightings(allLightings...); err != nil {
 		return err
 	}
-	return nil
+	return a.applyCalendar()
 }
 
 func (a *Almue) initializeRouter() error {
 	a.router = chi.NewRouter()
 
 	// Set up the middleware
-	//TODO: ONLY FOR DEBUGGING
 	a.router.Use(middleware.RequestID)
-	a.router.Use(middleware.Logger)
-	//
+	a.router.Use(a.logRequests)
+	a.router.Use(instrument)
 	a.router.Use(middleware.Recoverer)
 
 	if a.publicAPI {
 		cors := cors.New(cors.Options{
 			AllowedOrigins:   []string{"*"},
-			AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE"},
-			AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
-			ExposedHeaders:   []string{"Link"},
+			AllowedMethods:   []string{"GET", "POST", "PUT", "PATCH", "DELETE"},
+			AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token", "If-Match"},
+			ExposedHeaders:   []string{"Link", "ETag"},
 			AllowCredentials: false,
 			MaxAge:           300, // Maximum value not ignored by any of major browsers
 		})
@@ -141,73 +146,99 @@ func (a *Almue) initializeRouter() error {
 	filesDir := filepath.Join(workDir, "frontend/dist")
 	fileServer(a.router, "/", http.Dir(filesDir))
 
+	// Health checks and metrics of the monitoring
+	a.router.Get("/healthz", a.getHealth)
+	a.router.Get("/readyz", a.getReadiness)
+	a.router.Method("GET", "/metrics", metrics.Default.Handler())
+
 	// API version 1
 	a.router.Route("/api", func(r chi.Router) {
 		r.Route("/v1", func(r chi.Router) {
 			r.Use(apiVersionCtx("v1"))
 			r.Route("/manage", func(r chi.Router) {
 				r.Get("/logfile", a.getLogfile)
+				r.Get("/diagnostics", a.getDiagnostics)
+				r.Get("/export", a.exportConfiguration)
+				r.Post("/import", a.importConfiguration)
 				r.Route("/db", func(r chi.Router) {
 					r.Get("/backup", a.retrieveStoreBackup)
+					r.Get("/schema", a.getSchema)
 				})
 			})
-			r.Route("/shutters", func(r chi.Router) {
-				r.Get("/", a.getAllShutters)
-				r.Post("/", a.createShutter)
-				r.Route("/{shutterID:[0-9]+$}", func(r chi.Router) {
-					r.Use(a.shutterCtx)
-					r.Get("/", a.getShutter)
-					r.Put("/", a.updateShutter)
-					r.Delete("/", a.deleteShutter)
-					r.Route("/{action:[a-z]+$}", func(r chi.Router) {
-						r.Post("/", a.controlShutter)
-					})
+			r.Get("/pins", a.getAllPins)
+			r.Get("/board", a.getBoard)
+			r.Route("/simulation", func(r chi.Router) {
+				r.Use(a.simulationCtx)
+				r.Get("/pins", a.getSimulatedPins)
+				r.Post("/pins/{pin:[0-9]+}/{level:(high|low)}", a.injectPinLevel)
+			})
+			r.Route("/shutters", a.shutterRoutes)
+			r.Route("/lightings", a.lightingRoutes)
+			r.Get("/jobs", a.getAllJobs)
+			r.Route("/commands", func(r chi.Router) {
+				r.Get("/", a.getAllCommands)
+				r.Route("/{commandID:[0-9]+$}", func(r chi.Router) {
+					r.Use(a.commandCtx)
+					r.Get("/", a.getCommand)
+					r.Delete("/", a.cancelCommand)
 				})
 			})
-			r.Route("/lightings", func(r chi.Router) {
-				r.Get("/", a.getAllLightings)
-				r.Post("/", a.createLighting)
-				r.Route("/{lightingID:[0-9]+$}", func(r chi.Router) {
-					r.Use(a.lightingCtx)
-					r.Get("/", a.getLighting)
-					r.Put("/", a.updateLighting)
-					r.Delete("/", a.deleteLighting)
-					r.Route("/{action:[a-z]+$}", func(r chi.Router) {
-						r.Post("/", a.controlLighting)
+			r.Route("/presence", func(r chi.Router) {
+				r.Get("/", a.getPresence)
+				r.Put("/", a.startPresence)
+				r.Delete("/", a.stopPresence)
+			})
+			r.Route("/calendar", func(r chi.Router) {
+				r.Get("/triggers", a.getCalendarTriggers)
+				r.Post("/import", a.importCalendar)
+				r.Route("/exceptions", func(r chi.Router) {
+					r.Get("/", a.getAllCalendarExceptions)
+					r.Post("/", a.createCalendarException)
+					r.Route("/{exceptionID:[0-9]+$}", func(r chi.Router) {
+						r.Use(a.calendarExceptionCtx)
+						r.Get("/", a.getCalendarException)
+						r.Group(func(r chi.Router) {
+							r.Use(a.ifMatch(calendarExceptionCtxKey))
+							r.Put("/", a.updateCalendarException)
+							r.Delete("/", a.deleteCalendarException)
+						})
 					})
 				})
 			})
+			r.Route("/tags", func(r chi.Router) {
+				r.Get("/", a.getAllTags)
+				r.Post("/{tagName}/{action:[a-z]+$}", a.controlTag)
+			})
 			r.Route("/floors", func(r chi.Router) {
 				r.Get("/", a.getAllFloors)
 				r.Post("/", a.createFloor)
 				r.Route("/{floorID:[0-9]+$}", func(r chi.Router) {
 					r.Use(a.floorCtx)
 					r.Get("/", a.getFloor)
-					r.Put("/", a.updateFloor)
-					r.Delete("/", a.deleteFloor)
-					r.Route("/shutters", func(r chi.Router) {
-						r.Get("/", a.getAllShuttersOfFloor)
-						r.Post("/", a.createShutter)
-						r.Route("/{shutterID:[0-9]+$}", func(r chi.Router) {
-							r.Use(a.shutterCtx)
-							r.Get("/", a.getShutter)
-							r.Put("/", a.updateShutter)
-							r.Delete("/", a.deleteShutter)
-							r.Route("/{action:[a-z]+$}", func(r chi.Router) {
-								r.Post("/", a.controlShutter)
-							})
-						})
+					r.Group(func(r chi.Router) {
+						r.Use(a.ifMatch(floorCtxKey))
+						r.Put("/", a.updateFloor)
+						r.Patch("/", a.patchFloor)
+						r.Delete("/", a.deleteFloor)
 					})
-					r.Route("/lightings", func(r chi.Router) {
-						r.Get("/", a.getAllLightingsOfFloor)
-						r.Post("/", a.createLighting)
-						r.Route("/{lightingID:[0-9]+$}", func(r chi.Router) {
-							r.Use(a.lightingCtx)
-							r.Get("/", a.getLighting)
-							r.Put("/", a.updateLighting)
-							r.Delete("/", a.deleteLighting)
+					r.Route("/shutters", a.shutterRoutes)
+					r.Route("/lightings", a.lightingRoutes)
+					r.Route("/rooms", func(r chi.Router) {
+						r.Get("/", a.getAllRoomsOfFloor)
+						r.Post("/", a.createRoom)
+						r.Route("/{roomID:[0-9]+$}", func(r chi.Router) {
+							r.Use(a.roomCtx)
+							r.Get("/", a.getRoom)
+							r.Group(func(r chi.Router) {
+								r.Use(a.ifMatch(roomCtxKey))
+								r.Put("/", a.updateRoom)
+								r.Patch("/", a.patchRoom)
+								r.Delete("/", a.deleteRoom)
+							})
+							r.Route("/shutters", a.shutterRoutes)
+							r.Route("/lightings", a.lightingRoutes)
 							r.Route("/{action:[a-z]+$}", func(r chi.Router) {
-								r.Post("/", a.controlLighting)
+								r.Post("/", a.controlRoom)
 							})
 						})
 					})
@@ -218,6 +249,48 @@ func (a *Almue) initializeRouter() error {
 	return nil
 }
 
+// shutterRoutes are the routes of the shutters, they are mounted at the top level
+// and nested in floors and rooms, which restrict the listed and created shutters
+func (a *Almue) shutterRoutes(r chi.Router) {
+	r.Get("/", a.getAllShutters)
+	r.Post("/", a.createShutter)
+	r.Route("/{shutterID:[0-9]+$}", func(r chi.Router) {
+		r.Use(a.shutterCtx)
+		r.Get("/", a.getShutter)
+		r.Group(func(r chi.Router) {
+			r.Use(a.ifMatch(shutterCtxKey))
+			r.Put("/", a.updateShutter)
+			r.Patch("/", a.patchShutter)
+			r.Delete("/", a.deleteShutter)
+		})
+		r.Get("/jobs", a.getShutterJobs)
+		r.Route("/{action:[a-z]+$}", func(r chi.Router) {
+			r.Post("/", a.controlShutter)
+		})
+	})
+}
+
+// lightingRoutes are the routes of the lightings, they are mounted at the top level
+// and nested in floors and rooms, which restrict the listed and created lightings
+func (a *Almue) lightingRoutes(r chi.Router) {
+	r.Get("/", a.getAllLightings)
+	r.Post("/", a.createLighting)
+	r.Route("/{lightingID:[0-9]+$}", func(r chi.Router) {
+		r.Use(a.lightingCtx)
+		r.Get("/", a.getLighting)
+		r.Group(func(r chi.Router) {
+			r.Use(a.ifMatch(lightingCtxKey))
+			r.Put("/", a.updateLighting)
+			r.Patch("/", a.patchLighting)
+			r.Delete("/", a.deleteLighting)
+		})
+		r.Get("/jobs", a.getLightingJobs)
+		r.Route("/{action:[a-z]+$}", func(r chi.Router) {
+			r.Post("/", a.controlLighting)
+		})
+	})
+}
+
 func fileServer(r chi.Router, path string, root http.FileSystem) {
 	if strings.ContainsAny(path, ":*") {
 		panic("FileServer does not permit URL parameters.")
@@ -259,3 +332,13 @@ func (a *Almue) retrieveStoreBackup(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 	w.Write(file)
 }
+
+func (a *Almue) getSchema(w http.ResponseWriter, r *http.Request) {
+	schema, err := a.store.GetSchema()
+	if err != nil {
+		render.Render(w, r, ErrInternalServer(err))
+		a.logger.Error.Print(err)
+		return
+	}
+	render.JSON(w, r, schema)
+}
@@ -0,0 +1,146 @@
+package almue
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/he4d/almue-backend/model"
+)
+
+func TestExportImportConfiguration(t *testing.T) {
+	h := newHarness(t)
+	defer h.close()
+
+	floor := h.createFloor("erdgeschoss")
+	shutter := h.createShutter(floor.ID, 17, 27)
+	h.createLighting(floor.ID, 4)
+	exception := &model.CalendarException{}
+	h.mustDo("POST", "/api/v1/calendar/exceptions", map[string]interface{}{
+		"description": "holidays", "startDate": "2017-12-24", "action": "skip", "shutters": []int64{shutter.ID},
+	}, http.StatusCreated, exception)
+
+	rec := h.do("GET", "/api/v1/manage/export", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200 on export but got %d", rec.Code)
+	}
+	doc := map[string]interface{}{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &doc); err != nil {
+		t.Fatal(err)
+	}
+
+	h.controller.reset()
+	result := &importResult{}
+	h.mustDo("POST", "/api/v1/manage/import?dryRun=true", doc, http.StatusOK, result)
+	if result.Applied || len(result.Conflicts) != 0 || result.Shutters != 1 || result.Lightings != 1 ||
+		result.CalendarExceptions != 1 {
+		t.Errorf("Unexpected dry run result %+v", result)
+	}
+	if calls := h.controller.reset(); len(calls) != 0 {
+		t.Errorf("Expected no controller calls on a dry run but got %v", calls)
+	}
+
+	h.mustDo("POST", "/api/v1/manage/import", doc, http.StatusOK, result)
+	if !result.Applied {
+		t.Errorf("Expected the configuration to be applied %+v", result)
+	}
+	if calls := h.controller.reset(); len(calls) != 4 {
+		t.Errorf("Expected the devices to be unregistered and registered again but got %v", calls)
+	}
+	imported := &model.CalendarException{}
+	h.mustDo("GET", fmt.Sprintf("/api/v1/calendar/exceptions/%d", exception.ID), nil, http.StatusOK, imported)
+	if !reflect.DeepEqual(imported.Shutters, []int64{shutter.ID}) {
+		t.Errorf("Expected the calendar exception to survive the import but got %+v", imported)
+	}
+
+	// the time rules of the REST API apply to an import as well
+	shutterDoc := doc["shutters"].([]interface{})[0].(map[string]interface{})
+	shutterDoc["jobsEnabled"], shutterDoc["closeTime"] = true, "0000-01-01T06:00:00Z"
+	h.mustDo("POST", "/api/v1/manage/import", doc, http.StatusConflict, result)
+	if len(result.Conflicts) != 1 || result.Conflicts[0].Kind != "time" {
+		t.Errorf("Expected a time conflict but got %+v", result.Conflicts)
+	}
+	shutterDoc["jobsEnabled"] = false
+
+	doc["lightings"].([]interface{})[0].(map[string]interface{})["switchPin"] = 17
+	h.mustDo("POST", "/api/v1/manage/import", doc, http.StatusConflict, result)
+	if len(result.Conflicts) != 1 || result.Conflicts[0].Kind != "pin" {
+		t.Errorf("Expected a pin conflict but got %+v", result.Conflicts)
+	}
+}
+
+func TestImportStopsIfDevicesCanNotBeUnregistered(t *testing.T) {
+	h := newHarness(t)
+	defer h.close()
+
+	floor := h.createFloor("erdgeschoss")
+	first := h.createShutter(floor.ID, 17, 27)
+	second := h.createShutter(floor.ID, 5, 6)
+	disabled := h.createShutter(floor.ID, 12, 13)
+	h.mustDo("PATCH", fmt.Sprintf("/api/v1/shutters/%d", disabled.ID), map[string]interface{}{"disabled": true}, http.StatusOK, nil)
+
+	doc := map[string]interface{}{}
+	h.mustDo("GET", "/api/v1/manage/export", nil, http.StatusOK, &doc)
+	doc["floors"].([]interface{})[0].(map[string]interface{})["description"] = "obergeschoss"
+
+	h.controller.reset()
+	h.controller.failing[fmt.Sprintf("UnregisterShutter(%d)", second.ID)] = true
+	h.mustDo("POST", "/api/v1/manage/import", doc, http.StatusInternalServerError, nil)
+
+	// the disabled shutter is not registered and the unregistered shutter is registered again
+	expected := []string{fmt.Sprintf("UnregisterShutter(%d)", first.ID), fmt.Sprintf("RegisterShutters(%d)", first.ID)}
+	if calls := h.controller.reset(); !reflect.DeepEqual(calls, expected) {
+		t.Errorf("Expected the calls %v but got %v", expected, calls)
+	}
+	stored := &floorPayload{}
+	h.mustDo("GET", fmt.Sprintf("/api/v1/floors/%d", floor.ID), nil, http.StatusOK, stored)
+	if *stored.Description != "erdgeschoss" {
+		t.Errorf("Expected the configuration not to be imported but got the floor %q", *stored.Description)
+	}
+}
+
+func TestPinRoutes(t *testing.T) {
+	h := newHarness(t)
+	defer h.close()
+
+	floor := h.createFloor("erdgeschoss")
+	h.createShutter(floor.ID, 17, 27)
+
+	pins := &pinListPayload{}
+	h.mustDo("GET", "/api/v1/pins", nil, http.StatusOK, pins)
+	if len(pins.Used) != 2 {
+		t.Errorf("Expected 2 used pins but got %v", pins.Used)
+	}
+	for _, pin := range pins.Free {
+		if pin == 17 || pin == 27 || pin == 14 {
+			t.Errorf("Pin %d must not be free", pin)
+		}
+	}
+
+	h.mustDo("GET", "/api/v1/board", nil, http.StatusOK, nil)
+}
+
+func TestSimulationRoutesWithoutSimulator(t *testing.T) {
+	h := newHarness(t)
+	defer h.close()
+
+	h.mustDo("GET", "/api/v1/simulation/pins", nil, http.StatusNotFound, nil)
+}
+
+func TestSchemaRoute(t *testing.T) {
+	h := newHarness(t)
+	defer h.close()
+
+	schema := &model.Schema{}
+	h.mustDo("GET", "/api/v1/manage/db/schema", nil, http.StatusOK, schema)
+	if schema.Version == 0 || schema.Version != schema.Latest || len(schema.Migrations) != schema.Latest {
+		t.Errorf("Expected a completely migrated schema but got %+v", schema)
+	}
+	for _, m := range schema.Migrations {
+		if !m.Applied || m.AppliedAt == nil || m.Modified {
+			t.Errorf("Expected the migration to be applied unmodified but got %+v", m)
+		}
+	}
+}
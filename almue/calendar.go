@@ -0,0 +1,418 @@
+package almue
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/render"
+	"github.com/he4d/almue-backend/calendar"
+	"github.com/he4d/almue-backend/model"
+)
+
+const (
+	// defaultTriggerDays is the number of days the upcoming triggers are listed for if no days are given
+	defaultTriggerDays = 7
+	// maxTriggerDays is the maximum number of days the upcoming triggers can be listed for
+	maxTriggerDays = 31
+	// calendarImportYears is the number of years yearly events of an imported calendar are repeated for
+	calendarImportYears = 2
+)
+
+type calendarExceptionPayload struct {
+	*model.CalendarException
+	refs referenceChecker
+}
+
+func (p *calendarExceptionPayload) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+func (p *calendarExceptionPayload) Bind(r *http.Request) error {
+	if p.CalendarException == nil {
+		p.CalendarException = &model.CalendarException{}
+	}
+	if err := p.validate().errOrNil(); err != nil {
+		return err
+	}
+	p.Normalize()
+	return nil
+}
+
+func newCalendarExceptionListPayloadResponse(exceptions []*model.CalendarException) []render.Renderer {
+	list := []render.Renderer{}
+	for _, exception := range exceptions {
+		list = append(list, &calendarExceptionPayload{CalendarException: exception})
+	}
+	return list
+}
+
+// calendarImportPayload names an iCalendar file of the calendar directory. Its other
+// fields are the template of the exceptions that are created for the events of the file
+type calendarImportPayload struct {
+	*model.CalendarException
+	File string `json:"file"`
+	refs referenceChecker
+}
+
+func (p *calendarImportPayload) Bind(r *http.Request) error {
+	if p.CalendarException == nil {
+		p.CalendarException = &model.CalendarException{}
+	}
+	return p.validate().errOrNil()
+}
+
+type calendarImportResult struct {
+	File       string                     `json:"file"`
+	Removed    int                        `json:"removed"`
+	Exceptions []*model.CalendarException `json:"exceptions"`
+}
+
+func (c *calendarImportResult) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+type calendarTriggerPayload struct {
+	*model.CalendarTrigger
+}
+
+func (p *calendarTriggerPayload) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+func (a *Almue) getAllCalendarExceptions(w http.ResponseWriter, r *http.Request) {
+	exceptions, err := a.store.GetCalendarExceptionList()
+	if err != nil {
+		render.Render(w, r, ErrList(err))
+		a.logger.Error.Print(err)
+		return
+	}
+
+	if err := render.RenderList(w, r, newCalendarExceptionListPayloadResponse(exceptions)); err != nil {
+		render.Render(w, r, ErrRender(err))
+		a.logger.Error.Print(err)
+	}
+}
+
+func (a *Almue) createCalendarException(w http.ResponseWriter, r *http.Request) {
+	p := &calendarExceptionPayload{refs: a}
+	if err := render.Bind(r, p); err != nil {
+		render.Render(w, r, ErrBind(err))
+		a.logger.Error.Print(err)
+		return
+	}
+	p.Source = ""
+
+	id, err := a.store.CreateCalendarException(p.CalendarException)
+	if err != nil {
+		render.Render(w, r, ErrRender(err))
+		a.logger.Error.Print(err)
+		return
+	}
+
+	exception, err := a.store.GetCalendarException(id)
+	if err != nil {
+		render.Render(w, r, ErrInternalServer(err))
+		a.logger.Error.Print(err)
+		return
+	}
+
+	if err := a.applyCalendar(); err != nil {
+		render.Render(w, r, ErrInternalServer(err))
+		a.logger.Error.Print(err)
+		return
+	}
+
+	setETag(w, exception.Version)
+	render.Status(r, http.StatusCreated)
+	render.Render(w, r, &calendarExceptionPayload{CalendarException: exception})
+}
+
+func (a *Almue) getCalendarException(w http.ResponseWriter, r *http.Request) {
+	exception, ok := r.Context().Value(calendarExceptionCtxKey).(*model.CalendarException)
+	if !ok {
+		a.logger.Error.Print("Calendar exception from context is not a calendar exception?")
+		return
+	}
+
+	setETag(w, exception.Version)
+	if err := render.Render(w, r, &calendarExceptionPayload{CalendarException: exception}); err != nil {
+		render.Render(w, r, ErrRender(err))
+		return
+	}
+}
+
+// updateCalendarException replaces the exception. The source of an imported exception is kept,
+// so importing its file again replaces the updated exception as well
+func (a *Almue) updateCalendarException(w http.ResponseWriter, r *http.Request) {
+	exception, ok := r.Context().Value(calendarExceptionCtxKey).(*model.CalendarException)
+	if !ok {
+		a.logger.Error.Print("Calendar exception from context is not a calendar exception?")
+		return
+	}
+	old := exception.DeepCopy()
+
+	p := &calendarExceptionPayload{CalendarException: exception, refs: a}
+	if err := render.Bind(r, p); err != nil {
+		render.Render(w, r, ErrBind(err))
+		a.logger.Error.Print(err)
+		return
+	}
+	if p.ID != old.ID {
+		err := errors.New("Can not update the calendar exception to a different id")
+		render.Render(w, r, ErrInvalidRequest(err))
+		a.logger.Error.Print(err)
+		return
+	}
+
+	// the If-Match header was checked against the version of the old exception
+	p.Version = old.Version
+	p.Source = old.Source
+	if err := a.store.UpdateCalendarException(p.CalendarException); err != nil {
+		if err == model.ErrVersionConflict {
+			render.Render(w, r, ErrPreconditionFailed(err))
+		} else {
+			render.Render(w, r, ErrInternalServer(err))
+		}
+		a.logger.Error.Print(err)
+		return
+	}
+
+	updated, err := a.store.GetCalendarException(old.ID)
+	if err != nil {
+		render.Render(w, r, ErrInternalServer(err))
+		a.logger.Error.Print(err)
+		return
+	}
+
+	if err := a.applyCalendar(); err != nil {
+		render.Render(w, r, ErrInternalServer(err))
+		a.logger.Error.Print(err)
+		return
+	}
+
+	setETag(w, updated.Version)
+	render.Render(w, r, &calendarExceptionPayload{CalendarException: updated})
+}
+
+func (a *Almue) deleteCalendarException(w http.ResponseWriter, r *http.Request) {
+	exception, ok := r.Context().Value(calendarExceptionCtxKey).(*model.CalendarException)
+	if !ok {
+		a.logger.Error.Print("Calendar exception from context is not a calendar exception?")
+		return
+	}
+
+	if err := a.store.DeleteCalendarException(exception.ID); err != nil {
+		render.Render(w, r, ErrInternalServer(err))
+		a.logger.Error.Print(err)
+		return
+	}
+
+	if err := a.applyCalendar(); err != nil {
+		render.Render(w, r, ErrInternalServer(err))
+		a.logger.Error.Print(err)
+		return
+	}
+
+	render.NoContent(w, r)
+}
+
+// importCalendar creates an exception for every event of an iCalendar file of the calendar directory
+// that has not ended yet. The exceptions of a previous import of the same file are replaced
+func (a *Almue) importCalendar(w http.ResponseWriter, r *http.Request) {
+	p := &calendarImportPayload{refs: a}
+	if err := render.Bind(r, p); err != nil {
+		render.Render(w, r, ErrBind(err))
+		a.logger.Error.Print(err)
+		return
+	}
+
+	f, err := os.Open(filepath.Join(a.calendarDir, p.File))
+	if err != nil {
+		if os.IsNotExist(err) {
+			err = fmt.Errorf("The calendar file %s does not exist", p.File)
+		}
+		render.Render(w, r, ErrInvalidRequest(err))
+		a.logger.Error.Print(err)
+		return
+	}
+	defer f.Close()
+
+	now := time.Now()
+	events, err := calendar.ParseICS(f, now.AddDate(calendarImportYears, 0, 0))
+	if err != nil {
+		err = fmt.Errorf("Could not read the calendar file %s: %v", p.File, err)
+		render.Render(w, r, ErrInvalidRequest(err))
+		a.logger.Error.Print(err)
+		return
+	}
+
+	today := now.Format(model.DateFormat)
+	result := &calendarImportResult{File: p.File, Exceptions: []*model.CalendarException{}}
+	err = a.store.WithTx(func(tx DeviceStore) error {
+		exceptions, err := tx.GetCalendarExceptionList()
+		if err != nil {
+			return err
+		}
+		for _, exception := range exceptions {
+			if exception.Source != p.File {
+				continue
+			}
+			if err := tx.DeleteCalendarException(exception.ID); err != nil {
+				return err
+			}
+			result.Removed++
+		}
+
+		for _, event := range events {
+			if event.EndDate < today {
+				continue
+			}
+			exception := p.CalendarException.DeepCopy()
+			exception.Description = eventDescription(event, p.File)
+			exception.StartDate = event.StartDate
+			exception.EndDate = event.EndDate
+			exception.Source = p.File
+			exception.Normalize()
+			id, err := tx.CreateCalendarException(exception)
+			if err != nil {
+				return err
+			}
+			created, err := tx.GetCalendarException(id)
+			if err != nil {
+				return err
+			}
+			result.Exceptions = append(result.Exceptions, created)
+		}
+		return nil
+	})
+	if err != nil {
+		render.Render(w, r, ErrInternalServer(err))
+		a.logger.Error.Print(err)
+		return
+	}
+
+	if err := a.applyCalendar(); err != nil {
+		render.Render(w, r, ErrInternalServer(err))
+		a.logger.Error.Print(err)
+		return
+	}
+
+	a.logger.Info.Printf("Imported %d calendar exceptions of %s, replaced %d", len(result.Exceptions), p.File, result.Removed)
+	render.Render(w, r, result)
+}
+
+// eventDescription returns the summary of the event as description of an exception,
+// events without a summary are named after their file
+func eventDescription(event *calendar.Event, file string) *string {
+	descr := event.Summary
+	if descr == "" {
+		descr = file
+	}
+	if len(descr) > maxDescriptionLength {
+		descr = descr[:maxDescriptionLength]
+	}
+	return &descr
+}
+
+// getCalendarTriggers lists the runs of the daily jobs of the enabled devices in the next days
+// as they happen with the calendar exceptions applied. The days are given by the query parameter days
+func (a *Almue) getCalendarTriggers(w http.ResponseWriter, r *http.Request) {
+	days := defaultTriggerDays
+	if value := r.URL.Query().Get("days"); value != "" {
+		var err error
+		days, err = strconv.Atoi(value)
+		if err != nil || days < 1 || days > maxTriggerDays {
+			err := fmt.Errorf("The days must be a number between 1 and %d", maxTriggerDays)
+			render.Render(w, r, ErrInvalidRequest(err))
+			a.logger.Error.Print(err)
+			return
+		}
+	}
+
+	exceptions, err := a.store.GetCalendarExceptionList()
+	if err != nil {
+		render.Render(w, r, ErrInternalServer(err))
+		a.logger.Error.Print(err)
+		return
+	}
+	shutters, err := a.store.GetShutterList()
+	if err != nil {
+		render.Render(w, r, ErrInternalServer(err))
+		a.logger.Error.Print(err)
+		return
+	}
+	lightings, err := a.store.GetLightingList()
+	if err != nil {
+		render.Render(w, r, ErrInternalServer(err))
+		a.logger.Error.Print(err)
+		return
+	}
+
+	now := time.Now()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	triggers := []*model.CalendarTrigger{}
+	add := func(deviceType string, deviceID int64, job string, at time.Time) {
+		for d := 0; d < days; d++ {
+			day := today.AddDate(0, 0, d)
+			trigger := &model.CalendarTrigger{
+				Time:       time.Date(day.Year(), day.Month(), day.Day(), at.Hour(), at.Minute(), 0, 0, day.Location()),
+				DeviceType: deviceType,
+				DeviceID:   deviceID,
+				Job:        job,
+			}
+			if trigger.Time.Before(now) {
+				continue
+			}
+			if exception := model.ResolveCalendar(exceptions, deviceType, deviceID, job, day.Format(model.DateFormat)); exception != nil {
+				id := exception.ID
+				trigger.ExceptionID = &id
+				if exception.Action == model.CalendarSkip {
+					trigger.Skipped = true
+				} else {
+					trigger.ShiftMinutes = exception.ShiftMinutes
+					trigger.Time = trigger.Time.Add(time.Duration(exception.ShiftMinutes) * time.Minute)
+				}
+			}
+			triggers = append(triggers, trigger)
+		}
+	}
+	for _, shutter := range shutters {
+		if shutter.Disabled || !shutter.JobsEnabled {
+			continue
+		}
+		add("shutter", shutter.ID, model.JobOpen, shutter.OpenTime)
+		add("shutter", shutter.ID, model.JobClose, shutter.CloseTime)
+	}
+	for _, lighting := range lightings {
+		if lighting.Disabled || !lighting.JobsEnabled {
+			continue
+		}
+		add("lighting", lighting.ID, model.JobOn, lighting.OnTime)
+		add("lighting", lighting.ID, model.JobOff, lighting.OffTime)
+	}
+	sort.SliceStable(triggers, func(i, j int) bool { return triggers[i].Time.Before(triggers[j].Time) })
+
+	list := []render.Renderer{}
+	for _, trigger := range triggers {
+		list = append(list, &calendarTriggerPayload{trigger})
+	}
+	if err := render.RenderList(w, r, list); err != nil {
+		render.Render(w, r, ErrRender(err))
+		a.logger.Error.Print(err)
+	}
+}
+
+// applyCalendar hands the calendar exceptions of the store to the device controller
+func (a *Almue) applyCalendar() error {
+	exceptions, err := a.store.GetCalendarExceptionList()
+	if err != nil {
+		return err
+	}
+	return a.deviceController.SetCalendarExceptions(exceptions)
+}
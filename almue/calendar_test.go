@@ -0,0 +1,176 @@
+package almue
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/he4d/almue-backend/model"
+)
+
+func TestCalendarExceptions(t *testing.T) {
+	h := newHarness(t)
+	defer h.close()
+
+	floor := h.createFloor("ground")
+	shutter := h.createShutter(floor.ID, 17, 27)
+
+	invalid := map[string]interface{}{
+		"description":  "holidays",
+		"startDate":    "2017-12-24",
+		"endDate":      "2017-12-01",
+		"action":       "shift",
+		"shiftMinutes": 0,
+		"jobs":         []string{"open", "dance"},
+		"shutters":     []int64{shutter.ID, 99},
+	}
+	resp := &validationResponse{ErrResponse: &ErrResponse{}}
+	h.mustDo("POST", "/api/v1/calendar/exceptions", invalid, http.StatusUnprocessableEntity, resp)
+	got := map[string]int64{}
+	for _, field := range resp.Fields {
+		got[field.Field] = field.AppCode
+	}
+	expected := map[string]int64{
+		"endDate": AppCodeTimeOrder, "shiftMinutes": AppCodeOutOfRange, "jobs": AppCodeOutOfRange, "shutters": AppCodeUnknownDevice,
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected the invalid fields %v but got %v", expected, got)
+	}
+
+	body := map[string]interface{}{
+		"description": "holidays",
+		"startDate":   "2017-12-24",
+		"endDate":     "2017-12-26",
+		"action":      "skip",
+		"jobs":        []string{"open"},
+		"shutters":    []int64{shutter.ID},
+		"source":      "ignored.ics",
+	}
+	created := &model.CalendarException{}
+	h.mustDo("POST", "/api/v1/calendar/exceptions", body, http.StatusCreated, created)
+	if created.ID == 0 || created.Source != "" || len(created.Lightings) != 0 {
+		t.Errorf("Expected a created manual exception but got %+v", created)
+	}
+	if applied := h.controller.calendarExceptions(); len(applied) != 1 || applied[0].ID != created.ID {
+		t.Errorf("Expected the exception to be handed to the controller but got %+v", applied)
+	}
+
+	path := fmt.Sprintf("/api/v1/calendar/exceptions/%d", created.ID)
+	body["action"] = "shift"
+	body["shiftMinutes"] = 45
+	updated := &model.CalendarException{}
+	h.mustDo("PUT", path, body, http.StatusOK, updated)
+	if updated.Action != model.CalendarShift || updated.ShiftMinutes != 45 || updated.Version == created.Version {
+		t.Errorf("Expected the exception to be updated but got %+v", updated)
+	}
+	if applied := h.controller.calendarExceptions(); len(applied) != 1 || applied[0].ShiftMinutes != 45 {
+		t.Errorf("Expected the update to be handed to the controller but got %+v", applied)
+	}
+
+	var list []*model.CalendarException
+	h.mustDo("GET", "/api/v1/calendar/exceptions", nil, http.StatusOK, &list)
+	if len(list) != 1 || list[0].ID != created.ID {
+		t.Errorf("Expected the exception in the list but got %+v", list)
+	}
+
+	h.mustDo("DELETE", path, nil, http.StatusNoContent, nil)
+	h.mustDo("GET", path, nil, http.StatusNotFound, nil)
+	if applied := h.controller.calendarExceptions(); len(applied) != 0 {
+		t.Errorf("Expected the controller to have no exceptions but got %+v", applied)
+	}
+}
+
+func TestImportCalendar(t *testing.T) {
+	h := newHarness(t)
+	defer h.close()
+
+	dir, err := ioutil.TempDir("", "almue-calendar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	h.app.calendarDir = dir
+
+	next := time.Now().AddDate(0, 1, 0)
+	ics := "BEGIN:VCALENDAR\r\n" +
+		"BEGIN:VEVENT\r\nSUMMARY:Past\r\nDTSTART;VALUE=DATE:20100101\r\nEND:VEVENT\r\n" +
+		"BEGIN:VEVENT\r\nSUMMARY:Holiday\r\nDTSTART;VALUE=DATE:" + next.Format("20060102") + "\r\nEND:VEVENT\r\n" +
+		"END:VCALENDAR\r\n"
+	if err := ioutil.WriteFile(filepath.Join(dir, "holidays.ics"), []byte(ics), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	body := map[string]interface{}{"file": "holidays.ics", "action": "skip", "allDevices": true}
+	result := &calendarImportResult{}
+	h.mustDo("POST", "/api/v1/calendar/import", body, http.StatusOK, result)
+	if len(result.Exceptions) != 1 || result.Removed != 0 {
+		t.Fatalf("Expected one imported exception but got %+v", result)
+	}
+	imported := result.Exceptions[0]
+	if *imported.Description != "Holiday" || imported.StartDate != next.Format(model.DateFormat) ||
+		imported.Source != "holidays.ics" || !imported.AllDevices {
+		t.Errorf("Expected the holiday to be imported but got %+v", imported)
+	}
+
+	// importing the file again replaces its exceptions
+	h.mustDo("POST", "/api/v1/calendar/import", body, http.StatusOK, result)
+	var list []*model.CalendarException
+	h.mustDo("GET", "/api/v1/calendar/exceptions", nil, http.StatusOK, &list)
+	if result.Removed != 1 || len(list) != 1 {
+		t.Errorf("Expected the exceptions to be replaced but got %+v and %d exceptions", result, len(list))
+	}
+
+	h.mustDo("POST", "/api/v1/calendar/import", map[string]interface{}{"file": "../holidays.ics", "action": "skip", "allDevices": true}, 422, nil)
+	h.mustDo("POST", "/api/v1/calendar/import", map[string]interface{}{"file": "missing.ics", "action": "skip", "allDevices": true}, http.StatusBadRequest, nil)
+}
+
+func TestCalendarTriggers(t *testing.T) {
+	h := newHarness(t)
+	defer h.close()
+
+	floor := h.createFloor("ground")
+	body := shutterBody(floor.ID, 17, 27)
+	body["jobsEnabled"] = true
+	shutter := &model.Shutter{}
+	h.mustDo("POST", "/api/v1/shutters", body, http.StatusCreated, shutter)
+	h.createLighting(floor.ID, 4)
+
+	tomorrow := time.Now().AddDate(0, 0, 1)
+	dayAfter := tomorrow.AddDate(0, 0, 1)
+	skip := map[string]interface{}{
+		"description": "skip", "startDate": tomorrow.Format(model.DateFormat), "action": "skip",
+		"jobs": []string{"open"}, "allDevices": true,
+	}
+	shift := map[string]interface{}{
+		"description": "shift", "startDate": dayAfter.Format(model.DateFormat), "action": "shift",
+		"shiftMinutes": 30, "shutters": []int64{shutter.ID},
+	}
+	h.mustDo("POST", "/api/v1/calendar/exceptions", skip, http.StatusCreated, nil)
+	h.mustDo("POST", "/api/v1/calendar/exceptions", shift, http.StatusCreated, nil)
+
+	var triggers []*model.CalendarTrigger
+	h.mustDo("GET", "/api/v1/calendar/triggers?days=3", nil, http.StatusOK, &triggers)
+	found := map[string]*model.CalendarTrigger{}
+	for _, trigger := range triggers {
+		if trigger.DeviceType != "shutter" || trigger.DeviceID != shutter.ID {
+			t.Errorf("Expected only the triggers of the shutter with enabled jobs but got %+v", trigger)
+		}
+		found[trigger.Time.Local().Format("2006-01-02 15:04")+" "+trigger.Job] = trigger
+	}
+	if open := found[tomorrow.Format(model.DateFormat)+" 07:30 open"]; open == nil || !open.Skipped || open.ExceptionID == nil {
+		t.Errorf("Expected the open job of tomorrow to be skipped but got %+v", triggers)
+	}
+	if close := found[tomorrow.Format(model.DateFormat)+" 20:00 close"]; close == nil || close.Skipped {
+		t.Errorf("Expected the close job of tomorrow to run but got %+v", triggers)
+	}
+	if open := found[dayAfter.Format(model.DateFormat)+" 08:00 open"]; open == nil || open.ShiftMinutes != 30 {
+		t.Errorf("Expected the open job of the day after tomorrow to be shifted but got %+v", triggers)
+	}
+
+	h.mustDo("GET", "/api/v1/calendar/triggers?days=32", nil, http.StatusBadRequest, nil)
+}
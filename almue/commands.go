@@ -0,0 +1,115 @@
+package almue
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/go-chi/chi/middleware"
+	"github.com/go-chi/render"
+	"github.com/he4d/almue-backend/model"
+)
+
+type commandPayload struct {
+	*model.Command
+}
+
+func (p *commandPayload) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+// groupCommandsPayload is the response of an action of a room or a tag, the commands that were
+// queued and the devices whose command could not be queued
+type groupCommandsPayload struct {
+	Commands []*commandPayload `json:"commands"`
+	Failed   []*failedCommand  `json:"failed"`
+}
+
+func (p *groupCommandsPayload) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+// failedCommand is a device of a group whose command could not be queued
+type failedCommand struct {
+	DeviceType string `json:"deviceType"`
+	DeviceID   int64  `json:"deviceId"`
+	Error      string `json:"error"`
+}
+
+// newCommand returns a command of the REST API, its trace is the id of the request. Stopping a shutter
+// and resetting a device are urgent so they run before other queued commands
+func newCommand(r *http.Request, deviceType string, deviceID int64, action string) *model.Command {
+	priority := model.CommandPriorityNormal
+	if action == "stop" || action == "reset" {
+		priority = model.CommandPriorityHigh
+	}
+	return &model.Command{
+		DeviceType: deviceType,
+		DeviceID:   deviceID,
+		Action:     action,
+		Source:     model.CommandSourceAPI,
+		Priority:   priority,
+		Trace:      middleware.GetReqID(r.Context()),
+	}
+}
+
+// submitCommand queues the action for the device and renders the accepted command.
+// Its result can be polled at the location of the command
+func (a *Almue) submitCommand(w http.ResponseWriter, r *http.Request, deviceType string, deviceID int64, action string) {
+	command, err := a.deviceController.SubmitCommand(newCommand(r, deviceType, deviceID, action))
+	if err != nil {
+		render.Render(w, r, ErrInternalServer(err))
+		a.logger.Error.Print(err)
+		return
+	}
+
+	w.Header().Set("Location", fmt.Sprintf("/api/v1/commands/%d", command.ID))
+	render.Status(r, http.StatusAccepted)
+	render.Render(w, r, &commandPayload{command})
+}
+
+// getAllCommands lists the queued, running and the last finished commands
+func (a *Almue) getAllCommands(w http.ResponseWriter, r *http.Request) {
+	list := []render.Renderer{}
+	for _, command := range a.deviceController.Commands() {
+		list = append(list, &commandPayload{command})
+	}
+	if err := render.RenderList(w, r, list); err != nil {
+		render.Render(w, r, ErrRender(err))
+		a.logger.Error.Print(err)
+	}
+}
+
+func (a *Almue) getCommand(w http.ResponseWriter, r *http.Request) {
+	command, ok := r.Context().Value(commandCtxKey).(*model.Command)
+	if !ok {
+		a.logger.Error.Print("Command from context is not a command?")
+		return
+	}
+
+	render.Render(w, r, &commandPayload{command})
+}
+
+// cancelCommand cancels a queued command, a running or finished command is a conflict
+func (a *Almue) cancelCommand(w http.ResponseWriter, r *http.Request) {
+	command, ok := r.Context().Value(commandCtxKey).(*model.Command)
+	if !ok {
+		a.logger.Error.Print("Command from context is not a command?")
+		return
+	}
+
+	cancelled, err := a.deviceController.CancelCommand(command.ID)
+	if err != nil {
+		switch err {
+		case model.ErrNotCancellable:
+			render.Render(w, r, ErrConflict(err))
+		case model.ErrNotFound:
+			render.Render(w, r, ErrNotFound)
+		default:
+			render.Render(w, r, ErrInternalServer(err))
+		}
+		a.logger.Error.Print(err)
+		return
+	}
+
+	render.Render(w, r, &commandPayload{cancelled})
+}
@@ -0,0 +1,68 @@
+package almue
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/he4d/almue-backend/model"
+)
+
+func TestCommandRoutes(t *testing.T) {
+	h := newHarness(t)
+	defer h.close()
+
+	floor := h.createFloor("ground")
+	shutter := h.createShutter(floor.ID, 17, 27)
+
+	rec := h.do("POST", fmt.Sprintf("/api/v1/shutters/%d/stop", shutter.ID), nil)
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("Expected status 202 but got %d: %s", rec.Code, rec.Body.String())
+	}
+	accepted := &model.Command{}
+	if err := json.Unmarshal(rec.Body.Bytes(), accepted); err != nil {
+		t.Fatal(err)
+	}
+	location := fmt.Sprintf("/api/v1/commands/%d", accepted.ID)
+	if rec.Header().Get("Location") != location || accepted.DeviceID != shutter.ID || accepted.Action != "stop" ||
+		accepted.Source != model.CommandSourceAPI || accepted.Priority != model.CommandPriorityHigh {
+		t.Errorf("Expected the accepted stop command at %s but got %+v at %s", location, accepted, rec.Header().Get("Location"))
+	}
+
+	command := &model.Command{}
+	h.mustDo("GET", location, nil, http.StatusOK, command)
+	if command.ID != accepted.ID || command.Status != model.CommandDone {
+		t.Errorf("Expected the finished command but got %+v", command)
+	}
+	h.mustDo("GET", "/api/v1/commands/99", nil, http.StatusNotFound, nil)
+	h.mustDo("DELETE", location, nil, http.StatusConflict, nil)
+
+	// a group action queues a command for every device and accepts them all
+	h.controller.holdCommands = true
+	roomPath := fmt.Sprintf("/api/v1/floors/%d/rooms/%d", floor.ID, h.createRoom(floor.ID, "kitchen").ID)
+	lighting := &model.Lighting{}
+	h.mustDo("POST", roomPath+"/lightings", lightingBody(floor.ID, 4), http.StatusCreated, lighting)
+	group := &groupCommandsPayload{}
+	h.mustDo("POST", roomPath+"/on", nil, http.StatusAccepted, group)
+	if len(group.Commands) != 1 || group.Commands[0].DeviceType != model.DeviceTypeLighting ||
+		group.Commands[0].DeviceID != lighting.ID || len(group.Failed) != 0 {
+		t.Errorf("Expected a command for the lighting of the room but got %+v", group)
+	}
+	h.mustDo("POST", fmt.Sprintf("/api/v1/shutters/%d/open", shutter.ID), nil, http.StatusAccepted, command)
+	if command.Priority != model.CommandPriorityNormal || command.Status != model.CommandQueued {
+		t.Errorf("Expected a queued command with normal priority but got %+v", command)
+	}
+
+	cancelled := &model.Command{}
+	h.mustDo("DELETE", fmt.Sprintf("/api/v1/commands/%d", command.ID), nil, http.StatusOK, cancelled)
+	if cancelled.Status != model.CommandCancelled {
+		t.Errorf("Expected the command to be cancelled but got %+v", cancelled)
+	}
+
+	var commands []*model.Command
+	h.mustDo("GET", "/api/v1/commands", nil, http.StatusOK, &commands)
+	if len(commands) != 3 || commands[2].Status != model.CommandCancelled {
+		t.Errorf("Expected all commands but got %+v", commands)
+	}
+}
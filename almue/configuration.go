@@ -0,0 +1,357 @@
+package almue
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/render"
+	"github.com/he4d/almue-backend/board"
+	"github.com/he4d/almue-backend/model"
+)
+
+// configurationVersion is the version of the exported configuration document.
+// It must be increased whenever the document changes in an incompatible way.
+const configurationVersion = 1
+
+type configurationDocument struct {
+	Version  int       `json:"version"`
+	Exported time.Time `json:"exported"`
+	*model.Configuration
+}
+
+type configurationConflict struct {
+	Kind    string `json:"kind"`
+	Message string `json:"message"`
+}
+
+type importResult struct {
+	DryRun             bool                     `json:"dryRun"`
+	Applied            bool                     `json:"applied"`
+	Floors             int                      `json:"floors"`
+	Rooms              int                      `json:"rooms"`
+	Shutters           int                      `json:"shutters"`
+	Lightings          int                      `json:"lightings"`
+	CalendarExceptions int                      `json:"calendarExceptions"`
+	Conflicts          []*configurationConflict `json:"conflicts"`
+}
+
+func (i *importResult) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+func (a *Almue) exportConfiguration(w http.ResponseWriter, r *http.Request) {
+	config, err := a.store.GetConfiguration()
+	if err != nil {
+		render.Render(w, r, ErrInternalServer(err))
+		a.logger.Error.Print(err)
+		return
+	}
+
+	doc := &configurationDocument{
+		Version:       configurationVersion,
+		Exported:      time.Now().UTC(),
+		Configuration: config,
+	}
+
+	w.Header().Set("Content-Disposition", "attachment; filename=\"almue.json\"")
+	render.JSON(w, r, doc)
+}
+
+func (a *Almue) importConfiguration(w http.ResponseWriter, r *http.Request) {
+	dryRun, _ := strconv.ParseBool(r.URL.Query().Get("dryRun"))
+
+	doc := &configurationDocument{}
+	if err := render.DecodeJSON(r.Body, doc); err != nil {
+		render.Render(w, r, ErrInvalidRequest(err))
+		a.logger.Error.Print(err)
+		return
+	}
+	if doc.Configuration == nil {
+		doc.Configuration = &model.Configuration{}
+	}
+
+	result := &importResult{
+		DryRun:             dryRun,
+		Floors:             len(doc.Floors),
+		Rooms:              len(doc.Rooms),
+		Shutters:           len(doc.Shutters),
+		Lightings:          len(doc.Lightings),
+		CalendarExceptions: len(doc.CalendarExceptions),
+		Conflicts:          validateConfiguration(doc, a.board, a.deviceController),
+	}
+
+	if len(result.Conflicts) > 0 {
+		render.Status(r, http.StatusConflict)
+		render.Render(w, r, result)
+		return
+	}
+
+	if dryRun {
+		render.Render(w, r, result)
+		return
+	}
+
+	oldConfig, err := a.store.GetConfiguration()
+	if err != nil {
+		render.Render(w, r, ErrInternalServer(err))
+		a.logger.Error.Print(err)
+		return
+	}
+
+	if err := a.unregisterConfiguration(oldConfig); err != nil {
+		render.Render(w, r, ErrInternalServer(err))
+		a.logger.Error.Print(err)
+		return
+	}
+
+	if err := a.store.ImportConfiguration(doc.Configuration); err != nil {
+		a.logger.Error.Printf("Could not import the configuration: %v", err)
+		if err := a.feedDeviceController(); err != nil {
+			a.logger.Error.Printf("Could not register the previous devices again: %v", err)
+		}
+		render.Render(w, r, ErrInternalServer(err))
+		return
+	}
+
+	if err := a.feedDeviceController(); err != nil {
+		render.Render(w, r, ErrInternalServer(err))
+		a.logger.Error.Print(err)
+		return
+	}
+
+	a.logger.Info.Printf("Imported configuration with %d floors, %d rooms, %d shutters, %d lightings and %d calendar exceptions",
+		result.Floors, result.Rooms, result.Shutters, result.Lightings, result.CalendarExceptions)
+
+	result.Applied = true
+	render.Render(w, r, result)
+}
+
+// unregisterConfiguration unregisters the devices of the given configuration from the device controller,
+// disabled devices are not registered and skipped. If a device can not be unregistered the import must
+// not go on, as its jobs would keep running. The devices that were already unregistered are registered
+// again and the error is returned
+func (a *Almue) unregisterConfiguration(config *model.Configuration) error {
+	shutters := []*model.Shutter{}
+	lightings := []*model.Lighting{}
+	restore := func(err error) error {
+		if regErr := a.deviceController.RegisterShutters(shutters...); regErr != nil {
+			a.logger.Error.Printf("Could not register the unregistered shutters again: %v", regErr)
+		}
+		if regErr := a.deviceController.RegisterLightings(lightings...); regErr != nil {
+			a.logger.Error.Printf("Could not register the unregistered lightings again: %v", regErr)
+		}
+		return err
+	}
+
+	for _, shutter := range config.Shutters {
+		if shutter.Disabled {
+			continue
+		}
+		if err := a.deviceController.UnregisterShutter(shutter.ID); err != nil {
+			return restore(fmt.Errorf("Could not unregister shutter %d, the configuration is not imported: %v", shutter.ID, err))
+		}
+		shutters = append(shutters, shutter)
+	}
+	for _, lighting := range config.Lightings {
+		if lighting.Disabled {
+			continue
+		}
+		if err := a.deviceController.UnregisterLighting(lighting.ID); err != nil {
+			return restore(fmt.Errorf("Could not unregister lighting %d, the configuration is not imported: %v", lighting.ID, err))
+		}
+		lightings = append(lightings, lighting)
+	}
+	return nil
+}
+
+// configurationRefs checks the references of the payloads of a configuration document against the
+// document itself instead of the store, as the import replaces the store
+type configurationRefs struct {
+	board      *board.Profile
+	controller DeviceController
+	floors     map[int64]struct{}
+	roomFloors map[int64]int64
+	// the devices of the document by their id, the value tells if the device is disabled
+	shutters  map[int64]bool
+	lightings map[int64]bool
+}
+
+func (c *configurationRefs) checkPin(pin int) error {
+	return c.board.Validate(pin)
+}
+
+func (c *configurationRefs) checkFloor(floorID int64) error {
+	if _, ok := c.floors[floorID]; !ok {
+		return fmt.Errorf("Floor %d does not exist", floorID)
+	}
+	return nil
+}
+
+func (c *configurationRefs) checkRoom(roomID, floorID int64) error {
+	roomFloorID, ok := c.roomFloors[roomID]
+	if !ok {
+		return fmt.Errorf("Room %d does not exist", roomID)
+	}
+	if roomFloorID != floorID {
+		return fmt.Errorf("Room %d is not on the floor %d", roomID, floorID)
+	}
+	return nil
+}
+
+func (c *configurationRefs) checkDevice(deviceType string, deviceID int64) error {
+	devices := c.shutters
+	if deviceType != "shutter" {
+		devices = c.lightings
+	}
+	disabled, ok := devices[deviceID]
+	if !ok {
+		return fmt.Errorf("The %s %d does not exist", deviceType, deviceID)
+	}
+	if disabled {
+		return fmt.Errorf("The %s %d is disabled", deviceType, deviceID)
+	}
+	return nil
+}
+
+func (c *configurationRefs) checkCompleteWay(seconds int) error {
+	return c.controller.CheckCompleteWay(time.Duration(seconds) * time.Second)
+}
+
+// conflictKinds are the kinds of the conflicts of the field errors by their app code,
+// other field errors are invalid
+var conflictKinds = map[int64]string{
+	AppCodeRequired:      "missing",
+	AppCodeUnknownPin:    "pin",
+	AppCodeUnknownFloor:  "floor",
+	AppCodeUnknownRoom:   "room",
+	AppCodeInvalidTag:    "tag",
+	AppCodeInvalidTime:   "time",
+	AppCodeTimeOrder:     "time",
+	AppCodeUnknownDevice: "device",
+	AppCodeInvalidDate:   "date",
+}
+
+// validateConfiguration checks every model of the configuration document with the validation of its payload,
+// so a document can not contain what the REST API rejects. The references are checked against the document.
+// Additionally the ids must be unique, the descriptions of the floors and of the rooms of a floor too, and a pin
+// must only be used by one device
+func validateConfiguration(doc *configurationDocument, boardProfile *board.Profile, controller DeviceController) []*configurationConflict {
+	conflicts := []*configurationConflict{}
+	addConflict := func(kind string, format string, args ...interface{}) {
+		conflicts = append(conflicts, &configurationConflict{Kind: kind, Message: fmt.Sprintf(format, args...)})
+	}
+	addFieldErrors := func(model string, errs fieldErrors) {
+		for _, e := range errs {
+			kind, ok := conflictKinds[e.AppCode]
+			if !ok {
+				kind = "invalid"
+			}
+			addConflict(kind, "%s: %s: %s", model, e.Field, e.Message)
+		}
+	}
+
+	if doc.Version != configurationVersion {
+		addConflict("version", "Unsupported configuration version %d, expected %d", doc.Version, configurationVersion)
+		return conflicts
+	}
+
+	refs := &configurationRefs{
+		board:      boardProfile,
+		controller: controller,
+		floors:     map[int64]struct{}{},
+		roomFloors: map[int64]int64{},
+		shutters:   map[int64]bool{},
+		lightings:  map[int64]bool{},
+	}
+
+	floorDescriptions := map[string]int64{}
+	for _, f := range doc.Floors {
+		if _, ok := refs.floors[f.ID]; ok {
+			addConflict("id", "Floor id %d is used more than once", f.ID)
+		}
+		refs.floors[f.ID] = struct{}{}
+		addFieldErrors(fmt.Sprintf("floor %d", f.ID), (&floorPayload{Floor: f}).validate())
+		if f.Description == nil {
+			continue
+		}
+		if otherID, ok := floorDescriptions[*f.Description]; ok {
+			addConflict("description", "Floor %d and floor %d have the same description %q", otherID, f.ID, *f.Description)
+			continue
+		}
+		floorDescriptions[*f.Description] = f.ID
+	}
+
+	roomDescriptions := map[int64]map[string]int64{}
+	for _, room := range doc.Rooms {
+		if _, ok := refs.roomFloors[room.ID]; ok {
+			addConflict("id", "Room id %d is used more than once", room.ID)
+		}
+		addFieldErrors(fmt.Sprintf("room %d", room.ID), (&roomPayload{Room: room}).validate())
+		if room.FloorID == nil {
+			addConflict("missing", "room %d: floorId: Is required", room.ID)
+			continue
+		}
+		if err := refs.checkFloor(*room.FloorID); err != nil {
+			addConflict("floor", "room %d: floorId: %v", room.ID, err)
+		}
+		refs.roomFloors[room.ID] = *room.FloorID
+		if room.Description == nil {
+			continue
+		}
+		if roomDescriptions[*room.FloorID] == nil {
+			roomDescriptions[*room.FloorID] = map[string]int64{}
+		}
+		if otherID, ok := roomDescriptions[*room.FloorID][*room.Description]; ok {
+			addConflict("description", "Room %d and room %d of floor %d have the same description %q",
+				otherID, room.ID, *room.FloorID, *room.Description)
+			continue
+		}
+		roomDescriptions[*room.FloorID][*room.Description] = room.ID
+	}
+
+	usedPins := map[int]string{}
+	usePin := func(pin *int, device string) {
+		if pin == nil {
+			return
+		}
+		if otherDevice, ok := usedPins[*pin]; ok {
+			addConflict("pin", "Pin %d is used by %s and %s", *pin, otherDevice, device)
+			return
+		}
+		usedPins[*pin] = device
+	}
+
+	for _, s := range doc.Shutters {
+		device := fmt.Sprintf("shutter %d", s.ID)
+		if _, ok := refs.shutters[s.ID]; ok {
+			addConflict("id", "Shutter id %d is used more than once", s.ID)
+		}
+		refs.shutters[s.ID] = s.Disabled
+		addFieldErrors(device, (&shutterPayload{Shutter: s, refs: refs}).validate())
+		usePin(s.OpenPin, device)
+		usePin(s.ClosePin, device)
+	}
+
+	for _, l := range doc.Lightings {
+		device := fmt.Sprintf("lighting %d", l.ID)
+		if _, ok := refs.lightings[l.ID]; ok {
+			addConflict("id", "Lighting id %d is used more than once", l.ID)
+		}
+		refs.lightings[l.ID] = l.Disabled
+		addFieldErrors(device, (&lightingPayload{Lighting: l, refs: refs}).validate())
+		usePin(l.SwitchPin, device)
+	}
+
+	exceptionIDs := map[int64]struct{}{}
+	for _, e := range doc.CalendarExceptions {
+		if _, ok := exceptionIDs[e.ID]; ok {
+			addConflict("id", "Calendar exception id %d is used more than once", e.ID)
+		}
+		exceptionIDs[e.ID] = struct{}{}
+		addFieldErrors(fmt.Sprintf("calendar exception %d", e.ID), (&calendarExceptionPayload{CalendarException: e, refs: refs}).validate())
+	}
+
+	return conflicts
+}
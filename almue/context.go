@@ -2,10 +2,12 @@ package almue
 
 import (
 	"context"
+	"fmt"
 	"net/http"
 	"strconv"
 
 	"github.com/go-chi/chi"
+	"github.com/go-chi/render"
 )
 
 type contextKey struct {
@@ -17,10 +19,14 @@ func (k *contextKey) String() string {
 }
 
 var (
-	floorCtxKey      = &contextKey{"floor"}
-	shutterCtxKey    = &contextKey{"shutter"}
-	lightingCtxKey   = &contextKey{"lighting"}
-	apiVersionCtxKey = &contextKey{"api-version"}
+	floorCtxKey             = &contextKey{"floor"}
+	roomCtxKey              = &contextKey{"room"}
+	shutterCtxKey           = &contextKey{"shutter"}
+	lightingCtxKey          = &contextKey{"lighting"}
+	calendarExceptionCtxKey = &contextKey{"calendar-exception"}
+	commandCtxKey           = &contextKey{"command"}
+	simulatorCtxKey         = &contextKey{"simulator"}
+	apiVersionCtxKey        = &contextKey{"api-version"}
 )
 
 func (a *Almue) floorCtx(next http.Handler) http.Handler {
@@ -37,6 +43,31 @@ func (a *Almue) floorCtx(next http.Handler) http.Handler {
 	})
 }
 
+// roomCtx puts the room to the context, it must be nested in the route of its floor
+func (a *Almue) roomCtx(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		roomID, err := strconv.ParseInt(chi.URLParam(r, "roomID"), 10, 64)
+		if err != nil {
+			http.Error(w, http.StatusText(404), 404)
+			a.logger.Error.Printf("Failed to put room to context: %v", err)
+			return
+		}
+		room, err := a.store.GetRoom(roomID)
+		if err == nil {
+			if floorID, ok := floorFromContext(r); !ok || *floorID != *room.FloorID {
+				err = fmt.Errorf("Room %d does not belong to the floor of the route", roomID)
+			}
+		}
+		if err != nil {
+			http.Error(w, http.StatusText(404), 404)
+			a.logger.Error.Printf("Failed to put room to context: %v", err)
+			return
+		}
+		ctx := context.WithValue(r.Context(), roomCtxKey, room)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
 func (a *Almue) shutterCtx(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		shutterID, err := strconv.ParseInt(chi.URLParam(r, "shutterID"), 10, 64)
@@ -65,6 +96,56 @@ func (a *Almue) lightingCtx(next http.Handler) http.Handler {
 	})
 }
 
+func (a *Almue) calendarExceptionCtx(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		exceptionID, err := strconv.ParseInt(chi.URLParam(r, "exceptionID"), 10, 64)
+		if err != nil {
+			http.Error(w, http.StatusText(404), 404)
+			a.logger.Error.Printf("Failed to put calendar exception to context: %v", err)
+			return
+		}
+		exception, err := a.store.GetCalendarException(exceptionID)
+		if err != nil {
+			http.Error(w, http.StatusText(404), 404)
+			a.logger.Error.Printf("Failed to put calendar exception to context: %v", err)
+			return
+		}
+		ctx := context.WithValue(r.Context(), calendarExceptionCtxKey, exception)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func (a *Almue) commandCtx(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		commandID, err := strconv.ParseInt(chi.URLParam(r, "commandID"), 10, 64)
+		if err != nil {
+			http.Error(w, http.StatusText(404), 404)
+			a.logger.Error.Printf("Failed to put command to context: %v", err)
+			return
+		}
+		command, err := a.deviceController.Command(commandID)
+		if err != nil {
+			http.Error(w, http.StatusText(404), 404)
+			a.logger.Error.Printf("Failed to put command to context: %v", err)
+			return
+		}
+		ctx := context.WithValue(r.Context(), commandCtxKey, command)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func (a *Almue) simulationCtx(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		simulator, ok := a.deviceController.(Simulator)
+		if !ok || !simulator.Simulating() {
+			render.Render(w, r, ErrNotFound)
+			return
+		}
+		ctx := context.WithValue(r.Context(), simulatorCtxKey, simulator)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
 func apiVersionCtx(version string) func(next http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
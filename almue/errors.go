@@ -60,5 +60,45 @@ func ErrRender(err error) render.Renderer {
 	}
 }
 
+//ErrConflict returns a 409 renderer
+func ErrConflict(err error) render.Renderer {
+	return &ErrResponse{
+		Err:            err,
+		HTTPStatusCode: 409,
+		StatusText:     "Conflict.",
+		ErrorText:      err.Error(),
+	}
+}
+
+//ErrUnsupportedMediaType returns a 415 renderer
+func ErrUnsupportedMediaType(err error) render.Renderer {
+	return &ErrResponse{
+		Err:            err,
+		HTTPStatusCode: 415,
+		StatusText:     "Unsupported media type.",
+		ErrorText:      err.Error(),
+	}
+}
+
+//ErrPreconditionFailed returns a 412 renderer
+func ErrPreconditionFailed(err error) render.Renderer {
+	return &ErrResponse{
+		Err:            err,
+		HTTPStatusCode: 412,
+		StatusText:     "Precondition failed.",
+		ErrorText:      err.Error(),
+	}
+}
+
+//ErrPreconditionRequired returns a 428 renderer
+func ErrPreconditionRequired(err error) render.Renderer {
+	return &ErrResponse{
+		Err:            err,
+		HTTPStatusCode: 428,
+		StatusText:     "Precondition required.",
+		ErrorText:      err.Error(),
+	}
+}
+
 //ErrNotFound returns a 404 renderer
 var ErrNotFound = &ErrResponse{HTTPStatusCode: 404, StatusText: "Resource not found."}
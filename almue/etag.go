@@ -0,0 +1,80 @@
+package almue
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/render"
+	"github.com/he4d/almue-backend/model"
+)
+
+// etag returns the entity tag of the given model version
+func etag(version int64) string {
+	return fmt.Sprintf("\"%d\"", version)
+}
+
+func setETag(w http.ResponseWriter, version int64) {
+	w.Header().Set("ETag", etag(version))
+}
+
+// versionOf returns the version of the given model
+func versionOf(v interface{}) (int64, bool) {
+	switch m := v.(type) {
+	case *model.Floor:
+		return m.Version, true
+	case *model.Room:
+		return m.Version, true
+	case *model.Shutter:
+		return m.Version, true
+	case *model.Lighting:
+		return m.Version, true
+	case *model.CalendarException:
+		return m.Version, true
+	default:
+		return 0, false
+	}
+}
+
+// matchesETag checks if one of the entity tags of an If-Match header matches the given one.
+// The header "*" matches every existing model, weak entity tags never match
+func matchesETag(header string, tag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || candidate == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// ifMatch returns a middleware that requires an If-Match header matching the version
+// of the model with the given context key, so no client overwrites changes it has not seen yet
+func (a *Almue) ifMatch(key *contextKey) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			version, ok := versionOf(r.Context().Value(key))
+			if !ok {
+				a.logger.Error.Printf("Context value %s has no version?", key)
+				render.Render(w, r, ErrInternalServer(errors.New("The resource has no version")))
+				return
+			}
+			header := r.Header.Get("If-Match")
+			if header == "" {
+				err := fmt.Errorf("The If-Match header with the current ETag %s is required", etag(version))
+				render.Render(w, r, ErrPreconditionRequired(err))
+				a.logger.Error.Print(err)
+				return
+			}
+			if !matchesETag(header, etag(version)) {
+				setETag(w, version)
+				err := fmt.Errorf("The ETag %s of If-Match is not the current ETag %s", header, etag(version))
+				render.Render(w, r, ErrPreconditionFailed(err))
+				a.logger.Error.Print(err)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
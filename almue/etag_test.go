@@ -0,0 +1,87 @@
+package almue
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestETags(t *testing.T) {
+	h := newHarness(t)
+	defer h.close()
+
+	floor := h.createFloor("erdgeschoss")
+	shutter := h.createShutter(floor.ID, 17, 27)
+	lighting := h.createLighting(floor.ID, 4)
+
+	paths := []struct {
+		name string
+		path string
+		body map[string]interface{}
+	}{
+		{"floor", fmt.Sprintf("/api/v1/floors/%d", floor.ID), map[string]interface{}{"description": "keller"}},
+		{"shutter", fmt.Sprintf("/api/v1/shutters/%d", shutter.ID), map[string]interface{}{"completeWayInSeconds": 30}},
+		{"nested shutter", fmt.Sprintf("/api/v1/floors/%d/shutters/%d", floor.ID, shutter.ID), map[string]interface{}{"completeWayInSeconds": 40}},
+		{"lighting", fmt.Sprintf("/api/v1/lightings/%d", lighting.ID), map[string]interface{}{"jobsEnabled": true}},
+		{"nested lighting", fmt.Sprintf("/api/v1/floors/%d/lightings/%d", floor.ID, lighting.ID), map[string]interface{}{"jobsEnabled": false}},
+	}
+
+	for _, test := range paths {
+		t.Run(test.name, func(t *testing.T) {
+			rec := h.do("GET", test.path, nil)
+			tag := rec.Header().Get("ETag")
+			if tag == "" {
+				t.Fatal("Expected an ETag on GET")
+			}
+
+			for _, method := range []string{"PUT", "PATCH", "DELETE"} {
+				if rec := h.doWithHeader(method, test.path, test.body, http.Header{}); rec.Code != http.StatusPreconditionRequired {
+					t.Errorf("%s without If-Match: expected status 428 but got %d", method, rec.Code)
+				}
+				stale := http.Header{"If-Match": {`"0", W/` + tag}}
+				if rec := h.doWithHeader(method, test.path, test.body, stale); rec.Code != http.StatusPreconditionFailed {
+					t.Errorf("%s with a stale ETag: expected status 412 but got %d", method, rec.Code)
+				}
+			}
+
+			rec = h.doWithHeader("PATCH", test.path, test.body, http.Header{"If-Match": {tag}})
+			if rec.Code != http.StatusOK {
+				t.Fatalf("Expected the patch with the current ETag to succeed but got %d: %s", rec.Code, rec.Body.String())
+			}
+			newTag := rec.Header().Get("ETag")
+			if newTag == "" || newTag == tag {
+				t.Errorf("Expected a new ETag after the update but got %q", newTag)
+			}
+
+			// the second phone still has the old ETag
+			if rec := h.doWithHeader("PUT", test.path, test.body, http.Header{"If-Match": {tag}}); rec.Code != http.StatusPreconditionFailed {
+				t.Errorf("Expected the update with the old ETag to fail with 412 but got %d", rec.Code)
+			}
+		})
+	}
+
+	rec := h.do("GET", fmt.Sprintf("/api/v1/shutters/%d", shutter.ID), nil)
+	h.controller.reset()
+	if rec := h.doWithHeader("DELETE", fmt.Sprintf("/api/v1/shutters/%d", shutter.ID), nil, http.Header{"If-Match": {rec.Header().Get("ETag")}}); rec.Code != http.StatusNoContent {
+		t.Errorf("Expected the delete with the current ETag to succeed but got %d", rec.Code)
+	}
+}
+
+func TestVersionNotChangedByState(t *testing.T) {
+	h := newHarness(t)
+	defer h.close()
+
+	floor := h.createFloor("erdgeschoss")
+	shutter := h.createShutter(floor.ID, 17, 27)
+	if err := h.store.UpdateShutterState(shutter.ID, "opening"); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.store.UpdateShutterOpening(shutter.ID, 50); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := h.do("GET", fmt.Sprintf("/api/v1/shutters/%d", shutter.ID), nil)
+	if tag := rec.Header().Get("ETag"); tag != etag(shutter.Version) {
+		t.Errorf("Expected the ETag %s to stay the same on state changes but got %s", etag(shutter.Version), tag)
+	}
+}
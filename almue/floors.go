@@ -1,6 +1,7 @@
 package almue
 
 import (
+	"encoding/json"
 	"errors"
 	"net/http"
 
@@ -9,13 +10,36 @@ import (
 )
 
 func (a *Almue) getAllFloors(w http.ResponseWriter, r *http.Request) {
-	floors, err := a.store.GetFloorList()
+	opts, err := parseListOptions(r)
 	if err != nil {
-		render.Render(w, r, ErrRender(err))
+		render.Render(w, r, ErrInvalidRequest(err))
+		a.logger.Error.Print(err)
+		return
+	}
+
+	floors, err := a.store.FindFloors(pageOptions(opts))
+	if err != nil {
+		render.Render(w, r, ErrList(err))
+		a.logger.Error.Print(err)
+		return
+	}
+
+	found := len(floors)
+	start, end := pageBounds(opts, found)
+	floors = floors[start:end]
+	if err := setLinkHeader(w, r, opts, found, floors); err != nil {
+		render.Render(w, r, ErrInternalServer(err))
+		a.logger.Error.Print(err)
+		return
+	}
+
+	list, err := a.newFloorListPayloadResponse(floors)
+	if err != nil {
+		render.Render(w, r, ErrInternalServer(err))
 		a.logger.Error.Print(err)
 		return
 	}
-	if err := render.RenderList(w, r, a.newFloorListPayloadResponse(floors)); err != nil {
+	if err := render.RenderList(w, r, list); err != nil {
 		render.Render(w, r, ErrRender(err))
 		a.logger.Error.Print(err)
 	}
@@ -24,7 +48,7 @@ func (a *Almue) getAllFloors(w http.ResponseWriter, r *http.Request) {
 func (a *Almue) createFloor(w http.ResponseWriter, r *http.Request) {
 	f := &floorPayload{}
 	if err := render.Bind(r, f); err != nil {
-		render.Render(w, r, ErrInvalidRequest(err))
+		render.Render(w, r, ErrBind(err))
 		a.logger.Error.Print(err)
 		return
 	}
@@ -44,6 +68,7 @@ func (a *Almue) createFloor(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	setETag(w, floor.Version)
 	render.Status(r, http.StatusCreated)
 	render.Render(w, r, a.newFloorPayloadResponse(floor))
 }
@@ -56,6 +81,7 @@ func (a *Almue) getFloor(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	setETag(w, floor.Version)
 	if err := render.Render(w, r, a.newFloorPayloadResponse(floor)); err != nil {
 		render.Render(w, r, ErrRender(err))
 		return
@@ -73,11 +99,52 @@ func (a *Almue) updateFloor(w http.ResponseWriter, r *http.Request) {
 
 	f := &floorPayload{Floor: floor}
 	if err := render.Bind(r, f); err != nil {
+		render.Render(w, r, ErrBind(err))
+		a.logger.Error.Print(err)
+		return
+	}
+
+	a.saveFloor(w, r, oldFloor, f)
+}
+
+func (a *Almue) patchFloor(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	floor, ok := ctx.Value(floorCtxKey).(*model.Floor)
+	if !ok {
+		a.logger.Error.Print("Floor from context is not a floor?")
+		return
+	}
+
+	if err := checkPatchContentType(r); err != nil {
+		render.Render(w, r, ErrUnsupportedMediaType(err))
+		a.logger.Error.Print(err)
+		return
+	}
+
+	patched, err := readMergePatch(r, floor)
+	if err != nil {
 		render.Render(w, r, ErrInvalidRequest(err))
 		a.logger.Error.Print(err)
 		return
 	}
 
+	f := &floorPayload{}
+	if err := json.Unmarshal(patched, f); err != nil {
+		render.Render(w, r, ErrInvalidRequest(err))
+		a.logger.Error.Print(err)
+		return
+	}
+	if err := f.Bind(r); err != nil {
+		render.Render(w, r, ErrBind(err))
+		a.logger.Error.Print(err)
+		return
+	}
+
+	a.saveFloor(w, r, floor, f)
+}
+
+// saveFloor stores the bound payload as the new state of the old floor
+func (a *Almue) saveFloor(w http.ResponseWriter, r *http.Request, oldFloor *model.Floor, f *floorPayload) {
 	if f.Floor.ID != oldFloor.ID {
 		err := errors.New("Can not update the floor to a different id")
 		render.Render(w, r, ErrInvalidRequest(err))
@@ -85,8 +152,14 @@ func (a *Almue) updateFloor(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// the If-Match header was checked against the version of the old floor
+	f.Version = oldFloor.Version
 	if err := a.store.UpdateFloor(f.Floor); err != nil {
-		render.Render(w, r, ErrInternalServer(err))
+		if err == model.ErrVersionConflict {
+			render.Render(w, r, ErrPreconditionFailed(err))
+		} else {
+			render.Render(w, r, ErrInternalServer(err))
+		}
 		a.logger.Error.Print(err)
 		return
 	}
@@ -98,6 +171,7 @@ func (a *Almue) updateFloor(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	setETag(w, updatedFloor.Version)
 	render.Render(w, r, a.newFloorPayloadResponse(updatedFloor))
 }
 
@@ -115,29 +189,23 @@ func (a *Almue) deleteFloor(w http.ResponseWriter, r *http.Request) {
 		a.logger.Error.Print(err)
 		return
 	}
-	for _, shutter := range shutters {
-		if err := a.deviceController.UnregisterShutter(shutter.ID); err != nil {
-			render.Render(w, r, ErrInternalServer(err))
-			a.logger.Error.Print(err)
-			return
-		}
-	}
-
 	lightings, err := a.store.GetLightingListOfFloor(floor.ID)
 	if err != nil {
 		render.Render(w, r, ErrInternalServer(err))
 		a.logger.Error.Print(err)
 		return
 	}
-	for _, lighting := range lightings {
-		if err := a.deviceController.UnregisterLighting(lighting.ID); err != nil {
-			render.Render(w, r, ErrInternalServer(err))
-			a.logger.Error.Print(err)
-			return
-		}
+	devices := &model.Configuration{Shutters: shutters, Lightings: lightings}
+
+	if err := a.unregisterDevices(devices); err != nil {
+		render.Render(w, r, ErrInternalServer(err))
+		a.logger.Error.Print(err)
+		return
 	}
 
 	if err := a.store.DeleteFloor(floor.ID); err != nil {
+		// the devices of the floor still exist so they have to keep working
+		a.registerDevices(devices)
 		render.Render(w, r, ErrInternalServer(err))
 		a.logger.Error.Print(err)
 		return
@@ -145,3 +213,44 @@ func (a *Almue) deleteFloor(w http.ResponseWriter, r *http.Request) {
 
 	render.NoContent(w, r)
 }
+
+// unregisterDevices unregisters all enabled devices from the device controller.
+// If one of them can not be unregistered, the already unregistered ones are registered again
+func (a *Almue) unregisterDevices(devices *model.Configuration) error {
+	unregistered := &model.Configuration{}
+	for _, shutter := range devices.Shutters {
+		if shutter.Disabled {
+			continue
+		}
+		if err := a.deviceController.UnregisterShutter(shutter.ID); err != nil {
+			a.registerDevices(unregistered)
+			return err
+		}
+		unregistered.Shutters = append(unregistered.Shutters, shutter)
+	}
+	for _, lighting := range devices.Lightings {
+		if lighting.Disabled {
+			continue
+		}
+		if err := a.deviceController.UnregisterLighting(lighting.ID); err != nil {
+			a.registerDevices(unregistered)
+			return err
+		}
+		unregistered.Lightings = append(unregistered.Lightings, lighting)
+	}
+	return nil
+}
+
+// registerDevices registers the devices at the device controller again, errors are only logged
+func (a *Almue) registerDevices(devices *model.Configuration) {
+	for _, shutter := range devices.Shutters {
+		if err := a.deviceController.RegisterShutters(shutter); err != nil {
+			a.logger.Error.Printf("Could not register shutter %d again: %v", shutter.ID, err)
+		}
+	}
+	for _, lighting := range devices.Lightings {
+		if err := a.deviceController.RegisterLightings(lighting); err != nil {
+			a.logger.Error.Printf("Could not register lighting %d again: %v", lighting.ID, err)
+		}
+	}
+}
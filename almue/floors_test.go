@@ -0,0 +1,99 @@
+package almue
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/he4d/almue-backend/model"
+)
+
+func TestFloorRoutes(t *testing.T) {
+	h := newHarness(t)
+	defer h.close()
+
+	floor := h.createFloor("erdgeschoss")
+	h.createFloor("obergeschoss")
+	floorPath := fmt.Sprintf("/api/v1/floors/%d", floor.ID)
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   interface{}
+		status int
+	}{
+		{"list", "GET", "/api/v1/floors", nil, http.StatusOK},
+		{"get", "GET", floorPath, nil, http.StatusOK},
+		{"get unknown", "GET", "/api/v1/floors/999", nil, http.StatusNotFound},
+		{"get invalid id", "GET", "/api/v1/floors/abc", nil, http.StatusNotFound},
+		{"create invalid json", "POST", "/api/v1/floors", "{", http.StatusBadRequest},
+		{"create duplicate", "POST", "/api/v1/floors", map[string]interface{}{"description": "obergeschoss"}, http.StatusUnprocessableEntity},
+		{"update", "PUT", floorPath, map[string]interface{}{"description": "keller"}, http.StatusOK},
+		{"update other id", "PUT", floorPath, map[string]interface{}{"id": floor.ID + 1}, http.StatusBadRequest},
+		{"update unknown", "PUT", "/api/v1/floors/999", map[string]interface{}{"description": "dach"}, http.StatusNotFound},
+		{"delete unknown", "DELETE", "/api/v1/floors/999", nil, http.StatusNotFound},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rec := h.do(test.method, test.path, test.body)
+			if rec.Code != test.status {
+				t.Errorf("%s %s: expected status %d but got %d: %s", test.method, test.path, test.status, rec.Code, rec.Body.String())
+			}
+		})
+	}
+
+	updated := &model.Floor{}
+	h.mustDo("GET", floorPath, nil, http.StatusOK, updated)
+	if *updated.Description != "keller" {
+		t.Errorf("Expected the updated description keller but got %s", *updated.Description)
+	}
+}
+
+func TestFloorPayloadContainsDevices(t *testing.T) {
+	h := newHarness(t)
+	defer h.close()
+
+	floor := h.createFloor("erdgeschoss")
+	shutter := h.createShutter(floor.ID, 17, 27)
+	lighting := h.createLighting(floor.ID, 4)
+
+	payload := &floorPayload{}
+	h.mustDo("GET", fmt.Sprintf("/api/v1/floors/%d", floor.ID), nil, http.StatusOK, payload)
+	if len(payload.Shutters) != 1 || payload.Shutters[0].ID != shutter.ID {
+		t.Errorf("Expected the shutter %d in the floor payload but got %v", shutter.ID, payload.Shutters)
+	}
+	if len(payload.Lightings) != 1 || payload.Lightings[0].ID != lighting.ID {
+		t.Errorf("Expected the lighting %d in the floor payload but got %v", lighting.ID, payload.Lightings)
+	}
+
+	floors := []*floorPayload{}
+	h.mustDo("GET", "/api/v1/floors", nil, http.StatusOK, &floors)
+	if len(floors) != 1 || len(floors[0].Shutters) != 1 || len(floors[0].Lightings) != 1 {
+		t.Errorf("Expected one floor with its devices but got %v", floors)
+	}
+}
+
+func TestDeleteFloorUnregistersDevices(t *testing.T) {
+	h := newHarness(t)
+	defer h.close()
+
+	floor := h.createFloor("erdgeschoss")
+	shutter := h.createShutter(floor.ID, 17, 27)
+	lighting := h.createLighting(floor.ID, 4)
+	h.controller.reset()
+
+	h.mustDo("DELETE", fmt.Sprintf("/api/v1/floors/%d", floor.ID), nil, http.StatusNoContent, nil)
+
+	expected := []string{
+		fmt.Sprintf("UnregisterShutter(%d)", shutter.ID),
+		fmt.Sprintf("UnregisterLighting(%d)", lighting.ID),
+	}
+	if calls := h.controller.reset(); !reflect.DeepEqual(calls, expected) {
+		t.Errorf("Expected the calls %v but got %v", expected, calls)
+	}
+	h.mustDo("GET", fmt.Sprintf("/api/v1/shutters/%d", shutter.ID), nil, http.StatusNotFound, nil)
+	h.mustDo("GET", fmt.Sprintf("/api/v1/lightings/%d", lighting.ID), nil, http.StatusNotFound, nil)
+}
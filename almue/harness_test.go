@@ -0,0 +1,398 @@
+package almue
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/he4d/almue-backend/board"
+	"github.com/he4d/almue-backend/model"
+	"github.com/he4d/almue-backend/store"
+	"github.com/he4d/simplejack"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// recordingController is a DeviceController that records all calls.
+// Calls of the methods in failing return an error instead, a method can fail
+// for all devices, like OpenShutter, or for one device, like OpenShutter(1).
+type recordingController struct {
+	sync.Mutex
+	calls     []string
+	lastDiffs model.DifferenceType
+	failing   map[string]bool
+	presence  *model.PresenceSettings
+	calendar  []*model.CalendarException
+	jobs      []*model.JobStatus
+	commands  []*model.Command
+	status    *model.ControllerStatus
+	// maxCompleteWay is the longest complete way that is accepted, 0 accepts every way
+	maxCompleteWay time.Duration
+	// holdCommands keeps the submitted commands queued so they can be cancelled
+	holdCommands bool
+}
+
+func (c *recordingController) record(method string, id int64) error {
+	c.Lock()
+	defer c.Unlock()
+	call := fmt.Sprintf("%s(%d)", method, id)
+	if c.failing[method] || c.failing[call] {
+		return fmt.Errorf("%s failed", call)
+	}
+	c.calls = append(c.calls, call)
+	return nil
+}
+
+func (c *recordingController) recordDiffs(diffs model.DifferenceType) {
+	c.Lock()
+	c.lastDiffs = diffs
+	c.Unlock()
+}
+
+func (c *recordingController) diffs() model.DifferenceType {
+	c.Lock()
+	defer c.Unlock()
+	return c.lastDiffs
+}
+
+func (c *recordingController) reset() []string {
+	c.Lock()
+	defer c.Unlock()
+	calls := c.calls
+	c.calls = nil
+	return calls
+}
+
+func (c *recordingController) RegisterShutters(shutters ...*model.Shutter) error {
+	for _, s := range shutters {
+		if err := c.record("RegisterShutters", s.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *recordingController) CheckCompleteWay(completeWay time.Duration) error {
+	c.Lock()
+	defer c.Unlock()
+	if c.maxCompleteWay > 0 && completeWay > c.maxCompleteWay {
+		return fmt.Errorf("The complete way of %v is longer than %v", completeWay, c.maxCompleteWay)
+	}
+	return nil
+}
+
+func (c *recordingController) UnregisterShutter(shutterID int64) error {
+	return c.record("UnregisterShutter", shutterID)
+}
+
+func (c *recordingController) UpdateShutter(diffs model.DifferenceType, s *model.Shutter) error {
+	c.recordDiffs(diffs)
+	return c.record("UpdateShutter", s.ID)
+}
+
+func (c *recordingController) RegisterLightings(lightings ...*model.Lighting) error {
+	for _, l := range lightings {
+		if err := c.record("RegisterLightings", l.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *recordingController) UnregisterLighting(lightingID int64) error {
+	return c.record("UnregisterLighting", lightingID)
+}
+
+func (c *recordingController) UpdateLighting(diffs model.DifferenceType, l *model.Lighting) error {
+	c.recordDiffs(diffs)
+	return c.record("UpdateLighting", l.ID)
+}
+
+// SubmitCommand records the command as a call of the method that runs it, like OpenShutter(1).
+// The command is done at once unless holdCommands is set, then it stays queued
+func (c *recordingController) SubmitCommand(command *model.Command) (*model.Command, error) {
+	method := map[string]string{
+		"open": "OpenShutter", "close": "CloseShutter", "stop": "StopShutter",
+		"on": "TurnLightingOn", "off": "TurnLightingOff", "reset": "Reset",
+	}[command.Action]
+	if method == "Reset" {
+		method += map[string]string{model.DeviceTypeShutter: "Shutter", model.DeviceTypeLighting: "Lighting"}[command.DeviceType]
+	}
+	if err := c.record(method, command.DeviceID); err != nil {
+		return nil, err
+	}
+	c.Lock()
+	defer c.Unlock()
+	submitted := *command
+	submitted.ID = int64(len(c.commands) + 1)
+	submitted.Status = model.CommandDone
+	if c.holdCommands {
+		submitted.Status = model.CommandQueued
+	}
+	c.commands = append(c.commands, &submitted)
+	result := submitted
+	return &result, nil
+}
+
+func (c *recordingController) Command(commandID int64) (*model.Command, error) {
+	c.Lock()
+	defer c.Unlock()
+	if commandID < 1 || commandID > int64(len(c.commands)) {
+		return nil, model.ErrNotFound
+	}
+	command := *c.commands[commandID-1]
+	return &command, nil
+}
+
+func (c *recordingController) Commands() []*model.Command {
+	c.Lock()
+	defer c.Unlock()
+	commands := []*model.Command{}
+	for _, command := range c.commands {
+		copied := *command
+		commands = append(commands, &copied)
+	}
+	return commands
+}
+
+func (c *recordingController) CancelCommand(commandID int64) (*model.Command, error) {
+	c.Lock()
+	defer c.Unlock()
+	if commandID < 1 || commandID > int64(len(c.commands)) {
+		return nil, model.ErrNotFound
+	}
+	command := c.commands[commandID-1]
+	if command.Status != model.CommandQueued {
+		return nil, model.ErrNotCancellable
+	}
+	command.Status = model.CommandCancelled
+	cancelled := *command
+	return &cancelled, nil
+}
+
+func (c *recordingController) ScheduleShutterJobs(s *model.Shutter) error {
+	return c.record("ScheduleShutterJobs", s.ID)
+}
+
+func (c *recordingController) UnscheduleShutterJobs(shutterID int64) error {
+	return c.record("UnscheduleShutterJobs", shutterID)
+}
+
+func (c *recordingController) ScheduleLightingJobs(l *model.Lighting) error {
+	return c.record("ScheduleLightingJobs", l.ID)
+}
+
+func (c *recordingController) UnscheduleLightingJobs(lightingID int64) error {
+	return c.record("UnscheduleLightingJobs", lightingID)
+}
+
+// txStore lets the transactions of the datastore satisfy DeviceStore
+type txStore struct {
+	*store.Datastore
+}
+
+func (s txStore) WithTx(fn func(tx DeviceStore) error) error {
+	return s.Datastore.WithTx(func(tx *store.Datastore) error {
+		return fn(txStore{tx})
+	})
+}
+
+// harness runs the almue router on an in-memory store with a recording device controller
+type harness struct {
+	t          *testing.T
+	app        *Almue
+	store      *store.Datastore
+	controller *recordingController
+}
+
+func (c *recordingController) StartPresenceSimulation(settings *model.PresenceSettings) error {
+	if err := c.record("StartPresenceSimulation", 0); err != nil {
+		return err
+	}
+	c.Lock()
+	c.presence = settings
+	c.Unlock()
+	return nil
+}
+
+func (c *recordingController) StopPresenceSimulation() error {
+	if err := c.record("StopPresenceSimulation", 0); err != nil {
+		return err
+	}
+	c.Lock()
+	c.presence = nil
+	c.Unlock()
+	return nil
+}
+
+func (c *recordingController) PresenceStatus() *model.PresenceStatus {
+	c.Lock()
+	defer c.Unlock()
+	return &model.PresenceStatus{
+		Enabled:  c.presence != nil,
+		Settings: c.presence,
+		Planned:  []*model.PresenceAction{},
+		Done:     []*model.PresenceAction{},
+	}
+}
+
+func (c *recordingController) SetCalendarExceptions(exceptions []*model.CalendarException) error {
+	c.Lock()
+	defer c.Unlock()
+	c.calendar = exceptions
+	return nil
+}
+
+func (c *recordingController) calendarExceptions() []*model.CalendarException {
+	c.Lock()
+	defer c.Unlock()
+	return c.calendar
+}
+
+func (c *recordingController) Jobs() []*model.JobStatus {
+	c.Lock()
+	defer c.Unlock()
+	return c.jobs
+}
+
+// Status returns the configured status or a healthy status without devices
+func (c *recordingController) Status() *model.ControllerStatus {
+	c.Lock()
+	defer c.Unlock()
+	if c.status != nil {
+		status := *c.status
+		return &status
+	}
+	return &model.ControllerStatus{GPIO: "simulated", SchedulerAlive: true,
+		ShutterStates: map[string]int{}, LightingStates: map[string]int{}}
+}
+
+func newHarness(t *testing.T) *harness {
+	logger := simplejack.New(simplejack.TRACE, ioutil.Discard)
+	dsn := fmt.Sprintf("file:%s?mode=memory&cache=shared", strings.Replace(t.Name(), "/", "_", -1))
+	s, err := store.New(dsn, logger)
+	if err != nil {
+		t.Fatalf("Could not create the in-memory store: %v", err)
+	}
+	profile, err := board.Get("rpi3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	controller := &recordingController{failing: map[string]bool{}}
+	app, err := New(txStore{s}, controller, profile, logger, false)
+	if err != nil {
+		t.Fatalf("Could not create almue: %v", err)
+	}
+	return &harness{t: t, app: app, store: s, controller: controller}
+}
+
+func (h *harness) close() {
+	h.store.Close()
+}
+
+// do sends the request to the router and returns the recorded response.
+// Updates and deletes are sent with "If-Match: *" so they apply to any version
+func (h *harness) do(method, path string, body interface{}) *httptest.ResponseRecorder {
+	header := http.Header{}
+	switch method {
+	case "PUT", "PATCH", "DELETE":
+		header.Set("If-Match", "*")
+	}
+	return h.doWithHeader(method, path, body, header)
+}
+
+// doWithHeader sends the request with the given header to the router and returns the recorded response
+func (h *harness) doWithHeader(method, path string, body interface{}, header http.Header) *httptest.ResponseRecorder {
+	var reader io.Reader
+	switch b := body.(type) {
+	case nil:
+	case string:
+		reader = strings.NewReader(b)
+	default:
+		data, err := json.Marshal(b)
+		if err != nil {
+			h.t.Fatal(err)
+		}
+		reader = bytes.NewReader(data)
+	}
+	req := httptest.NewRequest(method, path, reader)
+	req.Header.Set("Content-Type", "application/json")
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	rec := httptest.NewRecorder()
+	h.app.router.ServeHTTP(rec, req)
+	return rec
+}
+
+// mustDo sends the request and fails the test if the status code is not the expected one.
+// The response body is decoded into result if it is not nil.
+func (h *harness) mustDo(method, path string, body interface{}, status int, result interface{}) {
+	h.t.Helper()
+	rec := h.do(method, path, body)
+	if rec.Code != status {
+		h.t.Fatalf("%s %s: expected status %d but got %d: %s", method, path, status, rec.Code, rec.Body.String())
+	}
+	if result != nil {
+		if err := json.Unmarshal(rec.Body.Bytes(), result); err != nil {
+			h.t.Fatalf("%s %s: could not decode the response %q: %v", method, path, rec.Body.String(), err)
+		}
+	}
+}
+
+func (h *harness) createFloor(description string) *model.Floor {
+	h.t.Helper()
+	floor := &model.Floor{}
+	h.mustDo("POST", "/api/v1/floors", map[string]interface{}{"description": description}, http.StatusCreated, floor)
+	return floor
+}
+
+func (h *harness) createRoom(floorID int64, description string) *model.Room {
+	h.t.Helper()
+	room := &model.Room{}
+	h.mustDo("POST", fmt.Sprintf("/api/v1/floors/%d/rooms", floorID), map[string]interface{}{"description": description}, http.StatusCreated, room)
+	return room
+}
+
+func (h *harness) createShutter(floorID int64, openPin, closePin int) *model.Shutter {
+	h.t.Helper()
+	shutter := &model.Shutter{}
+	h.mustDo("POST", "/api/v1/shutters", shutterBody(floorID, openPin, closePin), http.StatusCreated, shutter)
+	return shutter
+}
+
+func (h *harness) createLighting(floorID int64, switchPin int) *model.Lighting {
+	h.t.Helper()
+	lighting := &model.Lighting{}
+	h.mustDo("POST", "/api/v1/lightings", lightingBody(floorID, switchPin), http.StatusCreated, lighting)
+	return lighting
+}
+
+func shutterBody(floorID int64, openPin, closePin int) map[string]interface{} {
+	return map[string]interface{}{
+		"description":          fmt.Sprintf("shutter %d/%d", openPin, closePin),
+		"openPin":              openPin,
+		"closePin":             closePin,
+		"completeWayInSeconds": 20,
+		"openTime":             "0000-01-01T07:30:00Z",
+		"closeTime":            "0000-01-01T20:00:00Z",
+		"floorId":              floorID,
+	}
+}
+
+func lightingBody(floorID int64, switchPin int) map[string]interface{} {
+	return map[string]interface{}{
+		"description": fmt.Sprintf("lighting %d", switchPin),
+		"switchPin":   switchPin,
+		"onTime":      "0000-01-01T18:00:00Z",
+		"offTime":     "0000-01-01T23:00:00Z",
+		"floorId":     floorID,
+	}
+}
@@ -0,0 +1,104 @@
+package almue
+
+import (
+	"fmt"
+	"net/http"
+	"runtime"
+	"time"
+
+	"github.com/go-chi/render"
+	"github.com/he4d/almue-backend/model"
+)
+
+// Version is the build version of the backend, it is set with
+// -ldflags "-X github.com/he4d/almue-backend/almue.Version=..."
+var Version = "dev"
+
+// getHealth answers the liveness check of the monitoring. The backend is alive
+// as long as the store is reachable, the gpio host is initialized and the scheduler runs the jobs
+func (a *Almue) getHealth(w http.ResponseWriter, r *http.Request) {
+	a.renderHealth(w, r, a.healthChecks(a.deviceController.Status()))
+}
+
+// getReadiness answers the readiness check of the monitoring. Additionally to the health checks
+// all enabled devices of the store must be registered in the device controller
+func (a *Almue) getReadiness(w http.ResponseWriter, r *http.Request) {
+	status := a.deviceController.Status()
+	checks := append(a.healthChecks(status), a.devicesCheck(status))
+	a.renderHealth(w, r, checks)
+}
+
+func (a *Almue) renderHealth(w http.ResponseWriter, r *http.Request, checks []*model.HealthCheck) {
+	health := &model.Health{Status: model.HealthOK, Checks: checks}
+	for _, check := range checks {
+		if check.Status != model.HealthOK {
+			health.Status = model.HealthFailing
+			a.logger.Warning.Printf("Health check %s failed: %s", check.Name, check.Detail)
+		}
+	}
+	if health.Status != model.HealthOK {
+		render.Status(r, http.StatusServiceUnavailable)
+	}
+	render.JSON(w, r, health)
+}
+
+func (a *Almue) healthChecks(status *model.ControllerStatus) []*model.HealthCheck {
+	database := &model.HealthCheck{Name: "database", Status: model.HealthOK}
+	if err := a.store.Ping(); err != nil {
+		database.Status = model.HealthFailing
+		database.Detail = err.Error()
+	}
+	gpio := &model.HealthCheck{Name: "gpio", Status: model.HealthOK, Detail: status.GPIO}
+	scheduler := &model.HealthCheck{Name: "scheduler", Status: model.HealthOK}
+	if !status.SchedulerAlive {
+		scheduler.Status = model.HealthFailing
+		scheduler.Detail = fmt.Sprintf("%d daily jobs missed their last run", status.MissedJobs)
+	}
+	return []*model.HealthCheck{database, gpio, scheduler}
+}
+
+// devicesCheck compares the registered devices of the controller with the enabled devices of the store
+func (a *Almue) devicesCheck(status *model.ControllerStatus) *model.HealthCheck {
+	check := &model.HealthCheck{Name: "devices", Status: model.HealthOK}
+	disabled := false
+	opts := &model.ListOptions{Disabled: &disabled}
+	shutters, err := a.store.FindShutters(opts)
+	if err != nil {
+		check.Status = model.HealthFailing
+		check.Detail = err.Error()
+		return check
+	}
+	lightings, err := a.store.FindLightings(opts)
+	if err != nil {
+		check.Status = model.HealthFailing
+		check.Detail = err.Error()
+		return check
+	}
+	check.Detail = fmt.Sprintf("%d of %d shutters and %d of %d lightings registered",
+		status.Shutters, len(shutters), status.Lightings, len(lightings))
+	if status.Shutters != len(shutters) || status.Lightings != len(lightings) {
+		check.Status = model.HealthFailing
+	}
+	return check
+}
+
+func (a *Almue) getDiagnostics(w http.ResponseWriter, r *http.Request) {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	status := a.deviceController.Status()
+	render.JSON(w, r, &model.Diagnostics{
+		Version:       Version,
+		Started:       a.started,
+		UptimeSeconds: int64(time.Since(a.started) / time.Second),
+		Simulate:      status.Simulate,
+		Runtime: &model.RuntimeStats{
+			GoVersion:  runtime.Version(),
+			CPUs:       runtime.NumCPU(),
+			Goroutines: runtime.NumGoroutine(),
+			HeapAlloc:  mem.HeapAlloc,
+			HeapSys:    mem.HeapSys,
+			NumGC:      mem.NumGC,
+		},
+		Controller: status,
+	})
+}
@@ -0,0 +1,59 @@
+package almue
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/he4d/almue-backend/model"
+)
+
+func TestHealthRoutes(t *testing.T) {
+	h := newHarness(t)
+	defer h.close()
+
+	floor := h.createFloor("erdgeschoss")
+	h.createShutter(floor.ID, 17, 27)
+	h.createLighting(floor.ID, 4)
+
+	health := &model.Health{}
+	h.mustDo("GET", "/healthz", nil, http.StatusOK, health)
+	if health.Status != model.HealthOK || len(health.Checks) != 3 {
+		t.Errorf("Expected the passed health checks but got %+v", health)
+	}
+
+	// the recording controller has no devices registered
+	h.mustDo("GET", "/readyz", nil, http.StatusServiceUnavailable, health)
+	devices := health.Checks[len(health.Checks)-1]
+	if health.Status != model.HealthFailing || devices.Name != "devices" || devices.Status != model.HealthFailing ||
+		devices.Detail != "0 of 1 shutters and 0 of 1 lightings registered" {
+		t.Errorf("Expected the devices check to fail but got %+v", devices)
+	}
+
+	h.controller.Lock()
+	h.controller.status = &model.ControllerStatus{GPIO: "simulated", Simulate: true, SchedulerAlive: true, Shutters: 1, Lightings: 1,
+		ShutterStates: map[string]int{"stopped": 1}, LightingStates: map[string]int{"on": 1}}
+	h.controller.Unlock()
+	h.mustDo("GET", "/readyz", nil, http.StatusOK, health)
+
+	h.controller.Lock()
+	h.controller.status.SchedulerAlive = false
+	h.controller.status.MissedJobs = 2
+	h.controller.Unlock()
+	h.mustDo("GET", "/healthz", nil, http.StatusServiceUnavailable, health)
+	if scheduler := health.Checks[2]; scheduler.Name != "scheduler" || scheduler.Status != model.HealthFailing {
+		t.Errorf("Expected the scheduler check to fail but got %+v", scheduler)
+	}
+
+	diagnostics := &model.Diagnostics{}
+	h.mustDo("GET", "/api/v1/manage/diagnostics", nil, http.StatusOK, diagnostics)
+	if diagnostics.Version != Version || !diagnostics.Simulate || diagnostics.Runtime == nil || diagnostics.Runtime.Goroutines == 0 ||
+		diagnostics.Controller == nil || diagnostics.Controller.LightingStates["on"] != 1 {
+		t.Errorf("Expected the diagnostics of the backend but got %+v", diagnostics)
+	}
+
+	h.store.Close()
+	h.mustDo("GET", "/healthz", nil, http.StatusServiceUnavailable, health)
+	if database := health.Checks[0]; database.Name != "database" || database.Status != model.HealthFailing {
+		t.Errorf("Expected the database check to fail but got %+v", database)
+	}
+}
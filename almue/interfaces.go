@@ -1,6 +1,10 @@
 package almue
 
-import "github.com/he4d/almue-backend/model"
+import (
+	"time"
+
+	"github.com/he4d/almue-backend/model"
+)
 
 // DeviceStore must be implemented by the device data store
 type DeviceStore interface {
@@ -8,18 +12,36 @@ type DeviceStore interface {
 
 	GetFloorList() ([]*model.Floor, error)
 
+	FindFloors(*model.ListOptions) ([]*model.Floor, error)
+
 	CreateFloor(*model.Floor) (int64, error)
 
 	UpdateFloor(*model.Floor) error
 
 	DeleteFloor(floorID int64) error
 
+	GetRoom(roomID int64) (*model.Room, error)
+
+	GetRoomList() ([]*model.Room, error)
+
+	GetRoomListOfFloor(floorID int64) ([]*model.Room, error)
+
+	FindRooms(*model.ListOptions) ([]*model.Room, error)
+
+	CreateRoom(*model.Room) (int64, error)
+
+	UpdateRoom(*model.Room) error
+
+	DeleteRoom(roomID int64) error
+
 	GetShutter(shutterID int64) (*model.Shutter, error)
 
 	GetShutterList() ([]*model.Shutter, error)
 
 	GetShutterListOfFloor(int64) ([]*model.Shutter, error)
 
+	FindShutters(*model.ListOptions) ([]*model.Shutter, error)
+
 	CreateShutter(*model.Shutter) (int64, error)
 
 	UpdateShutter(*model.Shutter) error
@@ -32,13 +54,44 @@ type DeviceStore interface {
 
 	GetLightingListOfFloor(floorID int64) ([]*model.Lighting, error)
 
+	FindLightings(*model.ListOptions) ([]*model.Lighting, error)
+
 	CreateLighting(*model.Lighting) (int64, error)
 
 	UpdateLighting(*model.Lighting) error
 
 	DeleteLighting(int64) error
 
+	GetTagList() ([]*model.Tag, error)
+
+	GetCalendarException(exceptionID int64) (*model.CalendarException, error)
+
+	GetCalendarExceptionList() ([]*model.CalendarException, error)
+
+	CreateCalendarException(*model.CalendarException) (int64, error)
+
+	UpdateCalendarException(*model.CalendarException) error
+
+	DeleteCalendarException(exceptionID int64) error
+
+	GetPin(pin int) (*model.Pin, error)
+
+	GetPinList() ([]*model.Pin, error)
+
 	GetBackup() ([]byte, error)
+
+	GetSchema() (*model.Schema, error)
+
+	// Ping checks that the store is reachable
+	Ping() error
+
+	GetConfiguration() (*model.Configuration, error)
+
+	ImportConfiguration(*model.Configuration) error
+
+	// WithTx calls fn with a store whose methods all run in one transaction.
+	// The transaction is committed if fn returns nil and rolled back otherwise
+	WithTx(fn func(tx DeviceStore) error) error
 }
 
 // DeviceController must be implemented by the device controller
@@ -49,21 +102,21 @@ type DeviceController interface {
 
 	UpdateShutter(diffs model.DifferenceType, updatedShutter *model.Shutter) error
 
+	CheckCompleteWay(completeWay time.Duration) error
+
 	RegisterLightings(lightings ...*model.Lighting) error
 
 	UnregisterLighting(lightingID int64) error
 
 	UpdateLighting(diffs model.DifferenceType, updatedLighting *model.Lighting) error
 
-	OpenShutter(shutterID int64) error
+	SubmitCommand(command *model.Command) (*model.Command, error)
 
-	CloseShutter(shutterID int64) error
+	Command(commandID int64) (*model.Command, error)
 
-	StopShutter(shutterID int64) error
+	Commands() []*model.Command
 
-	TurnLightingOn(lightingID int64) error
-
-	TurnLightingOff(lightingID int64) error
+	CancelCommand(commandID int64) (*model.Command, error)
 
 	ScheduleShutterJobs(shutter *model.Shutter) error
 
@@ -72,4 +125,25 @@ type DeviceController interface {
 	ScheduleLightingJobs(lighting *model.Lighting) error
 
 	UnscheduleLightingJobs(lightingID int64) error
+
+	StartPresenceSimulation(settings *model.PresenceSettings) error
+
+	StopPresenceSimulation() error
+
+	PresenceStatus() *model.PresenceStatus
+
+	SetCalendarExceptions(exceptions []*model.CalendarException) error
+
+	Jobs() []*model.JobStatus
+
+	Status() *model.ControllerStatus
+}
+
+// Simulator is implemented by device controllers that can run on virtual hardware
+type Simulator interface {
+	Simulating() bool
+
+	SimulatedPins() ([]*model.PinState, error)
+
+	InjectPinLevel(pin int, high bool) error
 }
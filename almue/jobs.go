@@ -0,0 +1,57 @@
+package almue
+
+import (
+	"net/http"
+
+	"github.com/go-chi/render"
+	"github.com/he4d/almue-backend/model"
+)
+
+type jobStatusPayload struct {
+	*model.JobStatus
+}
+
+func (p *jobStatusPayload) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+// getAllJobs lists the daily jobs the device controller has scheduled, ordered by their next run
+func (a *Almue) getAllJobs(w http.ResponseWriter, r *http.Request) {
+	a.renderJobs(w, r, func(*model.JobStatus) bool { return true })
+}
+
+func (a *Almue) getShutterJobs(w http.ResponseWriter, r *http.Request) {
+	shutter, ok := r.Context().Value(shutterCtxKey).(*model.Shutter)
+	if !ok {
+		a.logger.Error.Print("Shutter from context is not a shutter?")
+		return
+	}
+	a.renderJobs(w, r, func(job *model.JobStatus) bool {
+		return job.DeviceType == "shutter" && job.DeviceID == shutter.ID
+	})
+}
+
+func (a *Almue) getLightingJobs(w http.ResponseWriter, r *http.Request) {
+	lighting, ok := r.Context().Value(lightingCtxKey).(*model.Lighting)
+	if !ok {
+		a.logger.Error.Print("Lighting from context is not a lighting?")
+		return
+	}
+	a.renderJobs(w, r, func(job *model.JobStatus) bool {
+		return job.DeviceType == "lighting" && job.DeviceID == lighting.ID
+	})
+}
+
+// renderJobs renders the scheduled jobs that match the filter
+func (a *Almue) renderJobs(w http.ResponseWriter, r *http.Request, match func(*model.JobStatus) bool) {
+	list := []render.Renderer{}
+	for _, job := range a.deviceController.Jobs() {
+		if match(job) {
+			list = append(list, &jobStatusPayload{job})
+		}
+	}
+	if err := render.RenderList(w, r, list); err != nil {
+		render.Render(w, r, ErrRender(err))
+		a.logger.Error.Print(err)
+	}
+}
@@ -0,0 +1,48 @@
+package almue
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/he4d/almue-backend/model"
+)
+
+func TestJobRoutes(t *testing.T) {
+	h := newHarness(t)
+	defer h.close()
+
+	floor := h.createFloor("ground")
+	shutter := h.createShutter(floor.ID, 17, 27)
+	lighting := h.createLighting(floor.ID, 4)
+
+	next := time.Date(2017, 10, 2, 7, 30, 0, 0, time.UTC)
+	nextOn := next.Add(10*time.Hour + 30*time.Minute)
+	h.controller.Lock()
+	h.controller.jobs = []*model.JobStatus{
+		{DeviceType: "shutter", DeviceID: shutter.ID, Job: model.JobOpen, TimeOfDay: "07:30", NextRun: &next},
+		{DeviceType: "lighting", DeviceID: lighting.ID, Job: model.JobOn, TimeOfDay: "18:00", NextRun: &nextOn,
+			LastResult: model.JobResultFailed, LastError: "relay stuck"},
+	}
+	h.controller.Unlock()
+
+	var jobs []*model.JobStatus
+	h.mustDo("GET", "/api/v1/jobs", nil, http.StatusOK, &jobs)
+	if len(jobs) != 2 || jobs[1].LastError != "relay stuck" || !jobs[0].NextRun.Equal(next) {
+		t.Errorf("Expected all jobs but got %+v", jobs)
+	}
+
+	h.mustDo("GET", fmt.Sprintf("/api/v1/shutters/%d/jobs", shutter.ID), nil, http.StatusOK, &jobs)
+	if len(jobs) != 1 || jobs[0].Job != model.JobOpen {
+		t.Errorf("Expected the jobs of the shutter but got %+v", jobs)
+	}
+	h.mustDo("GET", fmt.Sprintf("/api/v1/floors/%d/lightings/%d/jobs", floor.ID, lighting.ID), nil, http.StatusOK, &jobs)
+	if len(jobs) != 1 || jobs[0].Job != model.JobOn {
+		t.Errorf("Expected the jobs of the lighting but got %+v", jobs)
+	}
+	h.mustDo("GET", "/api/v1/shutters/99/jobs", nil, http.StatusNotFound, nil)
+
+	// the actions of a device are still routed
+	h.mustDo("POST", fmt.Sprintf("/api/v1/shutters/%d/open", shutter.ID), nil, http.StatusAccepted, nil)
+}
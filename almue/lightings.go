@@ -1,6 +1,7 @@
 package almue
 
 import (
+	"encoding/json"
 	"errors"
 	"net/http"
 
@@ -9,30 +10,28 @@ import (
 	"github.com/he4d/almue-backend/model"
 )
 
-func (a *Almue) getAllLightingsOfFloor(w http.ResponseWriter, r *http.Request) {
-	ctx := r.Context()
-	floor, ok := ctx.Value(floorCtxKey).(*model.Floor)
-	if !ok {
-		a.logger.Error.Print("Floor from context is not a floor?")
+// getAllLightings renders the page of lightings that match the query parameters.
+// The floor and room of a nested route replace the floorId and roomId filters
+func (a *Almue) getAllLightings(w http.ResponseWriter, r *http.Request) {
+	opts, err := parseListOptions(r, deviceFilters...)
+	if err != nil {
+		render.Render(w, r, ErrInvalidRequest(err))
+		a.logger.Error.Print(err)
 		return
 	}
+	scopeOptions(r, opts)
 
-	lightings, err := a.store.GetLightingListOfFloor(floor.ID)
+	lightings, err := a.store.FindLightings(pageOptions(opts))
 	if err != nil {
-		render.Render(w, r, ErrInternalServer(err))
+		render.Render(w, r, ErrList(err))
 		a.logger.Error.Print(err)
 		return
 	}
 
-	if err := render.RenderList(w, r, a.newLightingListPayloadResponse(lightings)); err != nil {
-		render.Render(w, r, ErrRender(err))
-		a.logger.Error.Print(err)
-	}
-}
-
-func (a *Almue) getAllLightings(w http.ResponseWriter, r *http.Request) {
-	lightings, err := a.store.GetLightingList()
-	if err != nil {
+	found := len(lightings)
+	start, end := pageBounds(opts, found)
+	lightings = lightings[start:end]
+	if err := setLinkHeader(w, r, opts, found, lightings); err != nil {
 		render.Render(w, r, ErrInternalServer(err))
 		a.logger.Error.Print(err)
 		return
@@ -52,6 +51,7 @@ func (a *Almue) getLighting(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	setETag(w, lighting.Version)
 	render.Render(w, r, a.newLightingPayloadResponse(lighting))
 }
 
@@ -59,87 +59,170 @@ func (a *Almue) createLighting(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	floor, hasFloorCtx := ctx.Value(floorCtxKey).(*model.Floor)
 
-	l := &lightingPayload{}
+	l := &lightingPayload{refs: a}
 	if err := render.Bind(r, l); err != nil {
-		render.Render(w, r, ErrInvalidRequest(err))
+		render.Render(w, r, ErrBind(err))
 		a.logger.Error.Print(err)
+		return
 	}
 
 	if hasFloorCtx {
 		l.FloorID = &floor.ID
 	}
 
-	var err error
-	l.ID, err = a.store.CreateLighting(l.Lighting)
+	// the lighting is only stored if it can be registered at the device controller
+	var lighting *model.Lighting
+	registered := false
+	err := a.store.WithTx(func(tx DeviceStore) error {
+		id, err := tx.CreateLighting(l.Lighting)
+		if err != nil {
+			return err
+		}
+		if lighting, err = tx.GetLighting(id); err != nil {
+			return err
+		}
+		if err := a.deviceController.RegisterLightings(lighting); err != nil {
+			return err
+		}
+		registered = !lighting.Disabled
+		return nil
+	})
 	if err != nil {
-		render.Render(w, r, ErrInternalServer(err))
+		if registered {
+			// the commit failed after the registration
+			if err := a.deviceController.UnregisterLighting(lighting.ID); err != nil {
+				a.logger.Error.Printf("Could not unregister the not created lighting %d: %v", lighting.ID, err)
+			}
+		}
+		if conflict, ok := err.(*model.PinConflictError); ok {
+			render.Render(w, r, ErrPinConflict(conflict))
+		} else {
+			render.Render(w, r, ErrInternalServer(err))
+		}
 		a.logger.Error.Print(err)
 		return
 	}
 
-	lighting, err := a.store.GetLighting(l.ID)
-	if err != nil {
-		render.Render(w, r, ErrInternalServer(err))
-		a.logger.Error.Print(err)
+	setETag(w, lighting.Version)
+	render.Status(r, http.StatusCreated)
+	render.Render(w, r, a.newLightingPayloadResponse(lighting))
+}
+
+func (a *Almue) updateLighting(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	lighting, ok := ctx.Value(lightingCtxKey).(*model.Lighting)
+	if !ok {
+		a.logger.Error.Print("Lighting from context is not a lighting?")
 		return
 	}
+	oldLighting := lighting.DeepCopy()
 
-	if err := a.deviceController.RegisterLightings(lighting); err != nil {
-		render.Render(w, r, ErrInternalServer(err))
+	l := &lightingPayload{Lighting: lighting, refs: a}
+	if err := render.Bind(r, l); err != nil {
+		render.Render(w, r, ErrBind(err))
 		a.logger.Error.Print(err)
 		return
 	}
 
-	render.Status(r, http.StatusCreated)
-	render.Render(w, r, a.newLightingPayloadResponse(lighting))
+	a.saveLighting(w, r, oldLighting, l)
 }
 
-func (a *Almue) updateLighting(w http.ResponseWriter, r *http.Request) {
+func (a *Almue) patchLighting(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	lighting, ok := ctx.Value(lightingCtxKey).(*model.Lighting)
 	if !ok {
 		a.logger.Error.Print("Lighting from context is not a lighting?")
 		return
 	}
-	oldLighting := lighting.DeepCopy()
 
-	l := &lightingPayload{Lighting: lighting}
-	if err := render.Bind(r, l); err != nil {
+	if err := checkPatchContentType(r); err != nil {
+		render.Render(w, r, ErrUnsupportedMediaType(err))
+		a.logger.Error.Print(err)
+		return
+	}
+
+	patched, err := readMergePatch(r, lighting)
+	if err != nil {
 		render.Render(w, r, ErrInvalidRequest(err))
 		a.logger.Error.Print(err)
 		return
 	}
 
-	if l.Lighting.ID != oldLighting.ID {
-		err := errors.New("Can not update the lighting to a different id")
+	l := &lightingPayload{refs: a}
+	if err := json.Unmarshal(patched, l); err != nil {
 		render.Render(w, r, ErrInvalidRequest(err))
 		a.logger.Error.Print(err)
 		return
 	}
+	if err := l.Bind(r); err != nil {
+		render.Render(w, r, ErrBind(err))
+		a.logger.Error.Print(err)
+		return
+	}
 
-	if err := a.store.UpdateLighting(l.Lighting); err != nil {
-		render.Render(w, r, ErrInternalServer(err))
+	a.saveLighting(w, r, lighting, l)
+}
+
+// saveLighting stores the bound payload as the new state of the old lighting
+func (a *Almue) saveLighting(w http.ResponseWriter, r *http.Request, oldLighting *model.Lighting, l *lightingPayload) {
+	if l.Lighting.ID != oldLighting.ID {
+		err := errors.New("Can not update the lighting to a different id")
+		render.Render(w, r, ErrInvalidRequest(err))
 		a.logger.Error.Print(err)
 		return
 	}
 
-	updatedLighting, err := a.store.GetLighting(l.Lighting.ID)
+	// the If-Match header was checked against the version of the old lighting
+	l.Version = oldLighting.Version
+	var updatedLighting *model.Lighting
+	err := a.store.WithTx(func(tx DeviceStore) error {
+		if err := tx.UpdateLighting(l.Lighting); err != nil {
+			return err
+		}
+		var err error
+		updatedLighting, err = tx.GetLighting(l.Lighting.ID)
+		return err
+	})
 	if err != nil {
-		render.Render(w, r, ErrInternalServer(err))
+		if conflict, ok := err.(*model.PinConflictError); ok {
+			render.Render(w, r, ErrPinConflict(conflict))
+		} else if err == model.ErrVersionConflict {
+			render.Render(w, r, ErrPreconditionFailed(err))
+		} else {
+			render.Render(w, r, ErrInternalServer(err))
+		}
 		a.logger.Error.Print(err)
 		return
 	}
 
+	// the device controller writes the state of the lighting to the store,
+	// so it is updated after the commit and a failure is rolled back by restoring the old lighting
 	diffs := oldLighting.GetDifferences(updatedLighting)
 	if err := a.deviceController.UpdateLighting(diffs, updatedLighting); err != nil {
+		a.restoreLighting(oldLighting, updatedLighting)
 		render.Render(w, r, ErrInternalServer(err))
 		a.logger.Error.Print(err)
 		return
 	}
 
+	setETag(w, updatedLighting.Version)
 	render.Render(w, r, a.newLightingPayloadResponse(updatedLighting))
 }
 
+// restoreLighting stores the old lighting again after the device controller could not apply the update,
+// so the store and the device controller do not disagree about the lighting
+func (a *Almue) restoreLighting(oldLighting, updatedLighting *model.Lighting) {
+	restored := oldLighting.DeepCopy()
+	restored.Version = updatedLighting.Version
+	if err := a.store.UpdateLighting(restored); err != nil {
+		a.logger.Error.Printf("Could not restore lighting %d: %v", restored.ID, err)
+		return
+	}
+	if err := a.deviceController.UpdateLighting(updatedLighting.GetDifferences(restored), restored); err != nil {
+		a.logger.Error.Printf("Could not restore lighting %d at the device controller: %v", restored.ID, err)
+	}
+}
+
 func (a *Almue) deleteLighting(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	lighting, ok := ctx.Value(lightingCtxKey).(*model.Lighting)
@@ -148,13 +231,20 @@ func (a *Almue) deleteLighting(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := a.store.DeleteLighting(lighting.ID); err != nil {
-		render.Render(w, r, ErrInternalServer(err))
-		a.logger.Error.Print(err)
-		return
+	// disabled devices are not registered
+	if !lighting.Disabled {
+		if err := a.deviceController.UnregisterLighting(lighting.ID); err != nil {
+			render.Render(w, r, ErrInternalServer(err))
+			a.logger.Error.Print(err)
+			return
+		}
 	}
 
-	if err := a.deviceController.UnregisterLighting(lighting.ID); err != nil {
+	if err := a.store.DeleteLighting(lighting.ID); err != nil {
+		// the lighting still exists so it has to keep working
+		if err := a.deviceController.RegisterLightings(lighting); err != nil {
+			a.logger.Error.Printf("Could not register the not deleted lighting %d again: %v", lighting.ID, err)
+		}
 		render.Render(w, r, ErrInternalServer(err))
 		a.logger.Error.Print(err)
 		return
@@ -180,25 +270,11 @@ func (a *Almue) controlLighting(w http.ResponseWriter, r *http.Request) {
 
 	action := chi.URLParam(r, "action")
 	switch action {
-	case "on":
-		if err := a.deviceController.TurnLightingOn(lighting.ID); err != nil {
-			render.Render(w, r, ErrInternalServer(err))
-			a.logger.Error.Print(err)
-			return
-		}
-		break
-	case "off":
-		if err := a.deviceController.TurnLightingOff(lighting.ID); err != nil {
-			render.Render(w, r, ErrInternalServer(err))
-			a.logger.Error.Print(err)
-			return
-		}
-		break
+	case "on", "off", "reset":
+		a.submitCommand(w, r, model.DeviceTypeLighting, lighting.ID, action)
 	default:
 		err := errors.New("Action not supported")
 		render.Render(w, r, ErrInvalidRequest(err))
 		a.logger.Info.Print(err)
-		return
 	}
-	render.NoContent(w, r)
 }
@@ -0,0 +1,117 @@
+package almue
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/he4d/almue-backend/model"
+)
+
+func TestLightingRoutes(t *testing.T) {
+	h := newHarness(t)
+	defer h.close()
+
+	floor := h.createFloor("erdgeschoss")
+	lighting := h.createLighting(floor.ID, 4)
+	shutter := h.createShutter(floor.ID, 17, 27)
+	lightingPath := fmt.Sprintf("/api/v1/lightings/%d", lighting.ID)
+	nestedPath := fmt.Sprintf("/api/v1/floors/%d/lightings/%d", floor.ID, lighting.ID)
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   interface{}
+		status int
+		calls  []string
+	}{
+		{"list", "GET", "/api/v1/lightings", nil, http.StatusOK, nil},
+		{"get", "GET", lightingPath, nil, http.StatusOK, nil},
+		{"get unknown", "GET", "/api/v1/lightings/999", nil, http.StatusNotFound, nil},
+		{"create invalid json", "POST", "/api/v1/lightings", "{", http.StatusBadRequest, nil},
+		{"create with used pin", "POST", "/api/v1/lightings", lightingBody(floor.ID, 4), http.StatusConflict, nil},
+		{"create with shutter pin", "POST", "/api/v1/lightings", lightingBody(floor.ID, *shutter.OpenPin), http.StatusConflict, nil},
+		{"create with unknown pin", "POST", "/api/v1/lightings", lightingBody(floor.ID, 99), http.StatusUnprocessableEntity, nil},
+		{"update", "PUT", lightingPath, map[string]interface{}{"jobsEnabled": true}, http.StatusOK,
+			[]string{fmt.Sprintf("UpdateLighting(%d)", lighting.ID)}},
+		{"update other id", "PUT", lightingPath, map[string]interface{}{"id": lighting.ID + 1}, http.StatusBadRequest, nil},
+		{"update with used pin", "PUT", lightingPath, map[string]interface{}{"switchPin": *shutter.ClosePin}, http.StatusConflict, nil},
+		{"on", "POST", lightingPath + "/on", nil, http.StatusAccepted, []string{fmt.Sprintf("TurnLightingOn(%d)", lighting.ID)}},
+		{"off", "POST", lightingPath + "/off", nil, http.StatusAccepted, []string{fmt.Sprintf("TurnLightingOff(%d)", lighting.ID)}},
+		{"unknown action", "POST", lightingPath + "/dim", nil, http.StatusBadRequest, nil},
+		{"nested list", "GET", fmt.Sprintf("/api/v1/floors/%d/lightings", floor.ID), nil, http.StatusOK, nil},
+		{"nested get", "GET", nestedPath, nil, http.StatusOK, nil},
+		{"nested on", "POST", nestedPath + "/on", nil, http.StatusAccepted, []string{fmt.Sprintf("TurnLightingOn(%d)", lighting.ID)}},
+		{"nested unknown floor", "GET", "/api/v1/floors/999/lightings", nil, http.StatusNotFound, nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			h.controller.reset()
+			rec := h.do(test.method, test.path, test.body)
+			if rec.Code != test.status {
+				t.Errorf("%s %s: expected status %d but got %d: %s", test.method, test.path, test.status, rec.Code, rec.Body.String())
+			}
+			if calls := h.controller.reset(); !reflect.DeepEqual(calls, test.calls) {
+				t.Errorf("%s %s: expected the controller calls %v but got %v", test.method, test.path, test.calls, calls)
+			}
+		})
+	}
+}
+
+func TestCreateLightingOnFloor(t *testing.T) {
+	h := newHarness(t)
+	defer h.close()
+
+	floor := h.createFloor("erdgeschoss")
+
+	lighting := &model.Lighting{}
+	h.mustDo("POST", fmt.Sprintf("/api/v1/floors/%d/lightings", floor.ID), lightingBody(0, 4), http.StatusCreated, lighting)
+	if *lighting.FloorID != floor.ID {
+		t.Errorf("Expected the lighting on floor %d of the route but it is on %d", floor.ID, *lighting.FloorID)
+	}
+	if lighting.DeviceStatus != "off" {
+		t.Errorf("Expected a new lighting to be off but it is %s", lighting.DeviceStatus)
+	}
+}
+
+func TestDeleteLighting(t *testing.T) {
+	h := newHarness(t)
+	defer h.close()
+
+	floor := h.createFloor("erdgeschoss")
+	lighting := h.createLighting(floor.ID, 4)
+	path := fmt.Sprintf("/api/v1/lightings/%d", lighting.ID)
+	h.controller.reset()
+
+	h.mustDo("DELETE", path, nil, http.StatusNoContent, nil)
+	if calls := h.controller.reset(); !reflect.DeepEqual(calls, []string{fmt.Sprintf("UnregisterLighting(%d)", lighting.ID)}) {
+		t.Errorf("Expected the lighting to be unregistered but got %v", calls)
+	}
+	h.mustDo("GET", path, nil, http.StatusNotFound, nil)
+}
+
+func TestLightingFault(t *testing.T) {
+	h := newHarness(t)
+	defer h.close()
+
+	floor := h.createFloor("erdgeschoss")
+	lighting := h.createLighting(floor.ID, 4)
+	path := fmt.Sprintf("/api/v1/lightings/%d", lighting.ID)
+	fault := &model.DeviceFault{Message: "The on job failed: relay stuck", Time: time.Date(2017, 10, 2, 18, 0, 0, 0, time.UTC)}
+	if err := h.store.UpdateLightingFault(lighting.ID, fault); err != nil {
+		t.Fatal(err)
+	}
+
+	// only a reset clears the fault, an update can not change the state
+	for _, method := range []string{"PUT", "PATCH"} {
+		got := &model.Lighting{}
+		h.mustDo(method, path, map[string]interface{}{"fault": nil, "deviceStatus": "on"}, http.StatusOK, got)
+		if got.DeviceStatus != model.DeviceStatusFault || got.Fault == nil || got.Fault.Message != fault.Message {
+			t.Errorf("%s: expected the fault of the lighting but got %+v", method, got)
+		}
+	}
+}
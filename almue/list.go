@@ -0,0 +1,228 @@
+package almue
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/render"
+	"github.com/he4d/almue-backend/model"
+)
+
+const maxListLimit = 100
+
+// The filters that can be passed as query parameters to a list endpoint
+const (
+	filterFloorID      = "floorId"
+	filterRoomID       = "roomId"
+	filterDisabled     = "disabled"
+	filterDeviceStatus = "deviceStatus"
+	filterJobsEnabled  = "jobsEnabled"
+	filterTag          = "tag"
+)
+
+var deviceFilters = []string{filterFloorID, filterRoomID, filterDisabled, filterDeviceStatus, filterJobsEnabled, filterTag}
+
+var errInvalidCursor = errors.New("The cursor is invalid, use the links of a previous response")
+
+// listCursor is the position of a page in a list, the sort value and id of the model before the page,
+// or after it for a backward cursor. Clients get it as an opaque token in the links of a list response.
+// The cursor is only valid for the sort it was created for
+type listCursor struct {
+	Sort     string          `json:"s,omitempty"`
+	Value    json.RawMessage `json:"v"`
+	ID       int64           `json:"id"`
+	Backward bool            `json:"b,omitempty"`
+}
+
+func encodeCursor(c *listCursor) string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(cursor, sort string) (*model.ListCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, errInvalidCursor
+	}
+	c := &listCursor{}
+	if err := json.Unmarshal(data, c); err != nil || c.Sort != sort || len(c.Value) == 0 {
+		return nil, errInvalidCursor
+	}
+	return &model.ListCursor{Value: c.Value, ID: c.ID, Backward: c.Backward}, nil
+}
+
+// cursorOf returns the cursor of a model for the sort of the list options, the sort value
+// is taken from the json of the model, so it has the same format as in the responses
+func cursorOf(m interface{}, opts *model.ListOptions, sort string, backward bool) (*listCursor, error) {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	fields := map[string]json.RawMessage{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	field := opts.Sort
+	if field == "" {
+		field = "id"
+	}
+	c := &listCursor{Sort: sort, Value: fields[field], Backward: backward}
+	if err := json.Unmarshal(fields["id"], &c.ID); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// parseListOptions reads the list options from the query parameters of the request:
+// limit, cursor, sort (a field name, prefixed with - for a descending order), q to search
+// the description and the given filters. Other query parameters are ignored
+func parseListOptions(r *http.Request, filters ...string) (*model.ListOptions, error) {
+	query := r.URL.Query()
+	opts := &model.ListOptions{}
+
+	if limit := query.Get("limit"); limit != "" {
+		l, err := strconv.Atoi(limit)
+		if err != nil || l < 1 || l > maxListLimit {
+			return nil, fmt.Errorf("The limit must be a number between 1 and %d", maxListLimit)
+		}
+		opts.Limit = l
+	}
+	if sort := query.Get("sort"); sort != "" {
+		opts.Descending = strings.HasPrefix(sort, "-")
+		opts.Sort = strings.TrimPrefix(sort, "-")
+	}
+	if cursor := query.Get("cursor"); cursor != "" {
+		c, err := decodeCursor(cursor, query.Get("sort"))
+		if err != nil {
+			return nil, err
+		}
+		opts.Cursor = c
+	}
+	opts.Search = query.Get("q")
+
+	for _, filter := range filters {
+		value := query.Get(filter)
+		if value == "" {
+			continue
+		}
+		switch filter {
+		case filterFloorID, filterRoomID:
+			id, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("The filter %s must be a number", filter)
+			}
+			if filter == filterFloorID {
+				opts.FloorID = &id
+			} else {
+				opts.RoomID = &id
+			}
+		case filterDisabled, filterJobsEnabled:
+			b, err := strconv.ParseBool(value)
+			if err != nil {
+				return nil, fmt.Errorf("The filter %s must be true or false", filter)
+			}
+			if filter == filterDisabled {
+				opts.Disabled = &b
+			} else {
+				opts.JobsEnabled = &b
+			}
+		case filterDeviceStatus:
+			opts.DeviceStatus = &value
+		case filterTag:
+			opts.Tag = value
+		}
+	}
+	return opts, nil
+}
+
+// scopeOptions restricts the list options to the floor and room of a nested route
+func scopeOptions(r *http.Request, opts *model.ListOptions) {
+	if floorID, ok := floorFromContext(r); ok {
+		opts.FloorID = floorID
+	}
+	if roomID, ok := roomFromContext(r); ok {
+		opts.RoomID = roomID
+	}
+}
+
+// pageOptions returns the options to query one more model than the limit,
+// which tells if there is a next page, or a prev page for a backward cursor
+func pageOptions(opts *model.ListOptions) *model.ListOptions {
+	page := *opts
+	if page.Limit > 0 {
+		page.Limit++
+	}
+	return &page
+}
+
+// pageBounds returns the bounds of the page in the found models of the options of pageOptions,
+// the extra model of a backward cursor is before the page and after it otherwise
+func pageBounds(opts *model.ListOptions, found int) (int, int) {
+	if opts.Limit == 0 || found <= opts.Limit {
+		return 0, found
+	}
+	if opts.Cursor != nil && opts.Cursor.Backward {
+		return found - opts.Limit, found
+	}
+	return 0, opts.Limit
+}
+
+// setLinkHeader sets the Link header with the first, prev and next pages of a paged list.
+// found is the number of models that were returned for the options of pageOptions and page is
+// the slice of the models of the page, the cursors of the links are taken from its first and last model
+func setLinkHeader(w http.ResponseWriter, r *http.Request, opts *model.ListOptions, found int, page interface{}) error {
+	if opts.Limit == 0 {
+		return nil
+	}
+	link := func(c *listCursor, rel string) string {
+		u := url.URL{Path: r.URL.Path}
+		query := r.URL.Query()
+		if c != nil {
+			query.Set("cursor", encodeCursor(c))
+		} else {
+			query.Del("cursor")
+		}
+		u.RawQuery = query.Encode()
+		return fmt.Sprintf("<%s>; rel=\"%s\"", u.String(), rel)
+	}
+
+	links := []string{link(nil, "first")}
+	models := reflect.ValueOf(page)
+	if models.Len() > 0 {
+		sort := r.URL.Query().Get("sort")
+		backward := opts.Cursor != nil && opts.Cursor.Backward
+		more := found > opts.Limit
+		if (!backward && opts.Cursor != nil) || (backward && more) {
+			prev, err := cursorOf(models.Index(0).Interface(), opts, sort, true)
+			if err != nil {
+				return err
+			}
+			links = append(links, link(prev, "prev"))
+		}
+		if (!backward && more) || backward {
+			next, err := cursorOf(models.Index(models.Len()-1).Interface(), opts, sort, false)
+			if err != nil {
+				return err
+			}
+			links = append(links, link(next, "next"))
+		}
+	}
+	w.Header().Set("Link", strings.Join(links, ", "))
+	return nil
+}
+
+// ErrList returns the renderer for an error of a list query of the store.
+// Invalid list options result in a 400 response, everything else in a 500 response
+func ErrList(err error) render.Renderer {
+	if _, ok := err.(*model.ListOptionsError); ok {
+		return ErrInvalidRequest(err)
+	}
+	return ErrInternalServer(err)
+}
@@ -0,0 +1,191 @@
+package almue
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"testing"
+
+	"github.com/he4d/almue-backend/model"
+)
+
+var linkPattern = regexp.MustCompile(`<([^>]*)>; rel="([a-z]+)"`)
+
+// links returns the urls of the Link header by their relation
+func links(header http.Header) map[string]string {
+	result := map[string]string{}
+	for _, match := range linkPattern.FindAllStringSubmatch(header.Get("Link"), -1) {
+		result[match[2]] = match[1]
+	}
+	return result
+}
+
+func TestListPaging(t *testing.T) {
+	h := newHarness(t)
+	defer h.close()
+
+	floor := h.createFloor("erdgeschoss")
+	created := []int64{}
+	for _, pin := range []int{4, 5, 6, 12, 13} {
+		created = append(created, h.createLighting(floor.ID, pin).ID)
+	}
+
+	rec := h.do("GET", "/api/v1/lightings", nil)
+	if rec.Header().Get("Link") != "" {
+		t.Errorf("Expected no Link header without a limit but got %s", rec.Header().Get("Link"))
+	}
+
+	descending := []int64{}
+	for i := range created {
+		descending = append(descending, created[len(created)-1-i])
+	}
+	// the lightings are created in the same second, so the id orders them by their creation
+	for sort, want := range map[string][]int64{"-id": descending, "created": created, "-created": descending} {
+		t.Run(sort, func(t *testing.T) {
+			first := "/api/v1/lightings?limit=2&sort=" + sort
+			pages, lastLinks := walkPages(t, h, first, "next")
+			if fmt.Sprint(flatten(pages)) != fmt.Sprint(want) {
+				t.Fatalf("Expected the lightings %v but got the pages %v", want, pages)
+			}
+
+			// the prev links lead back over the same pages
+			back, _ := walkPages(t, h, lastLinks["prev"], "prev")
+			for i := range back {
+				if fmt.Sprint(back[i]) != fmt.Sprint(pages[len(pages)-2-i]) {
+					t.Fatalf("Expected the prev links to return the pages %v but got %v", pages, back)
+				}
+			}
+			if len(back) != len(pages)-1 {
+				t.Fatalf("Expected %d prev pages but got %v", len(pages)-1, back)
+			}
+		})
+	}
+}
+
+// walkPages follows the links with the relation rel from the path and returns the ids of the pages
+// and the links of the last page
+func walkPages(t *testing.T, h *harness, path, rel string) ([][]int64, map[string]string) {
+	pages := [][]int64{}
+	pageLinks := map[string]string{}
+	for path != "" {
+		if len(pages) > 10 {
+			t.Fatalf("The %s links do not end: %s", rel, path)
+		}
+		lightings := []*model.Lighting{}
+		rec := h.do("GET", path, nil)
+		if err := json.Unmarshal(rec.Body.Bytes(), &lightings); err != nil {
+			t.Fatalf("GET %s: could not decode the response %q: %v", path, rec.Body.String(), err)
+		}
+		if len(lightings) == 0 || len(lightings) > 2 {
+			t.Fatalf("Expected 1 or 2 lightings on the page %s but got %d", path, len(lightings))
+		}
+		page := []int64{}
+		for _, l := range lightings {
+			page = append(page, l.ID)
+		}
+		pages = append(pages, page)
+
+		pageLinks = links(rec.Header())
+		if u, err := url.Parse(pageLinks["first"]); err != nil || u.Query().Get("cursor") != "" || u.Query().Get("limit") != "2" {
+			t.Errorf("Expected the first link to the first page but got %q", pageLinks["first"])
+		}
+		if _, ok := pageLinks["prev"]; rel == "next" && ok == (len(pages) == 1) {
+			t.Errorf("Expected a prev link on all but the first page: %v", pageLinks)
+		}
+		path = pageLinks[rel]
+	}
+	return pages, pageLinks
+}
+
+func flatten(pages [][]int64) []int64 {
+	ids := []int64{}
+	for _, page := range pages {
+		ids = append(ids, page...)
+	}
+	return ids
+}
+
+func TestListFilters(t *testing.T) {
+	h := newHarness(t)
+	defer h.close()
+
+	groundFloor := h.createFloor("erdgeschoss")
+	upperFloor := h.createFloor("obergeschoss")
+	kitchen := h.createShutter(groundFloor.ID, 17, 27)
+	bath := h.createShutter(upperFloor.ID, 5, 6)
+	h.mustDo("PATCH", fmt.Sprintf("/api/v1/shutters/%d", bath.ID), map[string]interface{}{"disabled": true}, http.StatusOK, nil)
+
+	tests := []struct {
+		name string
+		path string
+		want []int64
+	}{
+		{"floor", fmt.Sprintf("/api/v1/shutters?floorId=%d", upperFloor.ID), []int64{bath.ID}},
+		{"disabled", "/api/v1/shutters?disabled=false", []int64{kitchen.ID}},
+		{"device status", "/api/v1/shutters?deviceStatus=stopped", []int64{kitchen.ID, bath.ID}},
+		{"search", "/api/v1/shutters?q=17", []int64{kitchen.ID}},
+		{"nested floor wins", fmt.Sprintf("/api/v1/floors/%d/shutters?floorId=%d", groundFloor.ID, upperFloor.ID), []int64{kitchen.ID}},
+		{"jobs enabled", "/api/v1/shutters?jobsEnabled=true", []int64{}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			shutters := []*model.Shutter{}
+			h.mustDo("GET", test.path, nil, http.StatusOK, &shutters)
+			got := []int64{}
+			for _, s := range shutters {
+				got = append(got, s.ID)
+			}
+			if fmt.Sprint(got) != fmt.Sprint(test.want) {
+				t.Errorf("Expected the shutters %v but got %v", test.want, got)
+			}
+		})
+	}
+}
+
+func TestListInvalidOptions(t *testing.T) {
+	h := newHarness(t)
+	defer h.close()
+
+	for _, path := range []string{
+		"/api/v1/floors?limit=0",
+		"/api/v1/floors?limit=101",
+		"/api/v1/floors?limit=abc",
+		"/api/v1/floors?cursor=abc",
+		// a cursor is only valid for the sort of its list
+		"/api/v1/floors?sort=description&cursor=" + encodeCursor(&listCursor{Value: []byte("1"), ID: 1}),
+		"/api/v1/floors?sort=created&cursor=" + encodeCursor(&listCursor{Sort: "created", Value: []byte(`"today"`), ID: 1}),
+		"/api/v1/floors?sort=openPin",
+		"/api/v1/shutters?sort=-switchPin",
+		"/api/v1/shutters?floorId=abc",
+		"/api/v1/lightings?disabled=maybe",
+	} {
+		if rec := h.do("GET", path, nil); rec.Code != http.StatusBadRequest {
+			t.Errorf("GET %s: expected status %d but got %d: %s", path, http.StatusBadRequest, rec.Code, rec.Body.String())
+		}
+	}
+}
+
+func TestFloorListGroupsDevices(t *testing.T) {
+	h := newHarness(t)
+	defer h.close()
+
+	groundFloor := h.createFloor("erdgeschoss")
+	upperFloor := h.createFloor("obergeschoss")
+	h.createFloor("dachboden")
+	shutter := h.createShutter(groundFloor.ID, 17, 27)
+	lighting := h.createLighting(upperFloor.ID, 4)
+
+	floors := []*floorPayload{}
+	h.mustDo("GET", "/api/v1/floors?sort=-description&limit=2", nil, http.StatusOK, &floors)
+	if len(floors) != 2 || floors[0].ID != upperFloor.ID || floors[1].ID != groundFloor.ID {
+		t.Fatalf("Expected the first two floors sorted by description descending but got %v", floors)
+	}
+	if len(floors[0].Lightings) != 1 || floors[0].Lightings[0].ID != lighting.ID || len(floors[0].Shutters) != 0 {
+		t.Errorf("Expected only the lighting on the upper floor but got %v and %v", floors[0].Shutters, floors[0].Lightings)
+	}
+	if len(floors[1].Shutters) != 1 || floors[1].Shutters[0].ID != shutter.ID || len(floors[1].Lightings) != 0 {
+		t.Errorf("Expected only the shutter on the ground floor but got %v and %v", floors[1].Shutters, floors[1].Lightings)
+	}
+}
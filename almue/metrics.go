@@ -0,0 +1,53 @@
+package almue
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/go-chi/chi/middleware"
+	"github.com/he4d/almue-backend/metrics"
+)
+
+var (
+	httpRequests = metrics.Default.NewCounter("almue_http_requests_total",
+		"Number of handled HTTP requests by method, chi route pattern and status code.", "method", "route", "code")
+	httpRequestDuration = metrics.Default.NewHistogram("almue_http_request_duration_seconds",
+		"Latency of the HTTP requests by method and chi route pattern.", metrics.DefaultBuckets, "method", "route")
+)
+
+// unmatchedRoute is the route label of requests that did not match a route,
+// so unknown paths can not blow up the number of series
+const unmatchedRoute = "unmatched"
+
+// instrument counts the requests and observes their latency per route pattern of chi.
+// The pattern is only complete after the subrouters have routed the request
+func instrument(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		start := time.Now()
+		next.ServeHTTP(ww, r)
+		duration := time.Since(start).Seconds()
+
+		route, status := routePattern(r), responseStatus(ww)
+		httpRequests.Inc(r.Method, route, strconv.Itoa(status))
+		httpRequestDuration.Observe(duration, r.Method, route)
+	})
+}
+
+// routePattern returns the chi route pattern of the request, it is only complete after the request was routed
+func routePattern(r *http.Request) string {
+	if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+		return rctx.RoutePattern()
+	}
+	return unmatchedRoute
+}
+
+// responseStatus returns the status code that was written, a handler that only writes a body answers with 200
+func responseStatus(ww middleware.WrapResponseWriter) int {
+	if ww.Status() == 0 {
+		return http.StatusOK
+	}
+	return ww.Status()
+}
@@ -0,0 +1,43 @@
+package almue
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestRequestMetrics(t *testing.T) {
+	h := newHarness(t)
+	defer h.close()
+
+	const floorRoute = "/api/v1/floors/{floorID:[0-9]+$}/"
+	const floorCtxRoute = "/api/v1/floors/{floorID:[0-9]+$}"
+	found := httpRequests.Value("GET", floorRoute, "200")
+	// the floor context answers before the subrouter of the floor matched its route
+	missing := httpRequests.Value("GET", floorCtxRoute, "404")
+
+	floor := h.createFloor("erdgeschoss")
+	h.mustDo("GET", fmt.Sprintf("/api/v1/floors/%d", floor.ID), nil, http.StatusOK, nil)
+	h.mustDo("GET", fmt.Sprintf("/api/v1/floors/%d", floor.ID+1), nil, http.StatusNotFound, nil)
+	if delta := httpRequests.Value("GET", floorRoute, "200") - found; delta != 1 {
+		t.Errorf("Expected one found floor but got %v", delta)
+	}
+	if delta := httpRequests.Value("GET", floorCtxRoute, "404") - missing; delta != 1 {
+		t.Errorf("Expected one missing floor but got %v", delta)
+	}
+
+	rec := h.do("GET", "/metrics", nil)
+	if rec.Code != http.StatusOK || !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/plain") {
+		t.Fatalf("Expected the metrics in the text format but got %d %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	for _, expected := range []string{
+		`almue_http_requests_total{method="POST",route="/api/v1/floors/",code="201"}`,
+		`almue_http_request_duration_seconds_count{method="GET",route="` + floorRoute + `"}`,
+		`almue_store_query_duration_seconds_count{operation="insert",table="floors"}`,
+	} {
+		if !strings.Contains(rec.Body.String(), expected) {
+			t.Errorf("Expected the metrics to contain %s but got\n%s", expected, rec.Body.String())
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package almue
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"net/http"
+)
+
+const (
+	contentTypeMergePatch = "application/merge-patch+json"
+	contentTypeJSONPatch  = "application/json-patch+json"
+)
+
+var errJSONPatchUnsupported = errors.New("JSON Patch (RFC 6902) is not supported, use a JSON Merge Patch (RFC 7396) with the content type " + contentTypeMergePatch)
+
+// checkPatchContentType checks that the request body is a JSON Merge Patch (RFC 7396).
+// Besides application/merge-patch+json the content type application/json is accepted as well
+func checkPatchContentType(r *http.Request) error {
+	contentType := r.Header.Get("Content-Type")
+	if contentType == "" {
+		return nil
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return err
+	}
+	switch mediaType {
+	case contentTypeMergePatch, "application/json":
+		return nil
+	case contentTypeJSONPatch:
+		return errJSONPatchUnsupported
+	default:
+		return fmt.Errorf("Unsupported content type %s for a merge patch", mediaType)
+	}
+}
+
+// readMergePatch applies the JSON Merge Patch of the request body to the json representation
+// of the current model and returns the json of the patched model
+func readMergePatch(r *http.Request, current interface{}) ([]byte, error) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+	var patch interface{}
+	if err := json.Unmarshal(body, &patch); err != nil {
+		return nil, err
+	}
+	if _, ok := patch.(map[string]interface{}); !ok {
+		return nil, errors.New("The merge patch must be a json object")
+	}
+
+	currentJSON, err := json.Marshal(current)
+	if err != nil {
+		return nil, err
+	}
+	var target interface{}
+	if err := json.Unmarshal(currentJSON, &target); err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(mergePatch(target, patch))
+}
+
+// mergePatch merges the patch into the target as described in RFC 7396.
+// Members of the patch with a null value are removed from the target
+func mergePatch(target, patch interface{}) interface{} {
+	patchObject, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	targetObject, ok := target.(map[string]interface{})
+	if !ok {
+		targetObject = map[string]interface{}{}
+	}
+	for name, value := range patchObject {
+		if value == nil {
+			delete(targetObject, name)
+			continue
+		}
+		targetObject[name] = mergePatch(targetObject[name], value)
+	}
+	return targetObject
+}
@@ -0,0 +1,140 @@
+package almue
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/he4d/almue-backend/model"
+)
+
+func TestMergePatch(t *testing.T) {
+	// the examples of RFC 7396 appendix A
+	tests := []struct {
+		target string
+		patch  string
+		result string
+	}{
+		{`{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+		{`{"a":"b"}`, `{"a":null}`, `{}`},
+		{`{"a":"b","b":"c"}`, `{"a":null}`, `{"b":"c"}`},
+		{`{"a":["b"]}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"c"}`, `{"a":["b"]}`, `{"a":["b"]}`},
+		{`{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`},
+		{`{"a":[{"b":"c"}]}`, `{"a":[1]}`, `{"a":[1]}`},
+		{`["a","b"]`, `["c","d"]`, `["c","d"]`},
+		{`{"a":"b"}`, `["c"]`, `["c"]`},
+		{`{"a":"foo"}`, `null`, `null`},
+		{`{"a":"foo"}`, `"bar"`, `"bar"`},
+		{`{"e":null}`, `{"a":1}`, `{"a":1,"e":null}`},
+		{`[1,2]`, `{"a":"b","c":null}`, `{"a":"b"}`},
+		{`{}`, `{"a":{"bb":{"ccc":null}}}`, `{"a":{"bb":{}}}`},
+	}
+
+	for _, test := range tests {
+		var target, patch, expected interface{}
+		for _, doc := range []struct {
+			data string
+			v    *interface{}
+		}{{test.target, &target}, {test.patch, &patch}, {test.result, &expected}} {
+			if err := json.Unmarshal([]byte(doc.data), doc.v); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if result := mergePatch(target, patch); !reflect.DeepEqual(result, expected) {
+			t.Errorf("Merging %s into %s: expected %v but got %v", test.patch, test.target, expected, result)
+		}
+	}
+}
+
+func TestPatchRoutes(t *testing.T) {
+	h := newHarness(t)
+	defer h.close()
+
+	floor := h.createFloor("erdgeschoss")
+	shutter := h.createShutter(floor.ID, 17, 27)
+	lighting := h.createLighting(floor.ID, 4)
+	shutterPath := fmt.Sprintf("/api/v1/shutters/%d", shutter.ID)
+	lightingPath := fmt.Sprintf("/api/v1/floors/%d/lightings/%d", floor.ID, lighting.ID)
+
+	tests := []struct {
+		name   string
+		path   string
+		patch  interface{}
+		status int
+		diffs  model.DifferenceType
+	}{
+		{"shutter way", shutterPath, map[string]interface{}{"completeWayInSeconds": 30}, http.StatusOK,
+			model.DIFFNONE | model.DIFFCOMPLETEWAYINSECONDS},
+		{"shutter pins", shutterPath, map[string]interface{}{"openPin": 22, "closePin": 23}, http.StatusOK,
+			model.DIFFNONE | model.DIFFOPENPIN | model.DIFFCLOSEPIN},
+		{"shutter description only", shutterPath, map[string]interface{}{"description": "kueche"}, http.StatusOK, model.DIFFNONE},
+		{"shutter clear pin", shutterPath, map[string]interface{}{"closePin": nil}, http.StatusUnprocessableEntity, 0},
+		{"shutter other id", shutterPath, map[string]interface{}{"id": shutter.ID + 1}, http.StatusBadRequest, 0},
+		{"shutter no object", shutterPath, []int{1}, http.StatusBadRequest, 0},
+		{"lighting jobs", lightingPath, map[string]interface{}{"jobsEnabled": true}, http.StatusOK,
+			model.DIFFNONE | model.DIFFJOBSENABLED},
+		{"lighting off time", lightingPath, map[string]interface{}{"offTime": "0000-01-01T23:30:00Z"}, http.StatusOK,
+			model.DIFFNONE | model.DIFFOFFTIME},
+		{"lighting switch pin", lightingPath, map[string]interface{}{"switchPin": 5}, http.StatusOK,
+			model.DIFFNONE | model.DIFFSWITCHPIN},
+		{"lighting invalid time", lightingPath, map[string]interface{}{"onTime": "18 Uhr"}, http.StatusUnprocessableEntity, 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			h.controller.recordDiffs(0)
+			h.mustDo("PATCH", test.path, test.patch, test.status, nil)
+			if diffs := h.controller.diffs(); diffs != test.diffs {
+				t.Errorf("Expected the differences %b but got %b", test.diffs, diffs)
+			}
+		})
+	}
+
+	patched := &model.Shutter{}
+	h.mustDo("GET", shutterPath, nil, http.StatusOK, patched)
+	if *patched.Description != "kueche" || *patched.CompleteWayInSeconds != 30 || *patched.OpenPin != 22 {
+		t.Errorf("Expected all patches to be applied but got %+v", patched)
+	}
+
+	patchedFloor := &model.Floor{}
+	h.mustDo("PATCH", fmt.Sprintf("/api/v1/floors/%d", floor.ID), map[string]interface{}{"description": "keller"}, http.StatusOK, patchedFloor)
+	if *patchedFloor.Description != "keller" {
+		t.Errorf("Expected the patched floor description but got %s", *patchedFloor.Description)
+	}
+}
+
+func TestPatchContentTypes(t *testing.T) {
+	h := newHarness(t)
+	defer h.close()
+
+	floor := h.createFloor("erdgeschoss")
+	path := fmt.Sprintf("/api/v1/floors/%d", floor.ID)
+
+	tests := []struct {
+		contentType string
+		body        string
+		status      int
+	}{
+		{"application/merge-patch+json", `{"description":"keller"}`, http.StatusOK},
+		{"application/json; charset=utf-8", `{"description":"dach"}`, http.StatusOK},
+		{"application/json-patch+json", `[{"op":"replace","path":"/description","value":"dach"}]`, http.StatusUnsupportedMediaType},
+		{"text/plain", `description=dach`, http.StatusUnsupportedMediaType},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest("PATCH", path, strings.NewReader(test.body))
+		req.Header.Set("Content-Type", test.contentType)
+		req.Header.Set("If-Match", "*")
+		rec := httptest.NewRecorder()
+		h.app.router.ServeHTTP(rec, req)
+		if rec.Code != test.status {
+			t.Errorf("%s: expected status %d but got %d: %s", test.contentType, test.status, rec.Code, rec.Body.String())
+		}
+	}
+}
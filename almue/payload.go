@@ -11,6 +11,7 @@ import (
 
 type floorPayload struct {
 	*model.Floor
+	Rooms     roomListPayload     `json:"rooms,omitempty"`
 	Shutters  shutterListPayload  `json:"shutters,omitempty"`
 	Lightings lightingListPayload `json:"lightings,omitempty"`
 }
@@ -22,20 +23,80 @@ func (f *floorPayload) Render(w http.ResponseWriter, r *http.Request) error {
 }
 
 func (f *floorPayload) Bind(r *http.Request) error {
-	return nil
+	if f.Floor == nil {
+		f.Floor = &model.Floor{}
+	}
+	return f.validate().errOrNil()
 }
 
-func (a *Almue) newFloorListPayloadResponse(floors []*model.Floor) []render.Renderer {
+// newFloorListPayloadResponse returns the payloads of the floors with their rooms and devices.
+// The rooms and devices of the floors of the page are queried at once instead of once per floor
+func (a *Almue) newFloorListPayloadResponse(floors []*model.Floor) ([]render.Renderer, error) {
 	list := []render.Renderer{}
+	if len(floors) == 0 {
+		return list, nil
+	}
+
+	floorIDs := []int64{}
 	for _, floor := range floors {
-		list = append(list, a.newFloorPayloadResponse(floor))
+		floorIDs = append(floorIDs, floor.ID)
 	}
-	return list
+	opts := &model.ListOptions{FloorIDs: floorIDs}
+	rooms, err := a.store.FindRooms(opts)
+	if err != nil {
+		return nil, err
+	}
+	shutters, err := a.store.FindShutters(opts)
+	if err != nil {
+		return nil, err
+	}
+	lightings, err := a.store.FindLightings(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	payloads := map[int64]*floorPayload{}
+	for _, floor := range floors {
+		payload := &floorPayload{Floor: floor, Rooms: roomListPayload{}, Shutters: shutterListPayload{}, Lightings: lightingListPayload{}}
+		payloads[floor.ID] = payload
+		list = append(list, payload)
+	}
+	for _, room := range rooms {
+		if payload, ok := payloads[*room.FloorID]; ok {
+			payload.Rooms = append(payload.Rooms, &roomPayload{Room: room})
+		}
+	}
+	for _, shutter := range shutters {
+		if shutter.FloorID == nil {
+			continue
+		}
+		if payload, ok := payloads[*shutter.FloorID]; ok {
+			payload.Shutters = append(payload.Shutters, a.newShutterPayloadResponse(shutter))
+		}
+	}
+	for _, lighting := range lightings {
+		if lighting.FloorID == nil {
+			continue
+		}
+		if payload, ok := payloads[*lighting.FloorID]; ok {
+			payload.Lightings = append(payload.Lightings, a.newLightingPayloadResponse(lighting))
+		}
+	}
+	return list, nil
 }
 
 func (a *Almue) newFloorPayloadResponse(floor *model.Floor) *floorPayload {
 	resp := &floorPayload{Floor: floor}
 
+	if resp.Rooms == nil {
+		if rooms, _ := a.store.GetRoomListOfFloor(floor.ID); rooms != nil {
+			resp.Rooms = roomListPayload{}
+			for _, room := range rooms {
+				resp.Rooms = append(resp.Rooms, &roomPayload{Room: room})
+			}
+		}
+	}
+
 	if resp.Shutters == nil {
 		if shutters, _ := a.store.GetShutterListOfFloor(floor.ID); shutters != nil {
 			resp.Shutters = shutterListPayload{}
@@ -57,9 +118,65 @@ func (a *Almue) newFloorPayloadResponse(floor *model.Floor) *floorPayload {
 	return resp
 }
 
+//-- ROOM PAYLOAD --//
+
+// roomPayload is a room with its devices. The rooms of a floor payload are embedded without
+// their devices, as the devices of the floor name their room themselves
+type roomPayload struct {
+	*model.Room
+	Shutters  shutterListPayload  `json:"shutters,omitempty"`
+	Lightings lightingListPayload `json:"lightings,omitempty"`
+}
+
+type roomListPayload []*roomPayload
+
+func (rp *roomPayload) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+func (rp *roomPayload) Bind(r *http.Request) error {
+	if rp.Room == nil {
+		rp.Room = &model.Room{}
+	}
+	if floorID, ok := floorFromContext(r); ok {
+		rp.FloorID = floorID
+	}
+	return rp.validate().errOrNil()
+}
+
+func (a *Almue) newRoomListPayloadResponse(rooms []*model.Room) []render.Renderer {
+	list := []render.Renderer{}
+	for _, room := range rooms {
+		list = append(list, &roomPayload{Room: room})
+	}
+	return list
+}
+
+func (a *Almue) newRoomPayloadResponse(room *model.Room) *roomPayload {
+	resp := &roomPayload{Room: room}
+
+	if shutters, _ := a.store.FindShutters(&model.ListOptions{RoomID: &room.ID}); shutters != nil {
+		resp.Shutters = shutterListPayload{}
+		for _, shutter := range shutters {
+			resp.Shutters = append(resp.Shutters, a.newShutterPayloadResponse(shutter))
+		}
+	}
+
+	if lightings, _ := a.store.FindLightings(&model.ListOptions{RoomID: &room.ID}); lightings != nil {
+		resp.Lightings = lightingListPayload{}
+		for _, lighting := range lightings {
+			resp.Lightings = append(resp.Lightings, a.newLightingPayloadResponse(lighting))
+		}
+	}
+
+	return resp
+}
+
 //-- SHUTTER PAYLOAD --//
 type shutterPayload struct {
 	*model.Shutter
+	refs     referenceChecker
+	timeErrs fieldErrors
 }
 
 type shutterListPayload []*shutterPayload
@@ -69,7 +186,16 @@ func (s *shutterPayload) Render(w http.ResponseWriter, r *http.Request) error {
 }
 
 func (s *shutterPayload) Bind(r *http.Request) error {
-	return nil
+	if len(s.timeErrs) > 0 {
+		return s.timeErrs
+	}
+	if floorID, ok := floorFromContext(r); ok {
+		s.FloorID = floorID
+	}
+	if roomID, ok := roomFromContext(r); ok {
+		s.RoomID = roomID
+	}
+	return s.validate().errOrNil()
 }
 
 func (a *Almue) newShutterListPayloadResponse(shutters []*model.Shutter) []render.Renderer {
@@ -89,6 +215,8 @@ func (a *Almue) newShutterPayloadResponse(shutter *model.Shutter) *shutterPayloa
 //-- LIGHTING PAYLOAD --//
 type lightingPayload struct {
 	*model.Lighting
+	refs     referenceChecker
+	timeErrs fieldErrors
 }
 
 type lightingListPayload []*lightingPayload
@@ -98,7 +226,16 @@ func (l *lightingPayload) Render(w http.ResponseWriter, r *http.Request) error {
 }
 
 func (l *lightingPayload) Bind(r *http.Request) error {
-	return nil
+	if len(l.timeErrs) > 0 {
+		return l.timeErrs
+	}
+	if floorID, ok := floorFromContext(r); ok {
+		l.FloorID = floorID
+	}
+	if roomID, ok := roomFromContext(r); ok {
+		l.RoomID = roomID
+	}
+	return l.validate().errOrNil()
 }
 
 func (a *Almue) newLightingListPayloadResponse(lightings []*model.Lighting) []render.Renderer {
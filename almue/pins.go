@@ -0,0 +1,74 @@
+package almue
+
+import (
+	"net/http"
+
+	"github.com/go-chi/render"
+	"github.com/he4d/almue-backend/board"
+	"github.com/he4d/almue-backend/model"
+)
+
+type pinListPayload struct {
+	Used []*model.Pin `json:"used"`
+	Free []int        `json:"free"`
+}
+
+func (p *pinListPayload) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+type boardPayload struct {
+	*board.Profile
+}
+
+func (b *boardPayload) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+type pinConflictResponse struct {
+	*ErrResponse
+	ConflictingPin *model.Pin `json:"conflictingPin,omitempty"`
+}
+
+//ErrPinConflict returns a 409 renderer for a pin conflict of the store which contains the device that already uses the pin.
+//A device that uses the same pin twice conflicts with itself
+func ErrPinConflict(conflict *model.PinConflictError) render.Renderer {
+	if conflict.Assigned == nil {
+		return ErrConflict(conflict)
+	}
+	return &pinConflictResponse{
+		ErrResponse: &ErrResponse{
+			HTTPStatusCode: 409,
+			StatusText:     "Pin already in use.",
+			ErrorText:      conflict.Error(),
+		},
+		ConflictingPin: conflict.Assigned,
+	}
+}
+
+func (a *Almue) getAllPins(w http.ResponseWriter, r *http.Request) {
+	used, err := a.store.GetPinList()
+	if err != nil {
+		render.Render(w, r, ErrInternalServer(err))
+		a.logger.Error.Print(err)
+		return
+	}
+
+	usedNumbers := map[int]struct{}{}
+	for _, pin := range used {
+		usedNumbers[pin.Number] = struct{}{}
+	}
+
+	free := []int{}
+	for _, pin := range a.board.Available() {
+		if _, ok := usedNumbers[pin]; !ok {
+			free = append(free, pin)
+		}
+	}
+
+	render.Render(w, r, &pinListPayload{Used: used, Free: free})
+}
+
+func (a *Almue) getBoard(w http.ResponseWriter, r *http.Request) {
+	render.Render(w, r, &boardPayload{Profile: a.board})
+}
@@ -0,0 +1,66 @@
+package almue
+
+import (
+	"net/http"
+
+	"github.com/go-chi/render"
+	"github.com/he4d/almue-backend/model"
+)
+
+type presencePayload struct {
+	*model.PresenceSettings
+	refs referenceChecker
+}
+
+func (p *presencePayload) Bind(r *http.Request) error {
+	if p.PresenceSettings == nil {
+		p.PresenceSettings = &model.PresenceSettings{}
+	}
+	if p.Profile == "" {
+		p.Profile = model.PresenceProfileHistory
+	}
+	return p.validate().errOrNil()
+}
+
+type presenceStatusPayload struct {
+	*model.PresenceStatus
+}
+
+func (p *presenceStatusPayload) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+// getPresence returns the state of the presence simulation with its planned and performed actions
+func (a *Almue) getPresence(w http.ResponseWriter, r *http.Request) {
+	render.Render(w, r, &presenceStatusPayload{a.deviceController.PresenceStatus()})
+}
+
+// startPresence starts the presence simulation with the settings of the body.
+// A running simulation is replaced
+func (a *Almue) startPresence(w http.ResponseWriter, r *http.Request) {
+	p := &presencePayload{refs: a}
+	if err := render.Bind(r, p); err != nil {
+		render.Render(w, r, ErrBind(err))
+		a.logger.Error.Print(err)
+		return
+	}
+
+	if err := a.deviceController.StartPresenceSimulation(p.PresenceSettings); err != nil {
+		render.Render(w, r, ErrInternalServer(err))
+		a.logger.Error.Print(err)
+		return
+	}
+
+	render.Render(w, r, &presenceStatusPayload{a.deviceController.PresenceStatus()})
+}
+
+// stopPresence stops the presence simulation, the devices keep their states
+func (a *Almue) stopPresence(w http.ResponseWriter, r *http.Request) {
+	if err := a.deviceController.StopPresenceSimulation(); err != nil {
+		render.Render(w, r, ErrInternalServer(err))
+		a.logger.Error.Print(err)
+		return
+	}
+
+	render.NoContent(w, r)
+}
@@ -0,0 +1,77 @@
+package almue
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/he4d/almue-backend/model"
+)
+
+func TestPresenceRoutes(t *testing.T) {
+	h := newHarness(t)
+	defer h.close()
+
+	floor := h.createFloor("erdgeschoss")
+	shutter := h.createShutter(floor.ID, 17, 27)
+	lighting := h.createLighting(floor.ID, 4)
+	body := lightingBody(floor.ID, 5)
+	body["disabled"] = true
+	disabled := &model.Lighting{}
+	h.mustDo("POST", "/api/v1/lightings", body, http.StatusCreated, disabled)
+	h.controller.reset()
+
+	tests := []struct {
+		name  string
+		body  map[string]interface{}
+		field string
+	}{
+		{"no devices", map[string]interface{}{}, "lightings"},
+		{"unknown shutter", map[string]interface{}{"shutters": []int64{999}}, "shutters"},
+		{"disabled lighting", map[string]interface{}{"lightings": []int64{disabled.ID}}, "lightings"},
+		{"unknown profile", map[string]interface{}{"lightings": []int64{lighting.ID}, "profile": "party"}, "profile"},
+		{"jitter too large", map[string]interface{}{"lightings": []int64{lighting.ID}, "jitterMinutes": maxJitterMinutes + 1}, "jitterMinutes"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resp := &validationResponse{}
+			h.mustDo("PUT", "/api/v1/presence", test.body, http.StatusUnprocessableEntity, resp)
+			if len(resp.Fields) != 1 || resp.Fields[0].Field != test.field {
+				t.Errorf("Expected the field %s to be invalid but got %v", test.field, resp.Fields)
+			}
+		})
+	}
+	if calls := h.controller.reset(); len(calls) != 0 {
+		t.Errorf("Expected no simulation to be started for invalid settings but got %v", calls)
+	}
+
+	status := &model.PresenceStatus{}
+	h.mustDo("PUT", "/api/v1/presence", map[string]interface{}{
+		"shutters":    []int64{shutter.ID},
+		"lightings":   []int64{lighting.ID},
+		"suspendJobs": true,
+	}, http.StatusOK, status)
+	expected := &model.PresenceSettings{
+		Shutters:    []int64{shutter.ID},
+		Lightings:   []int64{lighting.ID},
+		Profile:     model.PresenceProfileHistory,
+		SuspendJobs: true,
+	}
+	if !status.Enabled || !reflect.DeepEqual(status.Settings, expected) {
+		t.Errorf("Expected the simulation to run with the history profile but got %+v", status)
+	}
+
+	h.mustDo("GET", "/api/v1/presence", nil, http.StatusOK, status)
+	if !status.Enabled {
+		t.Errorf("Expected the simulation to run but got %+v", status)
+	}
+
+	h.mustDo("DELETE", "/api/v1/presence", nil, http.StatusNoContent, nil)
+	if calls := h.controller.reset(); !reflect.DeepEqual(calls, []string{"StartPresenceSimulation(0)", "StopPresenceSimulation(0)"}) {
+		t.Errorf("Expected the simulation to be started and stopped but got %v", calls)
+	}
+	h.mustDo("GET", "/api/v1/presence", nil, http.StatusOK, status)
+	if status.Enabled {
+		t.Errorf("Expected the simulation to be stopped but got %+v", status)
+	}
+}
@@ -0,0 +1,40 @@
+package almue
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/middleware"
+	"github.com/he4d/almue-backend/logging"
+)
+
+// logRequests writes one record per request with the request id of the RequestID middleware.
+// The commands of a request carry the same id as their trace, so the actions of the
+// device controller can be followed back to the request
+func (a *Almue) logRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		start := time.Now()
+		next.ServeHTTP(ww, r)
+
+		route, status := routePattern(r), responseStatus(ww)
+		logger := logging.With(a.logger,
+			"request_id", middleware.GetReqID(r.Context()),
+			"method", r.Method,
+			"path", r.URL.Path,
+			"route", route,
+			"status", strconv.Itoa(status),
+			"bytes", strconv.Itoa(ww.BytesWritten()),
+			"duration", time.Since(start).String(),
+			"remote", r.RemoteAddr,
+		)
+		msg := fmt.Sprintf("%s %s %d", r.Method, r.URL.Path, status)
+		if status >= http.StatusInternalServerError {
+			logger.Error.Print(msg)
+			return
+		}
+		logger.Info.Print(msg)
+	})
+}
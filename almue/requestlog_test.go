@@ -0,0 +1,60 @@
+package almue
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/he4d/almue-backend/logging"
+	"github.com/he4d/almue-backend/model"
+	"github.com/he4d/simplejack"
+)
+
+func TestRequestLog(t *testing.T) {
+	h := newHarness(t)
+	defer h.close()
+
+	floor := h.createFloor("ground")
+	shutter := h.createShutter(floor.ID, 17, 27)
+
+	buf := &bytes.Buffer{}
+	logs, err := logging.New(buf, logging.FormatJSON, simplejack.INFO, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.app.logger = logs.Logger("almue")
+
+	path := fmt.Sprintf("/api/v1/shutters/%d/open", shutter.ID)
+	command := &model.Command{}
+	h.mustDo("POST", path, nil, http.StatusAccepted, command)
+	h.mustDo("GET", "/api/v1/floors/99", nil, http.StatusNotFound, nil)
+
+	records := []map[string]string{}
+	for _, line := range bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n")) {
+		record := map[string]string{}
+		if err := json.Unmarshal(line, &record); err != nil {
+			t.Fatalf("Expected JSON records but got %s: %v", line, err)
+		}
+		if record["route"] != "" {
+			records = append(records, record)
+		}
+	}
+	if len(records) != 2 {
+		t.Fatalf("Expected a record per request but got %v", records)
+	}
+
+	// the command carries the request id as trace to the device controller
+	request := records[0]
+	if command.Trace == "" || request["request_id"] != command.Trace {
+		t.Errorf("Expected the trace %q of the command to be the request id of %v", command.Trace, request)
+	}
+	if request["level"] != "info" || request["package"] != "almue" || request["method"] != "POST" || request["path"] != path ||
+		request["route"] != "/api/v1/shutters/{shutterID:[0-9]+$}/{action:[a-z]+$}/" || request["status"] != "202" {
+		t.Errorf("Expected the record of the accepted command but got %v", request)
+	}
+	if missing := records[1]; missing["status"] != "404" || missing["request_id"] == command.Trace {
+		t.Errorf("Expected the record of the missing floor with its own request id but got %v", missing)
+	}
+}
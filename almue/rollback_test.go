@@ -0,0 +1,100 @@
+package almue
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/he4d/almue-backend/model"
+)
+
+func TestCreateRollsBackOnRegisterFailure(t *testing.T) {
+	h := newHarness(t)
+	defer h.close()
+
+	floor := h.createFloor("erdgeschoss")
+	h.controller.failing["RegisterShutters"] = true
+	h.controller.failing["RegisterLightings"] = true
+
+	h.mustDo("POST", "/api/v1/shutters", shutterBody(floor.ID, 17, 27), http.StatusInternalServerError, nil)
+	h.mustDo("POST", "/api/v1/lightings", lightingBody(floor.ID, 4), http.StatusInternalServerError, nil)
+
+	config, err := h.store.GetConfiguration()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(config.Shutters) != 0 || len(config.Lightings) != 0 {
+		t.Errorf("Expected no stored devices after failed registrations but got %d shutters and %d lightings",
+			len(config.Shutters), len(config.Lightings))
+	}
+	pins, err := h.store.GetPinList()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pins) != 0 {
+		t.Errorf("Expected all pins to be free again but got %v", pins)
+	}
+}
+
+func TestDeleteKeepsDeviceOnUnregisterFailure(t *testing.T) {
+	h := newHarness(t)
+	defer h.close()
+
+	floor := h.createFloor("erdgeschoss")
+	shutter := h.createShutter(floor.ID, 17, 27)
+	lighting := h.createLighting(floor.ID, 4)
+	h.controller.failing["UnregisterShutter"] = true
+	h.controller.failing["UnregisterLighting"] = true
+
+	h.mustDo("DELETE", fmt.Sprintf("/api/v1/shutters/%d", shutter.ID), nil, http.StatusInternalServerError, nil)
+	h.mustDo("DELETE", fmt.Sprintf("/api/v1/lightings/%d", lighting.ID), nil, http.StatusInternalServerError, nil)
+	h.mustDo("GET", fmt.Sprintf("/api/v1/shutters/%d", shutter.ID), nil, http.StatusOK, nil)
+	h.mustDo("GET", fmt.Sprintf("/api/v1/lightings/%d", lighting.ID), nil, http.StatusOK, nil)
+}
+
+func TestDeleteFloorRegistersDevicesAgainOnFailure(t *testing.T) {
+	h := newHarness(t)
+	defer h.close()
+
+	floor := h.createFloor("erdgeschoss")
+	shutter := h.createShutter(floor.ID, 17, 27)
+	h.createLighting(floor.ID, 4)
+	h.controller.reset()
+	h.controller.failing["UnregisterLighting"] = true
+
+	h.mustDo("DELETE", fmt.Sprintf("/api/v1/floors/%d", floor.ID), nil, http.StatusInternalServerError, nil)
+
+	expected := []string{
+		fmt.Sprintf("UnregisterShutter(%d)", shutter.ID),
+		fmt.Sprintf("RegisterShutters(%d)", shutter.ID),
+	}
+	if calls := h.controller.reset(); !reflect.DeepEqual(calls, expected) {
+		t.Errorf("Expected the calls %v but got %v", expected, calls)
+	}
+	h.mustDo("GET", fmt.Sprintf("/api/v1/floors/%d", floor.ID), nil, http.StatusOK, nil)
+}
+
+func TestUpdateRestoresOnControllerFailure(t *testing.T) {
+	h := newHarness(t)
+	defer h.close()
+
+	floor := h.createFloor("erdgeschoss")
+	shutter := h.createShutter(floor.ID, 17, 27)
+	path := fmt.Sprintf("/api/v1/shutters/%d", shutter.ID)
+	h.controller.failing["UpdateShutter"] = true
+
+	h.mustDo("PATCH", path, map[string]interface{}{"openPin": 22}, http.StatusInternalServerError, nil)
+
+	restored := &model.Shutter{}
+	h.mustDo("GET", path, nil, http.StatusOK, restored)
+	if *restored.OpenPin != 17 {
+		t.Errorf("Expected the old open pin 17 after the failed update but got %d", *restored.OpenPin)
+	}
+	if restored.Version == shutter.Version {
+		t.Error("Expected a new version after restoring the shutter, clients may have seen the failed update")
+	}
+	if pin, err := h.store.GetPin(22); err == nil {
+		t.Errorf("Expected pin 22 to be free again but it is used by %+v", pin)
+	}
+}
@@ -0,0 +1,271 @@
+package almue
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/go-chi/chi"
+	"github.com/go-chi/render"
+	"github.com/he4d/almue-backend/model"
+)
+
+func (a *Almue) getAllRoomsOfFloor(w http.ResponseWriter, r *http.Request) {
+	opts, err := parseListOptions(r)
+	if err != nil {
+		render.Render(w, r, ErrInvalidRequest(err))
+		a.logger.Error.Print(err)
+		return
+	}
+	scopeOptions(r, opts)
+
+	rooms, err := a.store.FindRooms(pageOptions(opts))
+	if err != nil {
+		render.Render(w, r, ErrList(err))
+		a.logger.Error.Print(err)
+		return
+	}
+
+	found := len(rooms)
+	start, end := pageBounds(opts, found)
+	rooms = rooms[start:end]
+	if err := setLinkHeader(w, r, opts, found, rooms); err != nil {
+		render.Render(w, r, ErrInternalServer(err))
+		a.logger.Error.Print(err)
+		return
+	}
+
+	if err := render.RenderList(w, r, a.newRoomListPayloadResponse(rooms)); err != nil {
+		render.Render(w, r, ErrRender(err))
+		a.logger.Error.Print(err)
+	}
+}
+
+func (a *Almue) createRoom(w http.ResponseWriter, r *http.Request) {
+	rp := &roomPayload{}
+	if err := render.Bind(r, rp); err != nil {
+		render.Render(w, r, ErrBind(err))
+		a.logger.Error.Print(err)
+		return
+	}
+
+	id, err := a.store.CreateRoom(rp.Room)
+	if err != nil {
+		render.Render(w, r, ErrRender(err))
+		a.logger.Error.Print(err)
+		return
+	}
+
+	room, err := a.store.GetRoom(id)
+	if err != nil {
+		render.Render(w, r, ErrInternalServer(err))
+		a.logger.Error.Print(err)
+		return
+	}
+
+	setETag(w, room.Version)
+	render.Status(r, http.StatusCreated)
+	render.Render(w, r, a.newRoomPayloadResponse(room))
+}
+
+func (a *Almue) getRoom(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	room, ok := ctx.Value(roomCtxKey).(*model.Room)
+	if !ok {
+		a.logger.Error.Print("Room from context is not a room?")
+		return
+	}
+
+	setETag(w, room.Version)
+	if err := render.Render(w, r, a.newRoomPayloadResponse(room)); err != nil {
+		render.Render(w, r, ErrRender(err))
+		return
+	}
+}
+
+func (a *Almue) updateRoom(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	room, ok := ctx.Value(roomCtxKey).(*model.Room)
+	if !ok {
+		a.logger.Error.Print("Room from context is not a room?")
+		return
+	}
+	oldRoom := room.DeepCopy()
+
+	rp := &roomPayload{Room: room}
+	if err := render.Bind(r, rp); err != nil {
+		render.Render(w, r, ErrBind(err))
+		a.logger.Error.Print(err)
+		return
+	}
+
+	a.saveRoom(w, r, oldRoom, rp)
+}
+
+func (a *Almue) patchRoom(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	room, ok := ctx.Value(roomCtxKey).(*model.Room)
+	if !ok {
+		a.logger.Error.Print("Room from context is not a room?")
+		return
+	}
+
+	if err := checkPatchContentType(r); err != nil {
+		render.Render(w, r, ErrUnsupportedMediaType(err))
+		a.logger.Error.Print(err)
+		return
+	}
+
+	patched, err := readMergePatch(r, room)
+	if err != nil {
+		render.Render(w, r, ErrInvalidRequest(err))
+		a.logger.Error.Print(err)
+		return
+	}
+
+	rp := &roomPayload{}
+	if err := json.Unmarshal(patched, rp); err != nil {
+		render.Render(w, r, ErrInvalidRequest(err))
+		a.logger.Error.Print(err)
+		return
+	}
+	if err := rp.Bind(r); err != nil {
+		render.Render(w, r, ErrBind(err))
+		a.logger.Error.Print(err)
+		return
+	}
+
+	a.saveRoom(w, r, room, rp)
+}
+
+// saveRoom stores the bound payload as the new state of the old room.
+// The floor of a room is given by its route, so a room can not be moved to another floor
+func (a *Almue) saveRoom(w http.ResponseWriter, r *http.Request, oldRoom *model.Room, rp *roomPayload) {
+	if rp.Room.ID != oldRoom.ID {
+		err := errors.New("Can not update the room to a different id")
+		render.Render(w, r, ErrInvalidRequest(err))
+		a.logger.Error.Print(err)
+		return
+	}
+
+	// the If-Match header was checked against the version of the old room
+	rp.Version = oldRoom.Version
+	if err := a.store.UpdateRoom(rp.Room); err != nil {
+		if err == model.ErrVersionConflict {
+			render.Render(w, r, ErrPreconditionFailed(err))
+		} else {
+			render.Render(w, r, ErrInternalServer(err))
+		}
+		a.logger.Error.Print(err)
+		return
+	}
+
+	updatedRoom, err := a.store.GetRoom(rp.Room.ID)
+	if err != nil {
+		render.Render(w, r, ErrInternalServer(err))
+		a.logger.Error.Print(err)
+		return
+	}
+
+	setETag(w, updatedRoom.Version)
+	render.Render(w, r, a.newRoomPayloadResponse(updatedRoom))
+}
+
+// deleteRoom deletes the room, its devices stay on the floor without a room
+// and keep working, so the device controller is not involved
+func (a *Almue) deleteRoom(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	room, ok := ctx.Value(roomCtxKey).(*model.Room)
+	if !ok {
+		a.logger.Error.Print("Room from context is not a room?")
+		return
+	}
+
+	if err := a.store.DeleteRoom(room.ID); err != nil {
+		render.Render(w, r, ErrInternalServer(err))
+		a.logger.Error.Print(err)
+		return
+	}
+
+	render.NoContent(w, r)
+}
+
+// controlRoom runs the action on all enabled devices of the room
+func (a *Almue) controlRoom(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	room, ok := ctx.Value(roomCtxKey).(*model.Room)
+	if !ok {
+		a.logger.Error.Print("Room from context is not a room?")
+		return
+	}
+
+	enabled := false
+	a.controlGroup(w, r, fmt.Sprintf("room %d", room.ID), &model.ListOptions{RoomID: &room.ID, Disabled: &enabled})
+}
+
+// controlGroup queues the action of the route for all devices found with the options.
+// open, close and stop control the shutters, on and off the lightings.
+// A device whose command can not be queued does not stop the others from being controlled,
+// the response lists the queued commands and the failed devices. Only if no command could
+// be queued the request fails
+func (a *Almue) controlGroup(w http.ResponseWriter, r *http.Request, group string, opts *model.ListOptions) {
+	resp := &groupCommandsPayload{Commands: []*commandPayload{}, Failed: []*failedCommand{}}
+	submit := func(deviceType string, deviceID int64, action string) {
+		command, err := a.deviceController.SubmitCommand(newCommand(r, deviceType, deviceID, action))
+		if err != nil {
+			resp.Failed = append(resp.Failed, &failedCommand{DeviceType: deviceType, DeviceID: deviceID, Error: err.Error()})
+			return
+		}
+		resp.Commands = append(resp.Commands, &commandPayload{command})
+	}
+
+	action := chi.URLParam(r, "action")
+	switch action {
+	case "open", "close", "stop":
+		shutters, err := a.store.FindShutters(opts)
+		if err != nil {
+			render.Render(w, r, ErrInternalServer(err))
+			a.logger.Error.Print(err)
+			return
+		}
+		for _, shutter := range shutters {
+			submit(model.DeviceTypeShutter, shutter.ID, action)
+		}
+	case "on", "off":
+		lightings, err := a.store.FindLightings(opts)
+		if err != nil {
+			render.Render(w, r, ErrInternalServer(err))
+			a.logger.Error.Print(err)
+			return
+		}
+		for _, lighting := range lightings {
+			submit(model.DeviceTypeLighting, lighting.ID, action)
+		}
+	default:
+		err := errors.New("Action not supported")
+		render.Render(w, r, ErrInvalidRequest(err))
+		a.logger.Info.Print(err)
+		return
+	}
+
+	if len(resp.Failed) > 0 {
+		errs := []string{}
+		for _, f := range resp.Failed {
+			errs = append(errs, f.Error)
+		}
+		err := fmt.Errorf("Could not %s %d of the %d devices of %s: %v",
+			action, len(resp.Failed), len(resp.Failed)+len(resp.Commands), group, errs)
+		if len(resp.Commands) == 0 {
+			render.Render(w, r, ErrInternalServer(err))
+			a.logger.Error.Print(err)
+			return
+		}
+		a.logger.Error.Print(err)
+	}
+	render.Status(r, http.StatusAccepted)
+	if err := render.Render(w, r, resp); err != nil {
+		render.Render(w, r, ErrRender(err))
+		a.logger.Error.Print(err)
+	}
+}
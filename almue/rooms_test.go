@@ -0,0 +1,179 @@
+package almue
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/he4d/almue-backend/model"
+)
+
+func TestRoomRoutes(t *testing.T) {
+	h := newHarness(t)
+	defer h.close()
+
+	floor := h.createFloor("erdgeschoss")
+	otherFloor := h.createFloor("obergeschoss")
+	room := h.createRoom(floor.ID, "kueche")
+	h.createRoom(otherFloor.ID, "kueche")
+	roomsPath := fmt.Sprintf("/api/v1/floors/%d/rooms", floor.ID)
+	roomPath := fmt.Sprintf("%s/%d", roomsPath, room.ID)
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   interface{}
+		status int
+	}{
+		{"list", "GET", roomsPath, nil, http.StatusOK},
+		{"get", "GET", roomPath, nil, http.StatusOK},
+		{"get unknown", "GET", roomsPath + "/999", nil, http.StatusNotFound},
+		{"get of other floor", "GET", fmt.Sprintf("/api/v1/floors/%d/rooms/%d", otherFloor.ID, room.ID), nil, http.StatusNotFound},
+		{"create without description", "POST", roomsPath, map[string]interface{}{}, http.StatusUnprocessableEntity},
+		{"create duplicate", "POST", roomsPath, map[string]interface{}{"description": "kueche"}, http.StatusUnprocessableEntity},
+		{"update", "PUT", roomPath, map[string]interface{}{"description": "esszimmer"}, http.StatusOK},
+		{"update other id", "PUT", roomPath, map[string]interface{}{"id": room.ID + 1}, http.StatusBadRequest},
+		{"unsupported action", "POST", roomPath + "/dim", nil, http.StatusBadRequest},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rec := h.do(test.method, test.path, test.body)
+			if rec.Code != test.status {
+				t.Errorf("%s %s: expected status %d but got %d: %s", test.method, test.path, test.status, rec.Code, rec.Body.String())
+			}
+		})
+	}
+
+	updated := &model.Room{}
+	h.mustDo("GET", roomPath, nil, http.StatusOK, updated)
+	if *updated.Description != "esszimmer" || *updated.FloorID != floor.ID || updated.Version != 2 {
+		t.Errorf("Expected the updated room on its floor but got %+v", updated)
+	}
+}
+
+func TestRoomDevices(t *testing.T) {
+	h := newHarness(t)
+	defer h.close()
+
+	floor := h.createFloor("erdgeschoss")
+	otherFloor := h.createFloor("obergeschoss")
+	room := h.createRoom(floor.ID, "kueche")
+	otherRoom := h.createRoom(otherFloor.ID, "bad")
+	roomPath := fmt.Sprintf("/api/v1/floors/%d/rooms/%d", floor.ID, room.ID)
+
+	// the room of the route is the room of a created device
+	shutter := &model.Shutter{}
+	h.mustDo("POST", roomPath+"/shutters", shutterBody(otherFloor.ID, 17, 27), http.StatusCreated, shutter)
+	if *shutter.FloorID != floor.ID || shutter.RoomID == nil || *shutter.RoomID != room.ID {
+		t.Errorf("Expected the shutter in the room of the route but got %+v", shutter)
+	}
+	h.createShutter(floor.ID, 5, 6)
+
+	body := lightingBody(floor.ID, 4)
+	body["roomId"] = otherRoom.ID
+	rec := h.do("POST", "/api/v1/lightings", body)
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("Expected status 422 for a room of another floor but got %d: %s", rec.Code, rec.Body.String())
+	}
+	resp := &validationResponse{}
+	if err := json.Unmarshal(rec.Body.Bytes(), resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Fields) != 1 || resp.Fields[0].Field != "roomId" || resp.Fields[0].AppCode != AppCodeUnknownRoom {
+		t.Errorf("Expected an unknown room error of the roomId but got %s", rec.Body.String())
+	}
+	body["roomId"] = room.ID
+	lighting := &model.Lighting{}
+	h.mustDo("POST", "/api/v1/lightings", body, http.StatusCreated, lighting)
+
+	var shutters []*model.Shutter
+	h.mustDo("GET", roomPath+"/shutters", nil, http.StatusOK, &shutters)
+	if len(shutters) != 1 || shutters[0].ID != shutter.ID {
+		t.Errorf("Expected only the shutter of the room but got %v", shutters)
+	}
+	h.mustDo("GET", fmt.Sprintf("/api/v1/shutters?roomId=%d", room.ID), nil, http.StatusOK, &shutters)
+	if len(shutters) != 1 || shutters[0].ID != shutter.ID {
+		t.Errorf("Expected only the shutter of the roomId filter but got %v", shutters)
+	}
+
+	roomResp := &roomPayload{}
+	h.mustDo("GET", roomPath, nil, http.StatusOK, roomResp)
+	if len(roomResp.Shutters) != 1 || len(roomResp.Lightings) != 1 || roomResp.Lightings[0].ID != lighting.ID {
+		t.Errorf("Expected the room with its shutter and lighting but got %+v", roomResp)
+	}
+
+	floorResp := &floorPayload{}
+	h.mustDo("GET", fmt.Sprintf("/api/v1/floors/%d", floor.ID), nil, http.StatusOK, floorResp)
+	if len(floorResp.Rooms) != 1 || floorResp.Rooms[0].ID != room.ID || len(floorResp.Shutters) != 2 {
+		t.Errorf("Expected the floor with its room and all shutters but got %+v", floorResp)
+	}
+	var floors []*floorPayload
+	h.mustDo("GET", "/api/v1/floors", nil, http.StatusOK, &floors)
+	if len(floors) != 2 || len(floors[0].Rooms) != 1 || len(floors[1].Rooms) != 1 || floors[1].Rooms[0].ID != otherRoom.ID {
+		t.Errorf("Expected both floors with their rooms but got %v", floors)
+	}
+
+	h.controller.reset()
+	h.mustDo("DELETE", roomPath, nil, http.StatusNoContent, nil)
+	updated := &model.Shutter{}
+	h.mustDo("GET", fmt.Sprintf("/api/v1/shutters/%d", shutter.ID), nil, http.StatusOK, updated)
+	if updated.RoomID != nil || *updated.FloorID != floor.ID {
+		t.Errorf("Expected the shutter on its floor without a room after deleting the room but got %+v", updated)
+	}
+	if calls := h.controller.reset(); len(calls) != 0 {
+		t.Errorf("Expected the devices of a deleted room to stay registered but got %v", calls)
+	}
+}
+
+func TestControlRoom(t *testing.T) {
+	h := newHarness(t)
+	defer h.close()
+
+	floor := h.createFloor("erdgeschoss")
+	room := h.createRoom(floor.ID, "kueche")
+	roomPath := fmt.Sprintf("/api/v1/floors/%d/rooms/%d", floor.ID, room.ID)
+
+	first, second, disabled := &model.Shutter{}, &model.Shutter{}, &model.Shutter{}
+	h.mustDo("POST", roomPath+"/shutters", shutterBody(floor.ID, 17, 27), http.StatusCreated, first)
+	h.mustDo("POST", roomPath+"/shutters", shutterBody(floor.ID, 5, 6), http.StatusCreated, second)
+	body := shutterBody(floor.ID, 13, 19)
+	body["disabled"] = true
+	h.mustDo("POST", roomPath+"/shutters", body, http.StatusCreated, disabled)
+	lighting := &model.Lighting{}
+	h.mustDo("POST", roomPath+"/lightings", lightingBody(floor.ID, 4), http.StatusCreated, lighting)
+	h.createShutter(floor.ID, 20, 21)
+	h.controller.reset()
+
+	h.mustDo("POST", roomPath+"/close", nil, http.StatusAccepted, nil)
+	expected := []string{fmt.Sprintf("CloseShutter(%d)", first.ID), fmt.Sprintf("CloseShutter(%d)", second.ID)}
+	if calls := h.controller.reset(); !reflect.DeepEqual(calls, expected) {
+		t.Errorf("Expected the enabled shutters of the room to be closed %v but got %v", expected, calls)
+	}
+
+	h.mustDo("POST", roomPath+"/on", nil, http.StatusAccepted, nil)
+	expected = []string{fmt.Sprintf("TurnLightingOn(%d)", lighting.ID)}
+	if calls := h.controller.reset(); !reflect.DeepEqual(calls, expected) {
+		t.Errorf("Expected the lighting of the room to be turned on %v but got %v", expected, calls)
+	}
+
+	// a failing device does not stop the others, their commands are returned
+	h.controller.failing[fmt.Sprintf("OpenShutter(%d)", first.ID)] = true
+	resp := &groupCommandsPayload{}
+	h.mustDo("POST", roomPath+"/open", nil, http.StatusAccepted, resp)
+	if len(resp.Commands) != 1 || resp.Commands[0].DeviceID != second.ID || resp.Commands[0].ID == 0 {
+		t.Errorf("Expected the queued command of the second shutter but got %v", resp.Commands)
+	}
+	if len(resp.Failed) != 1 || resp.Failed[0].DeviceID != first.ID || resp.Failed[0].DeviceType != model.DeviceTypeShutter || resp.Failed[0].Error == "" {
+		t.Errorf("Expected the first shutter to have failed but got %v", resp.Failed)
+	}
+
+	h.controller.failing["OpenShutter"] = true
+	rec := h.do("POST", roomPath+"/open", nil)
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("Expected status 500 if none of the shutters could be opened but got %d", rec.Code)
+	}
+}
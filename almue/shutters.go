@@ -1,6 +1,7 @@
 package almue
 
 import (
+	"encoding/json"
 	"errors"
 	"net/http"
 
@@ -9,30 +10,28 @@ import (
 	"github.com/he4d/almue-backend/model"
 )
 
-func (a *Almue) getAllShuttersOfFloor(w http.ResponseWriter, r *http.Request) {
-	ctx := r.Context()
-	floor, ok := ctx.Value(floorCtxKey).(*model.Floor)
-	if !ok {
-		a.logger.Error.Print("Floor from context is not a floor?")
-		return
-	}
-
-	shutters, err := a.store.GetShutterListOfFloor(floor.ID)
+// getAllShutters renders the page of shutters that match the query parameters.
+// The floor and room of a nested route replace the floorId and roomId filters
+func (a *Almue) getAllShutters(w http.ResponseWriter, r *http.Request) {
+	opts, err := parseListOptions(r, deviceFilters...)
 	if err != nil {
-		render.Render(w, r, ErrInternalServer(err))
+		render.Render(w, r, ErrInvalidRequest(err))
 		a.logger.Error.Print(err)
 		return
 	}
+	scopeOptions(r, opts)
 
-	if err := render.RenderList(w, r, a.newShutterListPayloadResponse(shutters)); err != nil {
-		render.Render(w, r, ErrRender(err))
+	shutters, err := a.store.FindShutters(pageOptions(opts))
+	if err != nil {
+		render.Render(w, r, ErrList(err))
 		a.logger.Error.Print(err)
+		return
 	}
-}
 
-func (a *Almue) getAllShutters(w http.ResponseWriter, r *http.Request) {
-	shutters, err := a.store.GetShutterList()
-	if err != nil {
+	found := len(shutters)
+	start, end := pageBounds(opts, found)
+	shutters = shutters[start:end]
+	if err := setLinkHeader(w, r, opts, found, shutters); err != nil {
 		render.Render(w, r, ErrInternalServer(err))
 		a.logger.Error.Print(err)
 		return
@@ -52,6 +51,7 @@ func (a *Almue) getShutter(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	setETag(w, shutter.Version)
 	render.Render(w, r, a.newShutterPayloadResponse(shutter))
 }
 
@@ -59,42 +59,76 @@ func (a *Almue) createShutter(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	floor, hasFloorCtx := ctx.Value(floorCtxKey).(*model.Floor)
 
-	s := &shutterPayload{}
+	s := &shutterPayload{refs: a}
 	if err := render.Bind(r, s); err != nil {
-		render.Render(w, r, ErrInvalidRequest(err))
+		render.Render(w, r, ErrBind(err))
 		a.logger.Error.Print(err)
+		return
 	}
 
 	if hasFloorCtx {
 		s.FloorID = &floor.ID
 	}
 
-	var err error
-	s.ID, err = a.store.CreateShutter(s.Shutter)
+	// the shutter is only stored if it can be registered at the device controller
+	var shutter *model.Shutter
+	registered := false
+	err := a.store.WithTx(func(tx DeviceStore) error {
+		id, err := tx.CreateShutter(s.Shutter)
+		if err != nil {
+			return err
+		}
+		if shutter, err = tx.GetShutter(id); err != nil {
+			return err
+		}
+		if err := a.deviceController.RegisterShutters(shutter); err != nil {
+			return err
+		}
+		registered = !shutter.Disabled
+		return nil
+	})
 	if err != nil {
-		render.Render(w, r, ErrInternalServer(err))
+		if registered {
+			// the commit failed after the registration
+			if err := a.deviceController.UnregisterShutter(shutter.ID); err != nil {
+				a.logger.Error.Printf("Could not unregister the not created shutter %d: %v", shutter.ID, err)
+			}
+		}
+		if conflict, ok := err.(*model.PinConflictError); ok {
+			render.Render(w, r, ErrPinConflict(conflict))
+		} else {
+			render.Render(w, r, ErrInternalServer(err))
+		}
 		a.logger.Error.Print(err)
 		return
 	}
 
-	shutter, err := a.store.GetShutter(s.ID)
-	if err != nil {
-		render.Render(w, r, ErrInternalServer(err))
-		a.logger.Error.Print(err)
+	setETag(w, shutter.Version)
+	render.Status(r, http.StatusCreated)
+	render.Render(w, r, a.newShutterPayloadResponse(shutter))
+}
+
+func (a *Almue) updateShutter(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	shutter, ok := ctx.Value(shutterCtxKey).(*model.Shutter)
+	if !ok {
+		a.logger.Error.Print("Shutter from context is not a shutter?")
 		return
 	}
 
-	if err := a.deviceController.RegisterShutters(shutter); err != nil {
-		render.Render(w, r, ErrInternalServer(err))
+	oldShutter := shutter.DeepCopy()
+
+	s := &shutterPayload{Shutter: shutter, refs: a}
+	if err := render.Bind(r, s); err != nil {
+		render.Render(w, r, ErrBind(err))
 		a.logger.Error.Print(err)
 		return
 	}
 
-	render.Status(r, http.StatusCreated)
-	render.Render(w, r, a.newShutterPayloadResponse(shutter))
+	a.saveShutter(w, r, oldShutter, s)
 }
 
-func (a *Almue) updateShutter(w http.ResponseWriter, r *http.Request) {
+func (a *Almue) patchShutter(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	shutter, ok := ctx.Value(shutterCtxKey).(*model.Shutter)
 	if !ok {
@@ -102,45 +136,94 @@ func (a *Almue) updateShutter(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	oldShutter := shutter.DeepCopy()
+	if err := checkPatchContentType(r); err != nil {
+		render.Render(w, r, ErrUnsupportedMediaType(err))
+		a.logger.Error.Print(err)
+		return
+	}
 
-	s := &shutterPayload{Shutter: shutter}
-	if err := render.Bind(r, s); err != nil {
+	patched, err := readMergePatch(r, shutter)
+	if err != nil {
 		render.Render(w, r, ErrInvalidRequest(err))
 		a.logger.Error.Print(err)
 		return
 	}
 
-	if s.Shutter.ID != oldShutter.ID {
-		err := errors.New("Can not update the shutter to a different id")
+	s := &shutterPayload{refs: a}
+	if err := json.Unmarshal(patched, s); err != nil {
 		render.Render(w, r, ErrInvalidRequest(err))
 		a.logger.Error.Print(err)
 		return
 	}
+	if err := s.Bind(r); err != nil {
+		render.Render(w, r, ErrBind(err))
+		a.logger.Error.Print(err)
+		return
+	}
 
-	if err := a.store.UpdateShutter(s.Shutter); err != nil {
-		render.Render(w, r, ErrInternalServer(err))
+	a.saveShutter(w, r, shutter, s)
+}
+
+// saveShutter stores the bound payload as the new state of the old shutter
+func (a *Almue) saveShutter(w http.ResponseWriter, r *http.Request, oldShutter *model.Shutter, s *shutterPayload) {
+	if s.Shutter.ID != oldShutter.ID {
+		err := errors.New("Can not update the shutter to a different id")
+		render.Render(w, r, ErrInvalidRequest(err))
 		a.logger.Error.Print(err)
 		return
 	}
 
-	updatedShutter, err := a.store.GetShutter(s.Shutter.ID)
+	// the If-Match header was checked against the version of the old shutter
+	s.Version = oldShutter.Version
+	var updatedShutter *model.Shutter
+	err := a.store.WithTx(func(tx DeviceStore) error {
+		if err := tx.UpdateShutter(s.Shutter); err != nil {
+			return err
+		}
+		var err error
+		updatedShutter, err = tx.GetShutter(s.Shutter.ID)
+		return err
+	})
 	if err != nil {
-		render.Render(w, r, ErrInternalServer(err))
+		if conflict, ok := err.(*model.PinConflictError); ok {
+			render.Render(w, r, ErrPinConflict(conflict))
+		} else if err == model.ErrVersionConflict {
+			render.Render(w, r, ErrPreconditionFailed(err))
+		} else {
+			render.Render(w, r, ErrInternalServer(err))
+		}
 		a.logger.Error.Print(err)
 		return
 	}
 
+	// the device controller writes the state of the shutter to the store,
+	// so it is updated after the commit and a failure is rolled back by restoring the old shutter
 	diffs := oldShutter.GetDifferences(updatedShutter)
 	if err := a.deviceController.UpdateShutter(diffs, updatedShutter); err != nil {
+		a.restoreShutter(oldShutter, updatedShutter)
 		render.Render(w, r, ErrInternalServer(err))
 		a.logger.Error.Print(err)
 		return
 	}
 
+	setETag(w, updatedShutter.Version)
 	render.Render(w, r, a.newShutterPayloadResponse(updatedShutter))
 }
 
+// restoreShutter stores the old shutter again after the device controller could not apply the update,
+// so the store and the device controller do not disagree about the shutter
+func (a *Almue) restoreShutter(oldShutter, updatedShutter *model.Shutter) {
+	restored := oldShutter.DeepCopy()
+	restored.Version = updatedShutter.Version
+	if err := a.store.UpdateShutter(restored); err != nil {
+		a.logger.Error.Printf("Could not restore shutter %d: %v", restored.ID, err)
+		return
+	}
+	if err := a.deviceController.UpdateShutter(updatedShutter.GetDifferences(restored), restored); err != nil {
+		a.logger.Error.Printf("Could not restore shutter %d at the device controller: %v", restored.ID, err)
+	}
+}
+
 func (a *Almue) deleteShutter(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	shutter, ok := ctx.Value(shutterCtxKey).(*model.Shutter)
@@ -149,13 +232,20 @@ func (a *Almue) deleteShutter(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := a.store.DeleteShutter(shutter.ID); err != nil {
-		render.Render(w, r, ErrInternalServer(err))
-		a.logger.Error.Print(err)
-		return
+	// disabled devices are not registered
+	if !shutter.Disabled {
+		if err := a.deviceController.UnregisterShutter(shutter.ID); err != nil {
+			render.Render(w, r, ErrInternalServer(err))
+			a.logger.Error.Print(err)
+			return
+		}
 	}
 
-	if err := a.deviceController.UnregisterShutter(shutter.ID); err != nil {
+	if err := a.store.DeleteShutter(shutter.ID); err != nil {
+		// the shutter still exists so it has to keep working
+		if err := a.deviceController.RegisterShutters(shutter); err != nil {
+			a.logger.Error.Printf("Could not register the not deleted shutter %d again: %v", shutter.ID, err)
+		}
 		render.Render(w, r, ErrInternalServer(err))
 		a.logger.Error.Print(err)
 		return
@@ -181,32 +271,11 @@ func (a *Almue) controlShutter(w http.ResponseWriter, r *http.Request) {
 
 	action := chi.URLParam(r, "action")
 	switch action {
-	case "open":
-		if err := a.deviceController.OpenShutter(shutter.ID); err != nil {
-			render.Render(w, r, ErrInternalServer(err))
-			a.logger.Error.Print(err)
-			return
-		}
-		break
-	case "close":
-		if err := a.deviceController.CloseShutter(shutter.ID); err != nil {
-			render.Render(w, r, ErrInternalServer(err))
-			a.logger.Error.Print(err)
-			return
-		}
-		break
-	case "stop":
-		if err := a.deviceController.StopShutter(shutter.ID); err != nil {
-			render.Render(w, r, ErrInternalServer(err))
-			a.logger.Error.Print(err)
-			return
-		}
-		break
+	case "open", "close", "stop", "reset":
+		a.submitCommand(w, r, model.DeviceTypeShutter, shutter.ID, action)
 	default:
 		err := errors.New("Action not supported")
 		render.Render(w, r, ErrInvalidRequest(err))
 		a.logger.Info.Print(err)
-		return
 	}
-	render.NoContent(w, r)
 }
@@ -0,0 +1,215 @@
+package almue
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/he4d/almue-backend/model"
+)
+
+func TestShutterRoutes(t *testing.T) {
+	h := newHarness(t)
+	defer h.close()
+
+	floor := h.createFloor("erdgeschoss")
+	shutter := h.createShutter(floor.ID, 17, 27)
+	lighting := h.createLighting(floor.ID, 4)
+	shutterPath := fmt.Sprintf("/api/v1/shutters/%d", shutter.ID)
+	nestedPath := fmt.Sprintf("/api/v1/floors/%d/shutters/%d", floor.ID, shutter.ID)
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   interface{}
+		status int
+		calls  []string
+	}{
+		{"list", "GET", "/api/v1/shutters", nil, http.StatusOK, nil},
+		{"get", "GET", shutterPath, nil, http.StatusOK, nil},
+		{"get unknown", "GET", "/api/v1/shutters/999", nil, http.StatusNotFound, nil},
+		{"create invalid json", "POST", "/api/v1/shutters", "{", http.StatusBadRequest, nil},
+		{"create with used pin", "POST", "/api/v1/shutters", shutterBody(floor.ID, 22, 27), http.StatusConflict, nil},
+		{"create with lighting pin", "POST", "/api/v1/shutters", shutterBody(floor.ID, 22, *lighting.SwitchPin), http.StatusConflict, nil},
+		{"create with same pins", "POST", "/api/v1/shutters", shutterBody(floor.ID, 22, 22), http.StatusConflict, nil},
+		{"create with reserved pin", "POST", "/api/v1/shutters", shutterBody(floor.ID, 14, 22), http.StatusUnprocessableEntity, nil},
+		{"update", "PUT", shutterPath, map[string]interface{}{"completeWayInSeconds": 30}, http.StatusOK,
+			[]string{fmt.Sprintf("UpdateShutter(%d)", shutter.ID)}},
+		{"update other id", "PUT", shutterPath, map[string]interface{}{"id": shutter.ID + 1}, http.StatusBadRequest, nil},
+		{"update with used pin", "PUT", shutterPath, map[string]interface{}{"openPin": *lighting.SwitchPin}, http.StatusConflict, nil},
+		{"open", "POST", shutterPath + "/open", nil, http.StatusAccepted, []string{fmt.Sprintf("OpenShutter(%d)", shutter.ID)}},
+		{"close", "POST", shutterPath + "/close", nil, http.StatusAccepted, []string{fmt.Sprintf("CloseShutter(%d)", shutter.ID)}},
+		{"stop", "POST", shutterPath + "/stop", nil, http.StatusAccepted, []string{fmt.Sprintf("StopShutter(%d)", shutter.ID)}},
+		{"unknown action", "POST", shutterPath + "/dance", nil, http.StatusBadRequest, nil},
+		{"nested list", "GET", fmt.Sprintf("/api/v1/floors/%d/shutters", floor.ID), nil, http.StatusOK, nil},
+		{"nested get", "GET", nestedPath, nil, http.StatusOK, nil},
+		{"nested open", "POST", nestedPath + "/open", nil, http.StatusAccepted, []string{fmt.Sprintf("OpenShutter(%d)", shutter.ID)}},
+		{"nested unknown floor", "GET", "/api/v1/floors/999/shutters", nil, http.StatusNotFound, nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			h.controller.reset()
+			rec := h.do(test.method, test.path, test.body)
+			if rec.Code != test.status {
+				t.Errorf("%s %s: expected status %d but got %d: %s", test.method, test.path, test.status, rec.Code, rec.Body.String())
+			}
+			if calls := h.controller.reset(); !reflect.DeepEqual(calls, test.calls) {
+				t.Errorf("%s %s: expected the controller calls %v but got %v", test.method, test.path, test.calls, calls)
+			}
+		})
+	}
+}
+
+func TestShutterPinConflict(t *testing.T) {
+	h := newHarness(t)
+	defer h.close()
+
+	floor := h.createFloor("erdgeschoss")
+	lighting := h.createLighting(floor.ID, 4)
+	h.controller.reset()
+
+	resp := &pinConflictResponse{ErrResponse: &ErrResponse{}}
+	h.mustDo("POST", "/api/v1/shutters", shutterBody(floor.ID, 22, 4), http.StatusConflict, resp)
+	expected := &model.Pin{Number: 4, DeviceType: model.DeviceTypeLighting, DeviceID: lighting.ID, Function: "switch"}
+	if !reflect.DeepEqual(resp.ConflictingPin, expected) {
+		t.Errorf("Expected the conflicting pin %+v but got %+v", expected, resp.ConflictingPin)
+	}
+	if calls := h.controller.reset(); len(calls) != 0 {
+		t.Errorf("Expected no controller calls for a conflicting shutter but got %v", calls)
+	}
+}
+
+func TestCreateShutterOnFloor(t *testing.T) {
+	h := newHarness(t)
+	defer h.close()
+
+	floor := h.createFloor("erdgeschoss")
+	other := h.createFloor("obergeschoss")
+
+	shutter := &model.Shutter{}
+	h.mustDo("POST", fmt.Sprintf("/api/v1/floors/%d/shutters", floor.ID), shutterBody(other.ID, 17, 27), http.StatusCreated, shutter)
+	if *shutter.FloorID != floor.ID {
+		t.Errorf("Expected the shutter on floor %d of the route but it is on %d", floor.ID, *shutter.FloorID)
+	}
+	if calls := h.controller.reset(); !reflect.DeepEqual(calls, []string{fmt.Sprintf("RegisterShutters(%d)", shutter.ID)}) {
+		t.Errorf("Expected the shutter to be registered but got %v", calls)
+	}
+
+	shutters := []*model.Shutter{}
+	h.mustDo("GET", fmt.Sprintf("/api/v1/floors/%d/shutters", other.ID), nil, http.StatusOK, &shutters)
+	if len(shutters) != 0 {
+		t.Errorf("Expected no shutters on the other floor but got %d", len(shutters))
+	}
+}
+
+func TestControlDisabledShutter(t *testing.T) {
+	h := newHarness(t)
+	defer h.close()
+
+	floor := h.createFloor("erdgeschoss")
+	shutter := h.createShutter(floor.ID, 17, 27)
+	path := fmt.Sprintf("/api/v1/shutters/%d", shutter.ID)
+	h.mustDo("PUT", path, map[string]interface{}{"disabled": true}, http.StatusOK, nil)
+	h.controller.reset()
+
+	h.mustDo("POST", path+"/open", nil, http.StatusBadRequest, nil)
+	if calls := h.controller.reset(); len(calls) != 0 {
+		t.Errorf("Expected no controller calls for a disabled shutter but got %v", calls)
+	}
+}
+
+func TestShutterFault(t *testing.T) {
+	h := newHarness(t)
+	defer h.close()
+
+	floor := h.createFloor("erdgeschoss")
+	shutter := h.createShutter(floor.ID, 17, 27)
+	path := fmt.Sprintf("/api/v1/shutters/%d", shutter.ID)
+	fault := &model.DeviceFault{Message: "Could not stop the run: relay stuck", Time: time.Date(2017, 10, 2, 7, 30, 0, 0, time.UTC)}
+	if err := h.store.UpdateShutterFault(shutter.ID, fault); err != nil {
+		t.Fatal(err)
+	}
+
+	// the fault and the state are part of the shutter and are not changed by an update, only a reset clears them
+	for _, method := range []string{"PUT", "PATCH"} {
+		got := &model.Shutter{}
+		h.mustDo(method, path, map[string]interface{}{"fault": nil, "deviceStatus": "opened", "openingInPrc": 50}, http.StatusOK, got)
+		if got.DeviceStatus != model.DeviceStatusFault || got.OpeningInPrc != 0 || got.Fault == nil ||
+			got.Fault.Message != fault.Message || !got.Fault.Time.Equal(fault.Time) {
+			t.Errorf("%s: expected the fault of the shutter but got %+v", method, got)
+		}
+	}
+	h.controller.reset()
+
+	command := &model.Command{}
+	h.mustDo("POST", path+"/reset", nil, http.StatusAccepted, command)
+	if command.Action != "reset" || command.Priority != model.CommandPriorityHigh {
+		t.Errorf("Expected an urgent reset command but got %+v", command)
+	}
+	if calls := h.controller.reset(); !reflect.DeepEqual(calls, []string{fmt.Sprintf("ResetShutter(%d)", shutter.ID)}) {
+		t.Errorf("Expected the shutter to be reset but got %v", calls)
+	}
+}
+
+func TestShutterControllerFailure(t *testing.T) {
+	h := newHarness(t)
+	defer h.close()
+
+	floor := h.createFloor("erdgeschoss")
+	shutter := h.createShutter(floor.ID, 17, 27)
+	h.controller.failing["OpenShutter"] = true
+
+	h.mustDo("POST", fmt.Sprintf("/api/v1/shutters/%d/open", shutter.ID), nil, http.StatusInternalServerError, nil)
+}
+
+func TestShutterCompleteWayWithinWatchdog(t *testing.T) {
+	h := newHarness(t)
+	defer h.close()
+
+	floor := h.createFloor("erdgeschoss")
+	shutter := h.createShutter(floor.ID, 17, 27)
+	h.controller.maxCompleteWay = time.Minute
+	h.controller.reset()
+
+	body := shutterBody(floor.ID, 22, 23)
+	body["completeWayInSeconds"] = 90
+	for _, test := range []struct {
+		method, path string
+	}{
+		{"POST", "/api/v1/shutters"},
+		{"PUT", fmt.Sprintf("/api/v1/shutters/%d", shutter.ID)},
+		{"PATCH", fmt.Sprintf("/api/v1/shutters/%d", shutter.ID)},
+	} {
+		resp := &validationResponse{}
+		h.mustDo(test.method, test.path, body, http.StatusUnprocessableEntity, resp)
+		if len(resp.Fields) != 1 || resp.Fields[0].Field != "completeWayInSeconds" || resp.Fields[0].AppCode != AppCodeOutOfRange {
+			t.Errorf("%s: expected the complete way to be out of range but got %v", test.method, resp.Fields)
+		}
+	}
+	if calls := h.controller.reset(); len(calls) != 0 {
+		t.Errorf("Expected no calls of the device controller but got %v", calls)
+	}
+}
+
+func TestDeleteShutter(t *testing.T) {
+	h := newHarness(t)
+	defer h.close()
+
+	floor := h.createFloor("erdgeschoss")
+	shutter := h.createShutter(floor.ID, 17, 27)
+	path := fmt.Sprintf("/api/v1/floors/%d/shutters/%d", floor.ID, shutter.ID)
+	h.controller.reset()
+
+	h.mustDo("DELETE", path, nil, http.StatusNoContent, nil)
+	if calls := h.controller.reset(); !reflect.DeepEqual(calls, []string{fmt.Sprintf("UnregisterShutter(%d)", shutter.ID)}) {
+		t.Errorf("Expected the shutter to be unregistered but got %v", calls)
+	}
+	h.mustDo("DELETE", path, nil, http.StatusNotFound, nil)
+
+	// the pins of the deleted shutter are free again
+	h.createShutter(floor.ID, 17, 27)
+}
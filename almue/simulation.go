@@ -0,0 +1,63 @@
+package almue
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi"
+	"github.com/go-chi/render"
+	"github.com/he4d/almue-backend/model"
+)
+
+type pinStatePayload struct {
+	*model.PinState
+}
+
+func (p *pinStatePayload) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+func (a *Almue) getSimulatedPins(w http.ResponseWriter, r *http.Request) {
+	simulator, ok := r.Context().Value(simulatorCtxKey).(Simulator)
+	if !ok {
+		a.logger.Error.Print("Simulator from context is not a simulator?")
+		return
+	}
+
+	pins, err := simulator.SimulatedPins()
+	if err != nil {
+		render.Render(w, r, ErrInternalServer(err))
+		a.logger.Error.Print(err)
+		return
+	}
+
+	list := []render.Renderer{}
+	for _, pin := range pins {
+		list = append(list, &pinStatePayload{PinState: pin})
+	}
+	if err := render.RenderList(w, r, list); err != nil {
+		render.Render(w, r, ErrRender(err))
+		a.logger.Error.Print(err)
+	}
+}
+
+func (a *Almue) injectPinLevel(w http.ResponseWriter, r *http.Request) {
+	simulator, ok := r.Context().Value(simulatorCtxKey).(Simulator)
+	if !ok {
+		a.logger.Error.Print("Simulator from context is not a simulator?")
+		return
+	}
+
+	pin, err := strconv.Atoi(chi.URLParam(r, "pin"))
+	if err != nil {
+		render.Render(w, r, ErrInvalidRequest(err))
+		return
+	}
+
+	if err := simulator.InjectPinLevel(pin, chi.URLParam(r, "level") == "high"); err != nil {
+		render.Render(w, r, ErrInvalidRequest(err))
+		a.logger.Info.Print(err)
+		return
+	}
+	render.NoContent(w, r)
+}
@@ -0,0 +1,77 @@
+package almue
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/he4d/almue-backend/model"
+)
+
+// simulatingController is a recording device controller with virtual pins
+type simulatingController struct {
+	*recordingController
+	simulating bool
+	pins       []*model.PinState
+}
+
+func (c *simulatingController) Simulating() bool {
+	return c.simulating
+}
+
+func (c *simulatingController) SimulatedPins() ([]*model.PinState, error) {
+	c.Lock()
+	defer c.Unlock()
+	return c.pins, nil
+}
+
+func (c *simulatingController) InjectPinLevel(number int, high bool) error {
+	c.Lock()
+	defer c.Unlock()
+	for _, pin := range c.pins {
+		if pin.Number == number {
+			if pin.Function != "In" {
+				return fmt.Errorf("Pin %d is an output and can not be driven from the outside", number)
+			}
+			pin.High = high
+			pin.History = append(pin.History, &model.PinEvent{Time: time.Date(2017, 10, 2, 6, 0, 0, 0, time.UTC), High: high, Injected: true})
+			return nil
+		}
+	}
+	return fmt.Errorf("Pin %d is not used by any device", number)
+}
+
+func TestSimulationRoutes(t *testing.T) {
+	h := newHarness(t)
+	defer h.close()
+
+	simulator := &simulatingController{recordingController: h.controller, simulating: true, pins: []*model.PinState{
+		{Number: 4, Name: "stop", Function: "In", History: []*model.PinEvent{}},
+		{Number: 17, Name: "kueche", Function: "Out", History: []*model.PinEvent{}},
+	}}
+	h.app.deviceController = simulator
+
+	h.mustDo("POST", "/api/v1/simulation/pins/4/high", nil, http.StatusNoContent, nil)
+	h.mustDo("POST", "/api/v1/simulation/pins/17/high", nil, http.StatusBadRequest, nil)
+	h.mustDo("POST", "/api/v1/simulation/pins/22/low", nil, http.StatusBadRequest, nil)
+	h.mustDo("POST", "/api/v1/simulation/pins/4/up", nil, http.StatusNotFound, nil)
+
+	pins := []*model.PinState{}
+	h.mustDo("GET", "/api/v1/simulation/pins", nil, http.StatusOK, &pins)
+	expected := []*model.PinState{
+		{Number: 4, Name: "stop", Function: "In", High: true, History: []*model.PinEvent{
+			{Time: time.Date(2017, 10, 2, 6, 0, 0, 0, time.UTC), High: true, Injected: true},
+		}},
+		{Number: 17, Name: "kueche", Function: "Out", History: []*model.PinEvent{}},
+	}
+	if !reflect.DeepEqual(pins, expected) {
+		t.Errorf("Expected the pins %+v but got %+v", expected, pins)
+	}
+
+	// a controller that can simulate but runs on real gpio pins has no simulation routes
+	simulator.simulating = false
+	h.mustDo("GET", "/api/v1/simulation/pins", nil, http.StatusNotFound, nil)
+	h.mustDo("POST", "/api/v1/simulation/pins/4/low", nil, http.StatusNotFound, nil)
+}
@@ -0,0 +1,79 @@
+package almue
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/go-chi/chi"
+	"github.com/go-chi/render"
+	"github.com/he4d/almue-backend/model"
+)
+
+type tagPayload struct {
+	*model.Tag
+}
+
+func (t *tagPayload) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+func newTagListPayloadResponse(tags []*model.Tag) []render.Renderer {
+	list := []render.Renderer{}
+	for _, tag := range tags {
+		list = append(list, &tagPayload{Tag: tag})
+	}
+	return list
+}
+
+// getAllTags lists all tags that are used by at least one device
+// together with the number of shutters and lightings carrying them
+func (a *Almue) getAllTags(w http.ResponseWriter, r *http.Request) {
+	tags, err := a.store.GetTagList()
+	if err != nil {
+		render.Render(w, r, ErrInternalServer(err))
+		a.logger.Error.Print(err)
+		return
+	}
+
+	if err := render.RenderList(w, r, newTagListPayloadResponse(tags)); err != nil {
+		render.Render(w, r, ErrRender(err))
+		a.logger.Error.Print(err)
+	}
+}
+
+// controlTag runs the action on all enabled devices carrying the tag
+func (a *Almue) controlTag(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "tagName")
+	// the router matches the escaped path if the tag contains escaped characters
+	if r.URL.RawPath != "" {
+		unescaped, err := url.PathUnescape(name)
+		if err != nil {
+			render.Render(w, r, ErrInvalidRequest(err))
+			a.logger.Error.Print(err)
+			return
+		}
+		name = unescaped
+	}
+
+	tags, err := a.store.GetTagList()
+	if err != nil {
+		render.Render(w, r, ErrInternalServer(err))
+		a.logger.Error.Print(err)
+		return
+	}
+	found := false
+	for _, tag := range tags {
+		if tag.Name == name {
+			found = true
+			break
+		}
+	}
+	if !found {
+		render.Render(w, r, ErrNotFound)
+		return
+	}
+
+	enabled := false
+	a.controlGroup(w, r, fmt.Sprintf("tag %q", name), &model.ListOptions{Tag: name, Disabled: &enabled})
+}
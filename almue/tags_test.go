@@ -0,0 +1,107 @@
+package almue
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/he4d/almue-backend/model"
+)
+
+func TestDeviceTags(t *testing.T) {
+	h := newHarness(t)
+	defer h.close()
+
+	floor := h.createFloor("erdgeschoss")
+	body := shutterBody(floor.ID, 17, 27)
+	body["tags"] = []string{"south", "bedrooms", "south"}
+	shutter := &model.Shutter{}
+	h.mustDo("POST", "/api/v1/shutters", body, http.StatusCreated, shutter)
+	if !reflect.DeepEqual(shutter.Tags, []string{"bedrooms", "south"}) {
+		t.Errorf("Expected the sorted tags without duplicates but got %v", shutter.Tags)
+	}
+	untagged := h.createShutter(floor.ID, 5, 6)
+	if untagged.Tags == nil || len(untagged.Tags) != 0 {
+		t.Errorf("Expected an empty list of tags but got %v", untagged.Tags)
+	}
+
+	shutters := []*model.Shutter{}
+	h.mustDo("GET", "/api/v1/shutters?tag=south", nil, http.StatusOK, &shutters)
+	if len(shutters) != 1 || shutters[0].ID != shutter.ID {
+		t.Errorf("Expected only the tagged shutter but got %v", shutters)
+	}
+
+	tags := []*model.Tag{}
+	h.mustDo("GET", "/api/v1/tags", nil, http.StatusOK, &tags)
+	if len(tags) != 2 || tags[0].Name != "bedrooms" || tags[1].Name != "south" || tags[1].Shutters != 1 {
+		t.Errorf("Expected the tags of the shutter but got %v", tags)
+	}
+
+	tests := []struct {
+		name string
+		tags []string
+	}{
+		{"empty", []string{""}},
+		{"blank", []string{" "}},
+		{"slash", []string{"south/west"}},
+		{"too long", []string{string(make([]byte, maxTagLength+1))}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			body := lightingBody(floor.ID, 4)
+			body["tags"] = test.tags
+			rec := h.do("POST", "/api/v1/lightings", body)
+			if rec.Code != http.StatusUnprocessableEntity {
+				t.Errorf("Expected status 422 for the tags %q but got %d: %s", test.tags, rec.Code, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestControlTag(t *testing.T) {
+	h := newHarness(t)
+	defer h.close()
+
+	floor := h.createFloor("erdgeschoss")
+	otherFloor := h.createFloor("obergeschoss")
+	shutters := []*model.Shutter{}
+	for i, floorID := range []int64{floor.ID, otherFloor.ID, floor.ID} {
+		body := shutterBody(floorID, 2*i+5, 2*i+6)
+		body["tags"] = []string{"süd"}
+		body["disabled"] = i == 2
+		shutter := &model.Shutter{}
+		h.mustDo("POST", "/api/v1/shutters", body, http.StatusCreated, shutter)
+		shutters = append(shutters, shutter)
+	}
+	body := lightingBody(floor.ID, 17)
+	body["tags"] = []string{"süd"}
+	lighting := &model.Lighting{}
+	h.mustDo("POST", "/api/v1/lightings", body, http.StatusCreated, lighting)
+	h.createShutter(floor.ID, 20, 21)
+	h.controller.reset()
+
+	h.mustDo("POST", "/api/v1/tags/s%C3%BCd/close", nil, http.StatusAccepted, nil)
+	expected := []string{fmt.Sprintf("CloseShutter(%d)", shutters[0].ID), fmt.Sprintf("CloseShutter(%d)", shutters[1].ID)}
+	if calls := h.controller.reset(); !reflect.DeepEqual(calls, expected) {
+		t.Errorf("Expected the enabled shutters with the tag to be closed %v but got %v", expected, calls)
+	}
+
+	h.mustDo("POST", "/api/v1/tags/süd/off", nil, http.StatusAccepted, nil)
+	expected = []string{fmt.Sprintf("TurnLightingOff(%d)", lighting.ID)}
+	if calls := h.controller.reset(); !reflect.DeepEqual(calls, expected) {
+		t.Errorf("Expected the lighting with the tag to be turned off %v but got %v", expected, calls)
+	}
+
+	if rec := h.do("POST", "/api/v1/tags/nord/close", nil); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for an unknown tag but got %d", rec.Code)
+	}
+	if rec := h.do("POST", "/api/v1/tags/süd/dim", nil); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for an unsupported action but got %d", rec.Code)
+	}
+
+	h.controller.failing["OpenShutter"] = true
+	if rec := h.do("POST", "/api/v1/tags/süd/open", nil); rec.Code != http.StatusInternalServerError {
+		t.Errorf("Expected status 500 if the shutters could not be opened but got %d", rec.Code)
+	}
+}
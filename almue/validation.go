@@ -0,0 +1,484 @@
+package almue
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/go-chi/render"
+	"github.com/he4d/almue-backend/model"
+)
+
+// Application specific error codes of a validation error response and its fields
+const (
+	AppCodeValidation    int64 = 1000 // the request body contains invalid fields
+	AppCodeRequired      int64 = 1001 // a required field is missing or empty
+	AppCodeOutOfRange    int64 = 1002 // a number or text is out of its allowed range
+	AppCodeInvalidTime   int64 = 1003 // a time is not in RFC 3339 format or not a time of day
+	AppCodeUnknownPin    int64 = 1004 // a pin does not exist or is reserved on the board
+	AppCodeUnknownFloor  int64 = 1005 // a referenced floor does not exist
+	AppCodeTimeOrder     int64 = 1006 // two times of a device are in the wrong order
+	AppCodeUnknownRoom   int64 = 1007 // a referenced room does not exist on the floor of the device
+	AppCodeInvalidTag    int64 = 1008 // a tag is empty, too long or contains a slash
+	AppCodeUnknownDevice int64 = 1009 // a referenced device does not exist or is disabled
+	AppCodeInvalidDate   int64 = 1010 // a date is not in the format 2006-01-02
+)
+
+const (
+	maxDescriptionLength    = 100
+	maxCompleteWayInSeconds = 600
+	maxTagLength            = 50
+	maxJitterMinutes        = 120
+	maxShiftMinutes         = 720
+)
+
+// fieldError describes why a single field of the request body is invalid
+type fieldError struct {
+	Field   string `json:"field"`
+	AppCode int64  `json:"code"`
+	Message string `json:"message"`
+}
+
+// fieldErrors collects all invalid fields of a request body
+type fieldErrors []*fieldError
+
+func (f fieldErrors) Error() string {
+	msgs := make([]string, 0, len(f))
+	for _, e := range f {
+		msgs = append(msgs, fmt.Sprintf("%s: %s", e.Field, e.Message))
+	}
+	return "Invalid fields: " + strings.Join(msgs, ", ")
+}
+
+func (f *fieldErrors) add(field string, code int64, format string, args ...interface{}) {
+	*f = append(*f, &fieldError{Field: field, AppCode: code, Message: fmt.Sprintf(format, args...)})
+}
+
+// errOrNil returns the field errors as error or nil if there are none.
+// This avoids returning a nil slice inside of a non nil error interface
+func (f fieldErrors) errOrNil() error {
+	if len(f) == 0 {
+		return nil
+	}
+	return f
+}
+
+type validationResponse struct {
+	*ErrResponse
+	Fields fieldErrors `json:"fields"`
+}
+
+//ErrValidation returns a 422 renderer listing all invalid fields
+func ErrValidation(fields fieldErrors) render.Renderer {
+	return &validationResponse{
+		ErrResponse: &ErrResponse{
+			Err:            fields,
+			HTTPStatusCode: 422,
+			StatusText:     "Validation failed.",
+			AppCode:        AppCodeValidation,
+			ErrorText:      fields.Error(),
+		},
+		Fields: fields,
+	}
+}
+
+// ErrBind returns the renderer for an error of render.Bind.
+// Invalid fields result in a 422 response, everything else in a 400 response
+func ErrBind(err error) render.Renderer {
+	if fields, ok := err.(fieldErrors); ok {
+		return ErrValidation(fields)
+	}
+	return ErrInvalidRequest(err)
+}
+
+// referenceChecker checks the references of a payload that can not be validated from the payload alone
+type referenceChecker interface {
+	checkPin(pin int) error
+	checkFloor(floorID int64) error
+	checkRoom(roomID, floorID int64) error
+	checkDevice(deviceType string, deviceID int64) error
+	checkCompleteWay(seconds int) error
+}
+
+func (a *Almue) checkPin(pin int) error {
+	return a.board.Validate(pin)
+}
+
+func (a *Almue) checkFloor(floorID int64) error {
+	if _, err := a.store.GetFloor(floorID); err != nil {
+		if err == model.ErrNotFound {
+			return fmt.Errorf("Floor %d does not exist", floorID)
+		}
+		return err
+	}
+	return nil
+}
+
+func (a *Almue) checkRoom(roomID, floorID int64) error {
+	room, err := a.store.GetRoom(roomID)
+	if err != nil {
+		if err == model.ErrNotFound {
+			return fmt.Errorf("Room %d does not exist", roomID)
+		}
+		return err
+	}
+	if *room.FloorID != floorID {
+		return fmt.Errorf("Room %d is not on the floor %d", roomID, floorID)
+	}
+	return nil
+}
+
+// checkDevice checks that the device exists and is enabled, so the device controller knows it
+func (a *Almue) checkDevice(deviceType string, deviceID int64) error {
+	var disabled bool
+	var err error
+	if deviceType == "shutter" {
+		var shutter *model.Shutter
+		if shutter, err = a.store.GetShutter(deviceID); err == nil {
+			disabled = shutter.Disabled
+		}
+	} else {
+		var lighting *model.Lighting
+		if lighting, err = a.store.GetLighting(deviceID); err == nil {
+			disabled = lighting.Disabled
+		}
+	}
+	if err == model.ErrNotFound {
+		return fmt.Errorf("The %s %d does not exist", deviceType, deviceID)
+	}
+	if err != nil {
+		return err
+	}
+	if disabled {
+		return fmt.Errorf("The %s %d is disabled", deviceType, deviceID)
+	}
+	return nil
+}
+
+// checkCompleteWay checks that the watchdog of the device controller does not stop a run over the complete way
+func (a *Almue) checkCompleteWay(seconds int) error {
+	return a.deviceController.CheckCompleteWay(time.Duration(seconds) * time.Second)
+}
+
+// checkTag checks that the tag can be used as a path segment of the tag routes
+func checkTag(tag string) error {
+	if strings.TrimSpace(tag) == "" {
+		return errors.New("A tag must not be empty")
+	}
+	if len(tag) > maxTagLength {
+		return fmt.Errorf("The tag %q is longer than %d characters", tag, maxTagLength)
+	}
+	if strings.Contains(tag, "/") {
+		return fmt.Errorf("The tag %q must not contain a slash", tag)
+	}
+	return nil
+}
+
+// checkTimeFields checks that the given fields of the json object are times in RFC 3339 format.
+// If the data is no json object nothing is checked, decoding it reports the error then
+func checkTimeFields(data []byte, fields ...string) fieldErrors {
+	errs := fieldErrors{}
+	raw := map[string]json.RawMessage{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return errs
+	}
+	for _, field := range fields {
+		value, ok := raw[field]
+		if !ok || string(value) == "null" {
+			continue
+		}
+		var t time.Time
+		if err := json.Unmarshal(value, &t); err != nil {
+			errs.add(field, AppCodeInvalidTime, "Must be a time in RFC 3339 format like 0000-01-01T07:30:00Z")
+		}
+	}
+	return errs
+}
+
+// validateDescription checks that the description is set and not too long
+func (f *fieldErrors) validateDescription(descr *string) {
+	if descr == nil || strings.TrimSpace(*descr) == "" {
+		f.add("description", AppCodeRequired, "Is required")
+		return
+	}
+	if len(*descr) > maxDescriptionLength {
+		f.add("description", AppCodeOutOfRange, "Must not be longer than %d characters", maxDescriptionLength)
+	}
+}
+
+// validatePin checks that the pin is set and exists on the board
+func (f *fieldErrors) validatePin(field string, pin *int, refs referenceChecker) {
+	if pin == nil {
+		f.add(field, AppCodeRequired, "Is required")
+		return
+	}
+	if refs == nil {
+		return
+	}
+	if err := refs.checkPin(*pin); err != nil {
+		f.add(field, AppCodeUnknownPin, "%v", err)
+	}
+}
+
+// validateFloor checks that the floor is set and exists
+func (f *fieldErrors) validateFloor(floorID *int64, refs referenceChecker) {
+	if floorID == nil {
+		f.add("floorId", AppCodeRequired, "Is required")
+		return
+	}
+	if refs == nil {
+		return
+	}
+	if err := refs.checkFloor(*floorID); err != nil {
+		f.add("floorId", AppCodeUnknownFloor, "%v", err)
+	}
+}
+
+// validateRoom checks that the optional room exists on the floor of the device
+func (f *fieldErrors) validateRoom(roomID, floorID *int64, refs referenceChecker) {
+	if roomID == nil || floorID == nil || refs == nil {
+		return
+	}
+	if err := refs.checkRoom(*roomID, *floorID); err != nil {
+		f.add("roomId", AppCodeUnknownRoom, "%v", err)
+	}
+}
+
+// validateTags checks that all tags can be used in the tag routes
+func (f *fieldErrors) validateTags(tags []string) {
+	for _, tag := range tags {
+		if err := checkTag(tag); err != nil {
+			f.add("tags", AppCodeInvalidTag, "%v", err)
+		}
+	}
+}
+
+// validateTimeOfDay checks that the time only consists of hours and minutes,
+// as the jobs of a device are scheduled daily. If required it must not be the zero time
+func (f *fieldErrors) validateTimeOfDay(field string, t time.Time, required bool) {
+	if t.IsZero() {
+		if required {
+			f.add(field, AppCodeRequired, "Is required if the jobs are enabled")
+		}
+		return
+	}
+	if t.Second() != 0 || t.Nanosecond() != 0 {
+		f.add(field, AppCodeInvalidTime, "Must not contain seconds, the jobs are scheduled by hour and minute")
+	}
+}
+
+// minutesOfDay returns the minutes since midnight of the given time
+func minutesOfDay(t time.Time) int {
+	return t.Hour()*60 + t.Minute()
+}
+
+func (s *shutterPayload) UnmarshalJSON(data []byte) error {
+	s.timeErrs = checkTimeFields(data, "openTime", "closeTime")
+	if len(s.timeErrs) > 0 {
+		return nil
+	}
+	if s.Shutter == nil {
+		s.Shutter = &model.Shutter{}
+	}
+	return json.Unmarshal(data, s.Shutter)
+}
+
+func (s *shutterPayload) validate() fieldErrors {
+	errs := fieldErrors{}
+	errs.validateDescription(s.Description)
+	errs.validatePin("openPin", s.OpenPin, s.refs)
+	errs.validatePin("closePin", s.ClosePin, s.refs)
+	if s.CompleteWayInSeconds == nil {
+		errs.add("completeWayInSeconds", AppCodeRequired, "Is required")
+	} else if *s.CompleteWayInSeconds < 1 || *s.CompleteWayInSeconds > maxCompleteWayInSeconds {
+		errs.add("completeWayInSeconds", AppCodeOutOfRange, "Must be between 1 and %d", maxCompleteWayInSeconds)
+	} else if s.refs != nil {
+		if err := s.refs.checkCompleteWay(*s.CompleteWayInSeconds); err != nil {
+			errs.add("completeWayInSeconds", AppCodeOutOfRange, "%v", err)
+		}
+	}
+	if s.OpeningInPrc < 0 || s.OpeningInPrc > 100 {
+		errs.add("openingInPrc", AppCodeOutOfRange, "Must be between 0 and 100")
+	}
+	errs.validateTimeOfDay("openTime", s.OpenTime, s.JobsEnabled)
+	errs.validateTimeOfDay("closeTime", s.CloseTime, s.JobsEnabled)
+	if s.JobsEnabled && !s.OpenTime.IsZero() && !s.CloseTime.IsZero() &&
+		minutesOfDay(s.CloseTime) <= minutesOfDay(s.OpenTime) {
+		errs.add("closeTime", AppCodeTimeOrder, "Must be after the openTime")
+	}
+	errs.validateFloor(s.FloorID, s.refs)
+	errs.validateRoom(s.RoomID, s.FloorID, s.refs)
+	errs.validateTags(s.Tags)
+	return errs
+}
+
+func (l *lightingPayload) UnmarshalJSON(data []byte) error {
+	l.timeErrs = checkTimeFields(data, "onTime", "offTime")
+	if len(l.timeErrs) > 0 {
+		return nil
+	}
+	if l.Lighting == nil {
+		l.Lighting = &model.Lighting{}
+	}
+	return json.Unmarshal(data, l.Lighting)
+}
+
+func (l *lightingPayload) validate() fieldErrors {
+	errs := fieldErrors{}
+	errs.validateDescription(l.Description)
+	errs.validatePin("switchPin", l.SwitchPin, l.refs)
+	errs.validateTimeOfDay("onTime", l.OnTime, l.JobsEnabled)
+	errs.validateTimeOfDay("offTime", l.OffTime, l.JobsEnabled)
+	// a lighting may be switched off after midnight so only the same time is invalid
+	if l.JobsEnabled && !l.OnTime.IsZero() && !l.OffTime.IsZero() &&
+		minutesOfDay(l.OffTime) == minutesOfDay(l.OnTime) {
+		errs.add("offTime", AppCodeTimeOrder, "Must differ from the onTime")
+	}
+	errs.validateFloor(l.FloorID, l.refs)
+	errs.validateRoom(l.RoomID, l.FloorID, l.refs)
+	errs.validateTags(l.Tags)
+	return errs
+}
+
+func (f *floorPayload) validate() fieldErrors {
+	errs := fieldErrors{}
+	errs.validateDescription(f.Description)
+	return errs
+}
+
+func (r *roomPayload) validate() fieldErrors {
+	errs := fieldErrors{}
+	errs.validateDescription(r.Description)
+	return errs
+}
+
+func (p *presencePayload) validate() fieldErrors {
+	errs := fieldErrors{}
+	if len(p.Shutters) == 0 && len(p.Lightings) == 0 {
+		errs.add("lightings", AppCodeRequired, "At least one shutter or lighting is required")
+	}
+	for _, id := range p.Shutters {
+		if err := p.refs.checkDevice("shutter", id); err != nil {
+			errs.add("shutters", AppCodeUnknownDevice, "%v", err)
+		}
+	}
+	for _, id := range p.Lightings {
+		if err := p.refs.checkDevice("lighting", id); err != nil {
+			errs.add("lightings", AppCodeUnknownDevice, "%v", err)
+		}
+	}
+	if p.Profile != model.PresenceProfileHistory && p.Profile != model.PresenceProfileRandom {
+		errs.add("profile", AppCodeOutOfRange, "Must be %s or %s", model.PresenceProfileHistory, model.PresenceProfileRandom)
+	}
+	if p.JitterMinutes < 0 || p.JitterMinutes > maxJitterMinutes {
+		errs.add("jitterMinutes", AppCodeOutOfRange, "Must be between 0 and %d", maxJitterMinutes)
+	}
+	return errs
+}
+
+func (p *calendarExceptionPayload) validate() fieldErrors {
+	errs := fieldErrors{}
+	errs.validateDescription(p.Description)
+	start := errs.validateDate("startDate", p.StartDate, true)
+	end := errs.validateDate("endDate", p.EndDate, false)
+	if !start.IsZero() && !end.IsZero() && end.Before(start) {
+		errs.add("endDate", AppCodeTimeOrder, "Must not be before the startDate")
+	}
+	errs.validateCalendarRule(p.CalendarException, p.refs)
+	return errs
+}
+
+func (p *calendarImportPayload) validate() fieldErrors {
+	errs := fieldErrors{}
+	if p.File == "" {
+		errs.add("file", AppCodeRequired, "Is required")
+	} else if filepath.Base(p.File) != p.File || p.File == ".." || filepath.Ext(p.File) != ".ics" {
+		errs.add("file", AppCodeOutOfRange, "Must be the name of an .ics file in the calendar directory")
+	}
+	errs.validateCalendarRule(p.CalendarException, p.refs)
+	return errs
+}
+
+// validateDate checks that the date is in the format of model.DateFormat and returns it.
+// The zero time is returned for a missing or invalid date
+func (f *fieldErrors) validateDate(field, date string, required bool) time.Time {
+	if date == "" {
+		if required {
+			f.add(field, AppCodeRequired, "Is required")
+		}
+		return time.Time{}
+	}
+	t, err := time.Parse(model.DateFormat, date)
+	if err != nil {
+		f.add(field, AppCodeInvalidDate, "Must be a date like %s", model.DateFormat)
+	}
+	return t
+}
+
+// validateCalendarRule checks what the calendar exception does and to which jobs and devices it applies
+func (f *fieldErrors) validateCalendarRule(e *model.CalendarException, refs referenceChecker) {
+	switch e.Action {
+	case model.CalendarSkip:
+		if e.ShiftMinutes != 0 {
+			f.add("shiftMinutes", AppCodeOutOfRange, "Must be 0 if the jobs are skipped")
+		}
+	case model.CalendarShift:
+		if e.ShiftMinutes < 1 || e.ShiftMinutes > maxShiftMinutes {
+			f.add("shiftMinutes", AppCodeOutOfRange, "Must be between 1 and %d", maxShiftMinutes)
+		}
+	default:
+		f.add("action", AppCodeOutOfRange, "Must be %s or %s", model.CalendarSkip, model.CalendarShift)
+	}
+	for _, job := range e.Jobs {
+		switch job {
+		case model.JobOpen, model.JobClose, model.JobOn, model.JobOff:
+		default:
+			f.add("jobs", AppCodeOutOfRange, "The job %q must be %s, %s, %s or %s", job,
+				model.JobOpen, model.JobClose, model.JobOn, model.JobOff)
+		}
+	}
+	if e.AllDevices {
+		if len(e.Shutters) > 0 || len(e.Lightings) > 0 {
+			f.add("allDevices", AppCodeOutOfRange, "Must not be combined with shutters or lightings")
+		}
+		return
+	}
+	if len(e.Shutters) == 0 && len(e.Lightings) == 0 {
+		f.add("lightings", AppCodeRequired, "At least one shutter or lighting is required unless allDevices is set")
+	}
+	if refs == nil {
+		return
+	}
+	for _, id := range e.Shutters {
+		if err := refs.checkDevice("shutter", id); err != nil {
+			f.add("shutters", AppCodeUnknownDevice, "%v", err)
+		}
+	}
+	for _, id := range e.Lightings {
+		if err := refs.checkDevice("lighting", id); err != nil {
+			f.add("lightings", AppCodeUnknownDevice, "%v", err)
+		}
+	}
+}
+
+// floorFromContext returns the id of the floor of the route if there is one
+func floorFromContext(r *http.Request) (*int64, bool) {
+	floor, ok := r.Context().Value(floorCtxKey).(*model.Floor)
+	if !ok {
+		return nil, false
+	}
+	return &floor.ID, true
+}
+
+// roomFromContext returns the id of the room of the route if there is one
+func roomFromContext(r *http.Request) (*int64, bool) {
+	room, ok := r.Context().Value(roomCtxKey).(*model.Room)
+	if !ok {
+		return nil, false
+	}
+	return &room.ID, true
+}
@@ -0,0 +1,102 @@
+package almue
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestValidation(t *testing.T) {
+	h := newHarness(t)
+	defer h.close()
+
+	floor := h.createFloor("erdgeschoss")
+	shutter := h.createShutter(floor.ID, 17, 27)
+	lighting := h.createLighting(floor.ID, 4)
+
+	withShutter := func(changes map[string]interface{}) map[string]interface{} {
+		body := shutterBody(floor.ID, 22, 23)
+		for k, v := range changes {
+			body[k] = v
+		}
+		return body
+	}
+	withLighting := func(changes map[string]interface{}) map[string]interface{} {
+		body := lightingBody(floor.ID, 24)
+		for k, v := range changes {
+			body[k] = v
+		}
+		return body
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   interface{}
+		fields map[string]int64
+	}{
+		{"floor without description", "POST", "/api/v1/floors", map[string]interface{}{},
+			map[string]int64{"description": AppCodeRequired}},
+		{"floor with blank description", "PUT", fmt.Sprintf("/api/v1/floors/%d", floor.ID), map[string]interface{}{"description": "  "},
+			map[string]int64{"description": AppCodeRequired}},
+		{"shutter without anything", "POST", "/api/v1/shutters", map[string]interface{}{},
+			map[string]int64{"description": AppCodeRequired, "openPin": AppCodeRequired, "closePin": AppCodeRequired,
+				"completeWayInSeconds": AppCodeRequired, "floorId": AppCodeRequired}},
+		{"shutter with negative way", "POST", "/api/v1/shutters", withShutter(map[string]interface{}{"completeWayInSeconds": -5}),
+			map[string]int64{"completeWayInSeconds": AppCodeOutOfRange}},
+		{"shutter with opening over 100", "POST", "/api/v1/shutters", withShutter(map[string]interface{}{"openingInPrc": 105}),
+			map[string]int64{"openingInPrc": AppCodeOutOfRange}},
+		{"shutter with unknown pin", "POST", "/api/v1/shutters", withShutter(map[string]interface{}{"openPin": 99}),
+			map[string]int64{"openPin": AppCodeUnknownPin}},
+		{"shutter on unknown floor", "POST", "/api/v1/shutters", withShutter(map[string]interface{}{"floorId": 999}),
+			map[string]int64{"floorId": AppCodeUnknownFloor}},
+		{"shutter with invalid time", "POST", "/api/v1/shutters", withShutter(map[string]interface{}{"openTime": "7:30"}),
+			map[string]int64{"openTime": AppCodeInvalidTime}},
+		{"shutter with seconds", "POST", "/api/v1/shutters", withShutter(map[string]interface{}{"closeTime": "0000-01-01T20:00:30Z"}),
+			map[string]int64{"closeTime": AppCodeInvalidTime}},
+		{"shutter jobs without times", "POST", "/api/v1/shutters",
+			withShutter(map[string]interface{}{"jobsEnabled": true, "openTime": nil, "closeTime": nil}),
+			map[string]int64{"openTime": AppCodeRequired, "closeTime": AppCodeRequired}},
+		{"shutter closing before opening", "POST", "/api/v1/shutters",
+			withShutter(map[string]interface{}{"jobsEnabled": true, "closeTime": "0000-01-01T06:00:00Z"}),
+			map[string]int64{"closeTime": AppCodeTimeOrder}},
+		{"shutter update removing pin", "PUT", fmt.Sprintf("/api/v1/shutters/%d", shutter.ID), map[string]interface{}{"closePin": nil},
+			map[string]int64{"closePin": AppCodeRequired}},
+		{"lighting without anything", "POST", "/api/v1/lightings", map[string]interface{}{},
+			map[string]int64{"description": AppCodeRequired, "switchPin": AppCodeRequired, "floorId": AppCodeRequired}},
+		{"lighting with reserved pin", "POST", "/api/v1/lightings", withLighting(map[string]interface{}{"switchPin": 14}),
+			map[string]int64{"switchPin": AppCodeUnknownPin}},
+		{"lighting with same times", "POST", "/api/v1/lightings",
+			withLighting(map[string]interface{}{"jobsEnabled": true, "offTime": "0000-01-01T18:00:00Z"}),
+			map[string]int64{"offTime": AppCodeTimeOrder}},
+		{"lighting update on unknown floor", "PUT", fmt.Sprintf("/api/v1/lightings/%d", lighting.ID), map[string]interface{}{"floorId": 999},
+			map[string]int64{"floorId": AppCodeUnknownFloor}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resp := &validationResponse{ErrResponse: &ErrResponse{}}
+			h.mustDo(test.method, test.path, test.body, http.StatusUnprocessableEntity, resp)
+			if resp.AppCode != AppCodeValidation {
+				t.Errorf("Expected the app code %d but got %d", AppCodeValidation, resp.AppCode)
+			}
+			got := map[string]int64{}
+			for _, field := range resp.Fields {
+				got[field.Field] = field.AppCode
+			}
+			for field, code := range test.fields {
+				if got[field] != code {
+					t.Errorf("Expected the code %d for field %s but got %d", code, field, got[field])
+				}
+			}
+			if len(got) != len(test.fields) {
+				t.Errorf("Expected the invalid fields %v but got %v", test.fields, got)
+			}
+		})
+	}
+
+	// a nested route sets the floor so it is not required in the body
+	h.mustDo("POST", fmt.Sprintf("/api/v1/floors/%d/lightings", floor.ID),
+		map[string]interface{}{"description": "flur", "switchPin": 24}, http.StatusCreated, nil)
+}
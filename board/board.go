@@ -0,0 +1,135 @@
+package board
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Pin describes a single gpio pin of a board
+type Pin struct {
+	Number   int    `json:"number"`
+	Name     string `json:"name"`
+	Reserved bool   `json:"reserved"`
+	PWM      bool   `json:"pwm"`
+}
+
+// Profile describes which gpio pins a board offers and what they are capable of
+type Profile struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Pins        []*Pin `json:"pins"`
+}
+
+// DefaultProfile is the name of the profile that is used if no profile is configured
+const DefaultProfile = "rpi3"
+
+var profiles = map[string]*Profile{
+	"rpi1":    newProfile("rpi1", "Raspberry Pi 1 Model B (26 pin header)", rpi1Pins, []int{14, 15}, []int{18}),
+	"rpi2":    newProfile("rpi2", "Raspberry Pi 2 Model B (40 pin header)", headerPins(27), []int{0, 1, 14, 15}, []int{12, 13, 18, 19}),
+	"rpi3":    newProfile("rpi3", "Raspberry Pi 3 Model B/B+ (40 pin header)", headerPins(27), []int{0, 1, 14, 15}, []int{12, 13, 18, 19}),
+	"rpi4":    newProfile("rpi4", "Raspberry Pi 4 Model B (40 pin header)", headerPins(27), []int{0, 1, 14, 15}, []int{12, 13, 18, 19}),
+	"generic": newProfile("generic", "Generic board without reserved pins", headerPins(53), nil, nil),
+}
+
+// rpi1Pins are the gpio pins (BCM numbering) of the 26 pin header of revision 2 boards
+var rpi1Pins = []int{2, 3, 4, 7, 8, 9, 10, 11, 14, 15, 17, 18, 22, 23, 24, 25, 27}
+
+// Get returns the profile with the given name
+func Get(name string) (*Profile, error) {
+	profile, ok := profiles[name]
+	if !ok {
+		return nil, fmt.Errorf("Unknown board profile %q, available profiles are %v", name, Names())
+	}
+	return profile, nil
+}
+
+// Names returns the names of all available profiles
+func Names() []string {
+	names := []string{}
+	for name := range profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Pin returns the pin with the given number or nil if the board has no such pin
+func (p *Profile) Pin(number int) *Pin {
+	for _, pin := range p.Pins {
+		if pin.Number == number {
+			return pin
+		}
+	}
+	return nil
+}
+
+// Validate returns an error if the pin with the given number
+// does not exist on the board or is reserved
+func (p *Profile) Validate(number int) error {
+	pin := p.Pin(number)
+	if pin == nil {
+		return fmt.Errorf("Pin %d does not exist on board %s", number, p.Name)
+	}
+	if pin.Reserved {
+		return fmt.Errorf("Pin %d is reserved on board %s", number, p.Name)
+	}
+	return nil
+}
+
+// Reserve returns a copy of the profile on which the pin with the given number is reserved
+// for the given use, so that no device can use it
+func (p *Profile) Reserve(number int, use string) (*Profile, error) {
+	if err := p.Validate(number); err != nil {
+		return nil, err
+	}
+	reserved := &Profile{Name: p.Name, Description: p.Description}
+	for _, pin := range p.Pins {
+		copied := *pin
+		if copied.Number == number {
+			copied.Reserved = true
+			copied.Name = fmt.Sprintf("%s (%s)", pin.Name, use)
+		}
+		reserved.Pins = append(reserved.Pins, &copied)
+	}
+	return reserved, nil
+}
+
+// Available returns the numbers of all pins that are not reserved
+func (p *Profile) Available() []int {
+	available := []int{}
+	for _, pin := range p.Pins {
+		if !pin.Reserved {
+			available = append(available, pin.Number)
+		}
+	}
+	return available
+}
+
+func newProfile(name, description string, numbers, reserved, pwm []int) *Profile {
+	contains := func(list []int, number int) bool {
+		for _, n := range list {
+			if n == number {
+				return true
+			}
+		}
+		return false
+	}
+	profile := &Profile{Name: name, Description: description}
+	for _, number := range numbers {
+		profile.Pins = append(profile.Pins, &Pin{
+			Number:   number,
+			Name:     fmt.Sprintf("GPIO%d", number),
+			Reserved: contains(reserved, number),
+			PWM:      contains(pwm, number),
+		})
+	}
+	return profile
+}
+
+func headerPins(last int) []int {
+	pins := []int{}
+	for i := 0; i <= last; i++ {
+		pins = append(pins, i)
+	}
+	return pins
+}
@@ -0,0 +1,63 @@
+package board
+
+import "testing"
+
+func TestGetUnknownProfile(t *testing.T) {
+	if _, err := Get("rpi0"); err == nil {
+		t.Error("Expected an error on getting an unknown profile")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	profile, err := Get("rpi3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := profile.Validate(17); err != nil {
+		t.Errorf("Expected pin 17 to be valid: %v", err)
+	}
+	if err := profile.Validate(14); err == nil {
+		t.Error("Expected an error on validating the reserved uart pin 14")
+	}
+	if err := profile.Validate(40); err == nil {
+		t.Error("Expected an error on validating a pin that does not exist")
+	}
+	if pin := profile.Pin(18); pin == nil || !pin.PWM {
+		t.Error("Expected pin 18 to be pwm capable")
+	}
+}
+
+func TestAvailable(t *testing.T) {
+	profile, err := Get("rpi1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, number := range profile.Available() {
+		if number == 14 || number == 15 {
+			t.Errorf("Reserved pin %d must not be available", number)
+		}
+	}
+}
+
+func TestReserve(t *testing.T) {
+	profile, err := Get("rpi3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	reserved, err := profile.Reserve(4, "stop pin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := reserved.Validate(4); err == nil {
+		t.Error("Expected the reserved pin 4 to be invalid for devices")
+	}
+	if pin := reserved.Pin(4); pin == nil || pin.Name != "GPIO4 (stop pin)" {
+		t.Errorf("Expected the pin to name its use but got %+v", pin)
+	}
+	if err := profile.Validate(4); err != nil {
+		t.Errorf("Expected the original profile to stay unchanged: %v", err)
+	}
+	if _, err := profile.Reserve(14, "stop pin"); err == nil {
+		t.Error("Expected an error on reserving the already reserved pin 14")
+	}
+}
@@ -0,0 +1,215 @@
+// Package calendar reads the whole day events of iCalendar files, e.g. the public holidays,
+// so that they can be imported as calendar exceptions
+package calendar
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/he4d/almue-backend/model"
+)
+
+// Event is a whole day event of an iCalendar file.
+// The dates are in the format of model.DateFormat, the end date is included
+type Event struct {
+	Summary   string
+	StartDate string
+	EndDate   string
+}
+
+// ParseICS reads the events of an iCalendar file. The times of events that are
+// no whole day events are dropped, such events cover the days they touch.
+// Events that recur yearly are repeated up to the until date, other recurrences are not supported
+func ParseICS(r io.Reader, until time.Time) ([]*Event, error) {
+	lines, err := unfold(r)
+	if err != nil {
+		return nil, err
+	}
+
+	events := []*Event{}
+	var current *vevent
+	for i, line := range lines {
+		name, params, value := splitProperty(line)
+		switch {
+		case name == "BEGIN" && value == "VEVENT":
+			current = &vevent{line: i + 1}
+		case name == "END" && value == "VEVENT":
+			if current == nil {
+				return nil, fmt.Errorf("Line %d: END:VEVENT without BEGIN:VEVENT", i+1)
+			}
+			expanded, err := current.expand(until)
+			if err != nil {
+				return nil, err
+			}
+			events = append(events, expanded...)
+			current = nil
+		case current == nil:
+			// the properties of the calendar and other components are not needed
+		case name == "SUMMARY":
+			current.summary = unescape(value)
+		case name == "DTSTART":
+			current.start, current.startIsDate, err = parseDate(params, value)
+			if err != nil {
+				return nil, fmt.Errorf("Line %d: %v", i+1, err)
+			}
+		case name == "DTEND":
+			current.end, current.endIsDate, err = parseDate(params, value)
+			if err != nil {
+				return nil, fmt.Errorf("Line %d: %v", i+1, err)
+			}
+			current.hasEnd = true
+		case name == "RRULE":
+			current.rrule = value
+		}
+	}
+	if current != nil {
+		return nil, fmt.Errorf("Line %d: BEGIN:VEVENT without END:VEVENT", current.line)
+	}
+	return events, nil
+}
+
+// vevent holds the properties of a VEVENT component while it gets parsed
+type vevent struct {
+	line        int
+	summary     string
+	start       time.Time
+	startIsDate bool
+	end         time.Time
+	endIsDate   bool
+	hasEnd      bool
+	rrule       string
+}
+
+// expand returns the event with all its recurrences up to the until date
+func (v *vevent) expand(until time.Time) ([]*Event, error) {
+	if v.start.IsZero() {
+		return nil, fmt.Errorf("Line %d: the event has no DTSTART", v.line)
+	}
+	// the end of an event is exclusive, so a whole day event ends the day before
+	days := 0
+	if v.hasEnd {
+		end := v.end
+		if v.endIsDate || (end.Hour() == 0 && end.Minute() == 0 && end.Second() == 0) {
+			end = end.AddDate(0, 0, -1)
+		}
+		for d := v.start; d.Before(end); d = d.AddDate(0, 0, 1) {
+			days++
+		}
+	}
+
+	count, interval := 1, 1
+	var last time.Time
+	if v.rrule != "" {
+		var err error
+		if count, interval, last, err = parseYearlyRule(v.rrule); err != nil {
+			return nil, fmt.Errorf("Line %d: %v", v.line, err)
+		}
+	}
+
+	events := []*Event{}
+	for n := 0; count == 0 || n < count; n++ {
+		start := v.start.AddDate(n*interval, 0, 0)
+		if n > 0 && (start.After(until) || (!last.IsZero() && start.After(last))) {
+			break
+		}
+		events = append(events, &Event{
+			Summary:   v.summary,
+			StartDate: start.Format(model.DateFormat),
+			EndDate:   start.AddDate(0, 0, days).Format(model.DateFormat),
+		})
+	}
+	return events, nil
+}
+
+// parseYearlyRule reads a recurrence rule that repeats an event every interval years.
+// A count of 0 repeats the event without limit, a zero last time has no end either
+func parseYearlyRule(rule string) (count, interval int, last time.Time, err error) {
+	interval = 1
+	yearly := false
+	for _, part := range strings.Split(rule, ";") {
+		kv := strings.SplitN(part, "=", 2)
+		if len(kv) != 2 {
+			return 0, 0, last, fmt.Errorf("Invalid recurrence rule %s", rule)
+		}
+		switch kv[0] {
+		case "FREQ":
+			yearly = kv[1] == "YEARLY"
+		case "COUNT", "INTERVAL":
+			n, err := strconv.Atoi(kv[1])
+			if err != nil || n < 1 {
+				return 0, 0, last, fmt.Errorf("Invalid %s in the recurrence rule %s", kv[0], rule)
+			}
+			if kv[0] == "COUNT" {
+				count = n
+			} else {
+				interval = n
+			}
+		case "UNTIL":
+			if last, _, err = parseDate("", kv[1]); err != nil {
+				return 0, 0, last, err
+			}
+		default:
+			return 0, 0, last, fmt.Errorf("Unsupported recurrence rule %s, only yearly events without further rules are supported", rule)
+		}
+	}
+	if !yearly {
+		return 0, 0, last, fmt.Errorf("Unsupported recurrence rule %s, only yearly events are supported", rule)
+	}
+	return count, interval, last, nil
+}
+
+// parseDate reads the date of a DATE or DATE-TIME value and tells if it was a date only
+func parseDate(params, value string) (time.Time, bool, error) {
+	if strings.Contains(params, "VALUE=DATE") && !strings.Contains(params, "VALUE=DATE-TIME") || len(value) == 8 {
+		t, err := time.Parse("20060102", value)
+		if err != nil {
+			return t, false, fmt.Errorf("Invalid date %s", value)
+		}
+		return t, true, nil
+	}
+	t, err := time.Parse("20060102T150405", strings.TrimSuffix(value, "Z"))
+	if err != nil {
+		return t, false, fmt.Errorf("Invalid date and time %s", value)
+	}
+	return t, false, nil
+}
+
+// unfold reads the lines of the file and joins the folded ones.
+// A line that starts with a space or a tab continues the previous line
+func unfold(r io.Reader) ([]string, error) {
+	lines := []string{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines, scanner.Err()
+}
+
+// splitProperty splits a content line into its upper case name, its parameters and its value
+func splitProperty(line string) (name, params, value string) {
+	colon := strings.Index(line, ":")
+	if colon < 0 {
+		return strings.ToUpper(line), "", ""
+	}
+	name, value = line[:colon], line[colon+1:]
+	if semicolon := strings.Index(name, ";"); semicolon >= 0 {
+		name, params = name[:semicolon], strings.ToUpper(name[semicolon+1:])
+	}
+	return strings.ToUpper(name), params, value
+}
+
+// unescape replaces the escaped characters of a text value
+func unescape(value string) string {
+	return strings.NewReplacer(`\\`, `\`, `\;`, `;`, `\,`, `,`, `\n`, " ", `\N`, " ").Replace(value)
+}
@@ -0,0 +1,79 @@
+package calendar
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+const holidays = "BEGIN:VCALENDAR\r\n" +
+	"VERSION:2.0\r\n" +
+	"PRODID:-//Holidays//EN\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"SUMMARY:New Year\r\n" +
+	"DTSTART;VALUE=DATE:20170101\r\n" +
+	"DTEND;VALUE=DATE:20170102\r\n" +
+	"RRULE:FREQ=YEARLY\r\n" +
+	"END:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"SUMMARY:Summer holidays\\, school\r\n" +
+	"  closed\r\n" +
+	"DTSTART;VALUE=DATE:20170731\r\n" +
+	"DTEND;VALUE=DATE:20170812\r\n" +
+	"END:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"SUMMARY:Party\r\n" +
+	"DTSTART:20171231T200000Z\r\n" +
+	"DTEND:20180101T020000Z\r\n" +
+	"END:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"SUMMARY:Birthday\r\n" +
+	"DTSTART;VALUE=DATE:20170315\r\n" +
+	"RRULE:FREQ=YEARLY;COUNT=2\r\n" +
+	"END:VEVENT\r\n" +
+	"END:VCALENDAR\r\n"
+
+func TestParseICS(t *testing.T) {
+	until := time.Date(2019, 6, 30, 0, 0, 0, 0, time.UTC)
+	events, err := ParseICS(strings.NewReader(holidays), until)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []*Event{
+		{Summary: "New Year", StartDate: "2017-01-01", EndDate: "2017-01-01"},
+		{Summary: "New Year", StartDate: "2018-01-01", EndDate: "2018-01-01"},
+		{Summary: "New Year", StartDate: "2019-01-01", EndDate: "2019-01-01"},
+		{Summary: "Summer holidays, school closed", StartDate: "2017-07-31", EndDate: "2017-08-11"},
+		{Summary: "Party", StartDate: "2017-12-31", EndDate: "2018-01-01"},
+		{Summary: "Birthday", StartDate: "2017-03-15", EndDate: "2017-03-15"},
+		{Summary: "Birthday", StartDate: "2018-03-15", EndDate: "2018-03-15"},
+	}
+	if !reflect.DeepEqual(events, expected) {
+		for _, e := range events {
+			t.Logf("%+v", e)
+		}
+		t.Errorf("Expected the events of the calendar")
+	}
+}
+
+func TestParseICSFails(t *testing.T) {
+	tests := []struct {
+		name string
+		ics  string
+	}{
+		{"no start", "BEGIN:VEVENT\nSUMMARY:Nothing\nEND:VEVENT\n"},
+		{"invalid date", "BEGIN:VEVENT\nDTSTART;VALUE=DATE:2017013\nEND:VEVENT\n"},
+		{"not closed", "BEGIN:VEVENT\nDTSTART;VALUE=DATE:20170101\n"},
+		{"not opened", "END:VEVENT\n"},
+		{"weekly", "BEGIN:VEVENT\nDTSTART;VALUE=DATE:20170101\nRRULE:FREQ=WEEKLY\nEND:VEVENT\n"},
+		{"by month", "BEGIN:VEVENT\nDTSTART;VALUE=DATE:20170101\nRRULE:FREQ=YEARLY;BYMONTH=1\nEND:VEVENT\n"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := ParseICS(strings.NewReader(test.ics), time.Now()); err == nil {
+				t.Error("Expected an error")
+			}
+		})
+	}
+}
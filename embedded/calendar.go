@@ -0,0 +1,153 @@
+package embedded
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/he4d/almue-backend/model"
+)
+
+// calendar holds the calendar exceptions the daily jobs consult and the jobs that run later because of them
+type calendar struct {
+	sync.Mutex
+	exceptions []*model.CalendarException
+	shifted    map[jobKey]*shiftedJob
+}
+
+// shiftedJob is a daily job that waits for the time a calendar exception shifted it to
+type shiftedJob struct {
+	timer Timer
+	at    time.Time
+}
+
+// jobLookaheadDays is the number of days the next run of a daily job is searched for in the calendar
+const jobLookaheadDays = 366
+
+// jobKey identifies a daily job of a device
+type jobKey struct {
+	deviceType string
+	deviceID   int64
+	job        string
+}
+
+// SetCalendarExceptions replaces the calendar exceptions the daily jobs consult before they run.
+// Jobs that were already shifted by the previous exceptions still run.
+func (c *Controller) SetCalendarExceptions(exceptions []*model.CalendarException) error {
+	copied := make([]*model.CalendarException, 0, len(exceptions))
+	for _, e := range exceptions {
+		copied = append(copied, e.DeepCopy())
+	}
+	c.calendar.Lock()
+	c.calendar.exceptions = copied
+	c.calendar.Unlock()
+	return nil
+}
+
+// runJob runs a daily job of a device through its command queue unless the presence simulation suspends it.
+// A calendar exception of the current day skips the job or runs it later.
+// The outcome is kept in the job registry.
+func (c *Controller) runJob(deviceType string, deviceID int64, job string) {
+	key := jobKey{deviceType, deviceID, job}
+	if c.presence.suspends(deviceType, deviceID) {
+		c.recordJobRun(key, model.JobResultSuspended, nil)
+		c.logger.Info.Printf("Presence simulation: skipped the %s job of %s %d", job, deviceType, deviceID)
+		return
+	}
+
+	cal := &c.calendar
+	cal.Lock()
+	exception := model.ResolveCalendar(cal.exceptions, deviceType, deviceID, job, c.clock.Now().Format(model.DateFormat))
+	if exception == nil {
+		cal.Unlock()
+		c.runJobNow(key)
+		return
+	}
+	if exception.Action == model.CalendarSkip {
+		cal.Unlock()
+		c.recordJobRun(key, model.JobResultSkipped, nil)
+		c.logger.Info.Printf("Calendar: skipped the %s job of %s %d because of exception %d",
+			job, deviceType, deviceID, exception.ID)
+		return
+	}
+	defer cal.Unlock()
+	if cal.shifted == nil {
+		cal.shifted = map[jobKey]*shiftedJob{}
+	}
+	if previous, ok := cal.shifted[key]; ok {
+		previous.timer.Stop()
+	}
+	shift := time.Duration(exception.ShiftMinutes) * time.Minute
+	shifted := &shiftedJob{at: c.clock.Now().Add(shift)}
+	shifted.timer = c.clock.AfterFunc(shift, func() {
+		cal.Lock()
+		if cal.shifted[key] != shifted {
+			cal.Unlock()
+			return
+		}
+		delete(cal.shifted, key)
+		cal.Unlock()
+		c.runJobNow(key)
+	})
+	cal.shifted[key] = shifted
+	c.recordJobRun(key, model.JobResultShifted, nil)
+	c.logger.Info.Printf("Calendar: shifted the %s job of %s %d by %d minutes because of exception %d",
+		job, deviceType, deviceID, exception.ShiftMinutes, exception.ID)
+}
+
+// runJobNow switches the device of the job and records the outcome.
+// The jobs are named like the actions of the commands
+func (c *Controller) runJobNow(key jobKey) {
+	err := c.runCommand(key.deviceType, key.deviceID, key.job, model.CommandSourceSchedule, model.CommandPriorityLow)
+	if err == errCommandCancelled {
+		// a cancelled job did not switch the device but is no fault of the device
+		c.recordJobRun(key, model.JobResultCancelled, err)
+		c.logger.Info.Printf("The %s job of %s %d was cancelled", key.job, key.deviceType, key.deviceID)
+		return
+	}
+	if err != nil {
+		c.recordJobRun(key, model.JobResultFailed, err)
+		c.logger.Error.Printf("The %s job of %s %d failed: %v", key.job, key.deviceType, key.deviceID, err)
+		c.recordFault(key.deviceType, key.deviceID, fmt.Errorf("The %s job failed: %v", key.job, err))
+		return
+	}
+	c.recordJobRun(key, model.JobResultOK, nil)
+}
+
+// cancelShiftedJobs stops the jobs of the device that wait for their shifted time
+func (c *Controller) cancelShiftedJobs(deviceType string, deviceID int64) {
+	c.calendar.Lock()
+	defer c.calendar.Unlock()
+	for key, shifted := range c.calendar.shifted {
+		if key.deviceType == deviceType && key.deviceID == deviceID {
+			shifted.timer.Stop()
+			delete(c.calendar.shifted, key)
+		}
+	}
+}
+
+// nextJobRun returns when the daily job at the given time of day runs after now, decided like runJob does:
+// a job that waits for its shifted time runs then, otherwise it runs on the first day that no calendar exception
+// skips, later by the minutes of a shift. Nil is returned if the calendar skips every run within the lookahead
+func (c *Controller) nextJobRun(key jobKey, now time.Time, hour, minute int) *time.Time {
+	cal := &c.calendar
+	cal.Lock()
+	defer cal.Unlock()
+	if shifted, ok := cal.shifted[key]; ok && shifted.at.After(now) {
+		at := shifted.at
+		return &at
+	}
+	next := nextDaily(now, hour, minute)
+	for day := 0; day < jobLookaheadDays; day++ {
+		exception := model.ResolveCalendar(cal.exceptions, key.deviceType, key.deviceID, key.job, next.Format(model.DateFormat))
+		if exception == nil {
+			return &next
+		}
+		if exception.Action != model.CalendarSkip {
+			shifted := next.Add(time.Duration(exception.ShiftMinutes) * time.Minute)
+			return &shifted
+		}
+		next = next.AddDate(0, 0, 1)
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package embedded
+
+import (
+	"testing"
+	"time"
+
+	"github.com/he4d/almue-backend/model"
+)
+
+func TestCalendarSkipsJobs(t *testing.T) {
+	env := newTestEnv(t, Config{})
+	first, second := newTestLighting(1, 4), newTestLighting(2, 5)
+	first.JobsEnabled, second.JobsEnabled = true, true
+	if err := env.controller.RegisterLightings(first, second); err != nil {
+		t.Fatal(err)
+	}
+
+	// the clock starts on 2017-10-02, the exception covers the on job of the first lighting
+	err := env.controller.SetCalendarExceptions([]*model.CalendarException{
+		{Base: model.Base{ID: 1}, StartDate: "2017-10-01", EndDate: "2017-10-02", Action: model.CalendarSkip,
+			Jobs: []string{model.JobOn}, Lightings: []int64{1}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	env.scheduler.fire(18, 0)
+	if state := env.store.lightingState(1); state != "" {
+		t.Errorf("Expected the on job of the first lighting to be skipped but it is %s", state)
+	}
+	if state := env.store.lightingState(2); state != "on" {
+		t.Errorf("Expected the on job of the second lighting to run but it is %s", state)
+	}
+
+	// the exception ends with its end date
+	env.clock.Advance(24 * time.Hour)
+	env.scheduler.fire(18, 0)
+	if state := env.store.lightingState(1); state != "on" {
+		t.Errorf("Expected the on job to run after the exception but the lighting is %s", state)
+	}
+}
+
+func TestCalendarShiftsJobs(t *testing.T) {
+	env := newTestEnv(t, Config{})
+	shutter := newTestShutter(1, 17, 27, 20, 0)
+	shutter.JobsEnabled = true
+	if err := env.controller.RegisterShutters(shutter); err != nil {
+		t.Fatal(err)
+	}
+
+	err := env.controller.SetCalendarExceptions([]*model.CalendarException{
+		{Base: model.Base{ID: 1}, StartDate: "2017-10-02", EndDate: "2017-10-02", Action: model.CalendarShift,
+			ShiftMinutes: 30, AllDevices: true},
+		{Base: model.Base{ID: 2}, StartDate: "2017-10-02", EndDate: "2017-10-02", Action: model.CalendarShift,
+			ShiftMinutes: 90, Shutters: []int64{1}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	env.scheduler.fire(7, 30)
+	if states := env.store.states("shutter", 1); len(states) != 0 {
+		t.Errorf("Expected the open job to wait but got %v", states)
+	}
+	env.clock.Advance(89 * time.Minute)
+	if states := env.store.states("shutter", 1); len(states) != 0 {
+		t.Errorf("Expected the largest shift to win but got %v", states)
+	}
+	env.clock.Advance(time.Minute)
+	if states := env.store.states("shutter", 1); len(states) != 1 || states[0] != "opening" {
+		t.Errorf("Expected the shutter to be opened after the shift but got %v", states)
+	}
+
+	// unscheduling the jobs cancels the shifted ones
+	env.clock.Advance(time.Hour)
+	env.scheduler.fire(20, 0)
+	if err := env.controller.UnscheduleShutterJobs(1); err != nil {
+		t.Fatal(err)
+	}
+	env.clock.Advance(2 * time.Hour)
+	if states := env.store.states("shutter", 1); len(states) != 1 {
+		t.Errorf("Expected the shifted close job to be cancelled but got %v", states)
+	}
+}
@@ -0,0 +1,179 @@
+package embedded
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/he4d/scheduler"
+)
+
+// Clock abstracts the time for the controller so that it can run on an accelerated time
+type Clock interface {
+	Now() time.Time
+	AfterFunc(d time.Duration, f func()) Timer
+	Every(d time.Duration, f func()) Timer
+}
+
+// Timer calls a function once or periodically until it gets stopped
+type Timer interface {
+	Stop() bool
+}
+
+// Job is a scheduled job that can be stopped
+type Job interface {
+	Stop()
+}
+
+// Scheduler runs functions every day at a given time of day
+type Scheduler interface {
+	Daily(hour, minute int, f func()) (Job, error)
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time                            { return time.Now() }
+func (realClock) AfterFunc(d time.Duration, f func()) Timer { return time.AfterFunc(d, f) }
+func (realClock) Every(d time.Duration, f func()) Timer     { return newRealTicker(d, f) }
+
+// realTicker calls a function on every tick of a time.Ticker until it gets stopped
+type realTicker struct {
+	ticker *time.Ticker
+	done   chan struct{}
+	once   sync.Once
+}
+
+func newRealTicker(d time.Duration, f func()) *realTicker {
+	t := &realTicker{ticker: time.NewTicker(d), done: make(chan struct{})}
+	go func() {
+		for {
+			select {
+			case <-t.ticker.C:
+				f()
+			case <-t.done:
+				return
+			}
+		}
+	}()
+	return t
+}
+
+func (t *realTicker) Stop() bool {
+	stopped := false
+	t.once.Do(func() {
+		t.ticker.Stop()
+		close(t.done)
+		stopped = true
+	})
+	return stopped
+}
+
+// scaledClock runs faster than the real time by the given scale.
+// It starts at the real time when it gets created.
+type scaledClock struct {
+	start time.Time
+	scale float64
+}
+
+func newScaledClock(scale float64) *scaledClock {
+	return &scaledClock{start: time.Now(), scale: scale}
+}
+
+func (s *scaledClock) Now() time.Time {
+	elapsed := time.Since(s.start)
+	return s.start.Add(time.Duration(float64(elapsed) * s.scale))
+}
+
+func (s *scaledClock) AfterFunc(d time.Duration, f func()) Timer {
+	return time.AfterFunc(s.real(d), f)
+}
+
+func (s *scaledClock) Every(d time.Duration, f func()) Timer {
+	return newRealTicker(s.real(d), f)
+}
+
+// real converts a duration of the scaled time into the real time
+func (s *scaledClock) real(d time.Duration) time.Duration {
+	real := time.Duration(float64(d) / s.scale)
+	if real <= 0 {
+		return time.Nanosecond
+	}
+	return real
+}
+
+// libScheduler schedules jobs on the real time with the scheduler package
+type libScheduler struct{}
+
+func (libScheduler) Daily(hour, minute int, f func()) (Job, error) {
+	job, err := scheduler.Every().Day().At(fmt.Sprintf("%02d:%02d", hour, minute)).Run(f)
+	if err != nil {
+		return nil, err
+	}
+	return &libJob{job}, nil
+}
+
+type libJob struct {
+	*scheduler.Job
+}
+
+func (j *libJob) Stop() {
+	j.Quit <- true
+}
+
+// clockScheduler schedules jobs on the time of a Clock
+type clockScheduler struct {
+	clock Clock
+}
+
+func (s *clockScheduler) Daily(hour, minute int, f func()) (Job, error) {
+	if hour < 0 || hour > 23 || minute < 0 || minute > 59 {
+		return nil, fmt.Errorf("Invalid time of day %02d:%02d", hour, minute)
+	}
+	job := &clockJob{clock: s.clock, hour: hour, minute: minute, f: f}
+	job.Lock()
+	job.schedule()
+	job.Unlock()
+	return job, nil
+}
+
+type clockJob struct {
+	sync.Mutex
+	clock   Clock
+	hour    int
+	minute  int
+	f       func()
+	timer   Timer
+	stopped bool
+}
+
+// schedule starts the timer for the next run. The job must be locked by the caller.
+func (j *clockJob) schedule() {
+	now := j.clock.Now()
+	j.timer = j.clock.AfterFunc(nextDaily(now, j.hour, j.minute).Sub(now), j.run)
+}
+
+func (j *clockJob) run() {
+	j.Lock()
+	if j.stopped {
+		j.Unlock()
+		return
+	}
+	j.Unlock()
+
+	j.f()
+
+	j.Lock()
+	if !j.stopped {
+		j.schedule()
+	}
+	j.Unlock()
+}
+
+func (j *clockJob) Stop() {
+	j.Lock()
+	defer j.Unlock()
+	j.stopped = true
+	if j.timer != nil {
+		j.timer.Stop()
+	}
+}
@@ -0,0 +1,34 @@
+package embedded
+
+import (
+	"testing"
+	"time"
+)
+
+func TestScaledClock(t *testing.T) {
+	clock := newScaledClock(600)
+	start := clock.Now()
+	fired := make(chan time.Time, 1)
+	clock.AfterFunc(time.Minute, func() { fired <- clock.Now() })
+
+	// a minute of the scaled clock passes in 100ms
+	select {
+	case at := <-fired:
+		if elapsed := at.Sub(start); elapsed < time.Minute || elapsed > 3*time.Minute {
+			t.Errorf("Expected the timer to fire after a minute of the scaled clock but it fired after %v", elapsed)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected the timer to fire after 100ms")
+	}
+
+	ticks := make(chan struct{}, 10)
+	ticker := clock.Every(6*time.Second, func() { ticks <- struct{}{} })
+	defer ticker.Stop()
+	for i := 0; i < 3; i++ {
+		select {
+		case <-ticks:
+		case <-time.After(time.Second):
+			t.Fatalf("Expected a tick every 10ms but got %d", i)
+		}
+	}
+}
@@ -0,0 +1,284 @@
+package embedded
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/he4d/almue-backend/logging"
+	"github.com/he4d/almue-backend/model"
+	"github.com/he4d/simplejack"
+)
+
+// commandLogSize is the number of finished commands the controller keeps for their status
+const commandLogSize = 200
+
+// errCommandCancelled is returned by runCommand if the command was cancelled before it was run
+var errCommandCancelled = errors.New("The command was cancelled before it was run")
+
+// commandQueue holds the commands of all devices. Every device has its own queue
+// which is worked off by one goroutine at a time, so the commands of a device never run concurrently
+type commandQueue struct {
+	sync.Mutex
+	lastID   int64
+	commands map[int64]*queuedCommand
+	finished []int64
+	pending  map[string][]*queuedCommand
+	working  map[string]bool
+	// running holds the running command of a device
+	running map[string]*model.Command
+}
+
+type queuedCommand struct {
+	command model.Command
+	done    chan struct{}
+}
+
+// SubmitCommand queues the command for its device and returns it with its id.
+// The command runs asynchronously after the queued commands of the device with the same or a higher priority
+func (c *Controller) SubmitCommand(command *model.Command) (*model.Command, error) {
+	queued, err := c.submitCommand(command)
+	if err != nil {
+		return nil, err
+	}
+	c.commands.Lock()
+	defer c.commands.Unlock()
+	submitted := queued.command
+	return &submitted, nil
+}
+
+// runCommand queues the command and waits until it has finished. It returns errCommandCancelled
+// if the command got cancelled in the queue. The trace of the command names the source, the device and the time it was caused
+func (c *Controller) runCommand(deviceType string, deviceID int64, action, source string, priority int) error {
+	trace := fmt.Sprintf("%s/%s/%d/%s/%d", source, deviceType, deviceID, action, c.clock.Now().Unix())
+	queued, err := c.submitCommand(&model.Command{
+		DeviceType: deviceType, DeviceID: deviceID, Action: action, Source: source, Priority: priority, Trace: trace,
+	})
+	if err != nil {
+		return err
+	}
+	<-queued.done
+	c.commands.Lock()
+	defer c.commands.Unlock()
+	switch queued.command.Status {
+	case model.CommandFailed:
+		return errors.New(queued.command.Error)
+	case model.CommandCancelled:
+		return errCommandCancelled
+	}
+	return nil
+}
+
+func (c *Controller) submitCommand(command *model.Command) (*queuedCommand, error) {
+	if _, err := c.commandFunc(command.DeviceType, command.Action); err != nil {
+		return nil, err
+	}
+	var err error
+	if command.DeviceType == model.DeviceTypeShutter {
+		_, err = c.getShutterByID(command.DeviceID)
+	} else {
+		_, err = c.getLightingByID(command.DeviceID)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	q := &c.commands
+	q.Lock()
+	defer q.Unlock()
+	if q.commands == nil {
+		q.commands = map[int64]*queuedCommand{}
+		q.pending = map[string][]*queuedCommand{}
+		q.working = map[string]bool{}
+		q.running = map[string]*model.Command{}
+	}
+	q.lastID++
+	queued := &queuedCommand{command: *command, done: make(chan struct{})}
+	queued.command.ID = q.lastID
+	queued.command.Status = model.CommandQueued
+	queued.command.Error = ""
+	queued.command.Created = c.clock.Now()
+	queued.command.Started = nil
+	queued.command.Finished = nil
+	if queued.command.Trace == "" {
+		queued.command.Trace = fmt.Sprintf("command/%d", queued.command.ID)
+	}
+	q.commands[queued.command.ID] = queued
+
+	key := deviceKey(command.DeviceType, command.DeviceID)
+	pending := append(q.pending[key], queued)
+	sort.SliceStable(pending, func(i, j int) bool { return pending[i].command.Priority > pending[j].command.Priority })
+	q.pending[key] = pending
+	if !q.working[key] {
+		q.working[key] = true
+		go c.workOffCommands(key)
+	}
+	return queued, nil
+}
+
+// workOffCommands runs the queued commands of the device until its queue is empty
+func (c *Controller) workOffCommands(key string) {
+	q := &c.commands
+	for {
+		q.Lock()
+		pending := q.pending[key]
+		if len(pending) == 0 {
+			delete(q.pending, key)
+			delete(q.working, key)
+			q.Unlock()
+			return
+		}
+		queued := pending[0]
+		q.pending[key] = pending[1:]
+		started := c.clock.Now()
+		queued.command.Status = model.CommandRunning
+		queued.command.Started = &started
+		command := queued.command
+		q.running[key] = &command
+		q.Unlock()
+
+		logger := c.traceLogger(command.Trace, command.DeviceType, command.DeviceID)
+		logger.Debug.Printf("Running command %d to %s %s %d from %s",
+			command.ID, command.Action, command.DeviceType, command.DeviceID, command.Source)
+		run, err := c.commandFunc(command.DeviceType, command.Action)
+		if err == nil {
+			err = run(command.DeviceID)
+		}
+
+		q.Lock()
+		delete(q.running, key)
+		finished := c.clock.Now()
+		queued.command.Finished = &finished
+		if err != nil {
+			queued.command.Status = model.CommandFailed
+			queued.command.Error = err.Error()
+			logger.Error.Printf("Command %d to %s %s %d failed: %v",
+				command.ID, command.Action, command.DeviceType, command.DeviceID, err)
+		} else {
+			queued.command.Status = model.CommandDone
+		}
+		c.finishCommand(queued)
+		q.Unlock()
+	}
+}
+
+// finishCommand wakes up the waiting callers and drops the oldest finished commands.
+// The queue must be locked by the caller.
+func (c *Controller) finishCommand(queued *queuedCommand) {
+	q := &c.commands
+	close(queued.done)
+	q.finished = append(q.finished, queued.command.ID)
+	for len(q.finished) > commandLogSize {
+		delete(q.commands, q.finished[0])
+		q.finished = q.finished[1:]
+	}
+}
+
+// Command returns the command with the given id. Only the last finished commands are kept
+func (c *Controller) Command(commandID int64) (*model.Command, error) {
+	c.commands.Lock()
+	defer c.commands.Unlock()
+	queued, ok := c.commands.commands[commandID]
+	if !ok {
+		return nil, model.ErrNotFound
+	}
+	command := queued.command
+	return &command, nil
+}
+
+// Commands returns the queued, running and the last finished commands ordered by their id
+func (c *Controller) Commands() []*model.Command {
+	c.commands.Lock()
+	defer c.commands.Unlock()
+	commands := []*model.Command{}
+	for _, queued := range c.commands.commands {
+		command := queued.command
+		commands = append(commands, &command)
+	}
+	sort.Slice(commands, func(i, j int) bool { return commands[i].ID < commands[j].ID })
+	return commands
+}
+
+// CancelCommand removes the queued command from the queue of its device.
+// Commands that already run or have finished can not be cancelled
+func (c *Controller) CancelCommand(commandID int64) (*model.Command, error) {
+	q := &c.commands
+	q.Lock()
+	defer q.Unlock()
+	queued, ok := q.commands[commandID]
+	if !ok {
+		return nil, model.ErrNotFound
+	}
+	if queued.command.Status != model.CommandQueued {
+		return nil, model.ErrNotCancellable
+	}
+	key := deviceKey(queued.command.DeviceType, queued.command.DeviceID)
+	pending := q.pending[key]
+	for i, p := range pending {
+		if p == queued {
+			q.pending[key] = append(pending[:i:i], pending[i+1:]...)
+			break
+		}
+	}
+	finished := c.clock.Now()
+	queued.command.Status = model.CommandCancelled
+	queued.command.Finished = &finished
+	c.finishCommand(queued)
+	command := queued.command
+	return &command, nil
+}
+
+// commandFunc returns the function that runs the action on a device of the given type
+func (c *Controller) commandFunc(deviceType, action string) (func(int64) error, error) {
+	var run func(int64) error
+	switch deviceType {
+	case model.DeviceTypeShutter:
+		run = map[string]func(int64) error{
+			"open":  c.OpenShutter,
+			"close": c.CloseShutter,
+			"stop":  c.StopShutter,
+			"reset": c.ResetShutter,
+		}[action]
+	case model.DeviceTypeLighting:
+		run = map[string]func(int64) error{
+			"on":    c.TurnLightingOn,
+			"off":   c.TurnLightingOff,
+			"reset": c.ResetLighting,
+		}[action]
+	default:
+		return nil, fmt.Errorf("Unknown device type %s", deviceType)
+	}
+	if run == nil {
+		return nil, fmt.Errorf("The action %s is not supported by a %s", action, deviceType)
+	}
+	return run, nil
+}
+
+// runningTrace returns the trace of the command that currently runs on the device, it is empty
+// if the device is switched without a command
+func (c *Controller) runningTrace(deviceType string, deviceID int64) string {
+	c.commands.Lock()
+	defer c.commands.Unlock()
+	if command, ok := c.commands.running[deviceKey(deviceType, deviceID)]; ok {
+		return command.Trace
+	}
+	return ""
+}
+
+// runningSource returns the source of the command that currently runs on the device, it is empty
+// if the device is switched without a command
+func (c *Controller) runningSource(deviceType string, deviceID int64) string {
+	c.commands.Lock()
+	defer c.commands.Unlock()
+	if command, ok := c.commands.running[deviceKey(deviceType, deviceID)]; ok {
+		return command.Source
+	}
+	return ""
+}
+
+// traceLogger returns the logger for the actions on the device, its records carry the trace
+// so they can be followed back to the request or the job that caused them
+func (c *Controller) traceLogger(trace, deviceType string, deviceID int64) *simplejack.Logger {
+	return logging.With(c.logger, "trace", trace, "device", deviceKey(deviceType, deviceID))
+}
@@ -0,0 +1,198 @@
+package embedded
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/he4d/almue-backend/logging"
+	"github.com/he4d/almue-backend/model"
+	"github.com/he4d/simplejack"
+)
+
+// waitFor polls the condition until it holds or fails the test after a second
+func waitFor(t *testing.T, what string, condition func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestCommandQueue(t *testing.T) {
+	env := newTestEnv(t, Config{})
+	if err := env.controller.RegisterShutters(newTestShutter(1, 17, 27, 20, 0)); err != nil {
+		t.Fatal(err)
+	}
+	submit := func(action string, priority int) *model.Command {
+		t.Helper()
+		command, err := env.controller.SubmitCommand(&model.Command{
+			DeviceType: model.DeviceTypeShutter, DeviceID: 1, Action: action, Source: model.CommandSourceAPI, Priority: priority,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return command
+	}
+	status := func(id int64) string {
+		command, err := env.controller.Command(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return command.Status
+	}
+
+	// the locked shutter keeps the first command running while the others get queued
+	device, _ := env.controller.getShutterByID(1)
+	device.Lock()
+	first := submit("open", model.CommandPriorityNormal)
+	waitFor(t, "the first command to run", func() bool { return status(first.ID) == model.CommandRunning })
+	low := submit("close", model.CommandPriorityLow)
+	normal := submit("open", model.CommandPriorityNormal)
+	high := submit("stop", model.CommandPriorityHigh)
+	cancelled := submit("close", model.CommandPriorityNormal)
+	if low.Status != model.CommandQueued || low.ID <= first.ID {
+		t.Errorf("Expected a queued command with a new id but got %+v", low)
+	}
+
+	if command, err := env.controller.CancelCommand(cancelled.ID); err != nil || command.Status != model.CommandCancelled {
+		t.Errorf("Expected the queued command to be cancelled but got %+v, %v", command, err)
+	}
+	if _, err := env.controller.CancelCommand(first.ID); err != model.ErrNotCancellable {
+		t.Errorf("Expected the running command not to be cancellable but got %v", err)
+	}
+	if _, err := env.controller.CancelCommand(999); err != model.ErrNotFound {
+		t.Errorf("Expected an unknown command not to be found but got %v", err)
+	}
+	device.Unlock()
+
+	waitFor(t, "all commands to finish", func() bool { return status(low.ID) == model.CommandDone })
+	env.controller.commands.Lock()
+	order := append([]int64{}, env.controller.commands.finished...)
+	env.controller.commands.Unlock()
+	expected := []int64{cancelled.ID, first.ID, high.ID, normal.ID, low.ID}
+	if !reflect.DeepEqual(order, expected) {
+		t.Errorf("Expected the commands to finish in the order %v but got %v", expected, order)
+	}
+	if commands := env.controller.Commands(); len(commands) != 5 || commands[0].ID != first.ID || commands[0].Started == nil {
+		t.Errorf("Expected all commands ordered by id but got %+v", commands)
+	}
+}
+
+func TestSubmitCommandFails(t *testing.T) {
+	env := newTestEnv(t, Config{})
+	if err := env.controller.RegisterLightings(newTestLighting(1, 4)); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		command *model.Command
+	}{
+		{"unsupported action", &model.Command{DeviceType: model.DeviceTypeLighting, DeviceID: 1, Action: "open"}},
+		{"unknown device type", &model.Command{DeviceType: "heating", DeviceID: 1, Action: "on"}},
+		{"unregistered device", &model.Command{DeviceType: model.DeviceTypeLighting, DeviceID: 2, Action: "on"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := env.controller.SubmitCommand(test.command); err == nil {
+				t.Error("Expected an error")
+			}
+		})
+	}
+	if commands := env.controller.Commands(); len(commands) != 0 {
+		t.Errorf("Expected no commands but got %+v", commands)
+	}
+}
+
+// logBuffer collects the records of the controller, which are written by the goroutines of the command queues
+type logBuffer struct {
+	sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *logBuffer) Write(p []byte) (int, error) {
+	b.Lock()
+	defer b.Unlock()
+	return b.buf.Write(p)
+}
+
+// traces returns the traces of the records by their message
+func (b *logBuffer) traces(t *testing.T) map[string]string {
+	b.Lock()
+	defer b.Unlock()
+	traces := map[string]string{}
+	for _, line := range bytes.Split(bytes.TrimSpace(b.buf.Bytes()), []byte("\n")) {
+		record := map[string]string{}
+		if err := json.Unmarshal(line, &record); err != nil {
+			t.Fatalf("Expected JSON records but got %s: %v", line, err)
+		}
+		traces[record["msg"]] = record["trace"]
+	}
+	return traces
+}
+
+func TestCommandTrace(t *testing.T) {
+	env := newTestEnv(t, Config{})
+	buf := &logBuffer{}
+	logs, err := logging.New(buf, logging.FormatJSON, simplejack.INFO, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	env.controller.logger = logs.Logger("embedded")
+	if err := env.controller.RegisterShutters(newTestShutter(1, 17, 27, 20, 0)); err != nil {
+		t.Fatal(err)
+	}
+	lighting := newTestLighting(1, 4)
+	lighting.JobsEnabled = true
+	if err := env.controller.RegisterLightings(lighting); err != nil {
+		t.Fatal(err)
+	}
+
+	command, err := env.controller.SubmitCommand(&model.Command{DeviceType: model.DeviceTypeShutter, DeviceID: 1,
+		Action: "open", Source: model.CommandSourceAPI, Trace: "host/abc-000001"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "the open command", func() bool {
+		finished, err := env.controller.Command(command.ID)
+		return err == nil && finished.Status == model.CommandDone
+	})
+	// the stop at the end position belongs to the run of the request
+	env.clock.Advance(20 * time.Second)
+	env.scheduler.fire(18, 0)
+
+	traces := buf.traces(t)
+	for msg, expected := range map[string]string{
+		"Shutter 1 switched its relays to opening":            "host/abc-000001",
+		"Shutter 1 released its relays after opening for 20s": "host/abc-000001",
+	} {
+		if trace, ok := traces[msg]; !ok || trace != expected {
+			t.Errorf("Expected the record %q with the trace %s but got %q in %v", msg, expected, trace, traces)
+		}
+	}
+	if trace := traces["Lighting 1 switched on"]; !strings.HasPrefix(trace, "schedule/lighting/1/on/") {
+		t.Errorf("Expected the lighting to be switched with the trace of its job but got %q in %v", trace, traces)
+	}
+
+	// a command without a trace gets the trace of its id
+	command, err = env.controller.SubmitCommand(&model.Command{DeviceType: model.DeviceTypeLighting, DeviceID: 1, Action: "off"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if command.Trace != fmt.Sprintf("command/%d", command.ID) {
+		t.Errorf("Expected the trace of the command id but got %+v", command)
+	}
+	waitFor(t, "the off command", func() bool {
+		finished, err := env.controller.Command(command.ID)
+		return err == nil && finished.Status == model.CommandDone
+	})
+}
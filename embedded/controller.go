@@ -1,28 +1,98 @@
 package embedded
 
 import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"periph.io/x/periph/conn/gpio"
+	"periph.io/x/periph/conn/gpio/gpioreg"
 	"periph.io/x/periph/host"
 
 	"sync"
 
+	"github.com/he4d/almue-backend/board"
 	"github.com/he4d/simplejack"
 )
 
+// Config holds the settings of the Controller
+type Config struct {
+	// Simulate runs the controller without gpio access
+	Simulate bool
+	// Board describes the gpio pins that can be used by devices
+	Board *board.Profile
+	// ReversalDeadTime is the time both relays of a shutter stay off before its motor changes the direction
+	ReversalDeadTime time.Duration
+	// MinPause is the minimum time a shutter motor rests between two runs
+	MinPause time.Duration
+	// MaxRunTime is the maximum time a shutter motor may run continuously before it gets stopped, 0 disables the watchdog
+	MaxRunTime time.Duration
+	// StopPin is the input pin of a stop button or a wind sensor, a rising edge stops all shutters.
+	// No device can use the stop pin, 0 disables it
+	StopPin int
+	// TimeScale accelerates the time in simulation mode, e.g. 60 lets one minute pass in one second.
+	// Shutter runs, motor protection and schedules all run on the accelerated time. 0 or 1 is the real time.
+	TimeScale float64
+	// Clock replaces the time of the controller, e.g. with a fake clock in tests. It can not be combined with TimeScale.
+	Clock Clock
+	// Scheduler replaces the scheduler of the daily jobs. If it is not set the jobs are scheduled
+	// on the real time or on the configured Clock.
+	Scheduler Scheduler
+}
+
 // Controller holds all necessary fields for the Controller
 type Controller struct {
 	shuttersLock  sync.RWMutex
 	shutters      map[int64]*shutter
 	lightingsLock sync.RWMutex
 	lightings     map[int64]*lighting
-	simulate      bool
+	config        Config
+	clock         Clock
+	scheduler     Scheduler
+	pins          *pinBank
 	logger        *simplejack.Logger
 	stateStore    DeviceStateStore
+	historyLock   sync.Mutex
+	lastPrune     time.Time
+	presence      presence
+	calendar      calendar
+	jobs          jobRegistry
+	commands      commandQueue
+	faults        faults
 }
 
 //New creates a new DeviceController and returns it
-//if true is passed to the simulate argument it runs without gpio acces
-func New(logger *simplejack.Logger, stateStore DeviceStateStore, simulate bool) (*Controller, error) {
-	if !simulate {
+//if Simulate is set in the config it runs without gpio acces
+func New(logger *simplejack.Logger, stateStore DeviceStateStore, config Config) (*Controller, error) {
+	if config.Board == nil {
+		return nil, fmt.Errorf("No board profile configured")
+	}
+
+	if config.TimeScale < 0 {
+		return nil, fmt.Errorf("The time scale must not be negative")
+	}
+
+	var clock Clock = realClock{}
+	var scheduler Scheduler = libScheduler{}
+	if config.TimeScale != 0 && config.TimeScale != 1 {
+		if !config.Simulate {
+			return nil, fmt.Errorf("The time can only be scaled in simulation mode")
+		}
+		if config.Clock != nil {
+			return nil, fmt.Errorf("The time can not be scaled with a custom clock")
+		}
+		clock = newScaledClock(config.TimeScale)
+		scheduler = &clockScheduler{clock: clock}
+	}
+	if config.Clock != nil {
+		clock = config.Clock
+		scheduler = &clockScheduler{clock: clock}
+	}
+	if config.Scheduler != nil {
+		scheduler = config.Scheduler
+	}
+
+	if !config.Simulate {
 		if _, err := host.Init(); err != nil {
 			return nil, err
 		}
@@ -31,10 +101,42 @@ func New(logger *simplejack.Logger, stateStore DeviceStateStore, simulate bool)
 	controller := &Controller{
 		shutters:   make(map[int64]*shutter),
 		lightings:  make(map[int64]*lighting),
-		simulate:   simulate,
+		config:     config,
+		clock:      clock,
+		scheduler:  scheduler,
+		pins:       newPinBank(clock, logger),
 		stateStore: stateStore,
 		logger:     logger,
 	}
 
+	if config.StopPin != 0 {
+		if err := controller.watchStopPin(); err != nil {
+			return nil, err
+		}
+	}
+
 	return controller, nil
 }
+
+// newPin validates the pin number against the board profile and returns the gpio pin for it
+func (c *Controller) newPin(name string, number int) (gpio.PinIO, error) {
+	if err := c.config.Board.Validate(number); err != nil {
+		return nil, err
+	}
+	if c.config.StopPin != 0 && number == c.config.StopPin {
+		return nil, fmt.Errorf("Pin %d is the stop pin", number)
+	}
+	return c.openPin(name, number)
+}
+
+// openPin returns the gpio pin with the given number, it is a virtual pin in simulation mode
+func (c *Controller) openPin(name string, number int) (gpio.PinIO, error) {
+	if c.config.Simulate {
+		return c.pins.get(name, number), nil
+	}
+	pin := gpioreg.ByName(strconv.Itoa(number))
+	if pin == nil {
+		return nil, fmt.Errorf("Pin %d is not available on this host", number)
+	}
+	return pin, nil
+}
@@ -0,0 +1,354 @@
+package embedded
+
+import (
+	"io/ioutil"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/he4d/almue-backend/board"
+	"github.com/he4d/almue-backend/model"
+	"github.com/he4d/simplejack"
+)
+
+// fakeClock is a Clock that only moves when Advance is called.
+// Due timers are fired synchronously by Advance in the order of their due time.
+type fakeClock struct {
+	sync.Mutex
+	now    time.Time
+	timers []*fakeTimer
+}
+
+type fakeTimer struct {
+	clock   *fakeClock
+	when    time.Time
+	period  time.Duration
+	f       func()
+	stopped bool
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Date(2017, time.October, 2, 6, 0, 0, 0, time.UTC)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.Lock()
+	defer c.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) AfterFunc(d time.Duration, f func()) Timer {
+	return c.add(d, 0, f)
+}
+
+func (c *fakeClock) Every(d time.Duration, f func()) Timer {
+	return c.add(d, d, f)
+}
+
+func (c *fakeClock) add(d, period time.Duration, f func()) *fakeTimer {
+	c.Lock()
+	defer c.Unlock()
+	t := &fakeTimer{clock: c, when: c.now.Add(d), period: period, f: f}
+	c.timers = append(c.timers, t)
+	return t
+}
+
+func (t *fakeTimer) Stop() bool {
+	t.clock.Lock()
+	defer t.clock.Unlock()
+	wasActive := !t.stopped
+	t.stopped = true
+	return wasActive
+}
+
+// Advance moves the time forward and fires all timers that get due on the way
+func (c *fakeClock) Advance(d time.Duration) {
+	c.Lock()
+	target := c.now.Add(d)
+	c.Unlock()
+	for {
+		c.Lock()
+		var next *fakeTimer
+		active := c.timers[:0]
+		for _, t := range c.timers {
+			if t.stopped {
+				continue
+			}
+			active = append(active, t)
+			if !t.when.After(target) && (next == nil || t.when.Before(next.when)) {
+				next = t
+			}
+		}
+		c.timers = active
+		if next == nil {
+			if target.After(c.now) {
+				c.now = target
+			}
+			c.Unlock()
+			return
+		}
+		if next.when.After(c.now) {
+			c.now = next.when
+		}
+		if next.period > 0 {
+			next.when = next.when.Add(next.period)
+		} else {
+			next.stopped = true
+		}
+		f := next.f
+		c.Unlock()
+		f()
+	}
+}
+
+// fakeScheduler records the scheduled jobs so that tests can fire them
+type fakeScheduler struct {
+	sync.Mutex
+	jobs []*fakeJob
+}
+
+type fakeJob struct {
+	scheduler *fakeScheduler
+	hour      int
+	minute    int
+	f         func()
+	stopped   bool
+}
+
+func (s *fakeScheduler) Daily(hour, minute int, f func()) (Job, error) {
+	s.Lock()
+	defer s.Unlock()
+	job := &fakeJob{scheduler: s, hour: hour, minute: minute, f: f}
+	s.jobs = append(s.jobs, job)
+	return job, nil
+}
+
+func (j *fakeJob) Stop() {
+	j.scheduler.Lock()
+	defer j.scheduler.Unlock()
+	j.stopped = true
+}
+
+// active returns the times of day of all jobs that are not stopped as "hh:mm"
+func (s *fakeScheduler) active() []string {
+	s.Lock()
+	defer s.Unlock()
+	times := []string{}
+	for _, job := range s.jobs {
+		if !job.stopped {
+			times = append(times, time.Date(0, 1, 1, job.hour, job.minute, 0, 0, time.UTC).Format("15:04"))
+		}
+	}
+	sort.Strings(times)
+	return times
+}
+
+// fire runs all active jobs that are scheduled at the given time of day
+func (s *fakeScheduler) fire(hour, minute int) {
+	s.Lock()
+	due := []func(){}
+	for _, job := range s.jobs {
+		if !job.stopped && job.hour == hour && job.minute == minute {
+			due = append(due, job.f)
+		}
+	}
+	s.Unlock()
+	for _, f := range due {
+		f()
+	}
+}
+
+// memStateStore is a DeviceStateStore that keeps the states and events in memory
+type memStateStore struct {
+	sync.Mutex
+	shutterStates   map[int64]string
+	shutterOpenings map[int64]int
+	lightingStates  map[int64]string
+	shutterFaults   map[int64]*model.DeviceFault
+	lightingFaults  map[int64]*model.DeviceFault
+	events          []*model.DeviceEvent
+	// openingErr is returned by UpdateShutterOpening if it is set
+	openingErr error
+	// stateErr is returned by UpdateShutterState if it is set
+	stateErr error
+}
+
+func newMemStateStore() *memStateStore {
+	return &memStateStore{
+		shutterStates:   map[int64]string{},
+		shutterOpenings: map[int64]int{},
+		lightingStates:  map[int64]string{},
+		shutterFaults:   map[int64]*model.DeviceFault{},
+		lightingFaults:  map[int64]*model.DeviceFault{},
+	}
+}
+
+func (m *memStateStore) UpdateLightingState(lightingID int64, state string) error {
+	m.Lock()
+	defer m.Unlock()
+	m.lightingStates[lightingID] = state
+	return nil
+}
+
+func (m *memStateStore) UpdateShutterState(shutterID int64, state string) error {
+	m.Lock()
+	defer m.Unlock()
+	if m.stateErr != nil {
+		return m.stateErr
+	}
+	m.shutterStates[shutterID] = state
+	return nil
+}
+
+func (m *memStateStore) UpdateShutterOpening(shutterID int64, openingInPrc int) error {
+	m.Lock()
+	defer m.Unlock()
+	if m.openingErr != nil {
+		return m.openingErr
+	}
+	m.shutterOpenings[shutterID] = openingInPrc
+	return nil
+}
+
+func (m *memStateStore) UpdateLightingFault(lightingID int64, fault *model.DeviceFault) error {
+	m.Lock()
+	defer m.Unlock()
+	m.lightingFaults[lightingID] = fault.DeepCopy()
+	if fault != nil {
+		m.lightingStates[lightingID] = model.DeviceStatusFault
+	}
+	return nil
+}
+
+func (m *memStateStore) UpdateShutterFault(shutterID int64, fault *model.DeviceFault) error {
+	m.Lock()
+	defer m.Unlock()
+	m.shutterFaults[shutterID] = fault.DeepCopy()
+	if fault != nil {
+		m.shutterStates[shutterID] = model.DeviceStatusFault
+	}
+	return nil
+}
+
+func (m *memStateStore) AddDeviceEvent(event *model.DeviceEvent) error {
+	m.Lock()
+	defer m.Unlock()
+	e := *event
+	m.events = append(m.events, &e)
+	return nil
+}
+
+func (m *memStateStore) FindDeviceEvents(since time.Time) ([]*model.DeviceEvent, error) {
+	m.Lock()
+	defer m.Unlock()
+	events := []*model.DeviceEvent{}
+	for _, e := range m.events {
+		if !e.Time.Before(since) {
+			events = append(events, e)
+		}
+	}
+	return events, nil
+}
+
+func (m *memStateStore) DeleteDeviceEvents(before time.Time) error {
+	m.Lock()
+	defer m.Unlock()
+	kept := []*model.DeviceEvent{}
+	for _, e := range m.events {
+		if !e.Time.Before(before) {
+			kept = append(kept, e)
+		}
+	}
+	m.events = kept
+	return nil
+}
+
+// states returns the recorded states of the device in their order
+func (m *memStateStore) states(deviceType string, deviceID int64) []string {
+	m.Lock()
+	defer m.Unlock()
+	states := []string{}
+	for _, e := range m.events {
+		if e.DeviceType == deviceType && e.DeviceID == deviceID {
+			states = append(states, e.State)
+		}
+	}
+	return states
+}
+
+func (m *memStateStore) shutterState(shutterID int64) (string, int) {
+	m.Lock()
+	defer m.Unlock()
+	return m.shutterStates[shutterID], m.shutterOpenings[shutterID]
+}
+
+func (m *memStateStore) lightingState(lightingID int64) string {
+	m.Lock()
+	defer m.Unlock()
+	return m.lightingStates[lightingID]
+}
+
+func (m *memStateStore) fault(deviceType string, deviceID int64) *model.DeviceFault {
+	m.Lock()
+	defer m.Unlock()
+	if deviceType == model.DeviceTypeShutter {
+		return m.shutterFaults[deviceID]
+	}
+	return m.lightingFaults[deviceID]
+}
+
+type testEnv struct {
+	controller *Controller
+	clock      *fakeClock
+	scheduler  *fakeScheduler
+	store      *memStateStore
+}
+
+func newTestEnv(t *testing.T, config Config) *testEnv {
+	profile, err := board.Get("rpi3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	env := &testEnv{clock: newFakeClock(), scheduler: &fakeScheduler{}, store: newMemStateStore()}
+	config.Simulate = true
+	config.Board = profile
+	config.Clock = env.clock
+	config.Scheduler = env.scheduler
+	env.controller, err = New(simplejack.New(simplejack.TRACE, ioutil.Discard), env.store, config)
+	if err != nil {
+		t.Fatalf("Could not create the controller: %v", err)
+	}
+	return env
+}
+
+func newTestShutter(id int64, openPin, closePin, completeWayInSeconds, openingInPrc int) *model.Shutter {
+	descr := "testshutter"
+	floorID := int64(1)
+	return &model.Shutter{
+		Base:                 model.Base{ID: id},
+		Description:          &descr,
+		OpenPin:              &openPin,
+		ClosePin:             &closePin,
+		CompleteWayInSeconds: &completeWayInSeconds,
+		OpeningInPrc:         openingInPrc,
+		OpenTime:             time.Date(0, 1, 1, 7, 30, 0, 0, time.UTC),
+		CloseTime:            time.Date(0, 1, 1, 20, 0, 0, 0, time.UTC),
+		DeviceStatus:         "stopped",
+		FloorID:              &floorID,
+	}
+}
+
+func newTestLighting(id int64, switchPin int) *model.Lighting {
+	descr := "testlighting"
+	floorID := int64(1)
+	return &model.Lighting{
+		Base:         model.Base{ID: id},
+		Description:  &descr,
+		SwitchPin:    &switchPin,
+		OnTime:       time.Date(0, 1, 1, 18, 0, 0, 0, time.UTC),
+		OffTime:      time.Date(0, 1, 1, 23, 15, 0, 0, time.UTC),
+		DeviceStatus: "off",
+		FloorID:      &floorID,
+	}
+}
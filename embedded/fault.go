@@ -0,0 +1,105 @@
+package embedded
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/he4d/almue-backend/model"
+)
+
+// faults holds the faults of the devices. A fault is recorded when a background operation
+// of a device fails, like a shutter run, a state update or a job. The device refuses to
+// run until it is reset, only stopping a shutter and turning off a lighting stay possible.
+type faults struct {
+	sync.Mutex
+	devices map[string]*model.DeviceFault
+}
+
+// recordFault logs the error of a background operation and stores it as the fault of the device.
+// The first fault is kept until the device is reset, as it is the one that needs attention
+func (c *Controller) recordFault(deviceType string, deviceID int64, err error) {
+	f := &c.faults
+	f.Lock()
+	if f.devices == nil {
+		f.devices = map[string]*model.DeviceFault{}
+	}
+	key := deviceKey(deviceType, deviceID)
+	if _, ok := f.devices[key]; ok {
+		f.Unlock()
+		return
+	}
+	fault := &model.DeviceFault{Message: err.Error(), Time: c.clock.Now()}
+	f.devices[key] = fault
+	f.Unlock()
+
+	c.logger.Error.Printf("The %s %d has a fault: %v", deviceType, deviceID, err)
+	var storeErr error
+	if deviceType == model.DeviceTypeShutter {
+		storeErr = c.stateStore.UpdateShutterFault(deviceID, fault)
+	} else {
+		storeErr = c.stateStore.UpdateLightingFault(deviceID, fault)
+	}
+	if storeErr != nil {
+		c.logger.Error.Printf("Could not store the fault of %s %d: %v", deviceType, deviceID, storeErr)
+	}
+}
+
+// setFault replaces the fault of the device without storing it, nil removes the fault
+func (c *Controller) setFault(deviceType string, deviceID int64, fault *model.DeviceFault) {
+	f := &c.faults
+	f.Lock()
+	defer f.Unlock()
+	key := deviceKey(deviceType, deviceID)
+	if fault == nil {
+		delete(f.devices, key)
+		return
+	}
+	if f.devices == nil {
+		f.devices = map[string]*model.DeviceFault{}
+	}
+	f.devices[key] = fault.DeepCopy()
+}
+
+// hasFault reports if the device has a fault
+func (c *Controller) hasFault(deviceType string, deviceID int64) bool {
+	c.faults.Lock()
+	defer c.faults.Unlock()
+	_, ok := c.faults.devices[deviceKey(deviceType, deviceID)]
+	return ok
+}
+
+// checkFault returns an error if the device has a fault and must be reset before it can run again
+func (c *Controller) checkFault(deviceType string, deviceID int64) error {
+	c.faults.Lock()
+	defer c.faults.Unlock()
+	if fault, ok := c.faults.devices[deviceKey(deviceType, deviceID)]; ok {
+		return fmt.Errorf("The %s %d has a fault and must be reset: %s", deviceType, deviceID, fault.Message)
+	}
+	return nil
+}
+
+// ResetShutter stops the shutter with the given id and clears its fault
+func (c *Controller) ResetShutter(shutterID int64) error {
+	if _, err := c.getShutterByID(shutterID); err != nil {
+		return err
+	}
+	c.setFault(model.DeviceTypeShutter, shutterID, nil)
+	if err := c.StopShutter(shutterID); err != nil {
+		c.recordFault(model.DeviceTypeShutter, shutterID, err)
+		return err
+	}
+	return c.stateStore.UpdateShutterFault(shutterID, nil)
+}
+
+// ResetLighting turns off the lighting with the given id and clears its fault
+func (c *Controller) ResetLighting(lightingID int64) error {
+	if _, err := c.getLightingByID(lightingID); err != nil {
+		return err
+	}
+	c.setFault(model.DeviceTypeLighting, lightingID, nil)
+	if err := c.TurnLightingOff(lightingID); err != nil {
+		c.recordFault(model.DeviceTypeLighting, lightingID, err)
+		return err
+	}
+	return c.stateStore.UpdateLightingFault(lightingID, nil)
+}
@@ -0,0 +1,106 @@
+package embedded
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/he4d/almue-backend/model"
+	"periph.io/x/periph/conn/gpio"
+)
+
+func TestShutterRunFault(t *testing.T) {
+	env := newTestEnv(t, Config{})
+	if err := env.controller.RegisterShutters(newTestShutter(1, 17, 27, 20, 0)); err != nil {
+		t.Fatal(err)
+	}
+
+	// the shutter stops when its opening can not be stored while it runs
+	if err := env.controller.OpenShutter(1); err != nil {
+		t.Fatal(err)
+	}
+	env.store.Lock()
+	env.store.openingErr = errors.New("disk full")
+	env.store.Unlock()
+	env.clock.Advance(time.Second)
+	env.assertShutter(t, 1, model.DeviceStatusFault, 0)
+	env.assertRelays(t, 1, gpio.Low, gpio.Low)
+	fault := env.store.fault(model.DeviceTypeShutter, 1)
+	if fault == nil || !strings.Contains(fault.Message, "disk full") || !fault.Time.Equal(env.clock.Now()) {
+		t.Fatalf("Expected the fault of the run to be stored but got %+v", fault)
+	}
+
+	// the shutter does not move until it is reset, stopping keeps the fault
+	if err := env.controller.OpenShutter(1); err == nil {
+		t.Error("Expected a shutter with a fault not to open")
+	}
+	if err := env.controller.StopShutter(1); err != nil {
+		t.Fatal(err)
+	}
+	env.assertShutter(t, 1, model.DeviceStatusFault, 0)
+
+	env.store.Lock()
+	env.store.openingErr = nil
+	env.store.Unlock()
+	if err := env.controller.ResetShutter(1); err != nil {
+		t.Fatal(err)
+	}
+	env.assertShutter(t, 1, "stopped", 0)
+	if fault := env.store.fault(model.DeviceTypeShutter, 1); fault != nil {
+		t.Errorf("Expected the fault to be cleared but got %+v", fault)
+	}
+	if err := env.controller.OpenShutter(1); err != nil {
+		t.Errorf("Expected the reset shutter to open but got %v", err)
+	}
+}
+
+func TestJobFault(t *testing.T) {
+	env := newTestEnv(t, Config{})
+	lighting := newTestLighting(1, 4)
+	lighting.JobsEnabled = true
+	if err := env.controller.RegisterLightings(lighting); err != nil {
+		t.Fatal(err)
+	}
+
+	// the on job fails as the controller does not know the lighting anymore
+	env.controller.lightingsLock.Lock()
+	delete(env.controller.lightings, 1)
+	env.controller.lightingsLock.Unlock()
+	env.scheduler.fire(18, 0)
+	fault := env.store.fault(model.DeviceTypeLighting, 1)
+	if fault == nil || !strings.Contains(fault.Message, "on job failed") || env.store.lightingState(1) != model.DeviceStatusFault {
+		t.Fatalf("Expected the failed job to be stored as a fault but got %+v", fault)
+	}
+}
+
+func TestRegisterDeviceWithFault(t *testing.T) {
+	env := newTestEnv(t, Config{})
+	lighting := newTestLighting(1, 4)
+	lighting.DeviceStatus = model.DeviceStatusFault
+	lighting.Fault = &model.DeviceFault{Message: "relay stuck", Time: env.clock.Now().Add(-time.Hour)}
+	if err := env.controller.RegisterLightings(lighting); err != nil {
+		t.Fatal(err)
+	}
+
+	// the stored fault survives a restart of the controller
+	if err := env.controller.TurnLightingOn(1); err == nil || !strings.Contains(err.Error(), "relay stuck") {
+		t.Errorf("Expected the lighting with a stored fault not to turn on but got %v", err)
+	}
+	if err := env.controller.TurnLightingOff(1); err != nil {
+		t.Fatal(err)
+	}
+	if state := env.store.lightingState(1); state != model.DeviceStatusFault {
+		t.Errorf("Expected the lighting to keep the fault state but it is %s", state)
+	}
+
+	if _, err := env.controller.SubmitCommand(&model.Command{
+		DeviceType: model.DeviceTypeLighting, DeviceID: 1, Action: "reset", Source: model.CommandSourceAPI,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "the reset", func() bool { return env.store.lightingState(1) == "off" })
+	if err := env.controller.TurnLightingOn(1); err != nil {
+		t.Errorf("Expected the reset lighting to turn on but got %v", err)
+	}
+}
@@ -0,0 +1,39 @@
+package embedded
+
+import (
+	"time"
+
+	"github.com/he4d/almue-backend/model"
+)
+
+// historyRetention is the time the recorded device events are kept in the state store
+const historyRetention = 28 * 24 * time.Hour
+
+// recordEvent records the state change of a device in the history of the state store.
+// The changes by the commands of the presence simulation are not recorded, so a simulation never
+// replays itself, but the changes of a simulated device by any other source are. The source is the
+// one of the command that changed the state. Recording is best effort and never fails a command.
+func (c *Controller) recordEvent(deviceType string, deviceID int64, state, source string) {
+	if source == model.CommandSourcePresence {
+		return
+	}
+	now := c.clock.Now()
+	event := &model.DeviceEvent{DeviceType: deviceType, DeviceID: deviceID, State: state, Time: now}
+	if err := c.stateStore.AddDeviceEvent(event); err != nil {
+		c.logger.Warning.Printf("Could not record the state %s of %s %d: %v", state, deviceType, deviceID, err)
+		return
+	}
+
+	// the old events are deleted once a day
+	c.historyLock.Lock()
+	prune := now.Sub(c.lastPrune) >= 24*time.Hour
+	if prune {
+		c.lastPrune = now
+	}
+	c.historyLock.Unlock()
+	if prune {
+		if err := c.stateStore.DeleteDeviceEvents(now.Add(-historyRetention)); err != nil {
+			c.logger.Warning.Printf("Could not delete the old device events: %v", err)
+		}
+	}
+}
@@ -1,5 +1,11 @@
 package embedded
 
+import (
+	"time"
+
+	"github.com/he4d/almue-backend/model"
+)
+
 //DeviceStateStore must be implemented by the store that supports methods for updating the states of the devices
 type DeviceStateStore interface {
 	UpdateLightingState(int64, string) error
@@ -7,4 +13,14 @@ type DeviceStateStore interface {
 	UpdateShutterState(int64, string) error
 
 	UpdateShutterOpening(int64, int) error
+
+	UpdateLightingFault(int64, *model.DeviceFault) error
+
+	UpdateShutterFault(int64, *model.DeviceFault) error
+
+	AddDeviceEvent(*model.DeviceEvent) error
+
+	FindDeviceEvents(since time.Time) ([]*model.DeviceEvent, error)
+
+	DeleteDeviceEvents(before time.Time) error
 }
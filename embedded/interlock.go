@@ -0,0 +1,164 @@
+package embedded
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/he4d/almue-backend/model"
+	"periph.io/x/periph/conn/gpio"
+)
+
+type motorDirection int
+
+const (
+	motorStopped motorDirection = iota
+	motorOpening
+	motorClosing
+)
+
+func (d motorDirection) String() string {
+	switch d {
+	case motorOpening:
+		return "opening"
+	case motorClosing:
+		return "closing"
+	}
+	return "stopped"
+}
+
+var errInterlock = errors.New("The open and close relay of a shutter must never be switched on at the same time")
+
+// watchdogMargin is the time a run may take longer than the complete way of its shutter,
+// e.g. by the rounding of its ticks. The watchdog must never stop a regular run
+const watchdogMargin = 10 * time.Second
+
+// CheckCompleteWay checks that a shutter with the given complete way reaches its end position
+// before the watchdog stops its motor after the maximum run time
+func (c *Controller) CheckCompleteWay(completeWay time.Duration) error {
+	if c.config.MaxRunTime > 0 && completeWay+watchdogMargin >= c.config.MaxRunTime {
+		return fmt.Errorf("The complete way of %v plus a margin of %v must be shorter than the maximum run time of %v",
+			completeWay, watchdogMargin, c.config.MaxRunTime)
+	}
+	return nil
+}
+
+// pauseBefore returns how long the motor of the shutter still has to rest before it may run in the given direction.
+// The motor rests for the reversal dead time before changing its direction and for the minimum pause between two runs.
+// The shutter must be locked by the caller.
+func (c *Controller) pauseBefore(device *shutter, direction motorDirection) time.Duration {
+	pause := c.config.MinPause
+	if device.lastDirection != motorStopped && device.lastDirection != direction && c.config.ReversalDeadTime > pause {
+		pause = c.config.ReversalDeadTime
+	}
+	if wait := pause - c.clock.Now().Sub(device.lastStop); wait > 0 {
+		return wait
+	}
+	return 0
+}
+
+// drive switches the relays of the shutter so that its motor runs in the given direction.
+// It is the only place where the relays of a shutter get switched and guarantees that
+// the open and close pin are never high at the same time, that the motor never runs before
+// its pause is over and that the motor is stopped by the watchdog after the maximum run time.
+// The caller waits for the pause, drive never blocks.
+// The shutter must be locked by the caller.
+func (c *Controller) drive(shutterID int64, device *shutter, direction motorDirection) error {
+	if direction == device.direction {
+		return nil
+	}
+
+	if device.direction != motorStopped {
+		if err := c.release(shutterID, device); err != nil {
+			return err
+		}
+	}
+
+	if direction == motorStopped {
+		return nil
+	}
+
+	if wait := c.pauseBefore(device, direction); wait > 0 {
+		return fmt.Errorf("The motor of shutter %d must rest %v before %s", shutterID, wait, direction)
+	}
+
+	var err error
+	if direction == motorOpening {
+		err = device.setRelays(gpio.High, gpio.Low)
+	} else {
+		err = device.setRelays(gpio.Low, gpio.High)
+	}
+	if err != nil {
+		// never leave a relay switched on after a failure
+		if releaseErr := c.release(shutterID, device); releaseErr != nil {
+			c.logger.Error.Printf("Could not release the relays of shutter %d: %v", shutterID, releaseErr)
+		}
+		return err
+	}
+	device.direction = direction
+	device.runStart = c.clock.Now()
+	c.traceLogger(device.trace, model.DeviceTypeShutter, shutterID).Info.Printf("Shutter %d switched its relays to %s", shutterID, direction)
+
+	if c.config.MaxRunTime > 0 {
+		run := device.run
+		device.watchdog = c.clock.AfterFunc(c.config.MaxRunTime, func() {
+			c.logger.Warning.Printf("Shutter %d exceeded the maximum run time of %v and gets stopped", shutterID, c.config.MaxRunTime)
+			c.stopShutterRun(shutterID, device, run)
+		})
+	}
+	return nil
+}
+
+// release switches both relays of the shutter off, stops the watchdog and counts the runtime of the motor.
+// The shutter must be locked by the caller.
+func (c *Controller) release(shutterID int64, device *shutter) error {
+	if device.watchdog != nil {
+		device.watchdog.Stop()
+		device.watchdog = nil
+	}
+	if err := device.setRelays(gpio.Low, gpio.Low); err != nil {
+		return err
+	}
+	if device.direction != motorStopped {
+		device.lastDirection = device.direction
+		device.lastStop = c.clock.Now()
+		motorRuntime.Add(device.lastStop.Sub(device.runStart).Seconds(), deviceLabel(shutterID), device.direction.String())
+		trace := c.runningTrace(model.DeviceTypeShutter, shutterID)
+		if trace == "" {
+			trace = device.trace
+		}
+		c.traceLogger(trace, model.DeviceTypeShutter, shutterID).Info.Printf("Shutter %d released its relays after %s for %v",
+			shutterID, device.direction, device.lastStop.Sub(device.runStart))
+	}
+	device.direction = motorStopped
+	return nil
+}
+
+// setRelays sets the levels of the open and close pin. Pins that get switched off are
+// always switched before pins that get switched on, so both are never high at the same time.
+func (s *shutter) setRelays(open, close gpio.Level) error {
+	if open == gpio.High && close == gpio.High {
+		return errInterlock
+	}
+	if open == gpio.Low {
+		if err := s.openPin.Out(gpio.Low); err != nil {
+			return err
+		}
+	}
+	if close == gpio.Low {
+		if err := s.closePin.Out(gpio.Low); err != nil {
+			return err
+		}
+	}
+	if open == gpio.High {
+		if err := s.openPin.Out(gpio.High); err != nil {
+			return err
+		}
+	}
+	if close == gpio.High {
+		if err := s.closePin.Out(gpio.High); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,220 @@
+package embedded
+
+import (
+	"testing"
+	"time"
+
+	"github.com/he4d/almue-backend/model"
+	"periph.io/x/periph/conn/gpio"
+)
+
+func TestReverseShutter(t *testing.T) {
+	env := newTestEnv(t, Config{ReversalDeadTime: time.Second})
+	if err := env.controller.RegisterShutters(newTestShutter(1, 17, 27, 20, 0)); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := env.controller.OpenShutter(1); err != nil {
+		t.Fatal(err)
+	}
+	env.clock.Advance(10 * time.Second)
+	reversed := env.clock.Now()
+	if err := env.controller.CloseShutter(1); err != nil {
+		t.Fatal(err)
+	}
+	// the close relay is switched after the reversal dead time
+	env.assertRelays(t, 1, gpio.Low, gpio.Low)
+	env.clock.Advance(999 * time.Millisecond)
+	env.assertRelays(t, 1, gpio.Low, gpio.Low)
+	env.clock.Advance(time.Millisecond)
+	env.assertShutter(t, 1, "closing", 50)
+	env.assertRelays(t, 1, gpio.Low, gpio.High)
+
+	device, _ := env.controller.getShutterByID(1)
+	for _, event := range device.closePin.(*simulatePinIO).state().History {
+		if event.High && event.Time.Before(reversed.Add(time.Second)) {
+			t.Errorf("Close relay was switched on during the reversal dead time at %v", event.Time)
+		}
+	}
+}
+
+func TestMinPause(t *testing.T) {
+	env := newTestEnv(t, Config{MinPause: 3 * time.Second})
+	if err := env.controller.RegisterShutters(newTestShutter(1, 17, 27, 20, 0)); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := env.controller.OpenShutter(1); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.controller.StopShutter(1); err != nil {
+		t.Fatal(err)
+	}
+	env.clock.Advance(time.Second)
+	if err := env.controller.OpenShutter(1); err != nil {
+		t.Fatal(err)
+	}
+	// the run starts after the rest of the minimum pause
+	env.clock.Advance(2*time.Second - time.Millisecond)
+	env.assertShutter(t, 1, "stopped", 0)
+	env.assertRelays(t, 1, gpio.Low, gpio.Low)
+	env.clock.Advance(time.Millisecond)
+	env.assertShutter(t, 1, "opening", 0)
+	env.assertRelays(t, 1, gpio.High, gpio.Low)
+}
+
+func TestStopDuringPause(t *testing.T) {
+	env := newTestEnv(t, Config{MinPause: 3 * time.Second, ReversalDeadTime: time.Second})
+	if err := env.controller.RegisterShutters(newTestShutter(1, 17, 27, 20, 0)); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.controller.OpenShutter(1); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.controller.StopShutter(1); err != nil {
+		t.Fatal(err)
+	}
+
+	// the last move during the pause wins
+	if err := env.controller.OpenShutter(1); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.controller.CloseShutter(1); err != nil {
+		t.Fatal(err)
+	}
+	env.clock.Advance(3 * time.Second)
+	env.assertShutter(t, 1, "referencing", 0)
+	env.assertRelays(t, 1, gpio.Low, gpio.High)
+
+	// a stop during the pause cancels the pending start
+	if err := env.controller.StopShutter(1); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.controller.OpenShutter(1); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.controller.StopShutter(1); err != nil {
+		t.Fatal(err)
+	}
+	env.clock.Advance(5 * time.Second)
+	env.assertShutter(t, 1, "stopped", 0)
+	env.assertRelays(t, 1, gpio.Low, gpio.Low)
+
+	device, _ := env.controller.getShutterByID(1)
+	switchedOn := 0
+	for _, event := range device.openPin.(*simulatePinIO).state().History {
+		if event.High {
+			switchedOn++
+		}
+	}
+	if switchedOn != 1 {
+		t.Errorf("Expected the open relay to be switched on only for the first run but it was switched on %d times", switchedOn)
+	}
+}
+
+func TestShutterWatchdog(t *testing.T) {
+	env := newTestEnv(t, Config{MaxRunTime: 35 * time.Second})
+	if err := env.controller.RegisterShutters(newTestShutter(1, 17, 27, 20, 0)); err != nil {
+		t.Fatal(err)
+	}
+
+	// a regular run ends at the end position before the watchdog
+	if err := env.controller.OpenShutter(1); err != nil {
+		t.Fatal(err)
+	}
+	env.clock.Advance(21 * time.Second)
+	env.assertShutter(t, 1, "stopped", 100)
+
+	// a run that lost its end is stopped by the watchdog
+	device, _ := env.controller.getShutterByID(1)
+	device.Lock()
+	err := env.controller.drive(1, device, motorClosing)
+	device.Unlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	env.clock.Advance(34 * time.Second)
+	env.assertRelays(t, 1, gpio.Low, gpio.High)
+	env.clock.Advance(time.Second)
+	env.assertShutter(t, 1, "stopped", 100)
+	env.assertRelays(t, 1, gpio.Low, gpio.Low)
+}
+
+func TestCompleteWayWithinWatchdog(t *testing.T) {
+	env := newTestEnv(t, Config{MaxRunTime: 30 * time.Second})
+	if err := env.controller.RegisterShutters(newTestShutter(1, 17, 27, 20, 0)); err == nil {
+		t.Error("Expected an error on registering a shutter that the watchdog would stop before its end position")
+	}
+	if _, err := env.controller.getShutterByID(1); err == nil {
+		t.Error("Expected the shutter not to be registered")
+	}
+
+	shutter := newTestShutter(1, 17, 27, 19, 0)
+	if err := env.controller.RegisterShutters(shutter); err != nil {
+		t.Fatal(err)
+	}
+	way := 20
+	shutter.CompleteWayInSeconds = &way
+	if err := env.controller.UpdateShutter(model.DIFFCOMPLETEWAYINSECONDS, shutter); err == nil {
+		t.Error("Expected an error on updating the complete way beyond the watchdog")
+	}
+	device, _ := env.controller.getShutterByID(1)
+	if device.completeWayDuration != 19*time.Second {
+		t.Errorf("Expected the complete way to be kept but got %v", device.completeWayDuration)
+	}
+}
+
+func TestRelaysNeverBothHigh(t *testing.T) {
+	env := newTestEnv(t, Config{})
+	if err := env.controller.RegisterShutters(newTestShutter(1, 17, 27, 20, 0)); err != nil {
+		t.Fatal(err)
+	}
+	device, _ := env.controller.getShutterByID(1)
+	if err := device.setRelays(gpio.High, gpio.High); err != errInterlock {
+		t.Errorf("Expected the interlock error but got %v", err)
+	}
+	env.assertRelays(t, 1, gpio.Low, gpio.Low)
+}
+
+func TestDriveRefusesDuringPause(t *testing.T) {
+	env := newTestEnv(t, Config{MinPause: 3 * time.Second})
+	if err := env.controller.RegisterShutters(newTestShutter(1, 17, 27, 20, 0)); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.controller.OpenShutter(1); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.controller.StopShutter(1); err != nil {
+		t.Fatal(err)
+	}
+
+	device, _ := env.controller.getShutterByID(1)
+	device.Lock()
+	err := env.controller.drive(1, device, motorOpening)
+	device.Unlock()
+	if err == nil {
+		t.Error("Expected the relays not to be switched before the pause is over")
+	}
+	env.assertRelays(t, 1, gpio.Low, gpio.Low)
+}
+
+func TestFaultDuringPause(t *testing.T) {
+	env := newTestEnv(t, Config{MinPause: 3 * time.Second})
+	if err := env.controller.RegisterShutters(newTestShutter(1, 17, 27, 20, 0)); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.controller.OpenShutter(1); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.controller.StopShutter(1); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.controller.OpenShutter(1); err != nil {
+		t.Fatal(err)
+	}
+
+	// a shutter that got a fault during the pause does not start
+	env.controller.recordFault(model.DeviceTypeShutter, 1, errInterlock)
+	env.clock.Advance(5 * time.Second)
+	env.assertRelays(t, 1, gpio.Low, gpio.Low)
+}
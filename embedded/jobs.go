@@ -0,0 +1,164 @@
+package embedded
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/he4d/almue-backend/model"
+)
+
+// jobRegistry keeps the daily jobs of the devices and the outcome of their last runs.
+// The outcome survives rescheduling a job and gets dropped when its device is unregistered.
+type jobRegistry struct {
+	sync.Mutex
+	jobs map[jobKey]*jobEntry
+}
+
+type jobEntry struct {
+	scheduled   bool
+	scheduledAt time.Time
+	hour        int
+	minute      int
+	lastRun     time.Time
+	lastResult  string
+	lastError   string
+}
+
+// registerJob adds the scheduled job to the registry
+func (c *Controller) registerJob(key jobKey, hour, minute int) {
+	c.jobs.Lock()
+	defer c.jobs.Unlock()
+	if c.jobs.jobs == nil {
+		c.jobs.jobs = map[jobKey]*jobEntry{}
+	}
+	entry, ok := c.jobs.jobs[key]
+	if !ok {
+		entry = &jobEntry{}
+		c.jobs.jobs[key] = entry
+	}
+	entry.scheduled = true
+	entry.scheduledAt = c.clock.Now()
+	entry.hour = hour
+	entry.minute = minute
+}
+
+// unregisterJobs marks the jobs of the device as unscheduled, if forget is set their outcome is dropped as well
+func (c *Controller) unregisterJobs(deviceType string, deviceID int64, forget bool) {
+	c.jobs.Lock()
+	defer c.jobs.Unlock()
+	for key, entry := range c.jobs.jobs {
+		if key.deviceType != deviceType || key.deviceID != deviceID {
+			continue
+		}
+		if forget {
+			delete(c.jobs.jobs, key)
+		} else {
+			entry.scheduled = false
+		}
+	}
+}
+
+// recordJobRun stores the outcome of a run of the job
+func (c *Controller) recordJobRun(key jobKey, result string, err error) {
+	jobRuns.Inc(key.deviceType, key.job, result)
+	c.jobs.Lock()
+	defer c.jobs.Unlock()
+	entry, ok := c.jobs.jobs[key]
+	if !ok {
+		return
+	}
+	entry.lastRun = c.clock.Now()
+	entry.lastResult = result
+	entry.lastError = ""
+	if err != nil {
+		entry.lastError = err.Error()
+	}
+}
+
+// Jobs returns the scheduled daily jobs of all devices ordered by their next run,
+// the jobs without a next run come last
+func (c *Controller) Jobs() []*model.JobStatus {
+	now := c.clock.Now()
+	type scheduledJob struct {
+		key          jobKey
+		hour, minute int
+		status       *model.JobStatus
+	}
+	scheduled := []scheduledJob{}
+	c.jobs.Lock()
+	for key, entry := range c.jobs.jobs {
+		if !entry.scheduled {
+			continue
+		}
+		status := &model.JobStatus{
+			DeviceType: key.deviceType,
+			DeviceID:   key.deviceID,
+			Job:        key.job,
+			TimeOfDay:  fmt.Sprintf("%02d:%02d", entry.hour, entry.minute),
+			LastResult: entry.lastResult,
+			LastError:  entry.lastError,
+		}
+		if !entry.lastRun.IsZero() {
+			lastRun := entry.lastRun
+			status.LastRun = &lastRun
+		}
+		scheduled = append(scheduled, scheduledJob{key, entry.hour, entry.minute, status})
+	}
+	c.jobs.Unlock()
+
+	// the calendar and the presence are consulted after the registry is unlocked,
+	// as the runs of the jobs lock them before the registry
+	jobs := []*model.JobStatus{}
+	for _, s := range scheduled {
+		if c.presence.suspends(s.key.deviceType, s.key.deviceID) {
+			s.status.Suspended = true
+		} else {
+			s.status.NextRun = c.nextJobRun(s.key, now, s.hour, s.minute)
+		}
+		jobs = append(jobs, s.status)
+	}
+	sort.Slice(jobs, func(i, j int) bool {
+		a, b := jobs[i], jobs[j]
+		if (a.NextRun == nil) != (b.NextRun == nil) {
+			return a.NextRun != nil
+		}
+		if a.NextRun != nil && !a.NextRun.Equal(*b.NextRun) {
+			return a.NextRun.Before(*b.NextRun)
+		}
+		if a.DeviceType != b.DeviceType {
+			return a.DeviceType < b.DeviceType
+		}
+		return a.DeviceID < b.DeviceID
+	})
+	return jobs
+}
+
+// missedJobs counts the scheduled jobs that did not run at their last time of day.
+// Every run of a job is recorded, even a skipped one, so a missed run means that the scheduler does not run the jobs
+func (c *Controller) missedJobs() int {
+	now := c.clock.Now()
+	c.jobs.Lock()
+	defer c.jobs.Unlock()
+	missed := 0
+	for _, entry := range c.jobs.jobs {
+		if !entry.scheduled {
+			continue
+		}
+		last := nextDaily(now, entry.hour, entry.minute).AddDate(0, 0, -1)
+		if last.After(entry.scheduledAt) && entry.lastRun.Before(last) && now.Sub(last) > schedulerGracePeriod {
+			missed++
+		}
+	}
+	return missed
+}
+
+// nextDaily returns the next time after now at which a daily job of the given time of day runs
+func nextDaily(now time.Time, hour, minute int) time.Time {
+	next := time.Date(now.Year(), now.Month(), now.Day(), hour, minute, 0, 0, now.Location())
+	if !next.After(now) {
+		next = next.AddDate(0, 0, 1)
+	}
+	return next
+}
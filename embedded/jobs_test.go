@@ -0,0 +1,209 @@
+package embedded
+
+import (
+	"testing"
+	"time"
+
+	"github.com/he4d/almue-backend/model"
+)
+
+func TestJobRegistry(t *testing.T) {
+	env := newTestEnv(t, Config{})
+	shutter := newTestShutter(1, 17, 27, 20, 0)
+	shutter.JobsEnabled = true
+	lighting := newTestLighting(1, 4)
+	lighting.JobsEnabled = true
+	if err := env.controller.RegisterShutters(shutter); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.controller.RegisterLightings(lighting); err != nil {
+		t.Fatal(err)
+	}
+
+	// the clock starts at 6:00, so the open job runs first
+	jobs := env.controller.Jobs()
+	today := env.clock.Now().Truncate(24 * time.Hour)
+	expected := []struct {
+		deviceType, job, timeOfDay string
+		next                       time.Time
+	}{
+		{"shutter", model.JobOpen, "07:30", today.Add(7*time.Hour + 30*time.Minute)},
+		{"lighting", model.JobOn, "18:00", today.Add(18 * time.Hour)},
+		{"shutter", model.JobClose, "20:00", today.Add(20 * time.Hour)},
+		{"lighting", model.JobOff, "23:15", today.Add(23*time.Hour + 15*time.Minute)},
+	}
+	if len(jobs) != len(expected) {
+		t.Fatalf("Expected %d jobs but got %d", len(expected), len(jobs))
+	}
+	for i, e := range expected {
+		job := jobs[i]
+		if job.DeviceType != e.deviceType || job.DeviceID != 1 || job.Job != e.job ||
+			job.TimeOfDay != e.timeOfDay || !job.NextRun.Equal(e.next) || job.LastRun != nil {
+			t.Errorf("Expected the %s job of the %s at %v but got %+v", e.job, e.deviceType, e.next, job)
+		}
+	}
+
+	// the outcome of a run is kept when the jobs get rescheduled
+	env.clock.Advance(90 * time.Minute)
+	env.scheduler.fire(7, 30)
+	if err := env.controller.rescheduleShutterJobs(shutter); err != nil {
+		t.Fatal(err)
+	}
+	jobs = env.controller.Jobs()
+	open := jobs[len(jobs)-1]
+	if open.Job != model.JobOpen || !open.NextRun.Equal(today.Add(31*time.Hour+30*time.Minute)) ||
+		open.LastRun == nil || !open.LastRun.Equal(env.clock.Now()) || open.LastResult != model.JobResultOK {
+		t.Errorf("Expected the open job to have run and to run tomorrow again but got %+v", open)
+	}
+
+	if err := env.controller.SetCalendarExceptions([]*model.CalendarException{
+		{StartDate: "2017-10-02", EndDate: "2017-10-02", Action: model.CalendarSkip, AllDevices: true},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	env.scheduler.fire(18, 0)
+	for _, job := range env.controller.Jobs() {
+		if job.Job == model.JobOn && job.LastResult != model.JobResultSkipped {
+			t.Errorf("Expected the on job to be skipped but got %+v", job)
+		}
+	}
+
+	// unscheduling hides the jobs, unregistering forgets them
+	if err := env.controller.UnscheduleLightingJobs(1); err != nil {
+		t.Fatal(err)
+	}
+	if jobs := env.controller.Jobs(); len(jobs) != 2 {
+		t.Errorf("Expected only the jobs of the shutter but got %d jobs", len(jobs))
+	}
+	if err := env.controller.UnregisterShutter(1); err != nil {
+		t.Fatal(err)
+	}
+	if jobs := env.controller.Jobs(); len(jobs) != 0 {
+		t.Errorf("Expected no jobs but got %d", len(jobs))
+	}
+}
+
+func TestJobsNextRun(t *testing.T) {
+	env := newTestEnv(t, Config{})
+	lighting := newTestLighting(1, 4)
+	lighting.JobsEnabled = true
+	if err := env.controller.RegisterLightings(lighting); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.controller.SetCalendarExceptions([]*model.CalendarException{
+		{StartDate: "2017-10-02", EndDate: "2017-10-02", Action: model.CalendarSkip, Jobs: []string{model.JobOn}, AllDevices: true},
+		{StartDate: "2017-10-02", EndDate: "2017-10-02", Action: model.CalendarShift, ShiftMinutes: 30, Jobs: []string{model.JobOff}, AllDevices: true},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	nextRuns := func() map[string]*time.Time {
+		runs := map[string]*time.Time{}
+		for _, job := range env.controller.Jobs() {
+			if job.Suspended != (job.NextRun == nil) {
+				t.Errorf("Expected only a suspended job to have no next run but got %+v", job)
+			}
+			runs[job.Job] = job.NextRun
+		}
+		return runs
+	}
+
+	// the skipped on job runs tomorrow, the off job runs later today
+	today := env.clock.Now().Truncate(24 * time.Hour)
+	runs := nextRuns()
+	if on := runs[model.JobOn]; on == nil || !on.Equal(today.Add(42*time.Hour)) {
+		t.Errorf("Expected the on job to run tomorrow but got %v", on)
+	}
+	if off := runs[model.JobOff]; off == nil || !off.Equal(today.Add(23*time.Hour+45*time.Minute)) {
+		t.Errorf("Expected the off job to run shifted but got %v", off)
+	}
+
+	// a shifted job runs at its shifted time even if the exception is gone
+	env.clock.Advance(17*time.Hour + 15*time.Minute)
+	env.scheduler.fire(23, 15)
+	if err := env.controller.SetCalendarExceptions(nil); err != nil {
+		t.Fatal(err)
+	}
+	if off := nextRuns()[model.JobOff]; off == nil || !off.Equal(today.Add(23*time.Hour+45*time.Minute)) {
+		t.Errorf("Expected the shifted off job to wait for its shifted time but got %v", off)
+	}
+
+	// the presence simulation suspends the jobs, so they have no next run
+	settings := &model.PresenceSettings{Lightings: []int64{1}, Profile: model.PresenceProfileRandom, SuspendJobs: true}
+	if err := env.controller.StartPresenceSimulation(settings); err != nil {
+		t.Fatal(err)
+	}
+	for job, next := range nextRuns() {
+		if next != nil {
+			t.Errorf("Expected the suspended %s job to have no next run but got %v", job, next)
+		}
+	}
+}
+
+func TestJobRegistryRecordsFailures(t *testing.T) {
+	env := newTestEnv(t, Config{})
+	lighting := newTestLighting(1, 4)
+	lighting.JobsEnabled = true
+	if err := env.controller.RegisterLightings(lighting); err != nil {
+		t.Fatal(err)
+	}
+
+	// the command of the job fails as the controller does not know the lighting anymore
+	env.controller.lightingsLock.Lock()
+	delete(env.controller.lightings, 1)
+	env.controller.lightingsLock.Unlock()
+	env.scheduler.fire(18, 0)
+	for _, job := range env.controller.Jobs() {
+		if job.Job == model.JobOn && (job.LastResult != model.JobResultFailed || job.LastError == "") {
+			t.Errorf("Expected the failure to be recorded but got %+v", job)
+		}
+	}
+}
+
+func TestJobRegistryRecordsCancelledJobs(t *testing.T) {
+	env := newTestEnv(t, Config{})
+	lighting := newTestLighting(1, 4)
+	lighting.JobsEnabled = true
+	if err := env.controller.RegisterLightings(lighting); err != nil {
+		t.Fatal(err)
+	}
+
+	// the locked lighting keeps a command running, so the command of the job gets queued
+	device, _ := env.controller.getLightingByID(1)
+	device.Lock()
+	running, err := env.controller.SubmitCommand(&model.Command{DeviceType: model.DeviceTypeLighting, DeviceID: 1, Action: "off"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "the command to run", func() bool {
+		command, _ := env.controller.Command(running.ID)
+		return command.Status == model.CommandRunning
+	})
+	fired := make(chan struct{})
+	go func() {
+		env.scheduler.fire(18, 0)
+		close(fired)
+	}()
+	var queued *model.Command
+	waitFor(t, "the command of the job to be queued", func() bool {
+		for _, command := range env.controller.Commands() {
+			if command.Source == model.CommandSourceSchedule {
+				queued = command
+			}
+		}
+		return queued != nil
+	})
+	if _, err := env.controller.CancelCommand(queued.ID); err != nil {
+		t.Fatal(err)
+	}
+	device.Unlock()
+	<-fired
+
+	for _, job := range env.controller.Jobs() {
+		if job.Job == model.JobOn && (job.LastResult != model.JobResultCancelled || job.LastError == "") {
+			t.Errorf("Expected the cancelled job to be recorded but got %+v", job)
+		}
+	}
+	if env.controller.hasFault(model.DeviceTypeLighting, 1) {
+		t.Error("Expected a cancelled job not to be a fault of the lighting")
+	}
+}
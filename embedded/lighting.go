@@ -2,32 +2,36 @@ package embedded
 
 import (
 	"fmt"
-	"strconv"
 
 	"sync"
 
 	"github.com/he4d/almue-backend/model"
-	"github.com/he4d/scheduler"
 	"periph.io/x/periph/conn/gpio"
-	"periph.io/x/periph/conn/gpio/gpioreg"
 )
 
 type lighting struct {
 	sync.Mutex
 	switchPin gpio.PinIO
-	onJob     *scheduler.Job
-	offJob    *scheduler.Job
+	on        bool
+	onJob     Job
+	offJob    Job
 }
 
 // RegisterLightings registers one or more lightings to the controller
-// If a lighting has enabled jobs it will also start the scheduling for those
+// If a lighting has enabled jobs it will also start the scheduling for those.
+// Disabled lightings are skipped, a lighting that is already registered is rejected
 func (c *Controller) RegisterLightings(lightings ...*model.Lighting) error {
 	for _, lightingModel := range lightings {
-		var switchPin gpio.PinIO
-		if c.simulate {
-			switchPin = &simulatePinIO{name: *lightingModel.Description, number: *lightingModel.SwitchPin}
-		} else {
-			switchPin = gpioreg.ByName(strconv.Itoa(*lightingModel.SwitchPin))
+		if lightingModel.Disabled {
+			continue
+		}
+		if _, err := c.getLightingByID(lightingModel.ID); err == nil {
+			// the jobs and the relay of the registered lighting would be left without a device
+			return fmt.Errorf("Lighting %d can not be registered, it is already registered", lightingModel.ID)
+		}
+		switchPin, err := c.newPin(*lightingModel.Description, *lightingModel.SwitchPin)
+		if err != nil {
+			return err
 		}
 		lightingToAdd := &lighting{
 			switchPin: switchPin,
@@ -36,9 +40,18 @@ func (c *Controller) RegisterLightings(lightings ...*model.Lighting) error {
 		c.lightingsLock.Lock()
 		c.lightings[lightingModel.ID] = lightingToAdd
 		c.lightingsLock.Unlock()
+		c.setFault(model.DeviceTypeLighting, lightingModel.ID, lightingModel.Fault)
+		lightingOn.Set(0, deviceLabel(lightingModel.ID))
 
 		if lightingModel.JobsEnabled {
 			if err := c.ScheduleLightingJobs(lightingModel); err != nil {
+				// a device is either registered completely or not at all
+				c.UnscheduleLightingJobs(lightingModel.ID)
+				c.lightingsLock.Lock()
+				delete(c.lightings, lightingModel.ID)
+				c.lightingsLock.Unlock()
+				c.setFault(model.DeviceTypeLighting, lightingModel.ID, nil)
+				lightingOn.Delete(deviceLabel(lightingModel.ID))
 				return err
 			}
 		}
@@ -49,7 +62,7 @@ func (c *Controller) RegisterLightings(lightings ...*model.Lighting) error {
 // UnregisterLighting unregisters the lighting with the given id.
 // It will also unschedule the jobs of the lighting
 func (c *Controller) UnregisterLighting(lightingID int64) error {
-	if err := c.TurnLightingOff(lightingID); err != nil {
+	if err := c.switchOffBeforeChange(lightingID); err != nil {
 		return err
 	}
 	if err := c.UnscheduleLightingJobs(lightingID); err != nil {
@@ -59,6 +72,9 @@ func (c *Controller) UnregisterLighting(lightingID int64) error {
 	c.lightingsLock.Lock()
 	delete(c.lightings, lightingID)
 	c.lightingsLock.Unlock()
+	c.unregisterJobs("lighting", lightingID, true)
+	c.setFault(model.DeviceTypeLighting, lightingID, nil)
+	lightingOn.Delete(deviceLabel(lightingID))
 	return nil
 }
 
@@ -70,16 +86,16 @@ func (c *Controller) UpdateLighting(diffs model.DifferenceType, updatedLighting
 
 	var alreadyScheduled bool
 
-	if diffs.HasFlag(model.DIFFEMERGENCYENABLED) {
-		//TODO: Emergencydevices...
-		return nil
-	}
+	//TODO: Emergencydevices... (DIFFEMERGENCYENABLED)
 	if diffs.HasFlag(model.DIFFDISABLED) {
+		// registering applies all other changes as well
 		if updatedLighting.Disabled {
-			c.UnregisterLighting(updatedLighting.ID)
-			return nil
+			return c.UnregisterLighting(updatedLighting.ID)
 		}
-		c.RegisterLightings(updatedLighting)
+		return c.RegisterLightings(updatedLighting)
+	}
+	if updatedLighting.Disabled {
+		// a disabled device is not registered, the changes apply when it gets enabled
 		return nil
 	}
 	if diffs.HasFlag(model.DIFFJOBSENABLED) {
@@ -109,24 +125,33 @@ func (c *Controller) UpdateLighting(diffs model.DifferenceType, updatedLighting
 	return nil
 }
 
-// TurnLightingOn turns on the lighting with the given ID and updates the state store
+// TurnLightingOn turns on the lighting with the given ID and updates the state store.
+// A lighting with a fault is not turned on until it is reset
 func (c *Controller) TurnLightingOn(lightingID int64) error {
 	device, err := c.getLightingByID(lightingID)
 	if err != nil {
 		return err
 	}
+	if err := c.checkFault(model.DeviceTypeLighting, lightingID); err != nil {
+		return err
+	}
 	device.Lock()
 	defer device.Unlock()
 	if err := device.switchPin.Out(gpio.High); err != nil {
 		return err
 	}
+	device.on = true
+	lightingOn.Set(1, deviceLabel(lightingID))
+	c.traceLogger(c.runningTrace(model.DeviceTypeLighting, lightingID), model.DeviceTypeLighting, lightingID).Info.Printf("Lighting %d switched on", lightingID)
 	if err := c.stateStore.UpdateLightingState(lightingID, "on"); err != nil {
 		return err
 	}
+	c.recordEvent("lighting", lightingID, "on", c.runningSource(model.DeviceTypeLighting, lightingID))
 	return nil
 }
 
-// TurnLightingOff turns off the lighting with the given ID and updates the state store
+// TurnLightingOff turns off the lighting with the given ID and updates the state store.
+// A lighting with a fault keeps the fault state
 func (c *Controller) TurnLightingOff(lightingID int64) error {
 	device, err := c.getLightingByID(lightingID)
 	if err != nil {
@@ -137,9 +162,17 @@ func (c *Controller) TurnLightingOff(lightingID int64) error {
 	if err := device.switchPin.Out(gpio.Low); err != nil {
 		return err
 	}
-	if err := c.stateStore.UpdateLightingState(lightingID, "off"); err != nil {
+	device.on = false
+	lightingOn.Set(0, deviceLabel(lightingID))
+	c.traceLogger(c.runningTrace(model.DeviceTypeLighting, lightingID), model.DeviceTypeLighting, lightingID).Info.Printf("Lighting %d switched off", lightingID)
+	state := "off"
+	if c.hasFault(model.DeviceTypeLighting, lightingID) {
+		state = model.DeviceStatusFault
+	}
+	if err := c.stateStore.UpdateLightingState(lightingID, state); err != nil {
 		return err
 	}
+	c.recordEvent("lighting", lightingID, "off", c.runningSource(model.DeviceTypeLighting, lightingID))
 	return nil
 }
 
@@ -151,18 +184,20 @@ func (c *Controller) ScheduleLightingJobs(lighting *model.Lighting) error {
 	}
 	device.Lock()
 	defer device.Unlock()
-	device.onJob, err = scheduler.Every().Day().At(fmt.Sprintf("%02d:%02d", lighting.OnTime.Hour(), lighting.OnTime.Minute())).Run(func() {
-		c.TurnLightingOn(lighting.ID)
+	device.onJob, err = c.scheduler.Daily(lighting.OnTime.Hour(), lighting.OnTime.Minute(), func() {
+		c.runJob("lighting", lighting.ID, model.JobOn)
 	})
 	if err != nil {
 		return err
 	}
-	device.offJob, err = scheduler.Every().Day().At(fmt.Sprintf("%02d:%02d", lighting.OffTime.Hour(), lighting.OffTime.Minute())).Run(func() {
-		c.TurnLightingOff(lighting.ID)
+	c.registerJob(jobKey{"lighting", lighting.ID, model.JobOn}, lighting.OnTime.Hour(), lighting.OnTime.Minute())
+	device.offJob, err = c.scheduler.Daily(lighting.OffTime.Hour(), lighting.OffTime.Minute(), func() {
+		c.runJob("lighting", lighting.ID, model.JobOff)
 	})
 	if err != nil {
 		return err
 	}
+	c.registerJob(jobKey{"lighting", lighting.ID, model.JobOff}, lighting.OffTime.Hour(), lighting.OffTime.Minute())
 	return nil
 }
 
@@ -174,28 +209,40 @@ func (c *Controller) UnscheduleLightingJobs(lightingID int64) error {
 	}
 	device.Lock()
 	if device.onJob != nil {
-		device.onJob.Quit <- true
+		device.onJob.Stop()
+		device.onJob = nil
 	}
 	if device.offJob != nil {
-		device.offJob.Quit <- true
+		device.offJob.Stop()
+		device.offJob = nil
 	}
 	device.Unlock()
+	c.cancelShiftedJobs("lighting", lightingID)
+	c.unregisterJobs("lighting", lightingID, false)
 	return nil
 }
 
+// switchOffBeforeChange switches the lighting off through its command queue before the controller changes or
+// unregisters it. The switch runs before the queued commands and is traced like them
+func (c *Controller) switchOffBeforeChange(lightingID int64) error {
+	return c.runCommand(model.DeviceTypeLighting, lightingID, "off", model.CommandSourceSystem, model.CommandPriorityHigh)
+}
+
 func (c *Controller) changeLightingPin(diffs model.DifferenceType, updatedLighting *model.Lighting) error {
-	c.TurnLightingOff(updatedLighting.ID)
+	if err := c.switchOffBeforeChange(updatedLighting.ID); err != nil {
+		return err
+	}
 	lighting, err := c.getLightingByID(updatedLighting.ID)
 	if err != nil {
 		return err
 	}
 	lighting.Lock()
-	if c.simulate {
-		lighting.switchPin = &simulatePinIO{name: *updatedLighting.Description, number: *updatedLighting.SwitchPin}
-	} else {
-		lighting.switchPin = gpioreg.ByName(strconv.Itoa(*updatedLighting.SwitchPin))
+	defer lighting.Unlock()
+	switchPin, err := c.newPin(*updatedLighting.Description, *updatedLighting.SwitchPin)
+	if err != nil {
+		return err
 	}
-	lighting.Unlock()
+	lighting.switchPin = switchPin
 	return nil
 }
 
@@ -0,0 +1,105 @@
+package embedded
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"periph.io/x/periph/conn/gpio"
+)
+
+func TestTurnLightingOnAndOff(t *testing.T) {
+	env := newTestEnv(t, Config{})
+	if err := env.controller.RegisterLightings(newTestLighting(1, 4)); err != nil {
+		t.Fatal(err)
+	}
+	device, _ := env.controller.getLightingByID(1)
+
+	if err := env.controller.TurnLightingOn(1); err != nil {
+		t.Fatal(err)
+	}
+	if state := env.store.lightingState(1); state != "on" || device.switchPin.Read() != gpio.High {
+		t.Errorf("Expected the lighting to be on but it is %s", state)
+	}
+
+	if err := env.controller.TurnLightingOff(1); err != nil {
+		t.Fatal(err)
+	}
+	if state := env.store.lightingState(1); state != "off" || device.switchPin.Read() != gpio.Low {
+		t.Errorf("Expected the lighting to be off but it is %s", state)
+	}
+}
+
+func TestScheduleLightingJobs(t *testing.T) {
+	env := newTestEnv(t, Config{})
+	lighting := newTestLighting(1, 4)
+	lighting.JobsEnabled = true
+	if err := env.controller.RegisterLightings(lighting); err != nil {
+		t.Fatal(err)
+	}
+	if jobs := env.scheduler.active(); !reflect.DeepEqual(jobs, []string{"18:00", "23:15"}) {
+		t.Errorf("Expected jobs at 18:00 and 23:15 but got %v", jobs)
+	}
+
+	env.scheduler.fire(18, 0)
+	if state := env.store.lightingState(1); state != "on" {
+		t.Errorf("Expected the lighting to be on after the on job but it is %s", state)
+	}
+
+	if err := env.controller.UnregisterLighting(1); err != nil {
+		t.Fatal(err)
+	}
+	if jobs := env.scheduler.active(); len(jobs) != 0 {
+		t.Errorf("Expected no jobs after unregistering but got %v", jobs)
+	}
+	if state := env.store.lightingState(1); state != "off" {
+		t.Errorf("Expected the lighting to be switched off on unregistering but it is %s", state)
+	}
+}
+
+func TestRegisterLightingTwice(t *testing.T) {
+	env := newTestEnv(t, Config{})
+	if err := env.controller.RegisterLightings(newTestLighting(1, 4)); err != nil {
+		t.Fatal(err)
+	}
+	device, _ := env.controller.getLightingByID(1)
+	if err := env.controller.RegisterLightings(newTestLighting(1, 5)); err == nil {
+		t.Error("Expected an error on registering a lighting that is already registered")
+	}
+	if registered, _ := env.controller.getLightingByID(1); registered != device {
+		t.Error("Expected the registered lighting to be kept")
+	}
+}
+
+func TestClockScheduler(t *testing.T) {
+	clock := newFakeClock()
+	scheduler := &clockScheduler{clock: clock}
+	runs := 0
+	job, err := scheduler.Daily(7, 0, func() { runs++ })
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	clock.Advance(59 * time.Minute)
+	if runs != 0 {
+		t.Errorf("Job ran %d times before its time", runs)
+	}
+	clock.Advance(time.Minute)
+	if runs != 1 {
+		t.Errorf("Expected the job to run once at 07:00 but it ran %d times", runs)
+	}
+	clock.Advance(24 * time.Hour)
+	if runs != 2 {
+		t.Errorf("Expected the job to run again the next day but it ran %d times", runs)
+	}
+
+	job.Stop()
+	clock.Advance(48 * time.Hour)
+	if runs != 2 {
+		t.Errorf("Stopped job ran again")
+	}
+
+	if _, err := scheduler.Daily(24, 0, func() {}); err == nil {
+		t.Error("Expected an error on scheduling an invalid time of day")
+	}
+}
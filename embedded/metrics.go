@@ -0,0 +1,22 @@
+package embedded
+
+import (
+	"strconv"
+
+	"github.com/he4d/almue-backend/metrics"
+)
+
+var (
+	shutterOpening = metrics.Default.NewGauge("almue_shutter_opening_percent",
+		"Opening of the registered shutters in percent.", "shutter")
+	lightingOn = metrics.Default.NewGauge("almue_lighting_on",
+		"State of the registered lightings, 1 when switched on.", "lighting")
+	motorRuntime = metrics.Default.NewCounter("almue_shutter_motor_runtime_seconds_total",
+		"Time the motors of the shutters ran by direction.", "shutter", "direction")
+	jobRuns = metrics.Default.NewCounter("almue_job_runs_total",
+		"Runs of the daily jobs by device type, job and result.", "device_type", "job", "result")
+)
+
+func deviceLabel(id int64) string {
+	return strconv.FormatInt(id, 10)
+}
@@ -0,0 +1,64 @@
+package embedded
+
+import (
+	"testing"
+	"time"
+
+	"github.com/he4d/almue-backend/model"
+)
+
+func TestDeviceMetrics(t *testing.T) {
+	env := newTestEnv(t, Config{})
+	if err := env.controller.RegisterShutters(newTestShutter(71, 17, 27, 20, 0)); err != nil {
+		t.Fatal(err)
+	}
+	lighting := newTestLighting(71, 4)
+	lighting.JobsEnabled = true
+	if err := env.controller.RegisterLightings(lighting); err != nil {
+		t.Fatal(err)
+	}
+	runtime := motorRuntime.Value("71", "opening")
+	jobs := jobRuns.Value(model.DeviceTypeLighting, model.JobOn, model.JobResultOK)
+
+	if opening, ok := shutterOpening.Value("71"); !ok || opening != 0 {
+		t.Errorf("Expected the opening 0 of the registered shutter but got %v %v", opening, ok)
+	}
+	if err := env.controller.OpenShutter(71); err != nil {
+		t.Fatal(err)
+	}
+	env.clock.Advance(10 * time.Second)
+	if opening, _ := shutterOpening.Value("71"); opening != 50 {
+		t.Errorf("Expected the opening 50 but got %v", opening)
+	}
+	env.clock.Advance(10 * time.Second)
+	if opening, _ := shutterOpening.Value("71"); opening != 100 {
+		t.Errorf("Expected the opening 100 but got %v", opening)
+	}
+	if delta := motorRuntime.Value("71", "opening") - runtime; delta != 20 {
+		t.Errorf("Expected the motor to run 20 seconds but got %v", delta)
+	}
+
+	if on, ok := lightingOn.Value("71"); !ok || on != 0 {
+		t.Errorf("Expected the registered lighting to be off but got %v %v", on, ok)
+	}
+	env.scheduler.fire(18, 0)
+	if on, _ := lightingOn.Value("71"); on != 1 {
+		t.Errorf("Expected the lighting to be on but got %v", on)
+	}
+	if delta := jobRuns.Value(model.DeviceTypeLighting, model.JobOn, model.JobResultOK) - jobs; delta != 1 {
+		t.Errorf("Expected one successful run of the job but got %v", delta)
+	}
+
+	if err := env.controller.UnregisterShutter(71); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.controller.UnregisterLighting(71); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := shutterOpening.Value("71"); ok {
+		t.Error("Expected the opening of the unregistered shutter to be removed")
+	}
+	if _, ok := lightingOn.Value("71"); ok {
+		t.Error("Expected the state of the unregistered lighting to be removed")
+	}
+}
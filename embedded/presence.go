@@ -0,0 +1,368 @@
+package embedded
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/he4d/almue-backend/model"
+)
+
+const (
+	// presenceHistoryDays is the number of past days whose history the presence simulation replays
+	presenceHistoryDays = 14
+	// presenceLogSize is the number of performed actions the presence simulation keeps for its status
+	presenceLogSize = 100
+)
+
+// presence holds the state of the presence simulation.
+// The simulation is running if settings is set.
+type presence struct {
+	sync.Mutex
+	settings  *model.PresenceSettings
+	shutters  map[int64]bool
+	lightings map[int64]bool
+	since     time.Time
+	run       int
+	job       Job
+	pending   map[*model.PresenceAction]Timer
+	done      []*model.PresenceAction
+	rand      *rand.Rand
+}
+
+// suspends tells if the jobs of the device are suspended by the running presence simulation
+func (p *presence) suspends(deviceType string, deviceID int64) bool {
+	p.Lock()
+	defer p.Unlock()
+	return p.settings != nil && p.settings.SuspendJobs && p.selected(deviceType, deviceID)
+}
+
+// selected tells if the device is part of the running simulation. The presence must be locked by the caller.
+func (p *presence) selected(deviceType string, deviceID int64) bool {
+	if p.settings == nil {
+		return false
+	}
+	if deviceType == "shutter" {
+		return p.shutters[deviceID]
+	}
+	return p.lightings[deviceID]
+}
+
+// stop stops the running simulation, its pending actions are dropped.
+// The presence must be locked by the caller.
+func (p *presence) stop() {
+	if p.job != nil {
+		p.job.Stop()
+		p.job = nil
+	}
+	for _, timer := range p.pending {
+		timer.Stop()
+	}
+	p.pending = nil
+	p.settings = nil
+	p.shutters = nil
+	p.lightings = nil
+	p.run++
+}
+
+// StartPresenceSimulation switches the given devices like somebody was at home and replaces a running simulation.
+// Every day gets a plan: the history profile replays the recorded events of a past day, preferably of the same
+// weekday, and shifts their times randomly by up to the jitter. Devices without a history and all devices
+// of the random profile are switched at random times of plausible periods of the day.
+// If SuspendJobs is set the daily jobs of the devices are skipped while the simulation runs.
+// The simulation runs until it gets stopped, it does not survive a restart.
+func (c *Controller) StartPresenceSimulation(settings *model.PresenceSettings) error {
+	if settings.Profile != model.PresenceProfileHistory && settings.Profile != model.PresenceProfileRandom {
+		return errors.New("The presence profile must be history or random")
+	}
+	if settings.JitterMinutes < 0 {
+		return errors.New("The jitter must not be negative")
+	}
+	if len(settings.Shutters) == 0 && len(settings.Lightings) == 0 {
+		return errors.New("The presence simulation needs at least one device")
+	}
+	shutters := map[int64]bool{}
+	for _, id := range settings.Shutters {
+		if _, err := c.getShutterByID(id); err != nil {
+			return err
+		}
+		shutters[id] = true
+	}
+	lightings := map[int64]bool{}
+	for _, id := range settings.Lightings {
+		if _, err := c.getLightingByID(id); err != nil {
+			return err
+		}
+		lightings[id] = true
+	}
+
+	p := &c.presence
+	p.Lock()
+	p.stop()
+	copied := *settings
+	copied.Shutters = append([]int64{}, settings.Shutters...)
+	copied.Lightings = append([]int64{}, settings.Lightings...)
+	p.settings = &copied
+	p.shutters = shutters
+	p.lightings = lightings
+	p.since = c.clock.Now()
+	p.pending = map[*model.PresenceAction]Timer{}
+	p.done = nil
+	if p.rand == nil {
+		p.rand = rand.New(rand.NewSource(p.since.UnixNano()))
+	}
+	run := p.run
+	job, err := c.scheduler.Daily(0, 0, func() {
+		c.planPresenceDay(run)
+	})
+	if err != nil {
+		p.stop()
+		p.Unlock()
+		return err
+	}
+	p.job = job
+	p.Unlock()
+
+	c.logger.Info.Printf("Presence simulation started for %d shutters and %d lightings with the %s profile",
+		len(shutters), len(lightings), settings.Profile)
+	c.planPresenceDay(run)
+	return nil
+}
+
+// StopPresenceSimulation stops the presence simulation. The devices keep their
+// states and their daily jobs run again. Stopping a stopped simulation does nothing
+func (c *Controller) StopPresenceSimulation() error {
+	p := &c.presence
+	p.Lock()
+	defer p.Unlock()
+	if p.settings == nil {
+		return nil
+	}
+	p.stop()
+	c.logger.Info.Print("Presence simulation stopped")
+	return nil
+}
+
+// PresenceStatus returns the settings, the planned and the last performed actions of the presence simulation
+func (c *Controller) PresenceStatus() *model.PresenceStatus {
+	p := &c.presence
+	p.Lock()
+	defer p.Unlock()
+	status := &model.PresenceStatus{
+		Enabled: p.settings != nil,
+		Planned: []*model.PresenceAction{},
+		Done:    []*model.PresenceAction{},
+	}
+	if p.settings != nil {
+		since := p.since
+		settings := *p.settings
+		status.Since = &since
+		status.Settings = &settings
+	}
+	for action := range p.pending {
+		a := *action
+		status.Planned = append(status.Planned, &a)
+	}
+	sortActions(status.Planned)
+	for _, action := range p.done {
+		a := *action
+		status.Done = append(status.Done, &a)
+	}
+	return status
+}
+
+// planPresenceDay plans the actions of the simulation for the rest of the current day
+func (c *Controller) planPresenceDay(run int) {
+	now := c.clock.Now()
+	day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	events, err := c.stateStore.FindDeviceEvents(day.AddDate(0, 0, -presenceHistoryDays))
+	if err != nil {
+		c.logger.Warning.Printf("Presence simulation: could not read the device history, using the random profile: %v", err)
+		events = nil
+	}
+
+	p := &c.presence
+	p.Lock()
+	defer p.Unlock()
+	if p.run != run || p.settings == nil {
+		return
+	}
+	for _, action := range p.plan(day, events) {
+		if action.Time.Before(now) {
+			continue
+		}
+		action := action
+		p.pending[action] = c.clock.AfterFunc(action.Time.Sub(now), func() {
+			c.runPresenceAction(run, action)
+		})
+	}
+}
+
+// runPresenceAction switches the device of the planned action and logs what it did
+func (c *Controller) runPresenceAction(run int, action *model.PresenceAction) {
+	p := &c.presence
+	p.Lock()
+	if p.run != run {
+		p.Unlock()
+		return
+	}
+	delete(p.pending, action)
+	p.Unlock()
+
+	command := map[string]string{"opening": "open", "closing": "close", "on": "on", "off": "off"}[action.State]
+	err := c.runCommand(action.DeviceType, action.DeviceID, command, model.CommandSourcePresence, model.CommandPriorityLow)
+	if err == errCommandCancelled {
+		action.Error = err.Error()
+		c.logger.Info.Printf("Presence simulation: switching %s %d to %s was cancelled",
+			action.DeviceType, action.DeviceID, action.State)
+	} else if err != nil {
+		action.Error = err.Error()
+		c.logger.Error.Printf("Presence simulation: could not switch %s %d to %s: %v",
+			action.DeviceType, action.DeviceID, action.State, err)
+		c.recordFault(action.DeviceType, action.DeviceID,
+			fmt.Errorf("The presence simulation could not switch to %s: %v", action.State, err))
+	} else {
+		c.logger.Info.Printf("Presence simulation: switched %s %d to %s (%s profile)",
+			action.DeviceType, action.DeviceID, action.State, action.Profile)
+	}
+
+	p.Lock()
+	defer p.Unlock()
+	if p.run != run {
+		return
+	}
+	p.done = append(p.done, action)
+	if len(p.done) > presenceLogSize {
+		p.done = p.done[len(p.done)-presenceLogSize:]
+	}
+}
+
+// plan returns the actions of all devices of the simulation for the given day.
+// The presence must be locked by the caller.
+func (p *presence) plan(day time.Time, events []*model.DeviceEvent) []*model.PresenceAction {
+	// the recorded events of the past days by device and day
+	history := map[string]map[time.Time][]*model.DeviceEvent{}
+	for _, e := range events {
+		t := e.Time.In(day.Location())
+		eventDay := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, day.Location())
+		if !eventDay.Before(day) || !replayable(e.DeviceType, e.State) {
+			continue
+		}
+		key := deviceKey(e.DeviceType, e.DeviceID)
+		if history[key] == nil {
+			history[key] = map[time.Time][]*model.DeviceEvent{}
+		}
+		history[key][eventDay] = append(history[key][eventDay], e)
+	}
+
+	actions := []*model.PresenceAction{}
+	devices := func(deviceType string, ids []int64) {
+		for _, id := range ids {
+			var deviceActions []*model.PresenceAction
+			if p.settings.Profile == model.PresenceProfileHistory {
+				deviceActions = p.replay(day, deviceType, id, history[deviceKey(deviceType, id)])
+			}
+			if len(deviceActions) == 0 {
+				deviceActions = p.randomize(day, deviceType, id)
+			}
+			actions = append(actions, deviceActions...)
+		}
+	}
+	devices("shutter", p.settings.Shutters)
+	devices("lighting", p.settings.Lightings)
+	sortActions(actions)
+	return actions
+}
+
+// replay returns the actions of a recorded day of the device, preferably of the same weekday.
+// The times are shifted by the jitter but keep their order.
+func (p *presence) replay(day time.Time, deviceType string, deviceID int64, days map[time.Time][]*model.DeviceEvent) []*model.PresenceAction {
+	if len(days) == 0 {
+		return nil
+	}
+	candidates := []time.Time{}
+	for d := range days {
+		if d.Weekday() == day.Weekday() {
+			candidates = append(candidates, d)
+		}
+	}
+	if len(candidates) == 0 {
+		for d := range days {
+			candidates = append(candidates, d)
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool { return candidates[i].Before(candidates[j]) })
+	recorded := candidates[p.rand.Intn(len(candidates))]
+
+	actions := []*model.PresenceAction{}
+	var last time.Time
+	for _, e := range days[recorded] {
+		offset := e.Time.In(day.Location()).Sub(recorded)
+		at := day.Add(offset + p.jitter())
+		if len(actions) > 0 && !at.After(last) {
+			at = last.Add(time.Minute)
+		}
+		if at.Before(day) {
+			at = day
+		}
+		last = at
+		actions = append(actions, &model.PresenceAction{
+			Time: at, DeviceType: deviceType, DeviceID: deviceID, State: e.State, Profile: model.PresenceProfileHistory,
+		})
+	}
+	return actions
+}
+
+// randomize returns actions at random times of the periods in which a device usually gets switched:
+// shutters open in the morning and close in the evening, lightings are on in the evening and sometimes in the morning
+func (p *presence) randomize(day time.Time, deviceType string, deviceID int64) []*model.PresenceAction {
+	at := func(hour, minute, spread int) time.Time {
+		return day.Add(time.Duration(hour)*time.Hour + time.Duration(minute+p.rand.Intn(spread+1))*time.Minute)
+	}
+	action := func(t time.Time, state string) *model.PresenceAction {
+		return &model.PresenceAction{
+			Time: t, DeviceType: deviceType, DeviceID: deviceID, State: state, Profile: model.PresenceProfileRandom,
+		}
+	}
+
+	if deviceType == "shutter" {
+		return []*model.PresenceAction{
+			action(at(7, 0, 90), "opening"),
+			action(at(19, 0, 120), "closing"),
+		}
+	}
+	actions := []*model.PresenceAction{}
+	if p.rand.Intn(2) == 0 {
+		on := at(6, 30, 45)
+		actions = append(actions, action(on, "on"), action(on.Add(time.Duration(15+p.rand.Intn(31))*time.Minute), "off"))
+	}
+	return append(actions, action(at(18, 0, 120), "on"), action(at(22, 0, 100), "off"))
+}
+
+// jitter returns a random shift of up to the configured jitter in both directions
+func (p *presence) jitter() time.Duration {
+	minutes := p.settings.JitterMinutes
+	if minutes == 0 {
+		return 0
+	}
+	return time.Duration(p.rand.Intn(2*minutes+1)-minutes) * time.Minute
+}
+
+// replayable tells if the recorded state is one the presence simulation can switch a device to
+func replayable(deviceType, state string) bool {
+	if deviceType == "shutter" {
+		return state == "opening" || state == "closing"
+	}
+	return state == "on" || state == "off"
+}
+
+func deviceKey(deviceType string, deviceID int64) string {
+	return fmt.Sprintf("%s %d", deviceType, deviceID)
+}
+
+func sortActions(actions []*model.PresenceAction) {
+	sort.SliceStable(actions, func(i, j int) bool { return actions[i].Time.Before(actions[j].Time) })
+}
@@ -0,0 +1,196 @@
+package embedded
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/he4d/almue-backend/model"
+)
+
+func TestRecordDeviceEvents(t *testing.T) {
+	env := newTestEnv(t, Config{})
+	if err := env.controller.RegisterShutters(newTestShutter(1, 17, 27, 20, 0)); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.controller.RegisterLightings(newTestLighting(1, 4)); err != nil {
+		t.Fatal(err)
+	}
+
+	env.controller.OpenShutter(1)
+	env.clock.Advance(time.Minute)
+	env.controller.CloseShutter(1)
+	env.controller.TurnLightingOn(1)
+	env.controller.TurnLightingOff(1)
+
+	if states := env.store.states("shutter", 1); !reflect.DeepEqual(states, []string{"opening", "closing"}) {
+		t.Errorf("Expected the recorded directions of the shutter but got %v", states)
+	}
+	if states := env.store.states("lighting", 1); !reflect.DeepEqual(states, []string{"on", "off"}) {
+		t.Errorf("Expected the recorded states of the lighting but got %v", states)
+	}
+
+	// the events older than the retention are deleted once a day
+	env.store.AddDeviceEvent(&model.DeviceEvent{DeviceType: "lighting", DeviceID: 2, State: "on", Time: env.clock.Now().Add(-historyRetention - time.Hour)})
+	env.clock.Advance(25 * time.Hour)
+	env.controller.TurnLightingOn(1)
+	if states := env.store.states("lighting", 2); len(states) != 0 {
+		t.Errorf("Expected the old events to be deleted but got %v", states)
+	}
+}
+
+func TestPresenceReplaysHistory(t *testing.T) {
+	env := newTestEnv(t, Config{})
+	lighting := newTestLighting(1, 4)
+	lighting.JobsEnabled = true
+	if err := env.controller.RegisterLightings(lighting, newTestLighting(2, 5)); err != nil {
+		t.Fatal(err)
+	}
+
+	// the clock starts on a monday, the monday of the week before gets replayed
+	lastMonday := env.clock.Now().AddDate(0, 0, -7)
+	lastSunday := env.clock.Now().AddDate(0, 0, -1)
+	for _, e := range []*model.DeviceEvent{
+		{DeviceType: "lighting", DeviceID: 1, State: "on", Time: lastMonday.Add(12*time.Hour + 30*time.Minute)},
+		{DeviceType: "lighting", DeviceID: 1, State: "off", Time: lastMonday.Add(16 * time.Hour)},
+		{DeviceType: "lighting", DeviceID: 1, State: "on", Time: lastSunday.Add(14 * time.Hour)},
+	} {
+		env.store.AddDeviceEvent(e)
+	}
+
+	settings := &model.PresenceSettings{Lightings: []int64{1}, Profile: model.PresenceProfileHistory, SuspendJobs: true}
+	if err := env.controller.StartPresenceSimulation(settings); err != nil {
+		t.Fatal(err)
+	}
+	status := env.controller.PresenceStatus()
+	today := env.clock.Now().Truncate(24 * time.Hour)
+	if !status.Enabled || len(status.Planned) != 2 ||
+		!status.Planned[0].Time.Equal(today.Add(18*time.Hour+30*time.Minute)) || status.Planned[0].State != "on" ||
+		!status.Planned[1].Time.Equal(today.Add(22*time.Hour)) || status.Planned[1].State != "off" {
+		t.Fatalf("Expected the events of last monday to be planned but got %+v", status)
+	}
+
+	// the jobs of the lighting are suspended
+	env.scheduler.fire(18, 0)
+	if state := env.store.lightingState(1); state != "" {
+		t.Errorf("Expected the on job to be skipped but the lighting is %s", state)
+	}
+
+	env.clock.Advance(12*time.Hour + 30*time.Minute)
+	if state := env.store.lightingState(1); state != "on" {
+		t.Errorf("Expected the lighting to be switched on but it is %s", state)
+	}
+	env.clock.Advance(4 * time.Hour)
+	status = env.controller.PresenceStatus()
+	if len(status.Planned) != 0 || len(status.Done) != 2 || status.Done[1].State != "off" || status.Done[1].Error != "" {
+		t.Errorf("Expected both actions to be done but got %+v", status)
+	}
+	if states := env.store.states("lighting", 1); len(states) != 3 {
+		t.Errorf("Expected the switches of the simulation not to be recorded but got %v", states)
+	}
+
+	if err := env.controller.StopPresenceSimulation(); err != nil {
+		t.Fatal(err)
+	}
+	if status := env.controller.PresenceStatus(); status.Enabled || status.Settings != nil {
+		t.Errorf("Expected the simulation to be stopped but got %+v", status)
+	}
+	env.scheduler.fire(18, 0)
+	if state := env.store.lightingState(1); state != "on" {
+		t.Errorf("Expected the on job to run after stopping but the lighting is %s", state)
+	}
+}
+
+func TestRecordCommandsToSimulatedDevices(t *testing.T) {
+	env := newTestEnv(t, Config{})
+	if err := env.controller.RegisterShutters(newTestShutter(1, 17, 27, 20, 0)); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.controller.RegisterLightings(newTestLighting(1, 4)); err != nil {
+		t.Fatal(err)
+	}
+	settings := &model.PresenceSettings{Shutters: []int64{1}, Lightings: []int64{1}, Profile: model.PresenceProfileRandom}
+	if err := env.controller.StartPresenceSimulation(settings); err != nil {
+		t.Fatal(err)
+	}
+
+	// only the commands of the simulation itself are not recorded
+	if err := env.controller.runCommand(model.DeviceTypeLighting, 1, "on", model.CommandSourcePresence, model.CommandPriorityLow); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.controller.runCommand(model.DeviceTypeLighting, 1, "off", model.CommandSourceAPI, model.CommandPriorityNormal); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.controller.runCommand(model.DeviceTypeShutter, 1, "open", model.CommandSourceSchedule, model.CommandPriorityLow); err != nil {
+		t.Fatal(err)
+	}
+	if states := env.store.states("lighting", 1); !reflect.DeepEqual(states, []string{"off"}) {
+		t.Errorf("Expected only the command of the api to be recorded but got %v", states)
+	}
+	if states := env.store.states("shutter", 1); !reflect.DeepEqual(states, []string{"opening"}) {
+		t.Errorf("Expected the job of the simulated shutter to be recorded but got %v", states)
+	}
+}
+
+func TestPresenceRandomProfile(t *testing.T) {
+	env := newTestEnv(t, Config{})
+	if err := env.controller.RegisterShutters(newTestShutter(1, 17, 27, 20, 0)); err != nil {
+		t.Fatal(err)
+	}
+
+	settings := &model.PresenceSettings{Shutters: []int64{1}, Profile: model.PresenceProfileHistory, JitterMinutes: 10}
+	if err := env.controller.StartPresenceSimulation(settings); err != nil {
+		t.Fatal(err)
+	}
+	today := env.clock.Now().Truncate(24 * time.Hour)
+	checkPlan := func(day time.Time) {
+		t.Helper()
+		planned := env.controller.PresenceStatus().Planned
+		if len(planned) != 2 || planned[0].State != "opening" || planned[1].State != "closing" ||
+			planned[0].Profile != model.PresenceProfileRandom {
+			t.Fatalf("Expected the shutter to be opened and closed by the random profile but got %+v", planned)
+		}
+		if open := planned[0].Time.Sub(day); open < 7*time.Hour || open > 8*time.Hour+30*time.Minute {
+			t.Errorf("Expected the shutter to be opened between 7:00 and 8:30 but got %v", planned[0].Time)
+		}
+		if close := planned[1].Time.Sub(day); close < 19*time.Hour || close > 21*time.Hour {
+			t.Errorf("Expected the shutter to be closed between 19:00 and 21:00 but got %v", planned[1].Time)
+		}
+	}
+	checkPlan(today)
+
+	// the next day is planned at midnight
+	env.clock.Advance(18 * time.Hour)
+	env.scheduler.fire(0, 0)
+	checkPlan(today.AddDate(0, 0, 1))
+	if done := env.controller.PresenceStatus().Done; len(done) != 2 {
+		t.Errorf("Expected the actions of the first day to be done but got %+v", done)
+	}
+}
+
+func TestStartPresenceSimulationFails(t *testing.T) {
+	env := newTestEnv(t, Config{})
+	if err := env.controller.RegisterLightings(newTestLighting(1, 4)); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		settings *model.PresenceSettings
+	}{
+		{"unknown profile", &model.PresenceSettings{Lightings: []int64{1}, Profile: "party"}},
+		{"negative jitter", &model.PresenceSettings{Lightings: []int64{1}, Profile: "random", JitterMinutes: -1}},
+		{"no devices", &model.PresenceSettings{Profile: "random"}},
+		{"unregistered device", &model.PresenceSettings{Lightings: []int64{1, 2}, Profile: "random"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := env.controller.StartPresenceSimulation(test.settings); err == nil {
+				t.Error("Expected an error")
+			}
+			if status := env.controller.PresenceStatus(); status.Enabled {
+				t.Errorf("Expected no simulation to run but got %+v", status)
+			}
+		})
+	}
+}
@@ -2,27 +2,32 @@ package embedded
 
 import (
 	"fmt"
-	"strconv"
 	"time"
 
 	"sync"
 
 	"github.com/he4d/almue-backend/model"
-	"github.com/he4d/scheduler"
 	"periph.io/x/periph/conn/gpio"
-	"periph.io/x/periph/conn/gpio/gpioreg"
 )
 
 type shutter struct {
 	sync.Mutex
 	openPin             gpio.PinIO
 	closePin            gpio.PinIO
-	openJob             *scheduler.Job
-	closeJob            *scheduler.Job
+	openJob             Job
+	closeJob            Job
 	completeWayDuration time.Duration
-	timer               *time.Timer
-	ticker              *time.Ticker
+	timer               Timer
+	ticker              Timer
+	run                 int
 	openingInPrc        int
+	direction           motorDirection
+	lastDirection       motorDirection
+	lastStop            time.Time
+	runStart            time.Time
+	trace               string
+	source              string
+	watchdog            Timer
 }
 
 func (s *shutter) getTickDuration() time.Duration {
@@ -30,19 +35,29 @@ func (s *shutter) getTickDuration() time.Duration {
 	return time.Millisecond * time.Duration(calc)
 }
 
-// RegisterShutters registers one or more shutters to the controller. It will also start the scheudle if enabled for the given shutter
+// RegisterShutters registers one or more shutters to the controller. It will also start the scheudle if enabled for the given shutter.
+// Disabled shutters are skipped, a shutter that is already registered is rejected
 func (c *Controller) RegisterShutters(shutters ...*model.Shutter) error {
 	for _, shutterModel := range shutters {
-		var openPin gpio.PinIO
-		var closePin gpio.PinIO
-		if c.simulate {
-			openPin = &simulatePinIO{name: *shutterModel.Description, number: *shutterModel.OpenPin}
-			closePin = &simulatePinIO{name: *shutterModel.Description, number: *shutterModel.ClosePin}
-		} else {
-			openPin = gpioreg.ByName(strconv.Itoa(*shutterModel.OpenPin))
-			closePin = gpioreg.ByName(strconv.Itoa(*shutterModel.ClosePin))
+		if shutterModel.Disabled {
+			continue
+		}
+		if _, err := c.getShutterByID(shutterModel.ID); err == nil {
+			// the jobs and the relays of the registered shutter would be left without a device
+			return fmt.Errorf("Shutter %d can not be registered, it is already registered", shutterModel.ID)
 		}
 		duration := time.Duration(*shutterModel.CompleteWayInSeconds) * time.Second
+		if err := c.CheckCompleteWay(duration); err != nil {
+			return fmt.Errorf("Shutter %d can not be registered: %v", shutterModel.ID, err)
+		}
+		openPin, err := c.newPin(*shutterModel.Description, *shutterModel.OpenPin)
+		if err != nil {
+			return err
+		}
+		closePin, err := c.newPin(*shutterModel.Description, *shutterModel.ClosePin)
+		if err != nil {
+			return err
+		}
 		shutterToAdd := &shutter{
 			openPin:             openPin,
 			closePin:            closePin,
@@ -53,9 +68,18 @@ func (c *Controller) RegisterShutters(shutters ...*model.Shutter) error {
 		c.shuttersLock.Lock()
 		c.shutters[shutterModel.ID] = shutterToAdd
 		c.shuttersLock.Unlock()
+		c.setFault(model.DeviceTypeShutter, shutterModel.ID, shutterModel.Fault)
+		shutterOpening.Set(float64(shutterModel.OpeningInPrc), deviceLabel(shutterModel.ID))
 
 		if shutterModel.JobsEnabled {
 			if err := c.ScheduleShutterJobs(shutterModel); err != nil {
+				// a device is either registered completely or not at all
+				c.UnscheduleShutterJobs(shutterModel.ID)
+				c.shuttersLock.Lock()
+				delete(c.shutters, shutterModel.ID)
+				c.shuttersLock.Unlock()
+				c.setFault(model.DeviceTypeShutter, shutterModel.ID, nil)
+				shutterOpening.Delete(deviceLabel(shutterModel.ID))
 				return err
 			}
 		}
@@ -65,7 +89,7 @@ func (c *Controller) RegisterShutters(shutters ...*model.Shutter) error {
 
 // UnregisterShutter unregisters the shutter with the given id from the controller
 func (c *Controller) UnregisterShutter(shutterID int64) error {
-	if err := c.StopShutter(shutterID); err != nil {
+	if err := c.stopBeforeChange(shutterID); err != nil {
 		return err
 	}
 
@@ -76,6 +100,9 @@ func (c *Controller) UnregisterShutter(shutterID int64) error {
 	c.shuttersLock.Lock()
 	delete(c.shutters, shutterID)
 	c.shuttersLock.Unlock()
+	c.unregisterJobs("shutter", shutterID, true)
+	c.setFault(model.DeviceTypeShutter, shutterID, nil)
+	shutterOpening.Delete(deviceLabel(shutterID))
 	return nil
 }
 
@@ -87,16 +114,16 @@ func (c *Controller) UpdateShutter(diffs model.DifferenceType, updatedShutter *m
 
 	var alreadyScheduled bool
 
-	if diffs.HasFlag(model.DIFFEMERGENCYENABLED) {
-		//TODO: Emergencydevices...
-		return nil
-	}
+	//TODO: Emergencydevices... (DIFFEMERGENCYENABLED)
 	if diffs.HasFlag(model.DIFFDISABLED) {
+		// registering applies all other changes as well
 		if updatedShutter.Disabled {
-			c.UnregisterShutter(updatedShutter.ID)
-			return nil
+			return c.UnregisterShutter(updatedShutter.ID)
 		}
-		c.RegisterShutters(updatedShutter)
+		return c.RegisterShutters(updatedShutter)
+	}
+	if updatedShutter.Disabled {
+		// a disabled device is not registered, the changes apply when it gets enabled
 		return nil
 	}
 	if diffs.HasFlag(model.DIFFJOBSENABLED) {
@@ -117,12 +144,20 @@ func (c *Controller) UpdateShutter(diffs model.DifferenceType, updatedShutter *m
 		}
 	}
 	if diffs.HasFlag(model.DIFFCOMPLETEWAYINSECONDS) {
+		completeWay := time.Duration(*updatedShutter.CompleteWayInSeconds) * time.Second
+		if err := c.CheckCompleteWay(completeWay); err != nil {
+			return err
+		}
 		shutter, err := c.getShutterByID(updatedShutter.ID)
 		if err != nil {
 			return err
 		}
-		c.StopShutter(updatedShutter.ID)
-		shutter.completeWayDuration = time.Duration(*updatedShutter.CompleteWayInSeconds) * time.Second
+		if err := c.stopBeforeChange(updatedShutter.ID); err != nil {
+			return err
+		}
+		shutter.Lock()
+		shutter.completeWayDuration = completeWay
+		shutter.Unlock()
 	}
 	if diffs.HasFlag(model.DIFFOPENTIME) || diffs.HasFlag(model.DIFFCLOSETIME) {
 		if updatedShutter.JobsEnabled && !alreadyScheduled {
@@ -135,143 +170,179 @@ func (c *Controller) UpdateShutter(diffs model.DifferenceType, updatedShutter *m
 }
 
 // OpenShutter opens the shutter with the given id
-// It also updates the state store
+// It also updates the state store. A shutter with a fault does not move until it is reset
 func (c *Controller) OpenShutter(shutterID int64) error {
+	return c.moveShutter(shutterID, motorOpening)
+}
+
+// CloseShutter closes the shutter with the given id
+// It also updates the state store
+func (c *Controller) CloseShutter(shutterID int64) error {
+	return c.moveShutter(shutterID, motorClosing)
+}
+
+// StopShutter stops the shutter with the given id
+// It also updates the state store
+func (c *Controller) StopShutter(shutterID int64) error {
 	device, err := c.getShutterByID(shutterID)
 	if err != nil {
 		return err
 	}
 	device.Lock()
 	defer device.Unlock()
-	if device.ticker != nil {
-		device.ticker.Stop()
+	return c.stopShutter(shutterID, device)
+}
+
+// moveShutter lets the shutter run in the given direction until it reaches the end position.
+// If the motor still has to rest the run starts after the pause, unless the shutter gets stopped or moved before.
+func (c *Controller) moveShutter(shutterID int64, direction motorDirection) error {
+	device, err := c.getShutterByID(shutterID)
+	if err != nil {
+		return err
 	}
-	if device.timer != nil {
-		device.timer.Stop()
+	if err := c.checkFault(model.DeviceTypeShutter, shutterID); err != nil {
+		return err
 	}
-	if err := device.closePin.Out(gpio.Low); err != nil {
+	device.Lock()
+	defer device.Unlock()
+	c.stopMovement(device)
+	if err := c.drive(shutterID, device, motorStopped); err != nil {
 		return err
 	}
-	if err := device.openPin.Out(gpio.High); err != nil {
+	// the trace and the source of the run are kept for the delayed start, the stop at the end position and the watchdog
+	device.trace = c.runningTrace(model.DeviceTypeShutter, shutterID)
+	device.source = c.runningSource(model.DeviceTypeShutter, shutterID)
+	run := device.run
+
+	wait := c.pauseBefore(device, direction)
+	if wait == 0 {
+		return c.startRun(shutterID, device, direction)
+	}
+	c.traceLogger(device.trace, model.DeviceTypeShutter, shutterID).Debug.Printf("Shutter %d waits %v before %s", shutterID, wait, direction)
+	device.timer = c.clock.AfterFunc(wait, func() {
+		device.Lock()
+		defer device.Unlock()
+		if device.run != run {
+			return
+		}
+		device.timer = nil
+		if err := c.checkFault(model.DeviceTypeShutter, shutterID); err != nil {
+			c.logger.Warning.Printf("Shutter %d does not start after its pause: %v", shutterID, err)
+			return
+		}
+		if err := c.startRun(shutterID, device, direction); err != nil {
+			c.recordFault(model.DeviceTypeShutter, shutterID, fmt.Errorf("Could not start the run after the pause: %v", err))
+			c.stopShutterOnFault(shutterID, device)
+		}
+	})
+	return nil
+}
+
+// startRun switches the relays of the shutter and follows its run until the end position.
+// If the shutter already is at the end position a reference drive over the complete way is done.
+// The shutter must be locked by the caller.
+func (c *Controller) startRun(shutterID int64, device *shutter, direction motorDirection) error {
+	if err := c.drive(shutterID, device, direction); err != nil {
 		return err
 	}
-	if device.openingInPrc == 100.0 {
+	c.recordEvent("shutter", shutterID, direction.String(), device.source)
+
+	endPosition, step := 100, 5
+	if direction == motorClosing {
+		endPosition, step = 0, -5
+	}
+	run := device.run
+
+	if device.openingInPrc == endPosition {
 		// REFERENCE DRIVE
 		if err := c.stateStore.UpdateShutterState(shutterID, "referencing"); err != nil {
 			return err
 		}
-		device.timer = time.AfterFunc(device.completeWayDuration, func() {
-			if err := c.StopShutter(shutterID); err != nil {
-				//TODO: Handle error
-			}
+		device.timer = c.clock.AfterFunc(device.completeWayDuration, func() {
+			c.stopShutterRun(shutterID, device, run)
 		})
-	} else {
-		// NORMAL DRIVE
-		if err := c.stateStore.UpdateShutterState(shutterID, "opening"); err != nil {
-			return err
+		return nil
+	}
+
+	// NORMAL DRIVE
+	if err := c.stateStore.UpdateShutterState(shutterID, direction.String()); err != nil {
+		return err
+	}
+	device.ticker = c.clock.Every(device.getTickDuration(), func() {
+		device.Lock()
+		defer device.Unlock()
+		if device.run != run {
+			return
 		}
-		device.ticker = time.NewTicker(device.getTickDuration())
-		go func() {
-			for range device.ticker.C {
-				device.openingInPrc += 5
-				if err := c.stateStore.UpdateShutterOpening(shutterID, device.openingInPrc); err != nil {
-					//TODO: Handle error
-				}
-				if device.openingInPrc == 100 {
-					if err := c.StopShutter(shutterID); err != nil {
-						//TODO: Handle error
-					}
-					device.ticker.Stop()
-					device.ticker = nil
-					return
-				}
+		device.openingInPrc += step
+		shutterOpening.Set(float64(device.openingInPrc), deviceLabel(shutterID))
+		if err := c.stateStore.UpdateShutterOpening(shutterID, device.openingInPrc); err != nil {
+			// the shutter does not run without knowing its opening
+			c.recordFault(model.DeviceTypeShutter, shutterID, fmt.Errorf("Could not store the opening: %v", err))
+			c.stopShutterOnFault(shutterID, device)
+			return
+		}
+		if device.openingInPrc == endPosition {
+			if err := c.stopShutter(shutterID, device); err != nil {
+				c.recordFault(model.DeviceTypeShutter, shutterID, fmt.Errorf("Could not stop at the end position: %v", err))
 			}
-		}()
-	}
+		}
+	})
 	return nil
 }
 
-// CloseShutter closes the shutter with the given id
-// It also updates the state store
-func (c *Controller) CloseShutter(shutterID int64) error {
-	device, err := c.getShutterByID(shutterID)
-	if err != nil {
-		return err
-	}
+// stopShutterRun stops the shutter if it is still in the given run
+func (c *Controller) stopShutterRun(shutterID int64, device *shutter, run int) {
 	device.Lock()
 	defer device.Unlock()
-	if device.ticker != nil {
-		device.ticker.Stop()
+	if device.run != run {
+		return
 	}
-	if device.timer != nil {
-		device.timer.Stop()
+	if err := c.stopShutter(shutterID, device); err != nil {
+		c.recordFault(model.DeviceTypeShutter, shutterID, fmt.Errorf("Could not stop the run: %v", err))
 	}
-	if err := device.openPin.Out(gpio.Low); err != nil {
-		return err
+}
+
+// stopShutterOnFault stops the shutter after a fault was recorded, a failure is only logged
+// as the shutter already has a fault.
+// The shutter must be locked by the caller.
+func (c *Controller) stopShutterOnFault(shutterID int64, device *shutter) {
+	if err := c.stopShutter(shutterID, device); err != nil {
+		c.logger.Error.Printf("Could not stop shutter %d after its fault: %v", shutterID, err)
 	}
-	if err := device.closePin.Out(gpio.High); err != nil {
+}
+
+// stopShutter stops the motor of the shutter and updates the state store.
+// A shutter with a fault keeps the fault state.
+// The shutter must be locked by the caller.
+func (c *Controller) stopShutter(shutterID int64, device *shutter) error {
+	c.stopMovement(device)
+	if err := c.drive(shutterID, device, motorStopped); err != nil {
 		return err
 	}
-	if device.openingInPrc == 0 {
-		if err := c.stateStore.UpdateShutterState(shutterID, "referencing"); err != nil {
-			return err
-		}
-		device.timer = time.AfterFunc(device.completeWayDuration, func() {
-			if err := c.StopShutter(shutterID); err != nil {
-				//TODO: Handle error
-			}
-		})
-	} else {
-		// NORMAL DRIVE
-		if err := c.stateStore.UpdateShutterState(shutterID, "closing"); err != nil {
-			return err
-		}
-		device.ticker = time.NewTicker(device.getTickDuration())
-		go func() {
-			for range device.ticker.C {
-				device.openingInPrc -= 5
-				if err := c.stateStore.UpdateShutterOpening(shutterID, device.openingInPrc); err != nil {
-					//TODO: Handle error
-				}
-				if device.openingInPrc == 0 {
-					if err := c.StopShutter(shutterID); err != nil {
-						//TODO: Handle error
-					}
-					device.ticker.Stop()
-					device.ticker = nil
-					return
-				}
-			}
-		}()
+	state := "stopped"
+	if c.hasFault(model.DeviceTypeShutter, shutterID) {
+		state = model.DeviceStatusFault
+	}
+	if err := c.stateStore.UpdateShutterState(shutterID, state); err != nil {
+		return err
 	}
 	return nil
 }
 
-// StopShutter stops the shutter with the given id
-// It also updates the state store
-func (c *Controller) StopShutter(shutterID int64) error {
-	device, err := c.getShutterByID(shutterID)
-	if err != nil {
-		return err
-	}
-	device.Lock()
-	defer device.Unlock()
+// stopMovement ends the current run of the shutter so that its pending
+// timer and ticker callbacks do nothing anymore.
+// The shutter must be locked by the caller.
+func (c *Controller) stopMovement(device *shutter) {
+	device.run++
 	if device.ticker != nil {
 		device.ticker.Stop()
+		device.ticker = nil
 	}
 	if device.timer != nil {
 		device.timer.Stop()
+		device.timer = nil
 	}
-	if err := device.openPin.Out(gpio.Low); err != nil {
-		return err
-	}
-	if err := device.closePin.Out(gpio.Low); err != nil {
-		return err
-	}
-	if err := c.stateStore.UpdateShutterState(shutterID, "stopped"); err != nil {
-		return err
-	}
-	return nil
 }
 
 // ScheduleShutterJobs schedules jobs of the given shutter
@@ -282,18 +353,20 @@ func (c *Controller) ScheduleShutterJobs(shutter *model.Shutter) error {
 	}
 	device.Lock()
 	defer device.Unlock()
-	device.openJob, err = scheduler.Every().Day().At(fmt.Sprintf("%02d:%02d", shutter.OpenTime.Hour(), shutter.OpenTime.Minute())).Run(func() {
-		c.OpenShutter(shutter.ID)
+	device.openJob, err = c.scheduler.Daily(shutter.OpenTime.Hour(), shutter.OpenTime.Minute(), func() {
+		c.runJob("shutter", shutter.ID, model.JobOpen)
 	})
 	if err != nil {
 		return err
 	}
-	device.closeJob, err = scheduler.Every().Day().At(fmt.Sprintf("%02d:%02d", shutter.CloseTime.Hour(), shutter.CloseTime.Minute())).Run(func() {
-		c.CloseShutter(shutter.ID)
+	c.registerJob(jobKey{"shutter", shutter.ID, model.JobOpen}, shutter.OpenTime.Hour(), shutter.OpenTime.Minute())
+	device.closeJob, err = c.scheduler.Daily(shutter.CloseTime.Hour(), shutter.CloseTime.Minute(), func() {
+		c.runJob("shutter", shutter.ID, model.JobClose)
 	})
 	if err != nil {
 		return err
 	}
+	c.registerJob(jobKey{"shutter", shutter.ID, model.JobClose}, shutter.CloseTime.Hour(), shutter.CloseTime.Minute())
 	return nil
 }
 
@@ -305,12 +378,16 @@ func (c *Controller) UnscheduleShutterJobs(shutterID int64) error {
 	}
 	device.Lock()
 	if device.openJob != nil {
-		device.openJob.Quit <- true
+		device.openJob.Stop()
+		device.openJob = nil
 	}
 	if device.closeJob != nil {
-		device.closeJob.Quit <- true
+		device.closeJob.Stop()
+		device.closeJob = nil
 	}
 	device.Unlock()
+	c.cancelShiftedJobs("shutter", shutterID)
+	c.unregisterJobs("shutter", shutterID, false)
 	return nil
 }
 
@@ -334,8 +411,16 @@ func (c *Controller) rescheduleShutterJobs(shutter *model.Shutter) error {
 	return nil
 }
 
+// stopBeforeChange stops the shutter through its command queue before the controller changes or
+// unregisters it. The stop runs before the queued commands and is traced like them
+func (c *Controller) stopBeforeChange(shutterID int64) error {
+	return c.runCommand(model.DeviceTypeShutter, shutterID, "stop", model.CommandSourceSystem, model.CommandPriorityHigh)
+}
+
 func (c *Controller) changeShutterPins(diffs model.DifferenceType, updatedShutter *model.Shutter) error {
-	c.StopShutter(updatedShutter.ID)
+	if err := c.stopBeforeChange(updatedShutter.ID); err != nil {
+		return err
+	}
 	shutter, err := c.getShutterByID(updatedShutter.ID)
 	if err != nil {
 		return err
@@ -343,21 +428,18 @@ func (c *Controller) changeShutterPins(diffs model.DifferenceType, updatedShutte
 	shutter.Lock()
 	defer shutter.Unlock()
 	if diffs.HasFlag(model.DIFFOPENPIN) {
-		if c.simulate {
-			shutter.openPin = &simulatePinIO{name: *updatedShutter.Description, number: *updatedShutter.OpenPin}
-		} else {
-			shutter.openPin = gpioreg.ByName(strconv.Itoa(*updatedShutter.OpenPin))
+		openPin, err := c.newPin(*updatedShutter.Description, *updatedShutter.OpenPin)
+		if err != nil {
+			return err
 		}
+		shutter.openPin = openPin
 	}
-	if diffs.HasFlag(model.DIFFOPENPIN) {
+	if diffs.HasFlag(model.DIFFCLOSEPIN) {
+		closePin, err := c.newPin(*updatedShutter.Description, *updatedShutter.ClosePin)
 		if err != nil {
 			return err
 		}
-		if c.simulate {
-			shutter.closePin = &simulatePinIO{name: *updatedShutter.Description, number: *updatedShutter.ClosePin}
-		} else {
-			shutter.closePin = gpioreg.ByName(strconv.Itoa(*updatedShutter.ClosePin))
-		}
+		shutter.closePin = closePin
 	}
 	return nil
 }
@@ -0,0 +1,319 @@
+package embedded
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/he4d/almue-backend/model"
+	"periph.io/x/periph/conn/gpio"
+)
+
+func (env *testEnv) assertShutter(t *testing.T, shutterID int64, state string, openingInPrc int) {
+	t.Helper()
+	gotState, gotOpening := env.store.shutterState(shutterID)
+	if gotState != state || gotOpening != openingInPrc {
+		t.Errorf("Expected shutter %d to be %s at %d%% but it is %s at %d%%", shutterID, state, openingInPrc, gotState, gotOpening)
+	}
+}
+
+func (env *testEnv) assertRelays(t *testing.T, shutterID int64, open, close gpio.Level) {
+	t.Helper()
+	device, err := env.controller.getShutterByID(shutterID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if device.openPin.Read() != open || device.closePin.Read() != close {
+		t.Errorf("Expected the relays of shutter %d to be open=%t close=%t but got open=%t close=%t",
+			shutterID, open, close, device.openPin.Read(), device.closePin.Read())
+	}
+}
+
+func TestOpenShutter(t *testing.T) {
+	env := newTestEnv(t, Config{})
+	if err := env.controller.RegisterShutters(newTestShutter(1, 17, 27, 20, 0)); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := env.controller.OpenShutter(1); err != nil {
+		t.Fatal(err)
+	}
+	env.assertShutter(t, 1, "opening", 0)
+	env.assertRelays(t, 1, gpio.High, gpio.Low)
+
+	env.clock.Advance(10 * time.Second)
+	env.assertShutter(t, 1, "opening", 50)
+
+	env.clock.Advance(10 * time.Second)
+	env.assertShutter(t, 1, "stopped", 100)
+	env.assertRelays(t, 1, gpio.Low, gpio.Low)
+
+	env.clock.Advance(time.Minute)
+	env.assertShutter(t, 1, "stopped", 100)
+}
+
+func TestCloseShutter(t *testing.T) {
+	env := newTestEnv(t, Config{})
+	if err := env.controller.RegisterShutters(newTestShutter(1, 17, 27, 10, 100)); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := env.controller.CloseShutter(1); err != nil {
+		t.Fatal(err)
+	}
+	env.assertShutter(t, 1, "closing", 0)
+	env.assertRelays(t, 1, gpio.Low, gpio.High)
+
+	env.clock.Advance(5 * time.Second)
+	env.assertShutter(t, 1, "closing", 50)
+
+	env.clock.Advance(5 * time.Second)
+	env.assertShutter(t, 1, "stopped", 0)
+	env.assertRelays(t, 1, gpio.Low, gpio.Low)
+}
+
+func TestStopShutter(t *testing.T) {
+	env := newTestEnv(t, Config{})
+	if err := env.controller.RegisterShutters(newTestShutter(1, 17, 27, 20, 0)); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := env.controller.OpenShutter(1); err != nil {
+		t.Fatal(err)
+	}
+	env.clock.Advance(5 * time.Second)
+	if err := env.controller.StopShutter(1); err != nil {
+		t.Fatal(err)
+	}
+	env.assertShutter(t, 1, "stopped", 25)
+	env.assertRelays(t, 1, gpio.Low, gpio.Low)
+
+	env.clock.Advance(time.Minute)
+	env.assertShutter(t, 1, "stopped", 25)
+}
+
+func TestReferenceDrive(t *testing.T) {
+	env := newTestEnv(t, Config{})
+	if err := env.controller.RegisterShutters(newTestShutter(1, 17, 27, 20, 100)); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := env.controller.OpenShutter(1); err != nil {
+		t.Fatal(err)
+	}
+	env.assertShutter(t, 1, "referencing", 0)
+	env.assertRelays(t, 1, gpio.High, gpio.Low)
+
+	env.clock.Advance(19 * time.Second)
+	env.assertShutter(t, 1, "referencing", 0)
+
+	env.clock.Advance(time.Second)
+	env.assertShutter(t, 1, "stopped", 0)
+	env.assertRelays(t, 1, gpio.Low, gpio.Low)
+}
+
+func TestScheduleShutterJobs(t *testing.T) {
+	env := newTestEnv(t, Config{})
+	shutter := newTestShutter(1, 17, 27, 20, 0)
+	shutter.JobsEnabled = true
+	if err := env.controller.RegisterShutters(shutter); err != nil {
+		t.Fatal(err)
+	}
+
+	if jobs := env.scheduler.active(); !reflect.DeepEqual(jobs, []string{"07:30", "20:00"}) {
+		t.Errorf("Expected jobs at 07:30 and 20:00 but got %v", jobs)
+	}
+
+	env.scheduler.fire(7, 30)
+	env.assertShutter(t, 1, "opening", 0)
+}
+
+func TestRescheduleShutterJobs(t *testing.T) {
+	env := newTestEnv(t, Config{})
+	shutter := newTestShutter(1, 17, 27, 20, 0)
+	shutter.JobsEnabled = true
+	if err := env.controller.RegisterShutters(shutter); err != nil {
+		t.Fatal(err)
+	}
+
+	updated := shutter.DeepCopy()
+	updated.OpenTime = time.Date(0, 1, 1, 8, 15, 0, 0, time.UTC)
+	if err := env.controller.UpdateShutter(shutter.GetDifferences(updated), updated); err != nil {
+		t.Fatal(err)
+	}
+	if jobs := env.scheduler.active(); !reflect.DeepEqual(jobs, []string{"08:15", "20:00"}) {
+		t.Errorf("Expected jobs at 08:15 and 20:00 after rescheduling but got %v", jobs)
+	}
+
+	disabled := updated.DeepCopy()
+	disabled.JobsEnabled = false
+	if err := env.controller.UpdateShutter(updated.GetDifferences(disabled), disabled); err != nil {
+		t.Fatal(err)
+	}
+	if jobs := env.scheduler.active(); len(jobs) != 0 {
+		t.Errorf("Expected no jobs after disabling them but got %v", jobs)
+	}
+}
+
+func TestUnregisterShutterWhileMoving(t *testing.T) {
+	env := newTestEnv(t, Config{MaxRunTime: time.Minute})
+	shutter := newTestShutter(1, 17, 27, 20, 0)
+	shutter.JobsEnabled = true
+	if err := env.controller.RegisterShutters(shutter); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := env.controller.OpenShutter(1); err != nil {
+		t.Fatal(err)
+	}
+	env.clock.Advance(5 * time.Second)
+	if err := env.controller.UnregisterShutter(1); err != nil {
+		t.Fatal(err)
+	}
+	env.assertShutter(t, 1, "stopped", 25)
+	commands := env.controller.Commands()
+	if len(commands) != 1 || commands[0].Action != "stop" || commands[0].Source != model.CommandSourceSystem ||
+		commands[0].Priority != model.CommandPriorityHigh || commands[0].Status != model.CommandDone {
+		t.Errorf("Expected the shutter to be stopped by a command of the controller but got %+v", commands)
+	}
+
+	env.clock.Advance(2 * time.Minute)
+	env.assertShutter(t, 1, "stopped", 25)
+	if jobs := env.scheduler.active(); len(jobs) != 0 {
+		t.Errorf("Expected no jobs after unregistering but got %v", jobs)
+	}
+	if err := env.controller.OpenShutter(1); err == nil {
+		t.Error("Expected an error on opening an unregistered shutter")
+	}
+}
+
+func TestRegisterShutterWithInvalidPin(t *testing.T) {
+	env := newTestEnv(t, Config{})
+	if err := env.controller.RegisterShutters(newTestShutter(1, 17, 14, 20, 0)); err == nil {
+		t.Error("Expected an error on registering a shutter with a reserved pin")
+	}
+	if _, err := env.controller.getShutterByID(1); err == nil {
+		t.Error("Shutter with an invalid pin must not be registered")
+	}
+}
+
+func TestRegisterShutterTwice(t *testing.T) {
+	env := newTestEnv(t, Config{})
+	shutter := newTestShutter(1, 17, 27, 20, 0)
+	shutter.JobsEnabled = true
+	if err := env.controller.RegisterShutters(shutter); err != nil {
+		t.Fatal(err)
+	}
+	device, _ := env.controller.getShutterByID(1)
+
+	moved := newTestShutter(1, 5, 6, 20, 0)
+	if err := env.controller.RegisterShutters(moved); err == nil {
+		t.Error("Expected an error on registering a shutter that is already registered")
+	}
+	if registered, _ := env.controller.getShutterByID(1); registered != device {
+		t.Error("Expected the registered shutter to be kept")
+	}
+	if jobs := env.scheduler.active(); !reflect.DeepEqual(jobs, []string{"07:30", "20:00"}) {
+		t.Errorf("Expected only the jobs of the registered shutter but got %v", jobs)
+	}
+}
+
+func TestChangeShutterPins(t *testing.T) {
+	env := newTestEnv(t, Config{})
+	shutter := newTestShutter(1, 17, 27, 20, 0)
+	if err := env.controller.RegisterShutters(shutter); err != nil {
+		t.Fatal(err)
+	}
+
+	updated := shutter.DeepCopy()
+	closePin := 22
+	updated.ClosePin = &closePin
+	diffs := shutter.GetDifferences(updated)
+	if !diffs.HasFlag(model.DIFFCLOSEPIN) || diffs.HasFlag(model.DIFFOPENPIN) {
+		t.Fatalf("Expected only the close pin to differ but got %b", diffs)
+	}
+	if err := env.controller.UpdateShutter(diffs, updated); err != nil {
+		t.Fatal(err)
+	}
+
+	device, _ := env.controller.getShutterByID(1)
+	if device.closePin.Number() != 22 || device.openPin.Number() != 17 {
+		t.Errorf("Expected the pins 17 and 22 but got %d and %d", device.openPin.Number(), device.closePin.Number())
+	}
+}
+
+func TestUpdateDisabledShutter(t *testing.T) {
+	env := newTestEnv(t, Config{})
+	shutter := newTestShutter(1, 17, 27, 20, 0)
+	shutter.Disabled = true
+	if err := env.controller.RegisterShutters(shutter); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := env.controller.getShutterByID(1); err == nil {
+		t.Fatal("Expected a disabled shutter not to be registered")
+	}
+
+	updated := shutter.DeepCopy()
+	openPin := 22
+	updated.OpenPin = &openPin
+	if err := env.controller.UpdateShutter(shutter.GetDifferences(updated), updated); err != nil {
+		t.Fatalf("Expected no error on updating a disabled shutter but got %v", err)
+	}
+
+	enabled := updated.DeepCopy()
+	enabled.Disabled = false
+	enabled.EmergencyEnabled = true
+	if err := env.controller.UpdateShutter(updated.GetDifferences(enabled), enabled); err != nil {
+		t.Fatal(err)
+	}
+	device, err := env.controller.getShutterByID(1)
+	if err != nil {
+		t.Fatalf("Expected the enabled shutter to be registered: %v", err)
+	}
+	if device.openPin.Number() != 22 {
+		t.Errorf("Expected the changed open pin 22 but got %d", device.openPin.Number())
+	}
+}
+
+func TestUpdateShutterWithEmergencyChange(t *testing.T) {
+	env := newTestEnv(t, Config{})
+	shutter := newTestShutter(1, 17, 27, 20, 0)
+	if err := env.controller.RegisterShutters(shutter); err != nil {
+		t.Fatal(err)
+	}
+
+	updated := shutter.DeepCopy()
+	closePin := 22
+	updated.ClosePin = &closePin
+	updated.EmergencyEnabled = true
+	if err := env.controller.UpdateShutter(shutter.GetDifferences(updated), updated); err != nil {
+		t.Fatal(err)
+	}
+
+	device, _ := env.controller.getShutterByID(1)
+	if device.closePin.Number() != 22 {
+		t.Errorf("Expected the close pin to change along with the emergency flag but got %d", device.closePin.Number())
+	}
+}
+
+func TestChangeShutterPinsFailsOnStop(t *testing.T) {
+	env := newTestEnv(t, Config{})
+	shutter := newTestShutter(1, 17, 27, 20, 0)
+	if err := env.controller.RegisterShutters(shutter); err != nil {
+		t.Fatal(err)
+	}
+
+	env.store.Lock()
+	env.store.stateErr = errors.New("disk full")
+	env.store.Unlock()
+	openPin := 22
+	shutter.OpenPin = &openPin
+	if err := env.controller.UpdateShutter(model.DIFFOPENPIN, shutter); err == nil {
+		t.Error("Expected the failed stop to be returned")
+	}
+	device, _ := env.controller.getShutterByID(1)
+	if device.openPin.Number() != 17 {
+		t.Errorf("Expected the open pin to be kept but got %d", device.openPin.Number())
+	}
+}
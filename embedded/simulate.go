@@ -2,24 +2,99 @@ package embedded
 
 import (
 	"fmt"
-	"log"
-
+	"sort"
+	"strconv"
+	"sync"
 	"time"
 
+	"github.com/he4d/almue-backend/logging"
+	"github.com/he4d/almue-backend/model"
+	"github.com/he4d/simplejack"
 	"periph.io/x/periph/conn/gpio"
 	"periph.io/x/periph/conn/physic"
 )
 
+// maxPinHistory is the number of level changes that are kept per simulated pin
+const maxPinHistory = 100
+
+// pinBank holds the virtual gpio pins of the simulation mode.
+// A pin keeps its level and history for the whole runtime, even if the
+// device that uses it gets unregistered or changes its pins.
+type pinBank struct {
+	sync.Mutex
+	pins   map[int]*simulatePinIO
+	clock  Clock
+	logger *simplejack.Logger
+}
+
+func newPinBank(clock Clock, logger *simplejack.Logger) *pinBank {
+	return &pinBank{pins: make(map[int]*simulatePinIO), clock: clock, logger: logger}
+}
+
+// get returns the virtual pin with the given number and creates it if necessary
+func (b *pinBank) get(name string, number int) *simulatePinIO {
+	b.Lock()
+	defer b.Unlock()
+	pin, ok := b.pins[number]
+	if !ok {
+		pin = &simulatePinIO{bank: b, number: number, function: "In", pull: gpio.Float, edges: make(chan gpio.Level, 1)}
+		b.pins[number] = pin
+	}
+	pin.Lock()
+	pin.name = name
+	pin.Unlock()
+	return pin
+}
+
+// states returns the current states of all virtual pins ordered by their number
+func (b *pinBank) states() []*model.PinState {
+	b.Lock()
+	pins := make([]*simulatePinIO, 0, len(b.pins))
+	for _, pin := range b.pins {
+		pins = append(pins, pin)
+	}
+	b.Unlock()
+
+	sort.Slice(pins, func(i, j int) bool { return pins[i].number < pins[j].number })
+
+	states := make([]*model.PinState, 0, len(pins))
+	for _, pin := range pins {
+		states = append(states, pin.state())
+	}
+	return states
+}
+
+// inject sets the level of a virtual pin from the outside as if it was driven by connected hardware
+func (b *pinBank) inject(number int, level gpio.Level) error {
+	b.Lock()
+	pin, ok := b.pins[number]
+	b.Unlock()
+	if !ok {
+		return fmt.Errorf("Pin %d is not used by any device", number)
+	}
+	return pin.inject(level)
+}
+
 type simulatePinIO struct {
-	name   string
-	number int
+	sync.Mutex
+	bank     *pinBank
+	name     string
+	number   int
+	function string
+	level    gpio.Level
+	pull     gpio.Pull
+	edge     gpio.Edge
+	edges    chan gpio.Level
+	history  []*model.PinEvent
 }
 
 func (s *simulatePinIO) String() string {
-	return fmt.Sprintf("%s(%d)", s.name, s.number)
+	return fmt.Sprintf("%s(%d)", s.Name(), s.number)
 }
 
 func (s *simulatePinIO) Name() string {
+	s.Lock()
+	defer s.Unlock()
 	return s.name
 }
 
@@ -28,45 +103,137 @@ func (s *simulatePinIO) Number() int {
 }
 
 func (s *simulatePinIO) Function() string {
-	return "Out"
+	s.Lock()
+	defer s.Unlock()
+	return s.function
 }
 
 func (s *simulatePinIO) In(pull gpio.Pull, edge gpio.Edge) error {
-	//TODO:
+	s.Lock()
+	defer s.Unlock()
+	s.function = "In"
+	s.edge = edge
+	if pull != gpio.PullNoChange {
+		s.pull = pull
+	}
 	return nil
 }
 
 func (s *simulatePinIO) Read() gpio.Level {
-	//TODO:
-	return true
+	s.Lock()
+	defer s.Unlock()
+	return s.level
 }
 
+// WaitForEdge waits for an injected edge that matches the edge detection set by In.
+// A negative timeout waits forever.
 func (s *simulatePinIO) WaitForEdge(timeout time.Duration) bool {
-	//TODO:
-	return true
+	if timeout < 0 {
+		<-s.edges
+		return true
+	}
+	select {
+	case <-s.edges:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
 }
 
 func (s *simulatePinIO) Pull() gpio.Pull {
-	//TODO:
-	return 2
+	s.Lock()
+	defer s.Unlock()
+	return s.pull
 }
 
 func (s *simulatePinIO) DefaultPull() gpio.Pull {
-	//TODO:
-	return 2
+	return gpio.Float
 }
 
 func (s *simulatePinIO) Halt() error {
-	//TODO:
 	return nil
 }
 
 func (s *simulatePinIO) PWM(gpio.Duty, physic.Frequency) error {
-	//TODO:
-	return nil
+	return fmt.Errorf("PWM is not supported by the simulated pin %d", s.number)
 }
 
 func (s *simulatePinIO) Out(l gpio.Level) error {
-	log.Printf("Name: %s - Pin: %d is switching level to %t\n", s.name, s.number, l)
+	s.Lock()
+	defer s.Unlock()
+	s.function = "Out"
+	s.setLevel(l, false)
+	s.logger().Debug.Printf("Pin %d switches its level to %t", s.number, l)
 	return nil
 }
+
+func (s *simulatePinIO) inject(l gpio.Level) error {
+	s.Lock()
+	defer s.Unlock()
+	if s.function != "In" {
+		return fmt.Errorf("Pin %d is an output and can not be driven from the outside", s.number)
+	}
+	previous := s.level
+	s.setLevel(l, true)
+	s.logger().Debug.Printf("Pin %d got the injected level %t", s.number, l)
+
+	rising := previous == gpio.Low && l == gpio.High
+	falling := previous == gpio.High && l == gpio.Low
+	if (rising && (s.edge == gpio.RisingEdge || s.edge == gpio.BothEdges)) ||
+		(falling && (s.edge == gpio.FallingEdge || s.edge == gpio.BothEdges)) {
+		select {
+		case s.edges <- l:
+		default:
+		}
+	}
+	return nil
+}
+
+// logger returns the logger of the pin bank with the pin as field. The pin must be locked by the caller.
+func (s *simulatePinIO) logger() *simplejack.Logger {
+	return logging.With(s.bank.logger, "pin", strconv.Itoa(s.number), "pin_name", s.name)
+}
+
+// setLevel changes the level and records it in the history. The pin must be locked by the caller.
+func (s *simulatePinIO) setLevel(l gpio.Level, injected bool) {
+	s.level = l
+	s.history = append(s.history, &model.PinEvent{Time: s.bank.clock.Now(), High: bool(l), Injected: injected})
+	if len(s.history) > maxPinHistory {
+		s.history = s.history[len(s.history)-maxPinHistory:]
+	}
+}
+
+func (s *simulatePinIO) state() *model.PinState {
+	s.Lock()
+	defer s.Unlock()
+	history := make([]*model.PinEvent, len(s.history))
+	copy(history, s.history)
+	return &model.PinState{
+		Number:   s.number,
+		Name:     s.name,
+		Function: s.function,
+		High:     bool(s.level),
+		History:  history,
+	}
+}
+
+// Simulating returns true if the controller runs on virtual gpio pins
+func (c *Controller) Simulating() bool {
+	return c.config.Simulate
+}
+
+// SimulatedPins returns the states of all virtual gpio pins
+func (c *Controller) SimulatedPins() ([]*model.PinState, error) {
+	if !c.config.Simulate {
+		return nil, fmt.Errorf("The controller does not run in simulation mode")
+	}
+	return c.pins.states(), nil
+}
+
+// InjectPinLevel drives the virtual input pin with the given number to the given level
+func (c *Controller) InjectPinLevel(number int, high bool) error {
+	if !c.config.Simulate {
+		return fmt.Errorf("The controller does not run in simulation mode")
+	}
+	return c.pins.inject(number, gpio.Level(high))
+}
@@ -0,0 +1,162 @@
+package embedded
+
+import (
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/he4d/almue-backend/board"
+	"github.com/he4d/almue-backend/model"
+	"github.com/he4d/simplejack"
+	"periph.io/x/periph/conn/gpio"
+)
+
+func TestPinBank(t *testing.T) {
+	env := newTestEnv(t, Config{})
+	if err := env.controller.RegisterShutters(newTestShutter(1, 27, 17, 20, 0)); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.controller.OpenShutter(1); err != nil {
+		t.Fatal(err)
+	}
+	env.clock.Advance(time.Second)
+	if err := env.controller.UnregisterShutter(1); err != nil {
+		t.Fatal(err)
+	}
+
+	// the pins keep their level and history after the shutter was unregistered
+	pins, err := env.controller.SimulatedPins()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pins) != 2 || pins[0].Number != 17 || pins[1].Number != 27 {
+		t.Fatalf("Expected the pins 17 and 27 ordered by their number but got %+v", pins)
+	}
+	open := pins[1]
+	if open.Name != "testshutter" || open.Function != "Out" || open.High {
+		t.Errorf("Expected the switched off open pin of the shutter but got %+v", open)
+	}
+	var switchedOn, switchedOff *model.PinEvent
+	for _, event := range open.History {
+		if event.High && switchedOn == nil {
+			switchedOn = event
+		}
+		if !event.High && switchedOn != nil {
+			switchedOff = event
+		}
+	}
+	if switchedOn == nil || switchedOff == nil || switchedOff.Time.Sub(switchedOn.Time) != time.Second || switchedOn.Injected {
+		t.Errorf("Expected the open pin to be switched on for a second but got %+v", open.History)
+	}
+
+	// outputs and unknown pins can not be driven from the outside
+	if err := env.controller.InjectPinLevel(27, true); err == nil {
+		t.Error("Expected an error on injecting a level into an output")
+	}
+	if err := env.controller.InjectPinLevel(22, true); err == nil {
+		t.Error("Expected an error on injecting a level into an unused pin")
+	}
+}
+
+func TestPinHistoryIsLimited(t *testing.T) {
+	env := newTestEnv(t, Config{})
+	pin := env.controller.pins.get("test", 22)
+	for i := 0; i < maxPinHistory+10; i++ {
+		pin.Out(gpio.Level(i%2 == 0))
+	}
+	history := pin.state().History
+	if len(history) != maxPinHistory {
+		t.Fatalf("Expected the last %d level changes but got %d", maxPinHistory, len(history))
+	}
+	if last := history[maxPinHistory-1]; last.High != ((maxPinHistory+9)%2 == 0) {
+		t.Errorf("Expected the last level change at the end of the history but got %+v", last)
+	}
+}
+
+func TestInjectEdges(t *testing.T) {
+	env := newTestEnv(t, Config{})
+	pin := env.controller.pins.get("button", 22)
+	if err := pin.In(gpio.PullDown, gpio.RisingEdge); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := env.controller.InjectPinLevel(22, true); err != nil {
+		t.Fatal(err)
+	}
+	if !pin.WaitForEdge(time.Second) || pin.Read() != gpio.High {
+		t.Error("Expected the injected rising edge")
+	}
+	if err := env.controller.InjectPinLevel(22, false); err != nil {
+		t.Fatal(err)
+	}
+	if pin.WaitForEdge(10 * time.Millisecond) {
+		t.Error("Expected the falling edge not to be detected")
+	}
+	if history := pin.state().History; len(history) != 2 || !history[0].Injected || !history[1].Injected {
+		t.Errorf("Expected the injected levels in the history but got %+v", history)
+	}
+}
+
+func TestStopPin(t *testing.T) {
+	env := newTestEnv(t, Config{StopPin: 4})
+	if err := env.controller.RegisterShutters(newTestShutter(1, 17, 27, 20, 0), newTestShutter(2, 22, 23, 20, 100)); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.controller.RegisterLightings(newTestLighting(1, 4)); err == nil {
+		t.Error("Expected an error on registering a lighting on the stop pin")
+	}
+	if err := env.controller.OpenShutter(1); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.controller.CloseShutter(2); err != nil {
+		t.Fatal(err)
+	}
+	env.clock.Advance(2 * time.Second)
+
+	if err := env.controller.InjectPinLevel(4, true); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "the shutters to be stopped", func() bool {
+		stopped := 0
+		for _, command := range env.controller.Commands() {
+			if command.Source == model.CommandSourceStopPin && command.Status == model.CommandDone {
+				stopped++
+			}
+		}
+		return stopped == 2
+	})
+	env.assertShutter(t, 1, "stopped", 10)
+	env.assertRelays(t, 1, gpio.Low, gpio.Low)
+	env.assertShutter(t, 2, "stopped", 90)
+	env.assertRelays(t, 2, gpio.Low, gpio.Low)
+}
+
+func TestStopPinOnReservedBoard(t *testing.T) {
+	profile, err := board.Get("rpi3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	reserved, err := profile.Reserve(4, "stop pin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger := simplejack.New(simplejack.TRACE, ioutil.Discard)
+	config := Config{Simulate: true, Board: reserved, Clock: newFakeClock(), Scheduler: &fakeScheduler{}, StopPin: 4}
+	if _, err := New(logger, newMemStateStore(), config); err != nil {
+		t.Errorf("Expected the stop pin to be usable on the board that reserves it: %v", err)
+	}
+	config.StopPin = 40
+	if _, err := New(logger, newMemStateStore(), config); err == nil {
+		t.Error("Expected an error on a stop pin that does not exist")
+	}
+}
+
+func TestInjectWithoutSimulation(t *testing.T) {
+	controller := &Controller{}
+	if err := controller.InjectPinLevel(4, true); err == nil {
+		t.Error("Expected an error on injecting a level without the simulation mode")
+	}
+	if _, err := controller.SimulatedPins(); err == nil {
+		t.Error("Expected an error on listing the pins without the simulation mode")
+	}
+}
@@ -0,0 +1,65 @@
+package embedded
+
+import (
+	"time"
+
+	"github.com/he4d/almue-backend/model"
+)
+
+// schedulerGracePeriod is the time a daily job may be late before the scheduler is considered dead
+const schedulerGracePeriod = 2 * time.Minute
+
+// Status returns the state of the controller and counts its registered devices in each state.
+// The states are the ones of the controller, which writes them to the state store
+func (c *Controller) Status() *model.ControllerStatus {
+	status := &model.ControllerStatus{
+		Simulate:       c.config.Simulate,
+		GPIO:           "initialized",
+		ShutterStates:  map[string]int{},
+		LightingStates: map[string]int{},
+	}
+	if c.config.Simulate {
+		status.GPIO = "simulated"
+	}
+
+	c.shuttersLock.RLock()
+	shutters := make(map[int64]*shutter, len(c.shutters))
+	for id, device := range c.shutters {
+		shutters[id] = device
+	}
+	c.shuttersLock.RUnlock()
+	for id, device := range shutters {
+		state := model.DeviceStatusFault
+		if !c.hasFault(model.DeviceTypeShutter, id) {
+			device.Lock()
+			state = device.direction.String()
+			device.Unlock()
+		}
+		status.ShutterStates[state]++
+	}
+	status.Shutters = len(shutters)
+
+	c.lightingsLock.RLock()
+	lightings := make(map[int64]*lighting, len(c.lightings))
+	for id, device := range c.lightings {
+		lightings[id] = device
+	}
+	c.lightingsLock.RUnlock()
+	for id, device := range lightings {
+		state := model.DeviceStatusFault
+		if !c.hasFault(model.DeviceTypeLighting, id) {
+			state = "off"
+			device.Lock()
+			if device.on {
+				state = "on"
+			}
+			device.Unlock()
+		}
+		status.LightingStates[state]++
+	}
+	status.Lightings = len(lightings)
+
+	status.MissedJobs = c.missedJobs()
+	status.SchedulerAlive = status.MissedJobs == 0
+	return status
+}
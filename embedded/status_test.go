@@ -0,0 +1,55 @@
+package embedded
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/he4d/almue-backend/model"
+)
+
+func TestControllerStatus(t *testing.T) {
+	env := newTestEnv(t, Config{})
+	shutter := newTestShutter(1, 17, 27, 20, 0)
+	shutter.JobsEnabled = true
+	if err := env.controller.RegisterShutters(shutter, newTestShutter(2, 22, 23, 20, 0), newTestShutter(3, 5, 6, 20, 0)); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.controller.RegisterLightings(newTestLighting(1, 4), newTestLighting(2, 12)); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.controller.OpenShutter(2); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.controller.TurnLightingOn(1); err != nil {
+		t.Fatal(err)
+	}
+	env.controller.recordFault(model.DeviceTypeShutter, 3, errors.New("relay stuck"))
+
+	status := env.controller.Status()
+	if !status.Simulate || status.GPIO != "simulated" || !status.SchedulerAlive ||
+		status.Shutters != 3 || status.Lightings != 2 {
+		t.Errorf("Expected a healthy simulated controller with 5 devices but got %+v", status)
+	}
+	if expected := map[string]int{"stopped": 1, "opening": 1, model.DeviceStatusFault: 1}; !reflect.DeepEqual(status.ShutterStates, expected) {
+		t.Errorf("Expected the shutter states %v but got %v", expected, status.ShutterStates)
+	}
+	if expected := map[string]int{"on": 1, "off": 1}; !reflect.DeepEqual(status.LightingStates, expected) {
+		t.Errorf("Expected the lighting states %v but got %v", expected, status.LightingStates)
+	}
+
+	// the scheduler is considered dead when the open job at 7:30 does not run
+	env.clock.Advance(90*time.Minute + schedulerGracePeriod)
+	if status := env.controller.Status(); !status.SchedulerAlive {
+		t.Errorf("Expected the scheduler to be alive within the grace period but got %+v", status)
+	}
+	env.clock.Advance(time.Second)
+	if status := env.controller.Status(); status.SchedulerAlive || status.MissedJobs != 1 {
+		t.Errorf("Expected the missed open job but got %+v", status)
+	}
+	env.scheduler.fire(7, 30)
+	if status := env.controller.Status(); !status.SchedulerAlive {
+		t.Errorf("Expected the scheduler to be alive after the job ran but got %+v", status)
+	}
+}
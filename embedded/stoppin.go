@@ -0,0 +1,47 @@
+package embedded
+
+import (
+	"fmt"
+
+	"github.com/he4d/almue-backend/model"
+	"periph.io/x/periph/conn/gpio"
+)
+
+// watchStopPin configures the stop pin as input and stops all shutters on every rising edge of it.
+// The board profile may reserve the stop pin for the devices, it only has to exist
+func (c *Controller) watchStopPin() error {
+	if c.config.Board.Pin(c.config.StopPin) == nil {
+		return fmt.Errorf("The stop pin %d does not exist on board %s", c.config.StopPin, c.config.Board.Name)
+	}
+	pin, err := c.openPin("stop", c.config.StopPin)
+	if err != nil {
+		return err
+	}
+	if err := pin.In(gpio.PullDown, gpio.RisingEdge); err != nil {
+		return fmt.Errorf("Could not configure the stop pin %d as input: %v", c.config.StopPin, err)
+	}
+	go func() {
+		for pin.WaitForEdge(-1) {
+			c.logger.Warning.Printf("The stop pin %d was triggered, all shutters get stopped", c.config.StopPin)
+			c.stopAllShutters(model.CommandSourceStopPin)
+		}
+		c.logger.Error.Printf("Stopped watching the stop pin %d", c.config.StopPin)
+	}()
+	return nil
+}
+
+// stopAllShutters stops all registered shutters before their queued commands
+func (c *Controller) stopAllShutters(source string) {
+	c.shuttersLock.RLock()
+	shutterIDs := make([]int64, 0, len(c.shutters))
+	for shutterID := range c.shutters {
+		shutterIDs = append(shutterIDs, shutterID)
+	}
+	c.shuttersLock.RUnlock()
+
+	for _, shutterID := range shutterIDs {
+		if err := c.runCommand(model.DeviceTypeShutter, shutterID, "stop", source, model.CommandPriorityHigh); err != nil {
+			c.logger.Error.Printf("Could not stop shutter %d: %v", shutterID, err)
+		}
+	}
+}
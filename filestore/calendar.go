@@ -0,0 +1,106 @@
+package filestore
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/he4d/almue-backend/model"
+)
+
+// GetCalendarException returns the calendar exception with the given id
+func (s *Store) GetCalendarException(exceptionID int64) (*model.CalendarException, error) {
+	var exception *model.CalendarException
+	err := s.read(func(doc *document) error {
+		e, _ := doc.calendarException(exceptionID)
+		if e == nil {
+			return model.ErrNotFound
+		}
+		exception = e.DeepCopy()
+		return nil
+	})
+	return exception, err
+}
+
+// GetCalendarExceptionList returns all calendar exceptions ordered by their start date
+func (s *Store) GetCalendarExceptionList() ([]*model.CalendarException, error) {
+	exceptions := []*model.CalendarException{}
+	err := s.read(func(doc *document) error {
+		for _, e := range doc.CalendarExceptions {
+			exceptions = append(exceptions, e.DeepCopy())
+		}
+		return nil
+	})
+	sort.SliceStable(exceptions, func(i, j int) bool {
+		if exceptions[i].StartDate != exceptions[j].StartDate {
+			return exceptions[i].StartDate < exceptions[j].StartDate
+		}
+		return exceptions[i].ID < exceptions[j].ID
+	})
+	return exceptions, err
+}
+
+// CreateCalendarException creates a calendar exception and returns the generated id
+func (s *Store) CreateCalendarException(e *model.CalendarException) (int64, error) {
+	exception := e.DeepCopy()
+	exception.Normalize()
+	if err := checkCalendarException(exception); err != nil {
+		return 0, err
+	}
+	var id int64
+	err := s.write(func(doc *document) error {
+		id = doc.nextCalendarExceptionID()
+		created := now()
+		exception.Base = model.Base{ID: id, Created: created, Modified: created, Version: 1}
+		doc.CalendarExceptions = append(doc.CalendarExceptions, exception)
+		return nil
+	})
+	return id, err
+}
+
+// UpdateCalendarException updates a calendar exception with the given model.
+// The version of the model must match the stored one, otherwise model.ErrVersionConflict is returned
+func (s *Store) UpdateCalendarException(e *model.CalendarException) error {
+	updated := e.DeepCopy()
+	updated.Normalize()
+	if err := checkCalendarException(updated); err != nil {
+		return err
+	}
+	return s.write(func(doc *document) error {
+		exception, i := doc.calendarException(e.ID)
+		if exception == nil || exception.Version != e.Version {
+			return model.ErrVersionConflict
+		}
+		updated.Base = exception.Base
+		updated.Modified = now()
+		updated.Version++
+		doc.CalendarExceptions[i] = updated
+		return nil
+	})
+}
+
+// DeleteCalendarException deletes the calendar exception with the given id
+func (s *Store) DeleteCalendarException(exceptionID int64) error {
+	return s.write(func(doc *document) error {
+		_, i := doc.calendarException(exceptionID)
+		if i < 0 {
+			return fmt.Errorf("Calendar exception with id %d didnt exist", exceptionID)
+		}
+		doc.CalendarExceptions = append(doc.CalendarExceptions[:i], doc.CalendarExceptions[i+1:]...)
+		return nil
+	})
+}
+
+// checkCalendarException checks the fields that the sqlite schema requires
+func checkCalendarException(e *model.CalendarException) error {
+	if e.Description == nil || e.StartDate == "" {
+		return errors.New("The description and start date of a calendar exception are required")
+	}
+	if e.EndDate < e.StartDate {
+		return errors.New("The end date of a calendar exception must not be before its start date")
+	}
+	if e.Action != model.CalendarSkip && e.Action != model.CalendarShift {
+		return errors.New("The action of a calendar exception must be skip or shift")
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package filestore
+
+import (
+	"errors"
+
+	"github.com/he4d/almue-backend/model"
+)
+
+// GetConfiguration returns all floors, rooms, shutters, lightings and calendar exceptions of the store
+func (s *Store) GetConfiguration() (*model.Configuration, error) {
+	config := &model.Configuration{}
+	err := s.read(func(doc *document) error {
+		c := doc.clone()
+		config.Floors, config.Rooms, config.Shutters, config.Lightings = c.Floors, c.Rooms, c.Shutters, c.Lightings
+		config.CalendarExceptions = c.CalendarExceptions
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// ImportConfiguration replaces all floors, rooms, shutters, lightings and calendar exceptions of the store
+// with the given configuration. The ids of the configuration are kept.
+// Either the whole configuration is imported or nothing is changed at all.
+func (s *Store) ImportConfiguration(c *model.Configuration) error {
+	return s.write(func(doc *document) error {
+		created := now()
+		base := func(id int64) model.Base {
+			return model.Base{ID: id, Created: created, Modified: created, Version: 1}
+		}
+
+		doc.Floors = make([]*model.Floor, 0, len(c.Floors))
+		for _, f := range c.Floors {
+			if f.Description == nil {
+				return errors.New("The description of a floor is required")
+			}
+			floor := f.DeepCopy()
+			floor.Base = base(f.ID)
+			doc.Floors = append(doc.Floors, floor)
+		}
+
+		doc.Rooms = make([]*model.Room, 0, len(c.Rooms))
+		for _, r := range c.Rooms {
+			if err := checkRoom(r); err != nil {
+				return err
+			}
+			room := r.DeepCopy()
+			room.Base = base(r.ID)
+			doc.Rooms = append(doc.Rooms, room)
+		}
+
+		doc.Shutters = make([]*model.Shutter, 0, len(c.Shutters))
+		for _, sh := range c.Shutters {
+			if err := checkShutter(sh); err != nil {
+				return err
+			}
+			shutter := sh.DeepCopy()
+			shutter.Base = base(sh.ID)
+			shutter.OpenTime = sh.OpenTime.UTC()
+			shutter.CloseTime = sh.CloseTime.UTC()
+			shutter.DeviceStatus = "stopped"
+			shutter.Fault = nil
+			shutter.Tags = model.SortTags(sh.Tags)
+			doc.Shutters = append(doc.Shutters, shutter)
+		}
+
+		doc.Lightings = make([]*model.Lighting, 0, len(c.Lightings))
+		for _, l := range c.Lightings {
+			if err := checkLighting(l); err != nil {
+				return err
+			}
+			lighting := l.DeepCopy()
+			lighting.Base = base(l.ID)
+			lighting.OnTime = l.OnTime.UTC()
+			lighting.OffTime = l.OffTime.UTC()
+			lighting.DeviceStatus = "off"
+			lighting.Fault = nil
+			lighting.Tags = model.SortTags(l.Tags)
+			doc.Lightings = append(doc.Lightings, lighting)
+		}
+
+		doc.CalendarExceptions = make([]*model.CalendarException, 0, len(c.CalendarExceptions))
+		for _, e := range c.CalendarExceptions {
+			exception := e.DeepCopy()
+			exception.Normalize()
+			if err := checkCalendarException(exception); err != nil {
+				return err
+			}
+			exception.Base = base(e.ID)
+			doc.CalendarExceptions = append(doc.CalendarExceptions, exception)
+		}
+		doc.dropCalendarDevices()
+		return nil
+	})
+}
@@ -0,0 +1,280 @@
+package filestore
+
+import (
+	"fmt"
+
+	"github.com/he4d/almue-backend/model"
+)
+
+// clone returns a deep copy of the document
+func (d *document) clone() *document {
+	c := &document{
+		Version:   d.Version,
+		Floors:    make([]*model.Floor, 0, len(d.Floors)),
+		Rooms:     make([]*model.Room, 0, len(d.Rooms)),
+		Shutters:  make([]*model.Shutter, 0, len(d.Shutters)),
+		Lightings: make([]*model.Lighting, 0, len(d.Lightings)),
+		// events are never changed, so the copy can share them
+		Events:             append([]*model.DeviceEvent(nil), d.Events...),
+		CalendarExceptions: make([]*model.CalendarException, 0, len(d.CalendarExceptions)),
+	}
+	for _, f := range d.Floors {
+		c.Floors = append(c.Floors, f.DeepCopy())
+	}
+	for _, r := range d.Rooms {
+		c.Rooms = append(c.Rooms, r.DeepCopy())
+	}
+	for _, s := range d.Shutters {
+		c.Shutters = append(c.Shutters, s.DeepCopy())
+	}
+	for _, l := range d.Lightings {
+		c.Lightings = append(c.Lightings, l.DeepCopy())
+	}
+	for _, e := range d.CalendarExceptions {
+		c.CalendarExceptions = append(c.CalendarExceptions, e.DeepCopy())
+	}
+	return c
+}
+
+// check checks the constraints that the sqlite store gets from its schema:
+// unique ids and floor descriptions, unique room descriptions of a floor,
+// existing floors and rooms of the devices and pins that are assigned to one device only
+func (d *document) check() error {
+	floors := map[int64]bool{}
+	descriptions := map[string]bool{}
+	for _, f := range d.Floors {
+		if f.Description == nil {
+			return fmt.Errorf("The floor %d has no description", f.ID)
+		}
+		if floors[f.ID] {
+			return fmt.Errorf("The floor id %d is not unique", f.ID)
+		}
+		if descriptions[*f.Description] {
+			return fmt.Errorf("The floor description %s is not unique", *f.Description)
+		}
+		floors[f.ID] = true
+		descriptions[*f.Description] = true
+	}
+
+	rooms := map[int64]int64{}
+	roomDescriptions := map[int64]map[string]bool{}
+	for _, r := range d.Rooms {
+		if r.Description == nil || r.FloorID == nil {
+			return fmt.Errorf("The room %d has no description or floor", r.ID)
+		}
+		if _, ok := rooms[r.ID]; ok {
+			return fmt.Errorf("The room id %d is not unique", r.ID)
+		}
+		if !floors[*r.FloorID] {
+			return fmt.Errorf("The floor %d of the room %d does not exist", *r.FloorID, r.ID)
+		}
+		if roomDescriptions[*r.FloorID][*r.Description] {
+			return fmt.Errorf("The room description %s is not unique on the floor %d", *r.Description, *r.FloorID)
+		}
+		if roomDescriptions[*r.FloorID] == nil {
+			roomDescriptions[*r.FloorID] = map[string]bool{}
+		}
+		rooms[r.ID] = *r.FloorID
+		roomDescriptions[*r.FloorID][*r.Description] = true
+	}
+	checkDeviceRoom := func(roomID *int64, floorID int64, device string) error {
+		if roomID == nil {
+			return nil
+		}
+		if roomFloorID, ok := rooms[*roomID]; !ok || roomFloorID != floorID {
+			return fmt.Errorf("The room of the %s does not exist on its floor", device)
+		}
+		return nil
+	}
+
+	pins := map[int]bool{}
+	assign := func(pin int) error {
+		if pins[pin] {
+			return fmt.Errorf("The pin %d is already assigned to a device", pin)
+		}
+		pins[pin] = true
+		return nil
+	}
+
+	shutters := map[int64]bool{}
+	for _, s := range d.Shutters {
+		if shutters[s.ID] {
+			return fmt.Errorf("The shutter id %d is not unique", s.ID)
+		}
+		shutters[s.ID] = true
+		if !floors[*s.FloorID] {
+			return fmt.Errorf("The floor %d of the shutter %d does not exist", *s.FloorID, s.ID)
+		}
+		if err := checkDeviceRoom(s.RoomID, *s.FloorID, "shutter"); err != nil {
+			return err
+		}
+		if err := assign(*s.OpenPin); err != nil {
+			return err
+		}
+		if err := assign(*s.ClosePin); err != nil {
+			return err
+		}
+	}
+
+	lightings := map[int64]bool{}
+	for _, l := range d.Lightings {
+		if lightings[l.ID] {
+			return fmt.Errorf("The lighting id %d is not unique", l.ID)
+		}
+		lightings[l.ID] = true
+		if !floors[*l.FloorID] {
+			return fmt.Errorf("The floor %d of the lighting %d does not exist", *l.FloorID, l.ID)
+		}
+		if err := checkDeviceRoom(l.RoomID, *l.FloorID, "lighting"); err != nil {
+			return err
+		}
+		if err := assign(*l.SwitchPin); err != nil {
+			return err
+		}
+	}
+
+	exceptions := map[int64]bool{}
+	for _, e := range d.CalendarExceptions {
+		if exceptions[e.ID] {
+			return fmt.Errorf("The calendar exception id %d is not unique", e.ID)
+		}
+		exceptions[e.ID] = true
+		for _, id := range e.Shutters {
+			if !shutters[id] {
+				return fmt.Errorf("The shutter %d of the calendar exception %d does not exist", id, e.ID)
+			}
+		}
+		for _, id := range e.Lightings {
+			if !lightings[id] {
+				return fmt.Errorf("The lighting %d of the calendar exception %d does not exist", id, e.ID)
+			}
+		}
+	}
+	return nil
+}
+
+func (d *document) floor(floorID int64) (*model.Floor, int) {
+	for i, f := range d.Floors {
+		if f.ID == floorID {
+			return f, i
+		}
+	}
+	return nil, -1
+}
+
+func (d *document) room(roomID int64) (*model.Room, int) {
+	for i, r := range d.Rooms {
+		if r.ID == roomID {
+			return r, i
+		}
+	}
+	return nil, -1
+}
+
+func (d *document) shutter(shutterID int64) (*model.Shutter, int) {
+	for i, s := range d.Shutters {
+		if s.ID == shutterID {
+			return s, i
+		}
+	}
+	return nil, -1
+}
+
+func (d *document) lighting(lightingID int64) (*model.Lighting, int) {
+	for i, l := range d.Lightings {
+		if l.ID == lightingID {
+			return l, i
+		}
+	}
+	return nil, -1
+}
+
+func (d *document) calendarException(exceptionID int64) (*model.CalendarException, int) {
+	for i, e := range d.CalendarExceptions {
+		if e.ID == exceptionID {
+			return e, i
+		}
+	}
+	return nil, -1
+}
+
+// dropCalendarDevices removes the deleted devices from the calendar exceptions,
+// like the foreign keys of the sqlite store do
+func (d *document) dropCalendarDevices() {
+	shutters := map[int64]bool{}
+	for _, s := range d.Shutters {
+		shutters[s.ID] = true
+	}
+	lightings := map[int64]bool{}
+	for _, l := range d.Lightings {
+		lightings[l.ID] = true
+	}
+	for _, e := range d.CalendarExceptions {
+		kept := []int64{}
+		for _, id := range e.Shutters {
+			if shutters[id] {
+				kept = append(kept, id)
+			}
+		}
+		e.Shutters = kept
+		kept = []int64{}
+		for _, id := range e.Lightings {
+			if lightings[id] {
+				kept = append(kept, id)
+			}
+		}
+		e.Lightings = kept
+	}
+}
+
+// The ids of new models follow the highest id, like the row ids of sqlite
+
+func (d *document) nextFloorID() int64 {
+	var max int64
+	for _, f := range d.Floors {
+		if f.ID > max {
+			max = f.ID
+		}
+	}
+	return max + 1
+}
+
+func (d *document) nextRoomID() int64 {
+	var max int64
+	for _, r := range d.Rooms {
+		if r.ID > max {
+			max = r.ID
+		}
+	}
+	return max + 1
+}
+
+func (d *document) nextShutterID() int64 {
+	var max int64
+	for _, s := range d.Shutters {
+		if s.ID > max {
+			max = s.ID
+		}
+	}
+	return max + 1
+}
+
+func (d *document) nextLightingID() int64 {
+	var max int64
+	for _, l := range d.Lightings {
+		if l.ID > max {
+			max = l.ID
+		}
+	}
+	return max + 1
+}
+
+func (d *document) nextCalendarExceptionID() int64 {
+	var max int64
+	for _, e := range d.CalendarExceptions {
+		if e.ID > max {
+			max = e.ID
+		}
+	}
+	return max + 1
+}
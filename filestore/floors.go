@@ -0,0 +1,141 @@
+package filestore
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/he4d/almue-backend/model"
+)
+
+// GetFloor returns the floor with the given id
+func (s *Store) GetFloor(floorID int64) (*model.Floor, error) {
+	var floor *model.Floor
+	err := s.read(func(doc *document) error {
+		f, _ := doc.floor(floorID)
+		if f == nil {
+			return model.ErrNotFound
+		}
+		floor = f.DeepCopy()
+		return nil
+	})
+	return floor, err
+}
+
+// GetFloorList returns all the floors of the store
+func (s *Store) GetFloorList() ([]*model.Floor, error) {
+	return s.FindFloors(&model.ListOptions{})
+}
+
+// FindFloors returns the floors in the order and page of the list options.
+// Floors can only be searched by their description, the filters of devices are ignored
+func (s *Store) FindFloors(opts *model.ListOptions) ([]*model.Floor, error) {
+	if err := checkListOptions(opts); err != nil {
+		return nil, err
+	}
+	key := floorSortKeys["id"]
+	if opts.Sort != "" {
+		var ok bool
+		if key, ok = floorSortKeys[opts.Sort]; !ok {
+			return nil, &model.ListOptionsError{Option: "sort", Value: opts.Sort}
+		}
+	}
+
+	floors := []*model.Floor{}
+	err := s.read(func(doc *document) error {
+		for _, f := range doc.Floors {
+			if matchesSearch(opts, *f.Description) {
+				floors = append(floors, f.DeepCopy())
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(floors, func(i, j int) bool {
+		return less(key(floors[i]), key(floors[j]), floors[i].ID, floors[j].ID, opts.Descending)
+	})
+	start, end, err := page(opts, len(floors),
+		func(i int) interface{} { return key(floors[i]) }, func(i int) int64 { return floors[i].ID })
+	if err != nil {
+		return nil, err
+	}
+	return floors[start:end], nil
+}
+
+// CreateFloor creates a floor in the store and returns the generated id
+func (s *Store) CreateFloor(f *model.Floor) (int64, error) {
+	if f.Description == nil {
+		return 0, errors.New("The description of a floor is required")
+	}
+	var id int64
+	err := s.write(func(doc *document) error {
+		id = doc.nextFloorID()
+		created := now()
+		descr := *f.Description
+		doc.Floors = append(doc.Floors, &model.Floor{
+			Base:        model.Base{ID: id, Created: created, Modified: created, Version: 1},
+			Description: &descr,
+		})
+		return nil
+	})
+	return id, err
+}
+
+// DeleteFloor deletes a floor with the given id together with its rooms and devices
+func (s *Store) DeleteFloor(floorID int64) error {
+	return s.write(func(doc *document) error {
+		_, i := doc.floor(floorID)
+		if i < 0 {
+			return fmt.Errorf("Floor with id %d didnt exist", floorID)
+		}
+		doc.Floors = append(doc.Floors[:i], doc.Floors[i+1:]...)
+
+		rooms := doc.Rooms[:0]
+		for _, room := range doc.Rooms {
+			if *room.FloorID != floorID {
+				rooms = append(rooms, room)
+			}
+		}
+		doc.Rooms = rooms
+
+		shutters := doc.Shutters[:0]
+		for _, shutter := range doc.Shutters {
+			if *shutter.FloorID != floorID {
+				shutters = append(shutters, shutter)
+			}
+		}
+		doc.Shutters = shutters
+
+		lightings := doc.Lightings[:0]
+		for _, lighting := range doc.Lightings {
+			if *lighting.FloorID != floorID {
+				lightings = append(lightings, lighting)
+			}
+		}
+		doc.Lightings = lightings
+		doc.dropCalendarDevices()
+		return nil
+	})
+}
+
+// UpdateFloor updates the floor with the given model.
+// The version of the model must match the stored one, otherwise model.ErrVersionConflict is returned
+func (s *Store) UpdateFloor(f *model.Floor) error {
+	if f.Description == nil {
+		return errors.New("The description of a floor is required")
+	}
+	return s.write(func(doc *document) error {
+		floor, _ := doc.floor(f.ID)
+		if floor == nil || floor.Version != f.Version {
+			return model.ErrVersionConflict
+		}
+		descr := *f.Description
+		floor.Description = &descr
+		floor.Modified = now()
+		floor.Version++
+		return nil
+	})
+}
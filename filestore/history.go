@@ -0,0 +1,53 @@
+package filestore
+
+import (
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/he4d/almue-backend/model"
+)
+
+// AddDeviceEvent records the state change of a device.
+// The time is stored in UTC with the precision of seconds, like the sqlite store does
+func (s *Store) AddDeviceEvent(event *model.DeviceEvent) error {
+	if event.DeviceType != "shutter" && event.DeviceType != "lighting" {
+		return errors.New("The device type of an event must be shutter or lighting")
+	}
+	e := *event
+	e.Time = e.Time.UTC().Truncate(time.Second)
+	return s.write(func(doc *document) error {
+		// events are recorded in order, so they are only sorted if the clock went back
+		i := sort.Search(len(doc.Events), func(i int) bool { return doc.Events[i].Time.After(e.Time) })
+		doc.Events = append(doc.Events, nil)
+		copy(doc.Events[i+1:], doc.Events[i:])
+		doc.Events[i] = &e
+		return nil
+	})
+}
+
+// FindDeviceEvents returns the events of all devices since the given time, ordered by their time
+func (s *Store) FindDeviceEvents(since time.Time) ([]*model.DeviceEvent, error) {
+	since = since.UTC().Truncate(time.Second)
+	events := []*model.DeviceEvent{}
+	err := s.read(func(doc *document) error {
+		for _, e := range doc.Events {
+			if !e.Time.Before(since) {
+				c := *e
+				events = append(events, &c)
+			}
+		}
+		return nil
+	})
+	return events, err
+}
+
+// DeleteDeviceEvents deletes all events that are older than the given time
+func (s *Store) DeleteDeviceEvents(before time.Time) error {
+	before = before.UTC().Truncate(time.Second)
+	return s.write(func(doc *document) error {
+		i := sort.Search(len(doc.Events), func(i int) bool { return !doc.Events[i].Time.Before(before) })
+		doc.Events = doc.Events[i:]
+		return nil
+	})
+}
@@ -0,0 +1,174 @@
+package filestore
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/he4d/almue-backend/model"
+)
+
+// GetLighting returns the lighting with the provided id
+func (s *Store) GetLighting(lightingID int64) (*model.Lighting, error) {
+	var lighting *model.Lighting
+	err := s.read(func(doc *document) error {
+		found, _ := doc.lighting(lightingID)
+		if found == nil {
+			return model.ErrNotFound
+		}
+		lighting = found.DeepCopy()
+		return nil
+	})
+	return lighting, err
+}
+
+// GetLightingListOfFloor returns all lightings of a floor with the given floor id
+func (s *Store) GetLightingListOfFloor(floorID int64) ([]*model.Lighting, error) {
+	return s.FindLightings(&model.ListOptions{FloorID: &floorID})
+}
+
+// GetLightingList returns all lightings of the store
+func (s *Store) GetLightingList() ([]*model.Lighting, error) {
+	return s.FindLightings(&model.ListOptions{})
+}
+
+// FindLightings returns the lightings that match the filters of the list options in their order and page
+func (s *Store) FindLightings(opts *model.ListOptions) ([]*model.Lighting, error) {
+	if err := checkListOptions(opts); err != nil {
+		return nil, err
+	}
+	key := lightingSortKeys["id"]
+	if opts.Sort != "" {
+		var ok bool
+		if key, ok = lightingSortKeys[opts.Sort]; !ok {
+			return nil, &model.ListOptionsError{Option: "sort", Value: opts.Sort}
+		}
+	}
+
+	lightings := []*model.Lighting{}
+	err := s.read(func(doc *document) error {
+		for _, l := range doc.Lightings {
+			if matchesDevice(opts, *l.FloorID, l.RoomID, l.Tags, l.Disabled, l.DeviceStatus, l.JobsEnabled, *l.Description) {
+				lightings = append(lightings, l.DeepCopy())
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(lightings, func(i, j int) bool {
+		return less(key(lightings[i]), key(lightings[j]), lightings[i].ID, lightings[j].ID, opts.Descending)
+	})
+	start, end, err := page(opts, len(lightings),
+		func(i int) interface{} { return key(lightings[i]) }, func(i int) int64 { return lightings[i].ID })
+	if err != nil {
+		return nil, err
+	}
+	return lightings[start:end], nil
+}
+
+// CreateLighting creates a new lighting in the store and returns the generated id.
+// If the pin of the lighting is assigned to another device a *model.PinConflictError is returned
+func (s *Store) CreateLighting(l *model.Lighting) (int64, error) {
+	if err := checkLighting(l); err != nil {
+		return 0, err
+	}
+	var id int64
+	err := s.write(func(doc *document) error {
+		if conflict := model.FindPinConflict(doc.pins(), model.DeviceTypeLighting, 0, *l.SwitchPin); conflict != nil {
+			return conflict
+		}
+		id = doc.nextLightingID()
+		created := now()
+		lighting := l.DeepCopy()
+		lighting.Base = model.Base{ID: id, Created: created, Modified: created, Version: 1}
+		lighting.OnTime = l.OnTime.UTC()
+		lighting.OffTime = l.OffTime.UTC()
+		lighting.DeviceStatus = "off"
+		lighting.Fault = nil
+		lighting.Tags = model.SortTags(l.Tags)
+		doc.Lightings = append(doc.Lightings, lighting)
+		return nil
+	})
+	return id, err
+}
+
+// DeleteLighting deletes the lighting with the given id
+func (s *Store) DeleteLighting(lightingID int64) error {
+	return s.write(func(doc *document) error {
+		_, i := doc.lighting(lightingID)
+		if i < 0 {
+			return fmt.Errorf("Lighting with id %d didnt exist", lightingID)
+		}
+		doc.Lightings = append(doc.Lightings[:i], doc.Lightings[i+1:]...)
+		doc.dropCalendarDevices()
+		return nil
+	})
+}
+
+// UpdateLighting updates a lighting in the store with the given model.
+// The version of the model must match the stored one, otherwise model.ErrVersionConflict is returned.
+// If the pin of the lighting is assigned to another device a *model.PinConflictError is returned
+func (s *Store) UpdateLighting(l *model.Lighting) error {
+	if err := checkLighting(l); err != nil {
+		return err
+	}
+	return s.write(func(doc *document) error {
+		lighting, i := doc.lighting(l.ID)
+		if lighting == nil || lighting.Version != l.Version {
+			return model.ErrVersionConflict
+		}
+		if conflict := model.FindPinConflict(doc.pins(), model.DeviceTypeLighting, l.ID, *l.SwitchPin); conflict != nil {
+			return conflict
+		}
+		updated := l.DeepCopy()
+		updated.Base = lighting.Base
+		updated.Modified = now()
+		updated.Version++
+		updated.OnTime = l.OnTime.UTC()
+		updated.OffTime = l.OffTime.UTC()
+		// the state and the fault are only changed by the device controller
+		updated.DeviceStatus = lighting.DeviceStatus
+		updated.Fault = lighting.Fault
+		updated.Tags = model.SortTags(l.Tags)
+		doc.Lightings[i] = updated
+		return nil
+	})
+}
+
+// UpdateLightingState updates the state of a lighting
+func (s *Store) UpdateLightingState(lightingID int64, newState string) error {
+	return s.write(func(doc *document) error {
+		if lighting, _ := doc.lighting(lightingID); lighting != nil {
+			lighting.DeviceStatus = newState
+			lighting.Modified = now()
+		}
+		return nil
+	})
+}
+
+// UpdateLightingFault sets the fault of the lighting with the given id and its state to fault.
+// A nil fault clears the fault, the state is then set by the next state update
+func (s *Store) UpdateLightingFault(lightingID int64, fault *model.DeviceFault) error {
+	return s.write(func(doc *document) error {
+		if lighting, _ := doc.lighting(lightingID); lighting != nil {
+			lighting.Fault = fault.DeepCopy()
+			if fault != nil {
+				lighting.Fault.Time = fault.Time.UTC()
+				lighting.DeviceStatus = model.DeviceStatusFault
+			}
+			lighting.Modified = now()
+		}
+		return nil
+	})
+}
+
+// checkLighting checks the fields that the sqlite schema requires
+func checkLighting(l *model.Lighting) error {
+	if l.Description == nil || l.SwitchPin == nil || l.FloorID == nil {
+		return errors.New("The description, switch pin and floor of a lighting are required")
+	}
+	return nil
+}
@@ -0,0 +1,220 @@
+package filestore
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/he4d/almue-backend/model"
+)
+
+// The sort keys map the sortable json fields of the models to their values,
+// they are the same as the sort columns of the sqlite store
+var floorSortKeys = map[string]func(f *model.Floor) interface{}{
+	"id":          func(f *model.Floor) interface{} { return f.ID },
+	"created":     func(f *model.Floor) interface{} { return f.Created },
+	"modified":    func(f *model.Floor) interface{} { return f.Modified },
+	"description": func(f *model.Floor) interface{} { return *f.Description },
+}
+
+var roomSortKeys = map[string]func(r *model.Room) interface{}{
+	"id":          func(r *model.Room) interface{} { return r.ID },
+	"created":     func(r *model.Room) interface{} { return r.Created },
+	"modified":    func(r *model.Room) interface{} { return r.Modified },
+	"description": func(r *model.Room) interface{} { return *r.Description },
+	"floorId":     func(r *model.Room) interface{} { return *r.FloorID },
+}
+
+var shutterSortKeys = map[string]func(s *model.Shutter) interface{}{
+	"id":           func(s *model.Shutter) interface{} { return s.ID },
+	"created":      func(s *model.Shutter) interface{} { return s.Created },
+	"modified":     func(s *model.Shutter) interface{} { return s.Modified },
+	"description":  func(s *model.Shutter) interface{} { return *s.Description },
+	"openingInPrc": func(s *model.Shutter) interface{} { return s.OpeningInPrc },
+	"jobsEnabled":  func(s *model.Shutter) interface{} { return s.JobsEnabled },
+	"openTime":     func(s *model.Shutter) interface{} { return s.OpenTime },
+	"closeTime":    func(s *model.Shutter) interface{} { return s.CloseTime },
+	"deviceStatus": func(s *model.Shutter) interface{} { return s.DeviceStatus },
+	"disabled":     func(s *model.Shutter) interface{} { return s.Disabled },
+	"floorId":      func(s *model.Shutter) interface{} { return *s.FloorID },
+}
+
+var lightingSortKeys = map[string]func(l *model.Lighting) interface{}{
+	"id":           func(l *model.Lighting) interface{} { return l.ID },
+	"created":      func(l *model.Lighting) interface{} { return l.Created },
+	"modified":     func(l *model.Lighting) interface{} { return l.Modified },
+	"description":  func(l *model.Lighting) interface{} { return *l.Description },
+	"jobsEnabled":  func(l *model.Lighting) interface{} { return l.JobsEnabled },
+	"onTime":       func(l *model.Lighting) interface{} { return l.OnTime },
+	"offTime":      func(l *model.Lighting) interface{} { return l.OffTime },
+	"deviceStatus": func(l *model.Lighting) interface{} { return l.DeviceStatus },
+	"disabled":     func(l *model.Lighting) interface{} { return l.Disabled },
+	"floorId":      func(l *model.Lighting) interface{} { return *l.FloorID },
+}
+
+// compare compares two values of a sort key, false is sorted before true
+func compare(a, b interface{}) int {
+	switch a := a.(type) {
+	case int64:
+		return compareInt64(a, b.(int64))
+	case int:
+		return compareInt64(int64(a), int64(b.(int)))
+	case string:
+		return strings.Compare(a, b.(string))
+	case bool:
+		if a == b.(bool) {
+			return 0
+		}
+		if a {
+			return 1
+		}
+		return -1
+	case time.Time:
+		switch t := b.(time.Time); {
+		case a.Before(t):
+			return -1
+		case a.After(t):
+			return 1
+		}
+		return 0
+	}
+	panic(fmt.Sprintf("Can not compare the sort key %v", a))
+}
+
+func compareInt64(a, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// less returns the order of two models by the given sort key. Models with
+// an equal key are sorted by their id, so the order is stable between the pages
+func less(keyA, keyB interface{}, idA, idB int64, descending bool) bool {
+	c := compare(keyA, keyB)
+	if c == 0 {
+		c = compareInt64(idA, idB)
+	}
+	if descending {
+		return c > 0
+	}
+	return c < 0
+}
+
+// checkListOptions checks the options that are not specific to a model
+func checkListOptions(opts *model.ListOptions) error {
+	if opts.Limit < 0 {
+		return &model.ListOptionsError{Option: "limit", Value: fmt.Sprint(opts.Limit)}
+	}
+	return nil
+}
+
+// matchesDevice reports whether a device matches the filters of the list options
+func matchesDevice(opts *model.ListOptions, floorID int64, roomID *int64, tags []string, disabled bool, status string, jobsEnabled bool, description string) bool {
+	if !matchesFloor(opts, floorID) {
+		return false
+	}
+	if opts.RoomID != nil && (roomID == nil || *opts.RoomID != *roomID) {
+		return false
+	}
+	if opts.Tag != "" && !hasTag(tags, opts.Tag) {
+		return false
+	}
+	if opts.Disabled != nil && *opts.Disabled != disabled {
+		return false
+	}
+	if opts.DeviceStatus != nil && *opts.DeviceStatus != status {
+		return false
+	}
+	if opts.JobsEnabled != nil && *opts.JobsEnabled != jobsEnabled {
+		return false
+	}
+	return matchesSearch(opts, description)
+}
+
+// matchesFloor reports whether the floor id matches the floor filters of the list options
+func matchesFloor(opts *model.ListOptions, floorID int64) bool {
+	if opts.FloorID != nil && *opts.FloorID != floorID {
+		return false
+	}
+	if len(opts.FloorIDs) == 0 {
+		return true
+	}
+	for _, id := range opts.FloorIDs {
+		if id == floorID {
+			return true
+		}
+	}
+	return false
+}
+
+func hasTag(tags []string, tag string) bool {
+	for _, t := range tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesSearch reports whether the description contains the search of the list options, ignoring the case
+func matchesSearch(opts *model.ListOptions, description string) bool {
+	return opts.Search == "" || strings.Contains(strings.ToLower(description), strings.ToLower(opts.Search))
+}
+
+// page returns the bounds of the page of the list options in a sorted list of n models, key and id
+// return the sort key and the id of the i-th model. The page of a cursor starts after the model of the cursor,
+// a backward page ends before it
+func page(opts *model.ListOptions, n int, key func(i int) interface{}, id func(i int) int64) (int, int, error) {
+	start, end := 0, n
+	if opts.Cursor != nil {
+		var err error
+		if start, end, err = cursorBounds(opts, n, key, id); err != nil {
+			return 0, 0, err
+		}
+	}
+	if opts.Limit > 0 && end-start > opts.Limit {
+		if opts.Cursor != nil && opts.Cursor.Backward {
+			start = end - opts.Limit
+		} else {
+			end = start + opts.Limit
+		}
+	}
+	return start, end, nil
+}
+
+// cursorBounds returns the bounds of the models after the cursor, or before it if the cursor is backward
+func cursorBounds(opts *model.ListOptions, n int, key func(i int) interface{}, id func(i int) int64) (int, int, error) {
+	cursor := opts.Cursor
+	invalid := &model.ListOptionsError{Option: "cursor", Value: string(cursor.Value)}
+	var value interface{}
+	if err := json.Unmarshal(cursor.Value, &value); err != nil {
+		return 0, 0, invalid
+	}
+	switch value.(type) {
+	case string, float64, bool:
+	default:
+		return 0, 0, invalid
+	}
+	if n == 0 {
+		return 0, 0, nil
+	}
+	// the value of the cursor is decoded into the type of the sort key, so it can be compared
+	typed := reflect.New(reflect.TypeOf(key(0)))
+	if err := json.Unmarshal(cursor.Value, typed.Interface()); err != nil {
+		return 0, 0, invalid
+	}
+	cursorKey := typed.Elem().Interface()
+	if cursor.Backward {
+		before := sort.Search(n, func(i int) bool { return !less(key(i), cursorKey, id(i), cursor.ID, opts.Descending) })
+		return 0, before, nil
+	}
+	after := sort.Search(n, func(i int) bool { return less(cursorKey, key(i), cursor.ID, id(i), opts.Descending) })
+	return after, n, nil
+}
@@ -0,0 +1,49 @@
+package filestore
+
+import (
+	"sort"
+
+	"github.com/he4d/almue-backend/model"
+)
+
+// pins returns the pins that are assigned to the devices of the document
+func (d *document) pins() []*model.Pin {
+	pins := []*model.Pin{}
+	for _, s := range d.Shutters {
+		pins = append(pins,
+			&model.Pin{Number: *s.OpenPin, DeviceType: model.DeviceTypeShutter, DeviceID: s.ID, Function: "open"},
+			&model.Pin{Number: *s.ClosePin, DeviceType: model.DeviceTypeShutter, DeviceID: s.ID, Function: "close"})
+	}
+	for _, l := range d.Lightings {
+		pins = append(pins,
+			&model.Pin{Number: *l.SwitchPin, DeviceType: model.DeviceTypeLighting, DeviceID: l.ID, Function: "switch"})
+	}
+	sort.Slice(pins, func(i, j int) bool { return pins[i].Number < pins[j].Number })
+	return pins
+}
+
+// GetPin returns the assignment of the pin with the given number.
+// If the pin is not assigned to any device model.ErrNotFound is returned
+func (s *Store) GetPin(pin int) (*model.Pin, error) {
+	var found *model.Pin
+	err := s.read(func(doc *document) error {
+		for _, p := range doc.pins() {
+			if p.Number == pin {
+				found = p
+				return nil
+			}
+		}
+		return model.ErrNotFound
+	})
+	return found, err
+}
+
+// GetPinList returns all pins that are assigned to a device
+func (s *Store) GetPinList() ([]*model.Pin, error) {
+	var pins []*model.Pin
+	err := s.read(func(doc *document) error {
+		pins = doc.pins()
+		return nil
+	})
+	return pins, err
+}
@@ -0,0 +1,146 @@
+package filestore
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/he4d/almue-backend/model"
+)
+
+// GetRoom returns the room with the given id
+func (s *Store) GetRoom(roomID int64) (*model.Room, error) {
+	var room *model.Room
+	err := s.read(func(doc *document) error {
+		r, _ := doc.room(roomID)
+		if r == nil {
+			return model.ErrNotFound
+		}
+		room = r.DeepCopy()
+		return nil
+	})
+	return room, err
+}
+
+// GetRoomList returns the rooms of all floors
+func (s *Store) GetRoomList() ([]*model.Room, error) {
+	return s.FindRooms(&model.ListOptions{})
+}
+
+// GetRoomListOfFloor returns the rooms of the floor with the given id
+func (s *Store) GetRoomListOfFloor(floorID int64) ([]*model.Room, error) {
+	return s.FindRooms(&model.ListOptions{FloorID: &floorID})
+}
+
+// FindRooms returns the rooms in the order and page of the list options.
+// Rooms can only be filtered by their floors and searched by their description
+func (s *Store) FindRooms(opts *model.ListOptions) ([]*model.Room, error) {
+	if err := checkListOptions(opts); err != nil {
+		return nil, err
+	}
+	key := roomSortKeys["id"]
+	if opts.Sort != "" {
+		var ok bool
+		if key, ok = roomSortKeys[opts.Sort]; !ok {
+			return nil, &model.ListOptionsError{Option: "sort", Value: opts.Sort}
+		}
+	}
+
+	rooms := []*model.Room{}
+	err := s.read(func(doc *document) error {
+		for _, r := range doc.Rooms {
+			if !matchesFloor(opts, *r.FloorID) {
+				continue
+			}
+			if matchesSearch(opts, *r.Description) {
+				rooms = append(rooms, r.DeepCopy())
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(rooms, func(i, j int) bool {
+		return less(key(rooms[i]), key(rooms[j]), rooms[i].ID, rooms[j].ID, opts.Descending)
+	})
+	start, end, err := page(opts, len(rooms),
+		func(i int) interface{} { return key(rooms[i]) }, func(i int) int64 { return rooms[i].ID })
+	if err != nil {
+		return nil, err
+	}
+	return rooms[start:end], nil
+}
+
+// CreateRoom creates a room in the store and returns the generated id
+func (s *Store) CreateRoom(r *model.Room) (int64, error) {
+	if err := checkRoom(r); err != nil {
+		return 0, err
+	}
+	var id int64
+	err := s.write(func(doc *document) error {
+		id = doc.nextRoomID()
+		created := now()
+		room := r.DeepCopy()
+		room.Base = model.Base{ID: id, Created: created, Modified: created, Version: 1}
+		doc.Rooms = append(doc.Rooms, room)
+		return nil
+	})
+	return id, err
+}
+
+// DeleteRoom deletes the room with the given id, its devices stay on the floor without a room
+func (s *Store) DeleteRoom(roomID int64) error {
+	return s.write(func(doc *document) error {
+		_, i := doc.room(roomID)
+		if i < 0 {
+			return fmt.Errorf("Room with id %d didnt exist", roomID)
+		}
+		doc.Rooms = append(doc.Rooms[:i], doc.Rooms[i+1:]...)
+
+		modified := now()
+		for _, shutter := range doc.Shutters {
+			if shutter.RoomID != nil && *shutter.RoomID == roomID {
+				shutter.RoomID = nil
+				shutter.Modified = modified
+				shutter.Version++
+			}
+		}
+		for _, lighting := range doc.Lightings {
+			if lighting.RoomID != nil && *lighting.RoomID == roomID {
+				lighting.RoomID = nil
+				lighting.Modified = modified
+				lighting.Version++
+			}
+		}
+		return nil
+	})
+}
+
+// UpdateRoom updates the description of an existing room, a room can not be moved to another floor.
+// The version of the model must match the stored one, otherwise model.ErrVersionConflict is returned
+func (s *Store) UpdateRoom(r *model.Room) error {
+	if r.Description == nil {
+		return errors.New("The description of a room is required")
+	}
+	return s.write(func(doc *document) error {
+		room, _ := doc.room(r.ID)
+		if room == nil || room.Version != r.Version {
+			return model.ErrVersionConflict
+		}
+		descr := *r.Description
+		room.Description = &descr
+		room.Modified = now()
+		room.Version++
+		return nil
+	})
+}
+
+// checkRoom checks the fields that the sqlite schema requires
+func checkRoom(r *model.Room) error {
+	if r.Description == nil || r.FloorID == nil {
+		return errors.New("The description and floor of a room are required")
+	}
+	return nil
+}
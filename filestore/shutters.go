@@ -0,0 +1,188 @@
+package filestore
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/he4d/almue-backend/model"
+)
+
+// GetShutter returns the shutter with the given id
+func (s *Store) GetShutter(shutterID int64) (*model.Shutter, error) {
+	var shutter *model.Shutter
+	err := s.read(func(doc *document) error {
+		found, _ := doc.shutter(shutterID)
+		if found == nil {
+			return model.ErrNotFound
+		}
+		shutter = found.DeepCopy()
+		return nil
+	})
+	return shutter, err
+}
+
+// GetShutterListOfFloor returns all shutters of the floor with the provided floorId
+func (s *Store) GetShutterListOfFloor(floorID int64) ([]*model.Shutter, error) {
+	return s.FindShutters(&model.ListOptions{FloorID: &floorID})
+}
+
+// GetShutterList returns all shutters that exist in the store
+func (s *Store) GetShutterList() ([]*model.Shutter, error) {
+	return s.FindShutters(&model.ListOptions{})
+}
+
+// FindShutters returns the shutters that match the filters of the list options in their order and page
+func (s *Store) FindShutters(opts *model.ListOptions) ([]*model.Shutter, error) {
+	if err := checkListOptions(opts); err != nil {
+		return nil, err
+	}
+	key := shutterSortKeys["id"]
+	if opts.Sort != "" {
+		var ok bool
+		if key, ok = shutterSortKeys[opts.Sort]; !ok {
+			return nil, &model.ListOptionsError{Option: "sort", Value: opts.Sort}
+		}
+	}
+
+	shutters := []*model.Shutter{}
+	err := s.read(func(doc *document) error {
+		for _, sh := range doc.Shutters {
+			if matchesDevice(opts, *sh.FloorID, sh.RoomID, sh.Tags, sh.Disabled, sh.DeviceStatus, sh.JobsEnabled, *sh.Description) {
+				shutters = append(shutters, sh.DeepCopy())
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(shutters, func(i, j int) bool {
+		return less(key(shutters[i]), key(shutters[j]), shutters[i].ID, shutters[j].ID, opts.Descending)
+	})
+	start, end, err := page(opts, len(shutters),
+		func(i int) interface{} { return key(shutters[i]) }, func(i int) int64 { return shutters[i].ID })
+	if err != nil {
+		return nil, err
+	}
+	return shutters[start:end], nil
+}
+
+// CreateShutter creates a shutter in the store and returns the generated id.
+// If a pin of the shutter is assigned to another device a *model.PinConflictError is returned
+func (s *Store) CreateShutter(sh *model.Shutter) (int64, error) {
+	if err := checkShutter(sh); err != nil {
+		return 0, err
+	}
+	var id int64
+	err := s.write(func(doc *document) error {
+		if conflict := model.FindPinConflict(doc.pins(), model.DeviceTypeShutter, 0, *sh.OpenPin, *sh.ClosePin); conflict != nil {
+			return conflict
+		}
+		id = doc.nextShutterID()
+		created := now()
+		shutter := sh.DeepCopy()
+		shutter.Base = model.Base{ID: id, Created: created, Modified: created, Version: 1}
+		shutter.OpeningInPrc = 0
+		shutter.OpenTime = sh.OpenTime.UTC()
+		shutter.CloseTime = sh.CloseTime.UTC()
+		shutter.DeviceStatus = "stopped"
+		shutter.Fault = nil
+		shutter.Tags = model.SortTags(sh.Tags)
+		doc.Shutters = append(doc.Shutters, shutter)
+		return nil
+	})
+	return id, err
+}
+
+// DeleteShutter deletes a shutter from the store with the given id
+func (s *Store) DeleteShutter(shutterID int64) error {
+	return s.write(func(doc *document) error {
+		_, i := doc.shutter(shutterID)
+		if i < 0 {
+			return fmt.Errorf("Shutter with id %d didnt exist", shutterID)
+		}
+		doc.Shutters = append(doc.Shutters[:i], doc.Shutters[i+1:]...)
+		doc.dropCalendarDevices()
+		return nil
+	})
+}
+
+// UpdateShutter updates a shutter in the store with the given model.
+// The version of the model must match the stored one, otherwise model.ErrVersionConflict is returned.
+// If a pin of the shutter is assigned to another device a *model.PinConflictError is returned
+func (s *Store) UpdateShutter(sh *model.Shutter) error {
+	if err := checkShutter(sh); err != nil {
+		return err
+	}
+	return s.write(func(doc *document) error {
+		shutter, i := doc.shutter(sh.ID)
+		if shutter == nil || shutter.Version != sh.Version {
+			return model.ErrVersionConflict
+		}
+		if conflict := model.FindPinConflict(doc.pins(), model.DeviceTypeShutter, sh.ID, *sh.OpenPin, *sh.ClosePin); conflict != nil {
+			return conflict
+		}
+		updated := sh.DeepCopy()
+		updated.Base = shutter.Base
+		updated.Modified = now()
+		updated.Version++
+		// the state, the opening and the fault are only changed by the device controller
+		updated.DeviceStatus = shutter.DeviceStatus
+		updated.OpeningInPrc = shutter.OpeningInPrc
+		updated.Fault = shutter.Fault
+		updated.OpenTime = sh.OpenTime.UTC()
+		updated.CloseTime = sh.CloseTime.UTC()
+		updated.Tags = model.SortTags(sh.Tags)
+		doc.Shutters[i] = updated
+		return nil
+	})
+}
+
+// UpdateShutterState updates the state of the shutter with the given id
+func (s *Store) UpdateShutterState(shutterID int64, newState string) error {
+	return s.write(func(doc *document) error {
+		if shutter, _ := doc.shutter(shutterID); shutter != nil {
+			shutter.DeviceStatus = newState
+			shutter.Modified = now()
+		}
+		return nil
+	})
+}
+
+// UpdateShutterOpening updates the current openingwidth of the shutter with the provided id
+func (s *Store) UpdateShutterOpening(shutterID int64, openingInPrc int) error {
+	return s.write(func(doc *document) error {
+		if shutter, _ := doc.shutter(shutterID); shutter != nil {
+			shutter.OpeningInPrc = openingInPrc
+			shutter.Modified = now()
+		}
+		return nil
+	})
+}
+
+// UpdateShutterFault sets the fault of the shutter with the given id and its state to fault.
+// A nil fault clears the fault, the state is then set by the next state update
+func (s *Store) UpdateShutterFault(shutterID int64, fault *model.DeviceFault) error {
+	return s.write(func(doc *document) error {
+		if shutter, _ := doc.shutter(shutterID); shutter != nil {
+			shutter.Fault = fault.DeepCopy()
+			if fault != nil {
+				shutter.Fault.Time = fault.Time.UTC()
+				shutter.DeviceStatus = model.DeviceStatusFault
+			}
+			shutter.Modified = now()
+		}
+		return nil
+	})
+}
+
+// checkShutter checks the fields that the sqlite schema requires
+func checkShutter(s *model.Shutter) error {
+	if s.Description == nil || s.OpenPin == nil || s.ClosePin == nil ||
+		s.CompleteWayInSeconds == nil || s.FloorID == nil {
+		return errors.New("The description, pins, complete way and floor of a shutter are required")
+	}
+	return nil
+}
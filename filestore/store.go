@@ -0,0 +1,216 @@
+// Package filestore implements the device store in a single json file.
+// It is written in pure Go, so almue can be built without cgo when using it.
+package filestore
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/he4d/almue-backend/model"
+	"github.com/he4d/simplejack"
+)
+
+// documentVersion is the version of the json document.
+// It must be increased whenever the document changes, older documents are upgraded on loading.
+// Version 2 added the rooms, version 3 the tags of the devices, version 4 the device events
+// and version 5 the calendar exceptions
+const documentVersion = 5
+
+// document is the content of the json file
+type document struct {
+	Version   int               `json:"version"`
+	Floors    []*model.Floor    `json:"floors"`
+	Rooms     []*model.Room     `json:"rooms"`
+	Shutters  []*model.Shutter  `json:"shutters"`
+	Lightings []*model.Lighting `json:"lightings"`
+	// Events are the recorded state changes of the devices, ordered by their time
+	Events             []*model.DeviceEvent       `json:"events"`
+	CalendarExceptions []*model.CalendarException `json:"calendarExceptions"`
+}
+
+// file holds the committed document of the json file
+type file struct {
+	sync.Mutex
+	path string
+	doc  *document
+}
+
+// Store contains all necessary objects for the json file store handling
+type Store struct {
+	file *file
+	// tx is the document of the transaction the store belongs to
+	tx     *document
+	logger *simplejack.Logger
+}
+
+// New returns a new store that keeps its data in the json file of the given path.
+// The file is created if it does not exist
+func New(path string, logger *simplejack.Logger) (*Store, error) {
+	doc := &document{Version: documentVersion}
+	data, err := ioutil.ReadFile(path)
+	switch {
+	case os.IsNotExist(err):
+		if err := save(path, doc); err != nil {
+			return nil, err
+		}
+	case err != nil:
+		return nil, err
+	default:
+		if err := json.Unmarshal(data, doc); err != nil {
+			return nil, err
+		}
+		if doc.Version < 1 || doc.Version > documentVersion {
+			return nil, fmt.Errorf("The json file %s has the unsupported version %d", path, doc.Version)
+		}
+		// the changes of the older versions only added models and fields
+		doc.Version = documentVersion
+		for _, s := range doc.Shutters {
+			s.Tags = model.SortTags(s.Tags)
+		}
+		for _, l := range doc.Lightings {
+			l.Tags = model.SortTags(l.Tags)
+		}
+		if err := doc.check(); err != nil {
+			return nil, err
+		}
+	}
+	return &Store{file: &file{path: path, doc: doc}, logger: logger}, nil
+}
+
+// WithTx calls fn with a store whose methods all run in one transaction.
+// The transaction is committed if fn returns nil and rolled back otherwise.
+// Calling WithTx on the store of a transaction runs fn in the same transaction.
+//
+// The file is locked during the transaction, so fn must not use another
+// store than the given one. Such a call waits until the transaction ends.
+func (s *Store) WithTx(fn func(tx *Store) error) error {
+	if s.tx != nil {
+		return fn(s)
+	}
+
+	s.file.Lock()
+	defer s.file.Unlock()
+	tx := &Store{file: s.file, tx: s.file.doc.clone(), logger: s.logger}
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return s.file.commit(tx.tx)
+}
+
+// read calls fn with the current document, fn must not change it
+func (s *Store) read(fn func(doc *document) error) error {
+	if s.tx != nil {
+		return fn(s.tx)
+	}
+	s.file.Lock()
+	defer s.file.Unlock()
+	return fn(s.file.doc)
+}
+
+// write calls fn with a copy of the current document. The copy replaces the document
+// if fn returns nil and the constraints of the document are met. A failing write does
+// not change anything, like a failing statement does not change a database
+func (s *Store) write(fn func(doc *document) error) error {
+	if s.tx != nil {
+		doc := s.tx.clone()
+		if err := fn(doc); err != nil {
+			return err
+		}
+		if err := doc.check(); err != nil {
+			return err
+		}
+		*s.tx = *doc
+		return nil
+	}
+
+	s.file.Lock()
+	defer s.file.Unlock()
+	doc := s.file.doc.clone()
+	if err := fn(doc); err != nil {
+		return err
+	}
+	return s.file.commit(doc)
+}
+
+// commit checks the document, saves it and makes it the current one.
+// The file must be locked by the caller
+func (f *file) commit(doc *document) error {
+	if err := doc.check(); err != nil {
+		return err
+	}
+	if err := save(f.path, doc); err != nil {
+		return err
+	}
+	f.doc = doc
+	return nil
+}
+
+// save writes the document to a temporary file that replaces the json file,
+// so the file is never left half written
+func save(path string, doc *document) error {
+	data, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Ping checks that the json file is still accessible, the document itself is kept in memory
+func (s *Store) Ping() error {
+	info, err := os.Stat(s.file.path)
+	if err != nil {
+		return err
+	}
+	if !info.Mode().IsRegular() {
+		return fmt.Errorf("The json file %s is not a regular file", s.file.path)
+	}
+	return nil
+}
+
+// GetBackup returns the json file
+func (s *Store) GetBackup() ([]byte, error) {
+	var data []byte
+	err := s.read(func(doc *document) error {
+		var err error
+		data, err = json.MarshalIndent(doc, "", "  ")
+		return err
+	})
+	return data, err
+}
+
+// GetSchema returns the version of the json document.
+// The document has no migrations, it only has a version
+func (s *Store) GetSchema() (*model.Schema, error) {
+	return &model.Schema{
+		Version:    documentVersion,
+		Latest:     documentVersion,
+		Current:    "json-document",
+		Migrations: []*model.Migration{},
+	}, nil
+}
+
+// now returns the time of a change, with the precision of the timestamps of the sqlite store
+func now() time.Time {
+	return time.Now().UTC().Truncate(time.Second)
+}
@@ -0,0 +1,145 @@
+package filestore
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/he4d/almue-backend/almue"
+	"github.com/he4d/almue-backend/model"
+	"github.com/he4d/almue-backend/storetest"
+	"github.com/he4d/simplejack"
+)
+
+// conformanceStore lets the transactions of the store satisfy almue.DeviceStore
+type conformanceStore struct {
+	*Store
+}
+
+func (s conformanceStore) WithTx(fn func(tx almue.DeviceStore) error) error {
+	return s.Store.WithTx(func(tx *Store) error {
+		return fn(conformanceStore{tx})
+	})
+}
+
+func tempDir(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "filestore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir, func() { os.RemoveAll(dir) }
+}
+
+func newStore(t *testing.T, path string) *Store {
+	s, err := New(path, simplejack.New(simplejack.TRACE, ioutil.Discard))
+	if err != nil {
+		t.Fatalf("Could not create the store: %v", err)
+	}
+	return s
+}
+
+func TestConformance(t *testing.T) {
+	dir, remove := tempDir(t)
+	defer remove()
+
+	storetest.Run(t, func(t *testing.T) storetest.Store {
+		return conformanceStore{newStore(t, filepath.Join(dir, filepath.Base(t.Name())+".json"))}
+	})
+}
+
+func TestReopen(t *testing.T) {
+	dir, remove := tempDir(t)
+	defer remove()
+	path := filepath.Join(dir, "almue.json")
+
+	s := newStore(t, path)
+	descr := "erdgeschoss"
+	floorID, err := s.CreateFloor(&model.Floor{Description: &descr})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a failed transaction is not written to the file
+	s.WithTx(func(tx *Store) error {
+		descr := "obergeschoss"
+		if _, err := tx.CreateFloor(&model.Floor{Description: &descr}); err != nil {
+			return err
+		}
+		return model.ErrVersionConflict
+	})
+
+	reopened := newStore(t, path)
+	floors, err := reopened.GetFloorList()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(floors) != 1 || floors[0].ID != floorID || *floors[0].Description != descr || floors[0].Version != 1 {
+		t.Errorf("Expected the created floor after reopening but got %v", floors)
+	}
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 {
+		t.Errorf("Expected only the json file but found %d files", len(files))
+	}
+}
+
+func TestInvalidFile(t *testing.T) {
+	dir, remove := tempDir(t)
+	defer remove()
+
+	for name, content := range map[string]string{
+		"syntax":     `{"version": 1,`,
+		"version":    `{"version": 99}`,
+		"constraint": `{"version": 1, "floors": [{"id": 1, "description": "a"}, {"id": 1, "description": "b"}]}`,
+	} {
+		path := filepath.Join(dir, name+".json")
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := New(path, simplejack.New(simplejack.TRACE, ioutil.Discard)); err == nil {
+			t.Errorf("Expected an error for the invalid %s of the file", name)
+		}
+	}
+}
+
+func TestUpgradeDocument(t *testing.T) {
+	dir, remove := tempDir(t)
+	defer remove()
+
+	// the first version of the document had no rooms and no tags
+	path := filepath.Join(dir, "almue.json")
+	content := `{"version": 1, "floors": [{"id": 1, "description": "erdgeschoss", "version": 1}],
+	"lightings": [{"id": 1, "description": "flur", "switchPin": 4, "floorId": 1, "version": 1}]}`
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	s := newStore(t, path)
+	descr := "kueche"
+	floorID := int64(1)
+	if _, err := s.CreateRoom(&model.Room{Description: &descr, FloorID: &floorID}); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened := newStore(t, path)
+	if rooms, err := reopened.GetRoomList(); err != nil || len(rooms) != 1 {
+		t.Errorf("Expected the created room after reopening but got %v, %v", rooms, err)
+	}
+	data, err := reopened.GetBackup()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), fmt.Sprintf(`"version": %d`, documentVersion)) {
+		t.Errorf("Expected the upgraded document to have the version %d", documentVersion)
+	}
+	if floors, err := reopened.GetFloorList(); err != nil || len(floors) != 1 {
+		t.Errorf("Expected the floor of the first version but got %v, %v", floors, err)
+	}
+	if lighting, err := reopened.GetLighting(1); err != nil || lighting.Tags == nil || len(lighting.Tags) != 0 {
+		t.Errorf("Expected the lighting of the first version with an empty list of tags but got %+v, %v", lighting, err)
+	}
+}
@@ -0,0 +1,42 @@
+package filestore
+
+import (
+	"sort"
+
+	"github.com/he4d/almue-backend/model"
+)
+
+// GetTagList returns all tags with the number of their devices.
+// The tags are part of the devices, so a tag exists as long as a device carries it
+func (s *Store) GetTagList() ([]*model.Tag, error) {
+	tags := map[string]*model.Tag{}
+	tag := func(name string) *model.Tag {
+		if tags[name] == nil {
+			tags[name] = &model.Tag{Name: name}
+		}
+		return tags[name]
+	}
+	err := s.read(func(doc *document) error {
+		for _, sh := range doc.Shutters {
+			for _, name := range sh.Tags {
+				tag(name).Shutters++
+			}
+		}
+		for _, l := range doc.Lightings {
+			for _, name := range l.Tags {
+				tag(name).Lightings++
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	list := make([]*model.Tag, 0, len(tags))
+	for _, t := range tags {
+		list = append(list, t)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list, nil
+}
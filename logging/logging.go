@@ -0,0 +1,223 @@
+// Package logging writes the logs of almue as structured records in the JSON or logfmt format.
+// The loggers are simplejack loggers, so the packages keep logging with their printf calls,
+// and every package can have its own level.
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/he4d/simplejack"
+)
+
+// The formats of the records
+const (
+	FormatJSON   = "json"
+	FormatLogfmt = "logfmt"
+)
+
+// levelNames are the names of the levels in the records, indexed by the simplejack level
+var levelNames = []string{"trace", "debug", "info", "warning", "error", "fatal"}
+
+// Logs creates the loggers of the packages, which all write to the same writer
+type Logs struct {
+	mu     sync.Mutex
+	out    io.Writer
+	format string
+	level  simplejack.LogLevel
+	levels map[string]simplejack.LogLevel
+	now    func() time.Time
+}
+
+// New returns the logs that write records in the given format. Packages without their
+// own level in levels log everything from the given level up
+func New(out io.Writer, format string, level simplejack.LogLevel, levels map[string]simplejack.LogLevel) (*Logs, error) {
+	if format != FormatJSON && format != FormatLogfmt {
+		return nil, fmt.Errorf("Unknown log format %s, available are %s and %s", format, FormatJSON, FormatLogfmt)
+	}
+	if err := checkLevel(level); err != nil {
+		return nil, err
+	}
+	for pkg, l := range levels {
+		if err := checkLevel(l); err != nil {
+			return nil, fmt.Errorf("Level of package %s: %v", pkg, err)
+		}
+	}
+	return &Logs{out: out, format: format, level: level, levels: levels, now: time.Now}, nil
+}
+
+// Logger returns the logger of the package, its records have the field "package"
+func (l *Logs) Logger(pkg string) *simplejack.Logger {
+	level, ok := l.levels[pkg]
+	if !ok {
+		level = l.level
+	}
+	fields := []field{{"package", pkg}}
+	logger := func(lvl simplejack.LogLevel) *log.Logger {
+		if lvl < level {
+			return log.New(ioutil.Discard, "", 0)
+		}
+		return log.New(&recordWriter{logs: l, level: levelNames[lvl], fields: fields}, "", 0)
+	}
+	return &simplejack.Logger{
+		Trace:   logger(simplejack.TRACE),
+		Debug:   logger(simplejack.DEBUG),
+		Info:    logger(simplejack.INFO),
+		Warning: logger(simplejack.WARNING),
+		Error:   logger(simplejack.ERROR),
+		Fatal:   logger(simplejack.FATAL),
+	}
+}
+
+// With returns a logger whose records additionally have the given fields, which are
+// pairs of a key and a value. Loggers that are not created by Logs are returned unchanged
+func With(logger *simplejack.Logger, keyValues ...string) *simplejack.Logger {
+	if len(keyValues)%2 != 0 {
+		keyValues = append(keyValues, "")
+	}
+	with := func(l *log.Logger) *log.Logger {
+		w, ok := l.Writer().(*recordWriter)
+		if !ok {
+			return l
+		}
+		fields := append([]field{}, w.fields...)
+		for i := 0; i < len(keyValues); i += 2 {
+			fields = append(fields, field{keyValues[i], keyValues[i+1]})
+		}
+		return log.New(&recordWriter{logs: w.logs, level: w.level, fields: fields}, "", 0)
+	}
+	return &simplejack.Logger{
+		Trace:   with(logger.Trace),
+		Debug:   with(logger.Debug),
+		Info:    with(logger.Info),
+		Warning: with(logger.Warning),
+		Error:   with(logger.Error),
+		Fatal:   with(logger.Fatal),
+	}
+}
+
+// ParseLevel parses a level by its name or its number from 0 = trace to 5 = fatal
+func ParseLevel(s string) (simplejack.LogLevel, error) {
+	for i, name := range levelNames {
+		if strings.EqualFold(s, name) {
+			return simplejack.LogLevel(i), nil
+		}
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("Unknown log level %s, available are %v or 0 to 5", s, levelNames)
+	}
+	level := simplejack.LogLevel(n)
+	return level, checkLevel(level)
+}
+
+// ParseLevels parses the levels of the packages, e.g. "embedded=debug,store=4"
+func ParseLevels(s string) (map[string]simplejack.LogLevel, error) {
+	levels := map[string]simplejack.LogLevel{}
+	if s == "" {
+		return levels, nil
+	}
+	for _, pair := range strings.Split(s, ",") {
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" {
+			return nil, fmt.Errorf("The package level %q must have the form package=level", pair)
+		}
+		level, err := ParseLevel(strings.TrimSpace(parts[1]))
+		if err != nil {
+			return nil, err
+		}
+		levels[strings.TrimSpace(parts[0])] = level
+	}
+	return levels, nil
+}
+
+func checkLevel(level simplejack.LogLevel) error {
+	if level < simplejack.TRACE || level > simplejack.FATAL {
+		return fmt.Errorf("Log level must be between 0 and 5 but is %d", level)
+	}
+	return nil
+}
+
+type field struct {
+	key, value string
+}
+
+// recordWriter turns every message of its log.Logger into one record
+type recordWriter struct {
+	logs   *Logs
+	level  string
+	fields []field
+}
+
+func (w *recordWriter) Write(p []byte) (int, error) {
+	msg := strings.TrimSuffix(string(p), "\n")
+	var buf bytes.Buffer
+	if w.logs.format == FormatJSON {
+		writeJSON(&buf, w.logs.now(), w.level, msg, w.fields)
+	} else {
+		writeLogfmt(&buf, w.logs.now(), w.level, msg, w.fields)
+	}
+	w.logs.mu.Lock()
+	defer w.logs.mu.Unlock()
+	if _, err := w.logs.out.Write(buf.Bytes()); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// writeJSON writes the record as one JSON object, the fields follow the time, level and message
+func writeJSON(buf *bytes.Buffer, t time.Time, level, msg string, fields []field) {
+	all := append([]field{{"time", t.UTC().Format(time.RFC3339Nano)}, {"level", level}, {"msg", msg}}, sortedFields(fields)...)
+	buf.WriteByte('{')
+	for i, f := range all {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, _ := json.Marshal(f.key)
+		value, _ := json.Marshal(f.value)
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteString("}\n")
+}
+
+// writeLogfmt writes the record as key=value pairs, values with spaces, quotes or equal signs are quoted
+func writeLogfmt(buf *bytes.Buffer, t time.Time, level, msg string, fields []field) {
+	all := append([]field{{"time", t.UTC().Format(time.RFC3339Nano)}, {"level", level}, {"msg", msg}}, sortedFields(fields)...)
+	for i, f := range all {
+		if i > 0 {
+			buf.WriteByte(' ')
+		}
+		buf.WriteString(f.key)
+		buf.WriteByte('=')
+		if f.value == "" || strings.ContainsAny(f.value, " =\"\\\n\t") {
+			buf.WriteString(strconv.Quote(f.value))
+		} else {
+			buf.WriteString(f.value)
+		}
+	}
+	buf.WriteByte('\n')
+}
+
+// sortedFields orders the fields by their key so the records of a package always look the same,
+// the package comes first
+func sortedFields(fields []field) []field {
+	sorted := append([]field{}, fields...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].key == "package" || sorted[j].key == "package" {
+			return sorted[i].key == "package" && sorted[j].key != "package"
+		}
+		return sorted[i].key < sorted[j].key
+	})
+	return sorted
+}
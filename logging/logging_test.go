@@ -0,0 +1,100 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/he4d/simplejack"
+)
+
+func newTestLogs(t *testing.T, format string, levels map[string]simplejack.LogLevel) (*Logs, *bytes.Buffer) {
+	buf := &bytes.Buffer{}
+	logs, err := New(buf, format, simplejack.INFO, levels)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logs.now = func() time.Time { return time.Date(2017, 10, 2, 6, 0, 0, 0, time.UTC) }
+	return logs, buf
+}
+
+func TestJSONRecords(t *testing.T) {
+	logs, buf := newTestLogs(t, FormatJSON, nil)
+	logger := With(logs.Logger("almue"), "request_id", "host/abc-000001")
+	logger.Warning.Printf("Could not find %q", "floor 1")
+
+	record := map[string]string{}
+	if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+		t.Fatalf("Expected a JSON record but got %s: %v", buf.String(), err)
+	}
+	expected := map[string]string{
+		"time":       "2017-10-02T06:00:00Z",
+		"level":      "warning",
+		"msg":        `Could not find "floor 1"`,
+		"package":    "almue",
+		"request_id": "host/abc-000001",
+	}
+	if !reflect.DeepEqual(record, expected) {
+		t.Errorf("Expected the record %v but got %v", expected, record)
+	}
+}
+
+func TestLogfmtRecords(t *testing.T) {
+	logs, buf := newTestLogs(t, FormatLogfmt, nil)
+	With(logs.Logger("embedded"), "trace", "job/shutter/1/open", "device", "shutter/1").Info.Print("Relays switched to opening")
+
+	expected := `time=2017-10-02T06:00:00Z level=info msg="Relays switched to opening" package=embedded device=shutter/1 trace=job/shutter/1/open` + "\n"
+	if buf.String() != expected {
+		t.Errorf("Expected the record\n%sbut got\n%s", expected, buf.String())
+	}
+}
+
+func TestPackageLevels(t *testing.T) {
+	logs, buf := newTestLogs(t, FormatLogfmt, map[string]simplejack.LogLevel{"embedded": simplejack.DEBUG, "store": simplejack.ERROR})
+
+	logs.Logger("embedded").Debug.Print("embedded debug")
+	logs.Logger("store").Warning.Print("store warning")
+	logs.Logger("almue").Debug.Print("almue debug")
+	logs.Logger("almue").Info.Print("almue info")
+	With(logs.Logger("store"), "trace", "1").Warning.Print("store warning with trace")
+
+	lines := bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n"))
+	if len(lines) != 2 || !bytes.Contains(lines[0], []byte("embedded debug")) || !bytes.Contains(lines[1], []byte("almue info")) {
+		t.Errorf("Expected only the embedded debug and the almue info record but got\n%s", buf.String())
+	}
+}
+
+func TestWithForeignLogger(t *testing.T) {
+	logger := simplejack.New(simplejack.TRACE, ioutil.Discard)
+	if with := With(logger, "trace", "1"); with.Info != logger.Info {
+		t.Error("Expected a logger that is not created by the logs to stay unchanged")
+	}
+	discard := &simplejack.Logger{Info: log.New(ioutil.Discard, "", 0)}
+	discard.Trace, discard.Debug, discard.Warning, discard.Error, discard.Fatal = discard.Info, discard.Info, discard.Info, discard.Info, discard.Info
+	if with := With(discard, "trace", "1"); with.Info != discard.Info {
+		t.Error("Expected a discarding logger to stay unchanged")
+	}
+}
+
+func TestParseLevels(t *testing.T) {
+	levels, err := ParseLevels("embedded=debug, store=4,almue=Warning")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]simplejack.LogLevel{"embedded": simplejack.DEBUG, "store": simplejack.ERROR, "almue": simplejack.WARNING}
+	if !reflect.DeepEqual(levels, expected) {
+		t.Errorf("Expected the levels %v but got %v", expected, levels)
+	}
+	for _, invalid := range []string{"embedded", "=debug", "store=verbose", "store=6"} {
+		if _, err := ParseLevels(invalid); err == nil {
+			t.Errorf("Expected %q to be invalid", invalid)
+		}
+	}
+	if _, err := New(ioutil.Discard, "xml", simplejack.INFO, nil); err == nil {
+		t.Error("Expected the unknown format to be rejected")
+	}
+}
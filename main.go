@@ -2,34 +2,73 @@ package main
 
 import (
 	"flag"
+	"fmt"
 	"io"
 	"log"
 	"os"
 	"os/signal"
+	"sort"
+	"time"
 
 	"github.com/he4d/almue-backend/almue"
+	"github.com/he4d/almue-backend/board"
 	"github.com/he4d/almue-backend/embedded"
-	"github.com/he4d/almue-backend/store"
+	"github.com/he4d/almue-backend/logging"
 	"github.com/he4d/simplejack"
-	_ "github.com/mattn/go-sqlite3"
 )
 
 var (
-	simulate    = flag.Bool("simulate", false, "starts simulation mode without gpio (operations will be written to stdout instead)")
-	routes      = flag.Bool("routes", false, "generate router documentation")
-	publicAPI   = flag.Bool("publicapi", false, "enables public access to the rest service")
-	logLevel    = flag.Int("loglevel", 3, "set the minimum loglevel 0 = Trace, 1 = Debug, 2 = Info, 3 = Warning, 4 = Error, 5 = Fatal")
-	logToStdout = flag.Bool("logtostdout", false, "set this to true to get logging to the stdout instead of a logfile")
+	simulate         = flag.Bool("simulate", false, "starts simulation mode on virtual gpio pins that can be inspected with the simulation api")
+	routes           = flag.Bool("routes", false, "generate router documentation")
+	publicAPI        = flag.Bool("publicapi", false, "enables public access to the rest service")
+	logLevel         = flag.Int("loglevel", 3, "set the minimum loglevel 0 = Trace, 1 = Debug, 2 = Info, 3 = Warning, 4 = Error, 5 = Fatal")
+	logLevels        = flag.String("loglevels", "", "set the minimum loglevel of single packages (almue, embedded, store), e.g. embedded=debug,store=4")
+	logFormat        = flag.String("logformat", logging.FormatJSON, "the format of the log records, json or logfmt")
+	logToStdout      = flag.Bool("logtostdout", false, "set this to true to get logging to the stdout instead of a logfile")
+	reversalDeadTime = flag.Duration("reversaldeadtime", 500*time.Millisecond, "the time both shutter relays stay off before a motor changes its direction")
+	minPause         = flag.Duration("minpause", time.Second, "the minimum time a shutter motor rests between two runs")
+	maxRunTime       = flag.Duration("maxruntime", 2*time.Minute, "the maximum time a shutter motor may run continuously (must be longer than the complete way of every shutter plus 10s), 0 disables the watchdog")
+	stopPin          = flag.Int("stoppin", 0, "the input pin of a stop button or a wind sensor that stops all shutters on a rising edge, 0 disables it")
+	timeScale        = flag.Float64("timescale", 1, "accelerates the time in simulation mode, e.g. 60 lets one minute pass in one second")
+	boardName        = flag.String("board", board.DefaultProfile, fmt.Sprintf("the board profile that describes the available gpio pins %v", board.Names()))
+	migrate          = flag.String("migrate", "", "migrates the database and exits: up, down N (reverts the last N migrations) or status")
+	storageName      = flag.String("storage", "sqlite", "the storage backend, sqlite keeps the data in almue.db and json in almue.json (json does not need cgo)")
 )
 
 const serverAddr = ":8000"
 
 func main() {
 	flag.Parse()
-	if *logLevel < 0 || *logLevel > 5 {
-		log.Fatalf("Log level must be between 0 and 5!")
+	packageLevels, err := logging.ParseLevels(*logLevels)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if *migrate != "" {
+		if runMigration == nil {
+			log.Fatal("Migrations need the sqlite storage, which is not available without cgo")
+		}
+		if err := runMigration(*migrate, flag.Args()); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	boardProfile, err := board.Get(*boardName)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *stopPin != 0 {
+		// the devices can not use the stop pin
+		if boardProfile, err = boardProfile.Reserve(*stopPin, "stop pin"); err != nil {
+			log.Fatalf("Invalid stop pin: %v", err)
+		}
+	}
+
+	openStorage, ok := storages[*storageName]
+	if !ok {
+		log.Fatalf("Unknown storage %s, available are %v", *storageName, storageNames())
 	}
-	sjLogLevel := simplejack.LogLevel(*logLevel)
 
 	var writer io.Writer
 	if *logToStdout {
@@ -42,21 +81,36 @@ func main() {
 		}
 	}
 
-	logger := simplejack.New(sjLogLevel, writer)
+	logs, err := logging.New(writer, *logFormat, simplejack.LogLevel(*logLevel), packageLevels)
+	if err != nil {
+		log.Fatal(err)
+	}
+	logger := logs.Logger("main")
+	// libraries that log with the standard logger, like the http server, write warning records
+	log.SetFlags(0)
+	log.SetOutput(logger.Warning.Writer())
 
-	store, err := store.New("./almue.db", logger)
+	store, err := openStorage(logs.Logger("store"))
 	if err != nil {
 		logger.Error.Printf("Could not create a new store: %v", err)
 		return
 	}
 
-	deviceController, err := embedded.New(logger, store, *simulate)
+	deviceController, err := embedded.New(logs.Logger("embedded"), store, embedded.Config{
+		Simulate:         *simulate,
+		Board:            boardProfile,
+		ReversalDeadTime: *reversalDeadTime,
+		MinPause:         *minPause,
+		MaxRunTime:       *maxRunTime,
+		StopPin:          *stopPin,
+		TimeScale:        *timeScale,
+	})
 	if err != nil {
 		logger.Error.Printf("Could not create a new device controller: %v", err)
 		return
 	}
 
-	almue, err := almue.New(store, deviceController, logger, *publicAPI)
+	almue, err := almue.New(store, deviceController, boardProfile, logs.Logger("almue"), *publicAPI)
 	if err != nil {
 		logger.Error.Printf("Could not create a new instance of almue: %v", err)
 		return
@@ -81,3 +135,25 @@ func main() {
 		almue.Shutdown()
 	}
 }
+
+// storage is a storage backend for almue and the device controller
+type storage interface {
+	almue.DeviceStore
+	embedded.DeviceStateStore
+}
+
+// storages opens the available storage backends by their name
+var storages = map[string]func(logger *simplejack.Logger) (storage, error){}
+
+// runMigration runs the command of the migrate flag, it is only available with a storage that has migrations
+var runMigration func(command string, args []string) error
+
+func storageNames() []string {
+	names := []string{}
+	for name := range storages {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
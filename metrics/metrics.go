@@ -0,0 +1,303 @@
+// Package metrics collects counters, gauges and histograms and exposes them
+// in the text format of Prometheus. The packages of almue register their
+// metrics in the Default registry, which is served at /metrics.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultBuckets are the upper bounds in seconds of the histogram buckets for durations
+var DefaultBuckets = []float64{0.0005, 0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Default is the registry that is served at /metrics
+var Default = NewRegistry()
+
+// Registry holds the metrics that are exposed together
+type Registry struct {
+	sync.Mutex
+	families map[string]*family
+}
+
+// NewRegistry returns an empty registry
+func NewRegistry() *Registry {
+	return &Registry{families: map[string]*family{}}
+}
+
+// family is a metric with all of its series, a series is identified by the values of the labels
+type family struct {
+	sync.Mutex
+	name    string
+	help    string
+	kind    string
+	labels  []string
+	buckets []float64
+	series  map[string]*series
+}
+
+type series struct {
+	values []string
+	value  float64
+	// counts are the cumulative counts of the buckets of a histogram
+	counts []uint64
+	count  uint64
+}
+
+// register adds the family to the registry. A metric that is registered twice with the same
+// kind and labels returns the family of the first registration, so packages can be loaded in any order
+func (r *Registry) register(f *family) *family {
+	r.Lock()
+	defer r.Unlock()
+	if existing, ok := r.families[f.name]; ok {
+		if existing.kind != f.kind || strings.Join(existing.labels, ",") != strings.Join(f.labels, ",") {
+			panic(fmt.Sprintf("metrics: %s is already registered as another metric", f.name))
+		}
+		return existing
+	}
+	f.series = map[string]*series{}
+	r.families[f.name] = f
+	return f
+}
+
+// seriesKey identifies the series of the label values in its family
+func seriesKey(values []string) string {
+	return strings.Join(values, "\xff")
+}
+
+// with returns the series of the label values and creates it if necessary
+func (f *family) with(values []string) *series {
+	if len(values) != len(f.labels) {
+		panic(fmt.Sprintf("metrics: %s has the labels %v but got the values %v", f.name, f.labels, values))
+	}
+	key := seriesKey(values)
+	s, ok := f.series[key]
+	if !ok {
+		s = &series{values: append([]string{}, values...)}
+		if f.kind == "histogram" {
+			s.counts = make([]uint64, len(f.buckets))
+		}
+		f.series[key] = s
+	}
+	return s
+}
+
+// value returns the value of the series of the label values or zero if it does not exist
+func (f *family) value(values []string) float64 {
+	f.Lock()
+	defer f.Unlock()
+	if s, ok := f.series[seriesKey(values)]; ok {
+		return s.value
+	}
+	return 0
+}
+
+// CounterVec is a counter that only increases, partitioned by its labels
+type CounterVec struct {
+	f *family
+}
+
+// NewCounter registers a counter in the registry
+func (r *Registry) NewCounter(name, help string, labels ...string) *CounterVec {
+	return &CounterVec{r.register(&family{name: name, help: help, kind: "counter", labels: labels})}
+}
+
+// Add adds the value to the counter of the label values, negative values are ignored
+func (c *CounterVec) Add(value float64, labelValues ...string) {
+	if value < 0 {
+		return
+	}
+	c.f.Lock()
+	defer c.f.Unlock()
+	c.f.with(labelValues).value += value
+}
+
+// Inc increases the counter of the label values by one
+func (c *CounterVec) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Value returns the counter of the label values
+func (c *CounterVec) Value(labelValues ...string) float64 {
+	return c.f.value(labelValues)
+}
+
+// GaugeVec is a value that can go up and down, partitioned by its labels
+type GaugeVec struct {
+	f *family
+}
+
+// NewGauge registers a gauge in the registry
+func (r *Registry) NewGauge(name, help string, labels ...string) *GaugeVec {
+	return &GaugeVec{r.register(&family{name: name, help: help, kind: "gauge", labels: labels})}
+}
+
+// Set sets the gauge of the label values
+func (g *GaugeVec) Set(value float64, labelValues ...string) {
+	g.f.Lock()
+	defer g.f.Unlock()
+	g.f.with(labelValues).value = value
+}
+
+// Delete removes the gauge of the label values, e.g. when its device is unregistered
+func (g *GaugeVec) Delete(labelValues ...string) {
+	g.f.Lock()
+	defer g.f.Unlock()
+	delete(g.f.series, seriesKey(labelValues))
+}
+
+// Value returns the gauge of the label values, ok is false if the gauge is not set
+func (g *GaugeVec) Value(labelValues ...string) (value float64, ok bool) {
+	g.f.Lock()
+	defer g.f.Unlock()
+	s, ok := g.f.series[seriesKey(labelValues)]
+	if !ok {
+		return 0, false
+	}
+	return s.value, true
+}
+
+// HistogramVec counts observed values in buckets, partitioned by its labels
+type HistogramVec struct {
+	f *family
+}
+
+// NewHistogram registers a histogram with the given upper bounds of its buckets in the registry
+func (r *Registry) NewHistogram(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	sorted := append([]float64{}, buckets...)
+	sort.Float64s(sorted)
+	return &HistogramVec{r.register(&family{name: name, help: help, kind: "histogram", labels: labels, buckets: sorted})}
+}
+
+// Count returns the number of observations of the histogram of the label values
+func (h *HistogramVec) Count(labelValues ...string) uint64 {
+	h.f.Lock()
+	defer h.f.Unlock()
+	if s, ok := h.f.series[seriesKey(labelValues)]; ok {
+		return s.count
+	}
+	return 0
+}
+
+// Observe adds the value to the histogram of the label values
+func (h *HistogramVec) Observe(value float64, labelValues ...string) {
+	h.f.Lock()
+	defer h.f.Unlock()
+	s := h.f.with(labelValues)
+	for i, bound := range h.f.buckets {
+		if value <= bound {
+			s.counts[i]++
+		}
+	}
+	s.count++
+	s.value += value
+}
+
+// WriteTo writes all metrics in the text format of Prometheus, ordered by their name and label values
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	r.Lock()
+	families := make([]*family, 0, len(r.families))
+	for _, f := range r.families {
+		families = append(families, f)
+	}
+	r.Unlock()
+	sort.Slice(families, func(i, j int) bool { return families[i].name < families[j].name })
+
+	cw := &countingWriter{w: w}
+	bw := bufio.NewWriter(cw)
+	for _, f := range families {
+		f.write(bw)
+	}
+	err := bw.Flush()
+	return cw.n, err
+}
+
+// Handler serves the metrics of the registry
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		r.WriteTo(w)
+	})
+}
+
+func (f *family) write(w *bufio.Writer) {
+	f.Lock()
+	defer f.Unlock()
+	fmt.Fprintf(w, "# HELP %s %s\n", f.name, escapeHelp(f.help))
+	fmt.Fprintf(w, "# TYPE %s %s\n", f.name, f.kind)
+	keys := make([]string, 0, len(f.series))
+	for key := range f.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		s := f.series[key]
+		if f.kind != "histogram" {
+			fmt.Fprintf(w, "%s%s %s\n", f.name, f.labelPairs(s.values, "", ""), formatValue(s.value))
+			continue
+		}
+		for i, bound := range f.buckets {
+			fmt.Fprintf(w, "%s_bucket%s %d\n", f.name, f.labelPairs(s.values, "le", formatValue(bound)), s.counts[i])
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", f.name, f.labelPairs(s.values, "le", "+Inf"), s.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", f.name, f.labelPairs(s.values, "", ""), formatValue(s.value))
+		fmt.Fprintf(w, "%s_count%s %d\n", f.name, f.labelPairs(s.values, "", ""), s.count)
+	}
+}
+
+// labelPairs formats the labels of a series, the extra label is appended if it is set
+func (f *family) labelPairs(values []string, extraName, extraValue string) string {
+	pairs := []string{}
+	for i, name := range f.labels {
+		pairs = append(pairs, fmt.Sprintf("%s=\"%s\"", name, escapeLabel(values[i])))
+	}
+	if extraName != "" {
+		pairs = append(pairs, fmt.Sprintf("%s=\"%s\"", extraName, extraValue))
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func formatValue(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	case math.IsNaN(value):
+		return "NaN"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+var helpEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+
+func escapeHelp(help string) string {
+	return helpEscaper.Replace(help)
+}
+
+func escapeLabel(value string) string {
+	return labelEscaper.Replace(value)
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,117 @@
+package metrics
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestWriteTo(t *testing.T) {
+	r := NewRegistry()
+	requests := r.NewCounter("test_requests_total", "Requests by code.", "code")
+	state := r.NewGauge("test_state", "State of a device.\nOne line per device.", "device")
+	duration := r.NewHistogram("test_duration_seconds", "Durations.", []float64{1, 0.1}, "op")
+
+	requests.Inc("500")
+	requests.Add(2, "200")
+	requests.Add(-1, "200")
+	state.Set(0.5, `kitchen "left"`)
+	state.Set(1, "gone")
+	state.Delete("gone")
+	duration.Observe(0.05, "select")
+	duration.Observe(0.5, "select")
+	duration.Observe(3, "select")
+
+	buf := &bytes.Buffer{}
+	n, err := r.WriteTo(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != int64(buf.Len()) {
+		t.Errorf("Expected %d written bytes but got %d", buf.Len(), n)
+	}
+	expected := `# HELP test_duration_seconds Durations.
+# TYPE test_duration_seconds histogram
+test_duration_seconds_bucket{op="select",le="0.1"} 1
+test_duration_seconds_bucket{op="select",le="1"} 2
+test_duration_seconds_bucket{op="select",le="+Inf"} 3
+test_duration_seconds_sum{op="select"} 3.55
+test_duration_seconds_count{op="select"} 3
+# HELP test_requests_total Requests by code.
+# TYPE test_requests_total counter
+test_requests_total{code="200"} 2
+test_requests_total{code="500"} 1
+# HELP test_state State of a device.\nOne line per device.
+# TYPE test_state gauge
+test_state{device="kitchen \"left\""} 0.5
+`
+	if buf.String() != expected {
+		t.Errorf("Expected the metrics\n%s\nbut got\n%s", expected, buf.String())
+	}
+}
+
+func TestRegisterTwice(t *testing.T) {
+	r := NewRegistry()
+	first := r.NewCounter("test_total", "Test.", "label")
+	second := r.NewCounter("test_total", "Test.", "label")
+	first.Inc("a")
+	second.Inc("a")
+
+	buf := &bytes.Buffer{}
+	r.WriteTo(buf)
+	if !strings.Contains(buf.String(), `test_total{label="a"} 2`) {
+		t.Errorf("Expected both registrations to share the counter but got\n%s", buf.String())
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("Expected a panic when the metric is registered as another kind")
+		}
+	}()
+	r.NewGauge("test_total", "Test.", "label")
+}
+
+func TestHandler(t *testing.T) {
+	r := NewRegistry()
+	r.NewGauge("test_up", "Up.").Set(1)
+
+	w := httptest.NewRecorder()
+	r.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	if w.Code != http.StatusOK || !strings.HasPrefix(w.Header().Get("Content-Type"), "text/plain; version=0.0.4") {
+		t.Errorf("Expected the text format but got %d %q", w.Code, w.Header().Get("Content-Type"))
+	}
+	if !strings.HasSuffix(w.Body.String(), "test_up 1\n") {
+		t.Errorf("Expected the gauge without labels but got\n%s", w.Body.String())
+	}
+}
+
+func TestValue(t *testing.T) {
+	r := NewRegistry()
+	counter := r.NewCounter("test_total", "Test.", "label")
+	gauge := r.NewGauge("test_gauge", "Test.", "label")
+	histogram := r.NewHistogram("test_seconds", "Test.", DefaultBuckets, "label")
+
+	counter.Add(1.5, "a")
+	gauge.Set(3, "a")
+	histogram.Observe(0.2, "a")
+	histogram.Observe(0.4, "a")
+
+	if value := counter.Value("a"); value != 1.5 {
+		t.Errorf("Expected the counter 1.5 but got %v", value)
+	}
+	if value := counter.Value("b"); value != 0 {
+		t.Errorf("Expected a missing counter to be 0 but got %v", value)
+	}
+	if value, ok := gauge.Value("a"); !ok || value != 3 {
+		t.Errorf("Expected the gauge 3 but got %v %v", value, ok)
+	}
+	gauge.Delete("a")
+	if _, ok := gauge.Value("a"); ok {
+		t.Error("Expected the deleted gauge to be unset")
+	}
+	if count := histogram.Count("a"); count != 2 {
+		t.Errorf("Expected 2 observations but got %d", count)
+	}
+}
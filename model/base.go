@@ -1,10 +1,28 @@
 package model
 
-import "time"
+import (
+	"errors"
+	"time"
+)
+
+const (
+	// DeviceTypeShutter identifies the shutter device type
+	DeviceTypeShutter = "shutter"
+	// DeviceTypeLighting identifies the lighting device type
+	DeviceTypeLighting = "lighting"
+)
+
+// ErrNotFound is returned by a store if the requested model does not exist
+var ErrNotFound = errors.New("The model does not exist")
+
+// ErrVersionConflict is returned by a store if a model was changed by someone else in the meantime
+var ErrVersionConflict = errors.New("The model was modified in the meantime")
 
 //Base is a basemodel for all database models
 type Base struct {
 	ID       int64     `json:"id"`
 	Created  time.Time `json:"created"`
 	Modified time.Time `json:"modified"`
+	// Version is increased on every update of the configuration of a model
+	Version int64 `json:"version"`
 }
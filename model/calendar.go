@@ -0,0 +1,155 @@
+package model
+
+import (
+	"sort"
+	"time"
+)
+
+// DateFormat is the format of the dates of the calendar
+const DateFormat = "2006-01-02"
+
+// The actions of a calendar exception
+const (
+	// CalendarSkip skips the jobs on the dates of the exception
+	CalendarSkip = "skip"
+	// CalendarShift runs the jobs later by the shift minutes of the exception
+	CalendarShift = "shift"
+)
+
+// The daily jobs of the devices
+const (
+	JobOpen  = "open"
+	JobClose = "close"
+	JobOn    = "on"
+	JobOff   = "off"
+)
+
+//CalendarException represents the dates on which the daily jobs of devices are skipped or shifted,
+//e.g. the public holidays. The dates are in the format of DateFormat, the end date is included
+type CalendarException struct {
+	Base
+	Description  *string  `json:"description"`
+	StartDate    string   `json:"startDate"`
+	EndDate      string   `json:"endDate"`
+	Action       string   `json:"action"`
+	ShiftMinutes int      `json:"shiftMinutes"`
+	Jobs         []string `json:"jobs"`
+	AllDevices   bool     `json:"allDevices"`
+	Shutters     []int64  `json:"shutters"`
+	Lightings    []int64  `json:"lightings"`
+	Source       string   `json:"source"`
+}
+
+//CalendarTrigger represents an upcoming run of a daily job with the calendar applied
+type CalendarTrigger struct {
+	Time         time.Time `json:"time"`
+	DeviceType   string    `json:"deviceType"`
+	DeviceID     int64     `json:"deviceId"`
+	Job          string    `json:"job"`
+	Skipped      bool      `json:"skipped"`
+	ShiftMinutes int       `json:"shiftMinutes"`
+	ExceptionID  *int64    `json:"exceptionId,omitempty"`
+}
+
+//DeepCopy creates a deep copy of a CalendarException
+func (e *CalendarException) DeepCopy() *CalendarException {
+	if e == nil {
+		return nil
+	}
+	copy := *e
+	if e.Description != nil {
+		descr := *e.Description
+		copy.Description = &descr
+	}
+	if e.Jobs != nil {
+		copy.Jobs = append([]string{}, e.Jobs...)
+	}
+	copy.Shutters = copyIDs(e.Shutters)
+	copy.Lightings = copyIDs(e.Lightings)
+	return &copy
+}
+
+// Normalize sets the end date of a single day exception and sorts the
+// jobs and devices without duplicates. The lists are never nil afterwards
+func (e *CalendarException) Normalize() {
+	if e.EndDate == "" {
+		e.EndDate = e.StartDate
+	}
+	e.Jobs = SortTags(e.Jobs)
+	e.Shutters = sortIDs(e.Shutters)
+	e.Lightings = sortIDs(e.Lightings)
+}
+
+// Covers tells if the exception applies to the job of the device on the date
+func (e *CalendarException) Covers(deviceType string, deviceID int64, job string, date string) bool {
+	if date < e.StartDate || date > e.EndDate {
+		return false
+	}
+	if len(e.Jobs) > 0 && !containsString(e.Jobs, job) {
+		return false
+	}
+	if e.AllDevices {
+		return true
+	}
+	if deviceType == "shutter" {
+		return containsID(e.Shutters, deviceID)
+	}
+	return containsID(e.Lightings, deviceID)
+}
+
+// ResolveCalendar returns the exception that decides how the job of the device runs on the date
+// or nil if the job runs as usual. Skipping wins over shifting and the largest shift wins over smaller ones
+func ResolveCalendar(exceptions []*CalendarException, deviceType string, deviceID int64, job string, date string) *CalendarException {
+	var decisive *CalendarException
+	for _, e := range exceptions {
+		if !e.Covers(deviceType, deviceID, job, date) {
+			continue
+		}
+		switch {
+		case decisive == nil:
+			decisive = e
+		case decisive.Action == CalendarSkip:
+		case e.Action == CalendarSkip || e.ShiftMinutes > decisive.ShiftMinutes:
+			decisive = e
+		}
+	}
+	return decisive
+}
+
+func sortIDs(ids []int64) []int64 {
+	sorted := make([]int64, 0, len(ids))
+	seen := map[int64]bool{}
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			sorted = append(sorted, id)
+		}
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	return sorted
+}
+
+func copyIDs(ids []int64) []int64 {
+	if ids == nil {
+		return nil
+	}
+	return append([]int64{}, ids...)
+}
+
+func containsID(ids []int64, id int64) bool {
+	for _, i := range ids {
+		if i == id {
+			return true
+		}
+	}
+	return false
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
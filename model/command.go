@@ -0,0 +1,62 @@
+package model
+
+import (
+	"errors"
+	"time"
+)
+
+// The states of a command
+const (
+	// CommandQueued means the command waits for the commands before it in the queue of its device
+	CommandQueued = "queued"
+	// CommandRunning means the device controller runs the command
+	CommandRunning = "running"
+	// CommandDone means the command was run successfully
+	CommandDone = "done"
+	// CommandFailed means the command was run but failed, the error tells why
+	CommandFailed = "failed"
+	// CommandCancelled means the command was cancelled before it was run
+	CommandCancelled = "cancelled"
+)
+
+// The sources of a command
+const (
+	// CommandSourceAPI is a command of a request of the REST API
+	CommandSourceAPI = "api"
+	// CommandSourceSchedule is a command of a daily job of a device
+	CommandSourceSchedule = "schedule"
+	// CommandSourcePresence is a command of the presence simulation
+	CommandSourcePresence = "presence"
+	// CommandSourceStopPin is a command of the stop pin, e.g. of a stop button or a wind sensor
+	CommandSourceStopPin = "stoppin"
+	// CommandSourceSystem is a command of the device controller itself, e.g. the stop before a device changes its pins
+	CommandSourceSystem = "system"
+)
+
+// The priorities of a command, a queued command with a higher priority runs first
+const (
+	CommandPriorityLow    = 0
+	CommandPriorityNormal = 1
+	CommandPriorityHigh   = 2
+)
+
+// ErrNotCancellable is returned if a command that already runs or has finished gets cancelled
+var ErrNotCancellable = errors.New("Only queued commands can be cancelled")
+
+//Command represents an action on a device. The commands of a device are run one after another.
+//The trace is the request id of the API request or the id of the job run that caused the command,
+//the device controller logs it with every action on the device
+type Command struct {
+	ID         int64      `json:"id"`
+	DeviceType string     `json:"deviceType"`
+	DeviceID   int64      `json:"deviceId"`
+	Action     string     `json:"action"`
+	Source     string     `json:"source"`
+	Priority   int        `json:"priority"`
+	Trace      string     `json:"trace"`
+	Status     string     `json:"status"`
+	Error      string     `json:"error,omitempty"`
+	Created    time.Time  `json:"created"`
+	Started    *time.Time `json:"started,omitempty"`
+	Finished   *time.Time `json:"finished,omitempty"`
+}
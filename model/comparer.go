@@ -65,21 +65,21 @@ func (s1 *Shutter) GetDifferences(s2 *Shutter) DifferenceType {
 	return result
 }
 
-//GetDifferences return an ModelDifferenceType bitmask which holds all the differences between the two shutters
+//GetDifferences return an ModelDifferenceType bitmask which holds all the differences between the two lightings
 //See const in model/comparer.go
 func (l1 *Lighting) GetDifferences(l2 *Lighting) DifferenceType {
 	result := DIFFNONE
-	if l1.SwitchPin != l2.SwitchPin {
+	if *l1.SwitchPin != *l2.SwitchPin {
 		result |= DIFFSWITCHPIN
 	}
 	if l1.JobsEnabled != l2.JobsEnabled {
 		result |= DIFFJOBSENABLED
 	}
 	if l1.OnTime != l2.OnTime {
-		result |= DIFFOPENTIME
+		result |= DIFFONTIME
 	}
 	if l1.OffTime != l2.OffTime {
-		result |= DIFFCLOSETIME
+		result |= DIFFOFFTIME
 	}
 	if l1.EmergencyEnabled != l2.EmergencyEnabled {
 		result |= DIFFEMERGENCYENABLED
@@ -0,0 +1,11 @@
+package model
+
+//Configuration represents the complete installation with all floors, their rooms, their devices
+//and the calendar exceptions of the jobs of the devices
+type Configuration struct {
+	Floors             []*Floor             `json:"floors"`
+	Rooms              []*Room              `json:"rooms"`
+	Shutters           []*Shutter           `json:"shutters"`
+	Lightings          []*Lighting          `json:"lightings"`
+	CalendarExceptions []*CalendarException `json:"calendarExceptions"`
+}
@@ -0,0 +1,21 @@
+package model
+
+import "time"
+
+//DeviceStatusFault is the status of a device whose background operation failed, it stays until the device is reset
+const DeviceStatusFault = "fault"
+
+//DeviceFault describes the error that put a device into the fault status
+type DeviceFault struct {
+	Message string    `json:"message"`
+	Time    time.Time `json:"time"`
+}
+
+//DeepCopy creates a deep copy of a DeviceFault
+func (f *DeviceFault) DeepCopy() *DeviceFault {
+	if f == nil {
+		return nil
+	}
+	copy := *f
+	return &copy
+}
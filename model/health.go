@@ -0,0 +1,58 @@
+package model
+
+import "time"
+
+const (
+	//HealthOK is the status of a passed health check
+	HealthOK = "ok"
+	//HealthFailing is the status of a failed health check
+	HealthFailing = "failing"
+)
+
+//Health is the result of the health or readiness checks of the backend, its status is only ok if all checks passed
+type Health struct {
+	Status string         `json:"status"`
+	Checks []*HealthCheck `json:"checks"`
+}
+
+//HealthCheck is the result of a single health check
+type HealthCheck struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Detail string `json:"detail,omitempty"`
+}
+
+//ControllerStatus describes the state of the device controller and its devices
+type ControllerStatus struct {
+	Simulate bool `json:"simulate"`
+	// GPIO is simulated in the simulation mode, otherwise initialized as the controller does not start without the gpio host
+	GPIO string `json:"gpio"`
+	// SchedulerAlive is false if a daily job missed its last run
+	SchedulerAlive bool `json:"schedulerAlive"`
+	MissedJobs     int  `json:"missedJobs"`
+	Shutters       int  `json:"shutters"`
+	Lightings      int  `json:"lightings"`
+	// ShutterStates and LightingStates count the registered devices in each state
+	ShutterStates  map[string]int `json:"shutterStates"`
+	LightingStates map[string]int `json:"lightingStates"`
+}
+
+//Diagnostics describes the running backend for troubleshooting
+type Diagnostics struct {
+	Version       string            `json:"version"`
+	Started       time.Time         `json:"started"`
+	UptimeSeconds int64             `json:"uptimeSeconds"`
+	Simulate      bool              `json:"simulate"`
+	Runtime       *RuntimeStats     `json:"runtime"`
+	Controller    *ControllerStatus `json:"controller"`
+}
+
+//RuntimeStats are the statistics of the Go runtime
+type RuntimeStats struct {
+	GoVersion  string `json:"goVersion"`
+	CPUs       int    `json:"cpus"`
+	Goroutines int    `json:"goroutines"`
+	HeapAlloc  uint64 `json:"heapAlloc"`
+	HeapSys    uint64 `json:"heapSys"`
+	NumGC      uint32 `json:"numGC"`
+}
@@ -0,0 +1,11 @@
+package model
+
+import "time"
+
+//DeviceEvent represents a state change of a device that the device controller recorded
+type DeviceEvent struct {
+	DeviceType string    `json:"deviceType"`
+	DeviceID   int64     `json:"deviceId"`
+	State      string    `json:"state"`
+	Time       time.Time `json:"time"`
+}
@@ -0,0 +1,34 @@
+package model
+
+import "time"
+
+// The results of the last run of a daily job
+const (
+	// JobResultOK means the job switched its device
+	JobResultOK = "ok"
+	// JobResultFailed means the device could not be switched, the error tells why
+	JobResultFailed = "failed"
+	// JobResultSkipped means a calendar exception skipped the job
+	JobResultSkipped = "skipped"
+	// JobResultShifted means a calendar exception delayed the job, it has not run yet
+	JobResultShifted = "shifted"
+	// JobResultSuspended means the running presence simulation suspended the job
+	JobResultSuspended = "suspended"
+	// JobResultCancelled means the queued command of the job was cancelled before it switched the device
+	JobResultCancelled = "cancelled"
+)
+
+//JobStatus represents a daily job the device controller has scheduled and the outcome of its last run.
+//The time of day is in the format 15:04. The next run respects the calendar exceptions, it is missing
+//while the running presence simulation suspends the job or if the calendar skips every run of the next year
+type JobStatus struct {
+	DeviceType string     `json:"deviceType"`
+	DeviceID   int64      `json:"deviceId"`
+	Job        string     `json:"job"`
+	TimeOfDay  string     `json:"timeOfDay"`
+	NextRun    *time.Time `json:"nextRun,omitempty"`
+	Suspended  bool       `json:"suspended,omitempty"`
+	LastRun    *time.Time `json:"lastRun,omitempty"`
+	LastResult string     `json:"lastResult,omitempty"`
+	LastError  string     `json:"lastError,omitempty"`
+}
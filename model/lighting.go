@@ -7,15 +7,18 @@ import (
 //Lighting represents the database object of a lighting
 type Lighting struct {
 	Base
-	Description      *string   `json:"description"`
-	SwitchPin        *int      `json:"switchPin"`
-	JobsEnabled      bool      `json:"jobsEnabled"`
-	OnTime           time.Time `json:"onTime"`
-	OffTime          time.Time `json:"offTime"`
-	EmergencyEnabled bool      `json:"emergencyEnabled"`
-	DeviceStatus     string    `json:"deviceStatus"`
-	Disabled         bool      `json:"disabled"`
-	FloorID          *int64    `json:"floorId"`
+	Description      *string      `json:"description"`
+	SwitchPin        *int         `json:"switchPin"`
+	JobsEnabled      bool         `json:"jobsEnabled"`
+	OnTime           time.Time    `json:"onTime"`
+	OffTime          time.Time    `json:"offTime"`
+	EmergencyEnabled bool         `json:"emergencyEnabled"`
+	DeviceStatus     string       `json:"deviceStatus"`
+	Disabled         bool         `json:"disabled"`
+	FloorID          *int64       `json:"floorId"`
+	RoomID           *int64       `json:"roomId"`
+	Tags             []string     `json:"tags"`
+	Fault            *DeviceFault `json:"fault"`
 }
 
 //DeepCopy creates a deep copy of a Lighting
@@ -37,6 +40,9 @@ func (l *Lighting) DeepCopy() *Lighting {
 		DeviceStatus:     l.DeviceStatus,
 		Disabled:         l.Disabled,
 		FloorID:          &floorID,
+		RoomID:           copyRoomID(l.RoomID),
+		Tags:             copyTags(l.Tags),
+		Fault:            l.Fault.DeepCopy(),
 	}
 	return copy
 }
@@ -0,0 +1,49 @@
+package model
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// ListOptions filter, sort and page the lists of a store.
+// Filters that are nil or empty are not applied
+type ListOptions struct {
+	FloorID *int64
+	// FloorIDs only keeps the models on one of the floors
+	FloorIDs     []int64
+	RoomID       *int64
+	Disabled     *bool
+	DeviceStatus *string
+	JobsEnabled  *bool
+	// Tag only keeps the devices that carry it
+	Tag string
+	// Search only keeps the models whose description contains it, ignoring the case
+	Search string
+	// Sort is the json name of the field to sort by, the id is used if it is empty
+	Sort       string
+	Descending bool
+	// Limit is the maximum number of models, 0 means no limit
+	Limit int
+	// Cursor is the position of the page in the sorted list, the first page has none
+	Cursor *ListCursor
+}
+
+// ListCursor is the position of a page in a sorted list, it is the sort value and the id of a model.
+// The page starts after the model, or ends before it if Backward is set. The models
+// of a backward page are returned in the order of the list as well
+type ListCursor struct {
+	// Value is the json encoded value of the sort field of the model
+	Value    json.RawMessage
+	ID       int64
+	Backward bool
+}
+
+// ListOptionsError is returned by a store if list options can not be applied
+type ListOptionsError struct {
+	Option string
+	Value  string
+}
+
+func (e *ListOptionsError) Error() string {
+	return fmt.Sprintf("Invalid value %q for the list option %s", e.Value, e.Option)
+}
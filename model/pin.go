@@ -0,0 +1,65 @@
+package model
+
+import (
+	"fmt"
+	"time"
+)
+
+//Pin represents a gpio pin that is assigned to a device
+type Pin struct {
+	Number     int    `json:"number"`
+	DeviceType string `json:"deviceType"`
+	DeviceID   int64  `json:"deviceId"`
+	Function   string `json:"function"`
+}
+
+//PinConflictError is returned by the stores if a device is saved with a pin that is assigned to another device
+//or with the same pin twice, Assigned is nil in the latter case
+type PinConflictError struct {
+	Number   int
+	Assigned *Pin
+}
+
+func (e *PinConflictError) Error() string {
+	if e.Assigned == nil {
+		return fmt.Sprintf("Pin %d can not be used twice by the same device", e.Number)
+	}
+	return fmt.Sprintf("Pin %d is already used as %s pin of %s %d",
+		e.Number, e.Assigned.Function, e.Assigned.DeviceType, e.Assigned.DeviceID)
+}
+
+//FindPinConflict returns the conflict of the given pins of the device with the given type and id
+//with the assigned pins, or nil if there is none. A device that is not created yet has the id 0
+func FindPinConflict(assigned []*Pin, deviceType string, deviceID int64, pins ...int) *PinConflictError {
+	owners := map[int]*Pin{}
+	for _, p := range assigned {
+		owners[p.Number] = p
+	}
+	seen := map[int]struct{}{}
+	for _, pin := range pins {
+		if _, ok := seen[pin]; ok {
+			return &PinConflictError{Number: pin}
+		}
+		seen[pin] = struct{}{}
+		if owner, ok := owners[pin]; ok && (owner.DeviceType != deviceType || owner.DeviceID != deviceID) {
+			return &PinConflictError{Number: pin, Assigned: owner}
+		}
+	}
+	return nil
+}
+
+//PinState represents the current state of a simulated gpio pin
+type PinState struct {
+	Number   int         `json:"number"`
+	Name     string      `json:"name"`
+	Function string      `json:"function"`
+	High     bool        `json:"high"`
+	History  []*PinEvent `json:"history"`
+}
+
+//PinEvent represents a level change of a simulated gpio pin
+type PinEvent struct {
+	Time     time.Time `json:"time"`
+	High     bool      `json:"high"`
+	Injected bool      `json:"injected"`
+}
@@ -0,0 +1,40 @@
+package model
+
+import "time"
+
+// The profiles of a presence simulation
+const (
+	// PresenceProfileHistory replays the recorded history of the devices.
+	// Devices without a history get the random profile
+	PresenceProfileHistory = "history"
+	// PresenceProfileRandom switches the devices at random times of plausible periods of the day
+	PresenceProfileRandom = "random"
+)
+
+//PresenceSettings select the devices of a presence simulation and how they get switched
+type PresenceSettings struct {
+	Shutters      []int64 `json:"shutters"`
+	Lightings     []int64 `json:"lightings"`
+	Profile       string  `json:"profile"`
+	JitterMinutes int     `json:"jitterMinutes"`
+	SuspendJobs   bool    `json:"suspendJobs"`
+}
+
+//PresenceAction represents a planned or performed switch of a device by the presence simulation
+type PresenceAction struct {
+	Time       time.Time `json:"time"`
+	DeviceType string    `json:"deviceType"`
+	DeviceID   int64     `json:"deviceId"`
+	State      string    `json:"state"`
+	Profile    string    `json:"profile"`
+	Error      string    `json:"error,omitempty"`
+}
+
+//PresenceStatus represents the state of the presence simulation
+type PresenceStatus struct {
+	Enabled  bool              `json:"enabled"`
+	Since    *time.Time        `json:"since,omitempty"`
+	Settings *PresenceSettings `json:"settings,omitempty"`
+	Planned  []*PresenceAction `json:"planned"`
+	Done     []*PresenceAction `json:"done"`
+}
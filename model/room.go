@@ -0,0 +1,33 @@
+package model
+
+//Room represents the database object of a room, a room belongs to a floor
+//and groups some of the devices of the floor
+type Room struct {
+	Base
+	Description *string `json:"description"`
+	FloorID     *int64  `json:"floorId"`
+}
+
+//DeepCopy creates a deep copy of a Room
+func (r *Room) DeepCopy() *Room {
+	if r == nil {
+		return nil
+	}
+	descr := *r.Description
+	floorID := *r.FloorID
+	copy := &Room{
+		Base:        r.Base,
+		Description: &descr,
+		FloorID:     &floorID,
+	}
+	return copy
+}
+
+// copyRoomID copies the optional room of a device
+func copyRoomID(roomID *int64) *int64 {
+	if roomID == nil {
+		return nil
+	}
+	id := *roomID
+	return &id
+}
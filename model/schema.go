@@ -0,0 +1,26 @@
+package model
+
+import "time"
+
+// Schema describes the version of the database schema of a store
+type Schema struct {
+	// Version is the number of applied migrations
+	Version int `json:"version"`
+	// Latest is the version after all migrations of this build are applied
+	Latest int `json:"latest"`
+	// Current is the name of the last applied migration
+	Current    string       `json:"current"`
+	Migrations []*Migration `json:"migrations"`
+}
+
+// Migration is the state of a single migration of the database schema
+type Migration struct {
+	Name      string     `json:"name"`
+	Applied   bool       `json:"applied"`
+	AppliedAt *time.Time `json:"appliedAt,omitempty"`
+	Checksum  string     `json:"checksum"`
+	// Modified is true if the statement was changed after the migration was applied
+	Modified bool `json:"modified"`
+	// Unknown is true if the migration was applied by another build
+	Unknown bool `json:"unknown"`
+}
@@ -7,18 +7,21 @@ import (
 //Shutter represents the database object of a shutter
 type Shutter struct {
 	Base
-	Description          *string   `json:"description"`
-	OpenPin              *int      `json:"openPin"`
-	ClosePin             *int      `json:"closePin"`
-	CompleteWayInSeconds *int      `json:"completeWayInSeconds"`
-	OpeningInPrc         int       `json:"openingInPrc"`
-	JobsEnabled          bool      `json:"jobsEnabled"`
-	OpenTime             time.Time `json:"openTime"`
-	CloseTime            time.Time `json:"closeTime"`
-	EmergencyEnabled     bool      `json:"emergencyEnabled"`
-	DeviceStatus         string    `json:"deviceStatus"`
-	Disabled             bool      `json:"disabled"`
-	FloorID              *int64    `json:"floorId"`
+	Description          *string      `json:"description"`
+	OpenPin              *int         `json:"openPin"`
+	ClosePin             *int         `json:"closePin"`
+	CompleteWayInSeconds *int         `json:"completeWayInSeconds"`
+	OpeningInPrc         int          `json:"openingInPrc"`
+	JobsEnabled          bool         `json:"jobsEnabled"`
+	OpenTime             time.Time    `json:"openTime"`
+	CloseTime            time.Time    `json:"closeTime"`
+	EmergencyEnabled     bool         `json:"emergencyEnabled"`
+	DeviceStatus         string       `json:"deviceStatus"`
+	Disabled             bool         `json:"disabled"`
+	FloorID              *int64       `json:"floorId"`
+	RoomID               *int64       `json:"roomId"`
+	Tags                 []string     `json:"tags"`
+	Fault                *DeviceFault `json:"fault"`
 }
 
 //DeepCopy creates a deep copy of a Shutter
@@ -30,6 +33,7 @@ func (s *Shutter) DeepCopy() *Shutter {
 	openPin := *s.OpenPin
 	closePin := *s.ClosePin
 	completeWayInSecs := *s.CompleteWayInSeconds
+	floorID := *s.FloorID
 	copy := &Shutter{
 		Base:                 s.Base,
 		Description:          &descr,
@@ -43,7 +47,10 @@ func (s *Shutter) DeepCopy() *Shutter {
 		EmergencyEnabled:     s.EmergencyEnabled,
 		DeviceStatus:         s.DeviceStatus,
 		Disabled:             s.Disabled,
-		FloorID:              s.FloorID,
+		FloorID:              &floorID,
+		RoomID:               copyRoomID(s.RoomID),
+		Tags:                 copyTags(s.Tags),
+		Fault:                s.Fault.DeepCopy(),
 	}
 	return copy
 }
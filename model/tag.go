@@ -0,0 +1,33 @@
+package model
+
+import "sort"
+
+//Tag groups devices by a name, independent of their floors and rooms
+type Tag struct {
+	Name      string `json:"name"`
+	Shutters  int    `json:"shutters"`
+	Lightings int    `json:"lightings"`
+}
+
+// SortTags returns the tags sorted by name and without duplicates.
+// The result is never nil, so a device without tags has an empty list
+func SortTags(tags []string) []string {
+	sorted := make([]string, 0, len(tags))
+	seen := map[string]bool{}
+	for _, tag := range tags {
+		if !seen[tag] {
+			seen[tag] = true
+			sorted = append(sorted, tag)
+		}
+	}
+	sort.Strings(sorted)
+	return sorted
+}
+
+// copyTags copies the tags of a device
+func copyTags(tags []string) []string {
+	if tags == nil {
+		return nil
+	}
+	return append([]string{}, tags...)
+}
@@ -1,2 +1,2 @@
 #!/bin/sh
-go run main.go --publicapi --simulate --loglevel=1 --logtostdout
+go run . --publicapi --simulate --storage=sqlite --loglevel=1 --logformat=logfmt --logtostdout
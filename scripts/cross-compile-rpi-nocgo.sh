@@ -0,0 +1,11 @@
+## Crosscompile Script without cgo
+## Only the json storage is available (run almue with -storage json),
+## but no ARM C toolchain is needed
+## RaspberryPi 1 = ARMv6
+## RaspberryPi 2 = ARMv7
+## RaspberryPi 3 = ARMv8
+export GOOS=linux; \
+export GOARCH=arm; \
+export GOARM=7; \
+CGO_ENABLED=0 go build -v -ldflags "-X github.com/he4d/almue-backend/almue.Version=$(git describe --tags --always --dirty)" \
+  -o "./bin/${GOOS}_${GOARCH}/almue" github.com/he4d/almue
@@ -7,5 +7,5 @@ export GOOS=linux; \
 export GOARCH=arm; \
 export GOARM=7; \
 export CC=arm-linux-gnueabihf-gcc-6; \
-CGO_ENABLED=1 go build -v -ldflags "-linkmode external -extldflags -static" \
+CGO_ENABLED=1 go build -v -ldflags "-linkmode external -extldflags -static -X github.com/he4d/almue-backend/almue.Version=$(git describe --tags --always --dirty)" \
   -o "./bin/${GOOS}_${GOARCH}/almue" github.com/he4d/almue
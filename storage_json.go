@@ -0,0 +1,32 @@
+package main
+
+import (
+	"github.com/he4d/almue-backend/almue"
+	"github.com/he4d/almue-backend/filestore"
+	"github.com/he4d/simplejack"
+)
+
+func init() {
+	storages["json"] = openJSON
+}
+
+const jsonPath = "./almue.json"
+
+// jsonStore lets the transactions of the file store satisfy almue.DeviceStore
+type jsonStore struct {
+	*filestore.Store
+}
+
+func (s jsonStore) WithTx(fn func(tx almue.DeviceStore) error) error {
+	return s.Store.WithTx(func(tx *filestore.Store) error {
+		return fn(jsonStore{tx})
+	})
+}
+
+func openJSON(logger *simplejack.Logger) (storage, error) {
+	s, err := filestore.New(jsonPath, logger)
+	if err != nil {
+		return nil, err
+	}
+	return jsonStore{s}, nil
+}
@@ -0,0 +1,100 @@
+// +build cgo
+
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/he4d/almue-backend/almue"
+	"github.com/he4d/almue-backend/store"
+	"github.com/he4d/simplejack"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// the sqlite driver needs cgo, so the sqlite storage is only available with it
+func init() {
+	storages["sqlite"] = openSQLite
+	runMigration = migrateSQLite
+}
+
+const dbPath = "./almue.db"
+
+// sqliteStore lets the transactions of the datastore satisfy almue.DeviceStore
+type sqliteStore struct {
+	*store.Datastore
+}
+
+func (s sqliteStore) WithTx(fn func(tx almue.DeviceStore) error) error {
+	return s.Datastore.WithTx(func(tx *store.Datastore) error {
+		return fn(sqliteStore{tx})
+	})
+}
+
+func openSQLite(logger *simplejack.Logger) (storage, error) {
+	s, err := store.New(dbPath, logger)
+	if err != nil {
+		return nil, err
+	}
+	return sqliteStore{s}, nil
+}
+
+// migrateSQLite runs the command of the migrate flag on the database
+func migrateSQLite(command string, args []string) error {
+	db, err := store.Open(dbPath)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	switch command {
+	case "up":
+		if err := store.Migrate(db); err != nil {
+			return err
+		}
+	case "down":
+		if len(args) != 1 {
+			return fmt.Errorf("Usage: -migrate down N")
+		}
+		n, err := strconv.Atoi(args[0])
+		if err != nil {
+			return fmt.Errorf("The number of migrations to revert must be a number: %v", err)
+		}
+		if err := store.MigrateDown(db, n); err != nil {
+			return err
+		}
+	case "status":
+	default:
+		return fmt.Errorf("Unknown migrate command %s, use up, down N or status", command)
+	}
+	return printSchema(db)
+}
+
+func printSchema(db *sql.DB) error {
+	schema, err := store.SchemaStatus(db)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("schema version %d of %d\n", schema.Version, schema.Latest)
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, m := range schema.Migrations {
+		state, appliedAt := "pending", ""
+		if m.Applied {
+			state = "applied"
+		}
+		if m.Modified {
+			state = "modified"
+		}
+		if m.Unknown {
+			state = "unknown"
+		}
+		if m.AppliedAt != nil {
+			appliedAt = m.AppliedAt.Local().Format("2006-01-02 15:04:05")
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", m.Name, state, appliedAt)
+	}
+	return w.Flush()
+}
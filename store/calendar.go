@@ -0,0 +1,199 @@
+package store
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/he4d/almue-backend/model"
+)
+
+// GetCalendarException returns the calendar exception with the given id
+func (d *Datastore) GetCalendarException(exceptionID int64) (*model.CalendarException, error) {
+	e, err := scanCalendarException(d.q.QueryRow(calendarExceptionByIDStmt, exceptionID))
+	if err != nil {
+		return nil, err
+	}
+	if err := d.loadCalendarDevices([]*model.CalendarException{e}, "WHERE exception_id = ?", exceptionID); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// GetCalendarExceptionList returns all calendar exceptions ordered by their start date
+func (d *Datastore) GetCalendarExceptionList() ([]*model.CalendarException, error) {
+	rows, err := d.q.Query(calendarExceptionsFindAllStmt)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	exceptions := []*model.CalendarException{}
+	for rows.Next() {
+		e, err := scanCalendarException(rows)
+		if err != nil {
+			return nil, err
+		}
+		exceptions = append(exceptions, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	// the rows must be closed before the devices are queried in a transaction
+	rows.Close()
+	if err := d.loadCalendarDevices(exceptions, ""); err != nil {
+		return nil, err
+	}
+	return exceptions, nil
+}
+
+// CreateCalendarException creates a calendar exception with its devices and returns the generated id
+func (d *Datastore) CreateCalendarException(e *model.CalendarException) (int64, error) {
+	c := e.DeepCopy()
+	c.Normalize()
+	var id int64
+	err := d.WithTx(func(tx *Datastore) error {
+		res, err := tx.q.Exec(calendarExceptionCreateStmt,
+			c.Description, c.StartDate, c.EndDate, c.Action, c.ShiftMinutes,
+			strings.Join(c.Jobs, ","), c.AllDevices, c.Source)
+		if err != nil {
+			return err
+		}
+		if id, err = res.LastInsertId(); err != nil {
+			return err
+		}
+		return tx.setCalendarDevices(id, c)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+// UpdateCalendarException updates a calendar exception and replaces its devices.
+// The version of the model must match the stored one, otherwise model.ErrVersionConflict is returned
+func (d *Datastore) UpdateCalendarException(e *model.CalendarException) error {
+	c := e.DeepCopy()
+	c.Normalize()
+	return d.WithTx(func(tx *Datastore) error {
+		res, err := tx.q.Exec(calendarExceptionUpdateStmt,
+			c.Description, c.StartDate, c.EndDate, c.Action, c.ShiftMinutes,
+			strings.Join(c.Jobs, ","), c.AllDevices, c.Source, c.ID, c.Version)
+		if err != nil {
+			return err
+		}
+		if err := checkVersion(res); err != nil {
+			return err
+		}
+		return tx.setCalendarDevices(c.ID, c)
+	})
+}
+
+// DeleteCalendarException deletes the calendar exception with the given id
+func (d *Datastore) DeleteCalendarException(exceptionID int64) error {
+	res, err := d.q.Exec(calendarExceptionDeleteStmt, exceptionID)
+	if err != nil {
+		return err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return fmt.Errorf("Calendar exception with id %d didnt exist", exceptionID)
+	}
+	return err
+}
+
+// loadCalendarDevices sets the shutters and lightings of the exceptions from the link tables
+func (d *Datastore) loadCalendarDevices(exceptions []*model.CalendarException, where string, args ...interface{}) error {
+	byID := map[int64]*model.CalendarException{}
+	for _, e := range exceptions {
+		byID[e.ID] = e
+	}
+	load := func(stmt string, add func(e *model.CalendarException, deviceID int64)) error {
+		rows, err := d.q.Query(stmt+where+" ORDER BY 2", args...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var exceptionID, deviceID int64
+			if err := rows.Scan(&exceptionID, &deviceID); err != nil {
+				return err
+			}
+			if e, ok := byID[exceptionID]; ok {
+				add(e, deviceID)
+			}
+		}
+		return rows.Err()
+	}
+	if err := load(calendarShuttersStmt, func(e *model.CalendarException, id int64) { e.Shutters = append(e.Shutters, id) }); err != nil {
+		return err
+	}
+	return load(calendarLightingsStmt, func(e *model.CalendarException, id int64) { e.Lightings = append(e.Lightings, id) })
+}
+
+// setCalendarDevices replaces the linked devices of the exception
+func (d *Datastore) setCalendarDevices(exceptionID int64, e *model.CalendarException) error {
+	if _, err := d.q.Exec(calendarShuttersDeleteStmt, exceptionID); err != nil {
+		return err
+	}
+	if _, err := d.q.Exec(calendarLightingsDeleteStmt, exceptionID); err != nil {
+		return err
+	}
+	for _, id := range e.Shutters {
+		if _, err := d.q.Exec(calendarShutterInsertStmt, exceptionID, id); err != nil {
+			return err
+		}
+	}
+	for _, id := range e.Lightings {
+		if _, err := d.q.Exec(calendarLightingInsertStmt, exceptionID, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var calendarExceptionByIDStmt = `
+SELECT ` + calendarExceptionColumns + ` FROM calendar_exceptions WHERE id = ?
+`
+
+var calendarExceptionsFindAllStmt = `
+SELECT ` + calendarExceptionColumns + ` FROM calendar_exceptions ORDER BY start_date, id
+`
+
+var calendarExceptionCreateStmt = `
+INSERT INTO calendar_exceptions(description, start_date, end_date, action, shift_minutes, jobs, all_devices, source)
+VALUES(?, ?, ?, ?, ?, ?, ?, ?)
+`
+
+var calendarExceptionUpdateStmt = `
+UPDATE calendar_exceptions SET description = ?, start_date = ?, end_date = ?, action = ?, shift_minutes = ?,
+jobs = ?, all_devices = ?, source = ?, version = version + 1 WHERE id = ? AND version = ?
+`
+
+var calendarExceptionDeleteStmt = `
+DELETE FROM calendar_exceptions WHERE id = ?
+`
+
+var calendarShuttersStmt = `
+SELECT exception_id, shutter_id FROM calendar_shutters `
+
+var calendarLightingsStmt = `
+SELECT exception_id, lighting_id FROM calendar_lightings `
+
+var calendarShuttersDeleteStmt = `
+DELETE FROM calendar_shutters WHERE exception_id = ?
+`
+
+var calendarLightingsDeleteStmt = `
+DELETE FROM calendar_lightings WHERE exception_id = ?
+`
+
+var calendarShutterInsertStmt = `
+INSERT INTO calendar_shutters(exception_id, shutter_id) VALUES(?, ?)
+`
+
+var calendarLightingInsertStmt = `
+INSERT INTO calendar_lightings(exception_id, lighting_id) VALUES(?, ?)
+`
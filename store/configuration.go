@@ -0,0 +1,169 @@
+package store
+
+import (
+	"strings"
+
+	"github.com/he4d/almue-backend/model"
+)
+
+// GetConfiguration returns all floors, rooms, shutters, lightings and calendar exceptions of the store.
+// They are read in one transaction so they are consistent with each other
+func (d *Datastore) GetConfiguration() (*model.Configuration, error) {
+	config := &model.Configuration{}
+	err := d.WithTx(func(tx *Datastore) error {
+		var err error
+		if config.Floors, err = tx.GetFloorList(); err != nil {
+			return err
+		}
+		if config.Rooms, err = tx.GetRoomList(); err != nil {
+			return err
+		}
+		if config.Shutters, err = tx.GetShutterList(); err != nil {
+			return err
+		}
+		if config.Lightings, err = tx.GetLightingList(); err != nil {
+			return err
+		}
+		config.CalendarExceptions, err = tx.GetCalendarExceptionList()
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// ImportConfiguration replaces all floors, rooms, shutters, lightings and calendar exceptions of the store
+// with the given configuration. The ids of the configuration are kept.
+// Either the whole configuration is imported or nothing is changed at all.
+func (d *Datastore) ImportConfiguration(c *model.Configuration) error {
+	return d.WithTx(func(tx *Datastore) error {
+		for _, stmt := range []string{calendarExceptionsDeleteAllStmt, lightingsDeleteAllStmt, shuttersDeleteAllStmt, roomsDeleteAllStmt, floorsDeleteAllStmt} {
+			if _, err := tx.q.Exec(stmt); err != nil {
+				return err
+			}
+		}
+
+		for _, f := range c.Floors {
+			if _, err := tx.q.Exec(floorImportStmt, f.ID, f.Description); err != nil {
+				return err
+			}
+		}
+
+		for _, r := range c.Rooms {
+			if _, err := tx.q.Exec(roomImportStmt, r.ID, r.Description, r.FloorID); err != nil {
+				return err
+			}
+		}
+
+		for _, s := range c.Shutters {
+			if _, err := tx.q.Exec(
+				shutterImportStmt,
+				s.ID, s.Description, s.OpenPin, s.ClosePin, s.CompleteWayInSeconds,
+				s.OpeningInPrc, s.JobsEnabled, s.OpenTime.UTC(), s.CloseTime.UTC(),
+				s.EmergencyEnabled, "stopped", s.Disabled, s.FloorID, s.RoomID); err != nil {
+				return err
+			}
+			if err := tx.setTags(shutterTagLinks, s.ID, s.Tags); err != nil {
+				return err
+			}
+		}
+
+		for _, l := range c.Lightings {
+			if _, err := tx.q.Exec(
+				lightingImportStmt,
+				l.ID, l.Description, l.SwitchPin, l.JobsEnabled,
+				l.OnTime.UTC(), l.OffTime.UTC(), l.EmergencyEnabled,
+				"off", l.Disabled, l.FloorID, l.RoomID); err != nil {
+				return err
+			}
+			if err := tx.setTags(lightingTagLinks, l.ID, l.Tags); err != nil {
+				return err
+			}
+		}
+
+		for _, exception := range c.CalendarExceptions {
+			e := exception.DeepCopy()
+			e.Normalize()
+			if _, err := tx.q.Exec(calendarExceptionImportStmt,
+				e.ID, e.Description, e.StartDate, e.EndDate, e.Action, e.ShiftMinutes,
+				strings.Join(e.Jobs, ","), e.AllDevices, e.Source); err != nil {
+				return err
+			}
+			if err := tx.setCalendarDevices(e.ID, e); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+var calendarExceptionsDeleteAllStmt = `
+DELETE FROM calendar_exceptions
+`
+
+var floorsDeleteAllStmt = `
+DELETE FROM floors
+`
+
+var roomsDeleteAllStmt = `
+DELETE FROM rooms
+`
+
+var shuttersDeleteAllStmt = `
+DELETE FROM shutters
+`
+
+var lightingsDeleteAllStmt = `
+DELETE FROM lightings
+`
+
+var floorImportStmt = `
+INSERT INTO floors(id, description) VALUES(?, ?)
+`
+
+var roomImportStmt = `
+INSERT INTO rooms(id, description, floor_id) VALUES(?, ?, ?)
+`
+
+var shutterImportStmt = `
+INSERT INTO shutters(
+id,
+description,
+open_pin,
+close_pin,
+complete_way_in_seconds,
+opening_in_prc,
+jobs_enabled,
+open_time,
+close_time,
+emergency_enabled,
+device_status,
+disabled,
+floor_id,
+room_id
+)
+VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+`
+
+var lightingImportStmt = `
+INSERT INTO lightings(
+id,
+description,
+switch_pin,
+jobs_enabled,
+on_time,
+off_time,
+emergency_enabled,
+device_status,
+disabled,
+floor_id,
+room_id
+)
+VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+`
+
+var calendarExceptionImportStmt = `
+INSERT INTO calendar_exceptions(id, description, start_date, end_date, action, shift_minutes, jobs, all_devices, source)
+VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?)
+`
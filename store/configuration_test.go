@@ -0,0 +1,77 @@
+package store
+
+import (
+	"testing"
+
+	"github.com/he4d/almue-backend/model"
+)
+
+func TestImportConfiguration(t *testing.T) {
+	clearTable()
+
+	floorDescr := "erdgeschoss"
+	shutterDescr := "kueche"
+	lightingDescr := "flur"
+	floorID := int64(7)
+	openPin, closePin, switchPin, completeWay := 2, 3, 4, 20
+
+	config := &model.Configuration{
+		Floors: []*model.Floor{
+			{Base: model.Base{ID: floorID}, Description: &floorDescr},
+		},
+		Shutters: []*model.Shutter{
+			{Base: model.Base{ID: 3}, Description: &shutterDescr, OpenPin: &openPin, ClosePin: &closePin,
+				CompleteWayInSeconds: &completeWay, FloorID: &floorID},
+		},
+		Lightings: []*model.Lighting{
+			{Base: model.Base{ID: 5}, Description: &lightingDescr, SwitchPin: &switchPin, FloorID: &floorID},
+		},
+	}
+
+	if err := store.ImportConfiguration(config); err != nil {
+		t.Fatalf("Could not import the configuration: %v", err)
+	}
+
+	exported, err := store.GetConfiguration()
+	if err != nil {
+		t.Fatalf("Could not get the configuration: %v", err)
+	}
+	if len(exported.Floors) != 1 || exported.Floors[0].ID != floorID {
+		t.Errorf("Expected the floor with id %d but got %v", floorID, exported.Floors)
+	}
+	if len(exported.Shutters) != 1 || exported.Shutters[0].ID != 3 || *exported.Shutters[0].OpenPin != openPin {
+		t.Errorf("Expected the imported shutter but got %v", exported.Shutters)
+	}
+	if len(exported.Lightings) != 1 || exported.Lightings[0].ID != 5 || *exported.Lightings[0].SwitchPin != switchPin {
+		t.Errorf("Expected the imported lighting but got %v", exported.Lightings)
+	}
+}
+
+func TestImportConfigurationRollback(t *testing.T) {
+	clearTable()
+
+	descr := "obergeschoss"
+	if _, err := store.Exec("INSERT INTO floors(description) VALUES(?)", descr); err != nil {
+		t.Fatalf("Could not create the init floor: %v", err)
+	}
+
+	duplicate := "keller"
+	config := &model.Configuration{
+		Floors: []*model.Floor{
+			{Base: model.Base{ID: 1}, Description: &duplicate},
+			{Base: model.Base{ID: 2}, Description: &duplicate},
+		},
+	}
+
+	if err := store.ImportConfiguration(config); err == nil {
+		t.Fatal("Expected an error on importing duplicate floor descriptions")
+	}
+
+	floors, err := store.GetFloorList()
+	if err != nil {
+		t.Fatalf("Could not get the floor list %v", err)
+	}
+	if len(floors) != 1 || *floors[0].Description != descr {
+		t.Errorf("Expected the previous floor after a failed import but got %v", floors)
+	}
+}
@@ -0,0 +1,41 @@
+package store
+
+import (
+	"fmt"
+	"io/ioutil"
+	"testing"
+
+	"github.com/he4d/almue-backend/almue"
+	"github.com/he4d/almue-backend/storetest"
+	"github.com/he4d/simplejack"
+)
+
+// conformanceStore lets the transactions of the datastore satisfy almue.DeviceStore
+type conformanceStore struct {
+	*Datastore
+}
+
+func (s conformanceStore) WithTx(fn func(tx almue.DeviceStore) error) error {
+	return s.Datastore.WithTx(func(tx *Datastore) error {
+		return fn(conformanceStore{tx})
+	})
+}
+
+func TestConformance(t *testing.T) {
+	opened := []*Datastore{}
+	defer func() {
+		for _, s := range opened {
+			s.Close()
+		}
+	}()
+
+	storetest.Run(t, func(t *testing.T) storetest.Store {
+		dsn := fmt.Sprintf("file:conformance_%d?mode=memory&cache=shared", len(opened))
+		s, err := New(dsn, simplejack.New(simplejack.TRACE, ioutil.Discard))
+		if err != nil {
+			t.Fatalf("Could not create the in-memory store: %v", err)
+		}
+		opened = append(opened, s)
+		return conformanceStore{s}
+	})
+}
@@ -8,18 +8,30 @@ import (
 
 // GetFloor returns the floor with the given id
 func (d *Datastore) GetFloor(floorID int64) (*model.Floor, error) {
-	floor := &model.Floor{}
-	err := d.QueryRow(floorFindIDStmt,
-		floorID).Scan(&floor.ID, &floor.Created, &floor.Modified, &floor.Description)
-	if err != nil {
-		return nil, err
-	}
-	return floor, err
+	return scanFloor(d.q.QueryRow(floorFindIDStmt, floorID))
 }
 
 // GetFloorList returns all the floor in the database
 func (d *Datastore) GetFloorList() ([]*model.Floor, error) {
-	rows, err := d.Query(floorsFindAllStmt)
+	return d.FindFloors(&model.ListOptions{})
+}
+
+// FindFloors returns the floors in the order and page of the list options.
+// Floors can only be searched by their description, the filters of devices are ignored
+func (d *Datastore) FindFloors(opts *model.ListOptions) ([]*model.Floor, error) {
+	floorOpts := &model.ListOptions{
+		Search:     opts.Search,
+		Sort:       opts.Sort,
+		Descending: opts.Descending,
+		Limit:      opts.Limit,
+		Cursor:     opts.Cursor,
+	}
+	stmt, args, err := listStmt(floorsFindAllStmt, floorOpts, floorSortColumns, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := d.q.Query(stmt, args...)
 
 	if err != nil {
 		return nil, err
@@ -30,18 +42,18 @@ func (d *Datastore) GetFloorList() ([]*model.Floor, error) {
 	floors := []*model.Floor{}
 
 	for rows.Next() {
-		var f model.Floor
-		if err := rows.Scan(&f.ID, &f.Created, &f.Modified, &f.Description); err != nil {
+		f, err := scanFloor(rows)
+		if err != nil {
 			return nil, err
 		}
-		floors = append(floors, &f)
+		floors = append(floors, f)
 	}
-	return floors, err
+	return floors, rows.Err()
 }
 
 // CreateFloor creates a floor in the database and returns the generated id
 func (d *Datastore) CreateFloor(f *model.Floor) (int64, error) {
-	res, err := d.Exec(
+	res, err := d.q.Exec(
 		floorCreateStmt,
 		f.Description)
 	if err != nil {
@@ -56,7 +68,7 @@ func (d *Datastore) CreateFloor(f *model.Floor) (int64, error) {
 
 // DeleteFloor deletes a floor with the given id
 func (d *Datastore) DeleteFloor(floorID int64) error {
-	res, err := d.Exec(floorDeleteStmt, floorID)
+	res, err := d.q.Exec(floorDeleteStmt, floorID)
 	if err != nil {
 		return err
 	}
@@ -70,19 +82,23 @@ func (d *Datastore) DeleteFloor(floorID int64) error {
 	return err
 }
 
-// UpdateFloor updates an existing floor
+// UpdateFloor updates an existing floor.
+// The version of the model must match the stored one, otherwise model.ErrVersionConflict is returned
 func (d *Datastore) UpdateFloor(f *model.Floor) error {
-	_, err :=
-		d.Exec(floorUpdateStmt, f.Description, f.ID)
-	return err
+	res, err :=
+		d.q.Exec(floorUpdateStmt, f.Description, f.ID, f.Version)
+	if err != nil {
+		return err
+	}
+	return checkVersion(res)
 }
 
 var floorFindIDStmt = `
-SELECT * FROM floors WHERE id = ?
+SELECT ` + floorColumns + ` FROM floors WHERE id = ?
 `
 
 var floorsFindAllStmt = `
-SELECT * FROM floors
+SELECT ` + floorColumns + ` FROM floors
 `
 
 var floorCreateStmt = `
@@ -90,7 +106,7 @@ INSERT INTO floors(description) VALUES(?)
 `
 
 var floorUpdateStmt = `
-UPDATE floors SET description = ? WHERE id = ?
+UPDATE floors SET description = ?, version = version + 1 WHERE id = ? AND version = ?
 `
 
 var floorDeleteStmt = `
@@ -5,6 +5,7 @@ import (
 	"log"
 	"testing"
 
+	"github.com/he4d/almue-backend/model"
 	_ "github.com/mattn/go-sqlite3"
 )
 
@@ -75,6 +76,38 @@ func TestGetFloorList(t *testing.T) {
 	}
 }
 
+func TestUpdateFloorVersion(t *testing.T) {
+	clearTable()
+
+	descr := "obergeschoss"
+	id, err := store.CreateFloor(&model.Floor{Description: &descr})
+	if err != nil {
+		t.Fatalf("Could not create the init floor: %v", err)
+	}
+	floor, err := store.GetFloor(id)
+	if err != nil {
+		t.Fatalf("Could not get the floor: %v", err)
+	}
+	stale := floor.DeepCopy()
+
+	newDescr := "dachgeschoss"
+	floor.Description = &newDescr
+	if err := store.UpdateFloor(floor); err != nil {
+		t.Fatalf("Could not update the floor: %v", err)
+	}
+	updated, err := store.GetFloor(id)
+	if err != nil {
+		t.Fatalf("Could not get the updated floor: %v", err)
+	}
+	if updated.Version != stale.Version+1 {
+		t.Errorf("Expected the version %d after the update but got %d", stale.Version+1, updated.Version)
+	}
+
+	if err := store.UpdateFloor(stale); err != model.ErrVersionConflict {
+		t.Errorf("Expected a version conflict on updating a stale floor but got %v", err)
+	}
+}
+
 func clearTable() {
 	_, err := store.Exec("DELETE FROM floors")
 	if err != nil {
@@ -0,0 +1,52 @@
+package store
+
+import (
+	"time"
+
+	"github.com/he4d/almue-backend/model"
+)
+
+// AddDeviceEvent records the state change of a device.
+// The time is stored in UTC with the precision of seconds, so the events can be compared by their time
+func (d *Datastore) AddDeviceEvent(event *model.DeviceEvent) error {
+	_, err := d.q.Exec(deviceEventInsertStmt,
+		event.DeviceType, event.DeviceID, event.State, event.Time.UTC().Truncate(time.Second))
+	return err
+}
+
+// FindDeviceEvents returns the events of all devices since the given time, ordered by their time
+func (d *Datastore) FindDeviceEvents(since time.Time) ([]*model.DeviceEvent, error) {
+	rows, err := d.q.Query(deviceEventsSinceStmt, since.UTC().Truncate(time.Second))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []*model.DeviceEvent{}
+	for rows.Next() {
+		e := new(model.DeviceEvent)
+		if err := rows.Scan(&e.DeviceType, &e.DeviceID, &e.State, &e.Time); err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
+
+// DeleteDeviceEvents deletes all events that are older than the given time
+func (d *Datastore) DeleteDeviceEvents(before time.Time) error {
+	_, err := d.q.Exec(deviceEventsDeleteStmt, before.UTC().Truncate(time.Second))
+	return err
+}
+
+var deviceEventInsertStmt = `
+INSERT INTO device_events (device_type, device_id, state, time) VALUES (?, ?, ?, ?)
+`
+
+var deviceEventsSinceStmt = `
+SELECT device_type, device_id, state, time FROM device_events WHERE time >= ? ORDER BY time, id
+`
+
+var deviceEventsDeleteStmt = `
+DELETE FROM device_events WHERE time < ?
+`
@@ -8,34 +8,22 @@ import (
 
 // GetLightingListOfFloor returns all lightings of a floor with the given floor id
 func (d *Datastore) GetLightingListOfFloor(floorID int64) ([]*model.Lighting, error) {
-	rows, err := d.Query(lightingsOfFloorStmt, floorID)
+	return d.FindLightings(&model.ListOptions{FloorID: &floorID})
+}
+
+// GetLightingList returns all lightings of the database
+func (d *Datastore) GetLightingList() ([]*model.Lighting, error) {
+	return d.FindLightings(&model.ListOptions{})
+}
 
+// FindLightings returns the lightings that match the filters of the list options in their order and page
+func (d *Datastore) FindLightings(opts *model.ListOptions) ([]*model.Lighting, error) {
+	stmt, args, err := listStmt(lightingsFindAllStmt, opts, lightingSortColumns, lightingTagLinks)
 	if err != nil {
 		return nil, err
 	}
 
-	defer rows.Close()
-
-	lightings := []*model.Lighting{}
-
-	for rows.Next() {
-		l := new(model.Lighting)
-		if err := rows.Scan(
-			&l.ID, &l.Created, &l.Modified, &l.Description,
-			&l.SwitchPin, &l.JobsEnabled, &l.OnTime, &l.OffTime,
-			&l.EmergencyEnabled, &l.DeviceStatus, &l.Disabled,
-			&l.FloorID); err != nil {
-			return nil, err
-		}
-		lightings = append(lightings, l)
-	}
-
-	return lightings, err
-}
-
-// GetLightingList returns all lightings of the database
-func (d *Datastore) GetLightingList() ([]*model.Lighting, error) {
-	rows, err := d.Query(lightingsFindAllStmt)
+	rows, err := d.q.Query(stmt, args...)
 
 	if err != nil {
 		return nil, err
@@ -46,41 +34,58 @@ func (d *Datastore) GetLightingList() ([]*model.Lighting, error) {
 	lightings := []*model.Lighting{}
 
 	for rows.Next() {
-		l := new(model.Lighting)
-		if err := rows.Scan(
-			&l.ID, &l.Created, &l.Modified, &l.Description,
-			&l.SwitchPin, &l.JobsEnabled, &l.OnTime, &l.OffTime,
-			&l.EmergencyEnabled, &l.DeviceStatus, &l.Disabled,
-			&l.FloorID); err != nil {
+		l, err := scanLighting(rows)
+		if err != nil {
 			return nil, err
 		}
 		lightings = append(lightings, l)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
 
-	return lightings, err
+	ids := []int64{}
+	for _, l := range lightings {
+		ids = append(ids, l.ID)
+	}
+	tags, err := d.tagsOfDevices(lightingTagLinks, ids)
+	if err != nil {
+		return nil, err
+	}
+	for _, l := range lightings {
+		l.Tags = model.SortTags(tags[l.ID])
+	}
+	return lightings, nil
 }
 
-// CreateLighting creates a new lighting in the database and returns the generated id
+// CreateLighting creates a new lighting with its tags in the database and returns the generated id.
+// If the pin of the lighting is assigned to another device a *model.PinConflictError is returned
 func (d *Datastore) CreateLighting(l *model.Lighting) (int64, error) {
-	res, err := d.Exec(
-		lightingCreateStmt,
-		l.Description, l.SwitchPin, l.JobsEnabled,
-		l.OnTime.UTC(), l.OffTime.UTC(), l.EmergencyEnabled,
-		"off", l.Disabled, l.FloorID)
-
-	if err != nil {
-		return 0, err
-	}
-	id, err := res.LastInsertId()
+	var id int64
+	err := d.WithTx(func(tx *Datastore) error {
+		res, err := tx.q.Exec(
+			lightingCreateStmt,
+			l.Description, l.SwitchPin, l.JobsEnabled,
+			l.OnTime.UTC(), l.OffTime.UTC(), l.EmergencyEnabled,
+			"off", l.Disabled, l.FloorID, l.RoomID)
+		if err != nil {
+			return tx.pinConflict(err, model.DeviceTypeLighting, 0, l.SwitchPin)
+		}
+		if id, err = res.LastInsertId(); err != nil {
+			return err
+		}
+		return tx.setTags(lightingTagLinks, id, l.Tags)
+	})
 	if err != nil {
 		return 0, err
 	}
-	return id, err
+	return id, nil
 }
 
 // DeleteLighting deletes the lighting with the given id from the database
 func (d *Datastore) DeleteLighting(lightingID int64) error {
-	res, err := d.Exec(lightingDeleteStmt, lightingID)
+	res, err := d.q.Exec(lightingDeleteStmt, lightingID)
 	if err != nil {
 		return err
 	}
@@ -94,46 +99,63 @@ func (d *Datastore) DeleteLighting(lightingID int64) error {
 	return err
 }
 
-// UpdateLighting updates the lighting in the database according to the given model
+// UpdateLighting updates the lighting and replaces its tags in the database according to the given model.
+// The state and the fault are kept, they are only changed by the device controller.
+// The version of the model must match the stored one, otherwise model.ErrVersionConflict is returned.
+// If the pin of the lighting is assigned to another device a *model.PinConflictError is returned
 func (d *Datastore) UpdateLighting(l *model.Lighting) error {
-	_, err :=
-		d.Exec(
-			lightingUpdateStmt,
-			l.Description, l.SwitchPin,
-			l.JobsEnabled, l.OnTime.UTC(), l.OffTime.UTC(), l.EmergencyEnabled,
-			l.DeviceStatus, l.Disabled, l.FloorID, l.ID)
-	return err
+	return d.WithTx(func(tx *Datastore) error {
+		res, err :=
+			tx.q.Exec(
+				lightingUpdateStmt,
+				l.Description, l.SwitchPin,
+				l.JobsEnabled, l.OnTime.UTC(), l.OffTime.UTC(), l.EmergencyEnabled,
+				l.Disabled, l.FloorID, l.RoomID, l.ID, l.Version)
+		if err != nil {
+			return tx.pinConflict(err, model.DeviceTypeLighting, l.ID, l.SwitchPin)
+		}
+		if err := checkVersion(res); err != nil {
+			return err
+		}
+		return tx.setTags(lightingTagLinks, l.ID, l.Tags)
+	})
 }
 
 // UpdateLightingState updates the state of a lighting
 func (d *Datastore) UpdateLightingState(lightingID int64, newState string) error {
 	_, err :=
-		d.Exec(lightingStateUpdateStmt, newState, lightingID)
+		d.q.Exec(lightingStateUpdateStmt, newState, lightingID)
+	return err
+}
+
+// UpdateLightingFault sets the fault of the lighting with the given id and its state to fault.
+// A nil fault clears the fault, the state is then set by the next state update
+func (d *Datastore) UpdateLightingFault(lightingID int64, fault *model.DeviceFault) error {
+	if fault == nil {
+		_, err := d.q.Exec(lightingFaultClearStmt, lightingID)
+		return err
+	}
+	_, err :=
+		d.q.Exec(lightingFaultUpdateStmt, model.DeviceStatusFault, fault.Message, fault.Time.UTC(), lightingID)
 	return err
 }
 
 // GetLighting returns the lighting with the provided id
 func (d *Datastore) GetLighting(lightingID int64) (*model.Lighting, error) {
-	l := new(model.Lighting)
-
-	err := d.QueryRow(lightingByIDStmt, lightingID).Scan(
-		&l.ID, &l.Created, &l.Modified, &l.Description,
-		&l.SwitchPin, &l.JobsEnabled, &l.OnTime, &l.OffTime,
-		&l.EmergencyEnabled, &l.DeviceStatus, &l.Disabled,
-		&l.FloorID)
-
+	l, err := scanLighting(d.q.QueryRow(lightingByIDStmt, lightingID))
+	if err != nil {
+		return nil, err
+	}
+	tags, err := d.tagsOf(lightingTagLinks.selectDevice, lightingID)
 	if err != nil {
 		return nil, err
 	}
-	return l, err
+	l.Tags = model.SortTags(tags[lightingID])
+	return l, nil
 }
 
-var lightingsOfFloorStmt = `
-SELECT * FROM lightings WHERE floor_id = ?
-`
-
 var lightingsFindAllStmt = `
-SELECT * FROM lightings
+SELECT ` + lightingColumns + ` FROM lightings
 `
 
 var lightingStateUpdateStmt = `
@@ -142,8 +164,23 @@ device_status = ?
 WHERE id = ?
 `
 
+var lightingFaultUpdateStmt = `
+UPDATE lightings SET
+device_status = ?,
+fault_message = ?,
+fault_time = ?
+WHERE id = ?
+`
+
+var lightingFaultClearStmt = `
+UPDATE lightings SET
+fault_message = NULL,
+fault_time = NULL
+WHERE id = ?
+`
+
 var lightingByIDStmt = `
-SELECT * FROM lightings WHERE id = ?
+SELECT ` + lightingColumns + ` FROM lightings WHERE id = ?
 `
 
 var lightingCreateStmt = `
@@ -156,9 +193,10 @@ off_time,
 emergency_enabled,
 device_status,
 disabled,
-floor_id
+floor_id,
+room_id
 ) 
-VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?)
+VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 `
 
 var lightingUpdateStmt = `
@@ -169,10 +207,11 @@ jobs_enabled = ?,
 on_time = ?,
 off_time = ?,
 emergency_enabled = ?,
-device_status = ?,
 disabled = ?,
-floor_id = ?  
-WHERE id = ?
+floor_id = ?,
+room_id = ?,
+version = version + 1
+WHERE id = ? AND version = ?
 `
 
 var lightingDeleteStmt = `
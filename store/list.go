@@ -0,0 +1,219 @@
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/he4d/almue-backend/model"
+)
+
+// The sort columns map the sortable json fields of the models to their columns
+var floorSortColumns = map[string]string{
+	"id":          "id",
+	"created":     "created",
+	"modified":    "modified",
+	"description": "description",
+}
+
+var roomSortColumns = map[string]string{
+	"id":          "id",
+	"created":     "created",
+	"modified":    "modified",
+	"description": "description",
+	"floorId":     "floor_id",
+}
+
+var shutterSortColumns = map[string]string{
+	"id":           "id",
+	"created":      "created",
+	"modified":     "modified",
+	"description":  "description",
+	"openingInPrc": "opening_in_prc",
+	"jobsEnabled":  "jobs_enabled",
+	"openTime":     "open_time",
+	"closeTime":    "close_time",
+	"deviceStatus": "device_status",
+	"disabled":     "disabled",
+	"floorId":      "floor_id",
+}
+
+var lightingSortColumns = map[string]string{
+	"id":           "id",
+	"created":      "created",
+	"modified":     "modified",
+	"description":  "description",
+	"jobsEnabled":  "jobs_enabled",
+	"onTime":       "on_time",
+	"offTime":      "off_time",
+	"deviceStatus": "device_status",
+	"disabled":     "disabled",
+	"floorId":      "floor_id",
+}
+
+// timeColumns are sorted and compared by their time, the driver and the default values of sqlite
+// store times in different text formats
+var timeColumns = map[string]bool{
+	"created":    true,
+	"modified":   true,
+	"open_time":  true,
+	"close_time": true,
+	"on_time":    true,
+	"off_time":   true,
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// listStmt appends the filters, the order and the page of the list options to the select statement.
+// All values are passed as parameters, only the whitelisted sort columns are part of the statement.
+// The page of a cursor starts after the sort value and id of the cursor (keyset paging), a backward page
+// is queried in the reversed order and turned around again. The tag filter is only applied to models with tag links
+func listStmt(selectStmt string, opts *model.ListOptions, sortColumns map[string]string, links *tagLinks) (string, []interface{}, error) {
+	column := "id"
+	if opts.Sort != "" {
+		var ok bool
+		if column, ok = sortColumns[opts.Sort]; !ok {
+			return "", nil, &model.ListOptionsError{Option: "sort", Value: opts.Sort}
+		}
+	}
+	if opts.Limit < 0 {
+		return "", nil, &model.ListOptionsError{Option: "limit", Value: fmt.Sprint(opts.Limit)}
+	}
+	sortExpr := column
+	if timeColumns[column] {
+		sortExpr = fmt.Sprintf("datetime(%s)", column)
+	}
+	backward := opts.Cursor != nil && opts.Cursor.Backward
+	direction := "ASC"
+	if opts.Descending != backward {
+		direction = "DESC"
+	}
+
+	where := []string{}
+	args := []interface{}{}
+	if opts.FloorID != nil {
+		where = append(where, "floor_id = ?")
+		args = append(args, *opts.FloorID)
+	}
+	if len(opts.FloorIDs) > 0 {
+		where = append(where, "floor_id IN ("+placeholders(len(opts.FloorIDs))+")")
+		for _, id := range opts.FloorIDs {
+			args = append(args, id)
+		}
+	}
+	if opts.RoomID != nil {
+		where = append(where, "room_id = ?")
+		args = append(args, *opts.RoomID)
+	}
+	if opts.Disabled != nil {
+		where = append(where, "disabled = ?")
+		args = append(args, *opts.Disabled)
+	}
+	if opts.DeviceStatus != nil {
+		where = append(where, "device_status = ?")
+		args = append(args, *opts.DeviceStatus)
+	}
+	if opts.JobsEnabled != nil {
+		where = append(where, "jobs_enabled = ?")
+		args = append(args, *opts.JobsEnabled)
+	}
+	if opts.Tag != "" && links != nil {
+		where = append(where, links.filter)
+		args = append(args, opts.Tag)
+	}
+	if opts.Search != "" {
+		where = append(where, `description LIKE ? ESCAPE '\'`)
+		args = append(args, "%"+likeEscaper.Replace(opts.Search)+"%")
+	}
+	if opts.Cursor != nil {
+		value, err := cursorValue(opts.Cursor, column)
+		if err != nil {
+			return "", nil, err
+		}
+		// the page follows the cursor in the order of the statement
+		operator := ">"
+		if direction == "DESC" {
+			operator = "<"
+		}
+		switch {
+		case column == "id":
+			where = append(where, "id "+operator+" ?")
+			args = append(args, opts.Cursor.ID)
+		// sqlite sorts NULL before all values, so the models with a NULL sort value
+		// come first in an ascending and last in a descending order
+		case value == nil && operator == ">":
+			where = append(where, fmt.Sprintf("(%s IS NOT NULL OR id > ?)", sortExpr))
+			args = append(args, opts.Cursor.ID)
+		case value == nil:
+			where = append(where, fmt.Sprintf("(%s IS NULL AND id < ?)", sortExpr))
+			args = append(args, opts.Cursor.ID)
+		case operator == ">":
+			where = append(where, fmt.Sprintf("(%s, id) > (?, ?)", sortExpr))
+			args = append(args, value, opts.Cursor.ID)
+		default:
+			where = append(where, fmt.Sprintf("((%s, id) < (?, ?) OR %s IS NULL)", sortExpr, sortExpr))
+			args = append(args, value, opts.Cursor.ID)
+		}
+	}
+
+	stmt := strings.TrimSpace(selectStmt)
+	if len(where) > 0 {
+		stmt += " WHERE " + strings.Join(where, " AND ")
+	}
+	orderBy := func(direction string) string {
+		order := fmt.Sprintf(" ORDER BY %s %s", sortExpr, direction)
+		if column != "id" {
+			// the id makes the order of equal values stable between the pages
+			order += fmt.Sprintf(", id %s", direction)
+		}
+		return order
+	}
+	stmt += orderBy(direction)
+	if opts.Limit > 0 {
+		stmt += " LIMIT ?"
+		args = append(args, opts.Limit)
+	}
+	if backward {
+		listDirection := "ASC"
+		if opts.Descending {
+			listDirection = "DESC"
+		}
+		stmt = "SELECT * FROM (" + stmt + ")" + orderBy(listDirection)
+	}
+	return stmt, args, nil
+}
+
+// placeholders returns n comma separated parameter placeholders
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
+
+// cursorValue returns the sort value of the cursor as parameter for the sort column, nil for a NULL value
+func cursorValue(cursor *model.ListCursor, column string) (interface{}, error) {
+	invalid := &model.ListOptionsError{Option: "cursor", Value: string(cursor.Value)}
+	var value interface{}
+	if err := json.Unmarshal(cursor.Value, &value); err != nil {
+		return nil, invalid
+	}
+	switch v := value.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		if !timeColumns[column] {
+			return v, nil
+		}
+		t, err := time.Parse(time.RFC3339Nano, v)
+		if err != nil {
+			return nil, invalid
+		}
+		// the format of the datetime function of sqlite
+		return t.UTC().Format("2006-01-02 15:04:05"), nil
+	case float64, bool:
+		if timeColumns[column] {
+			return nil, invalid
+		}
+		return v, nil
+	}
+	return nil, invalid
+}
@@ -0,0 +1,190 @@
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/he4d/almue-backend/model"
+)
+
+func TestFindLightings(t *testing.T) {
+	clearTable()
+
+	floorDescr := "erdgeschoss"
+	groundFloor, err := store.CreateFloor(&model.Floor{Description: &floorDescr})
+	if err != nil {
+		t.Fatal(err)
+	}
+	floorDescr = "obergeschoss"
+	upperFloor, err := store.CreateFloor(&model.Floor{Description: &floorDescr})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lightings := []struct {
+		description string
+		floorID     int64
+		disabled    bool
+	}{
+		{"Kueche", groundFloor, false},
+		{"Flur", groundFloor, true},
+		{"Bad 100%", upperFloor, false},
+		{"Bad_oben", upperFloor, false},
+	}
+	ids := []int64{}
+	for i, l := range lightings {
+		description, pin, floorID := l.description, i+2, l.floorID
+		id, err := store.CreateLighting(&model.Lighting{
+			Description: &description, SwitchPin: &pin, Disabled: l.disabled, FloorID: &floorID})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+
+	enabled := false
+	tests := []struct {
+		name string
+		opts model.ListOptions
+		want []string
+	}{
+		{"all", model.ListOptions{}, []string{"Kueche", "Flur", "Bad 100%", "Bad_oben"}},
+		{"floor", model.ListOptions{FloorID: &upperFloor}, []string{"Bad 100%", "Bad_oben"}},
+		{"disabled", model.ListOptions{Disabled: &enabled}, []string{"Kueche", "Bad 100%", "Bad_oben"}},
+		{"search ignores the case", model.ListOptions{Search: "bad"}, []string{"Bad 100%", "Bad_oben"}},
+		{"search escapes wildcards", model.ListOptions{Search: "%"}, []string{"Bad 100%"}},
+		{"search escapes underscores", model.ListOptions{Search: "_"}, []string{"Bad_oben"}},
+		{"sort", model.ListOptions{Sort: "description"}, []string{"Bad 100%", "Bad_oben", "Flur", "Kueche"}},
+		{"sort descending", model.ListOptions{Sort: "floorId", Descending: true}, []string{"Bad_oben", "Bad 100%", "Flur", "Kueche"}},
+		{"page", model.ListOptions{Sort: "description", Limit: 2,
+			Cursor: &model.ListCursor{Value: []byte(`"Bad 100%"`), ID: ids[2]}}, []string{"Bad_oben", "Flur"}},
+		{"page before the cursor", model.ListOptions{Sort: "description", Limit: 2,
+			Cursor: &model.ListCursor{Value: []byte(`"Kueche"`), ID: ids[0], Backward: true}}, []string{"Bad_oben", "Flur"}},
+		{"cursor without limit", model.ListOptions{Cursor: &model.ListCursor{Value: []byte(fmt.Sprint(ids[2])), ID: ids[2]}}, []string{"Bad_oben"}},
+		{"page of a time", model.ListOptions{Sort: "created", Descending: true, Limit: 1,
+			Cursor: &model.ListCursor{Value: []byte(`"2999-01-01T00:00:00Z"`), ID: 0}}, []string{"Bad_oben"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			found, err := store.FindLightings(&tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := []string{}
+			for _, l := range found {
+				got = append(got, *l.Description)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("Expected %v but got %v", tt.want, got)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("Expected %v but got %v", tt.want, got)
+				}
+			}
+		})
+	}
+}
+
+func TestFindWithInvalidSort(t *testing.T) {
+	// the sort field becomes part of the statement so only whitelisted fields are accepted
+	for _, sort := range []string{"openPin; DROP TABLE floors", "switchPin", "floor_id"} {
+		_, err := store.FindLightings(&model.ListOptions{Sort: sort})
+		if _, ok := err.(*model.ListOptionsError); !ok {
+			t.Errorf("Expected a ListOptionsError for the sort %q but got %v", sort, err)
+		}
+	}
+	if _, err := store.FindFloors(&model.ListOptions{Sort: "openingInPrc"}); err == nil {
+		t.Error("Expected an error for a shutter field as sort of the floors")
+	}
+}
+
+func TestFindQueriesTheTagsOfThePage(t *testing.T) {
+	clearTable()
+	defer func(max int) { maxTagQueryDevices = max }(maxTagQueryDevices)
+	maxTagQueryDevices = 2
+
+	floorDescr := "erdgeschoss"
+	floorID, err := store.CreateFloor(&model.Floor{Description: &floorDescr})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[int64]string{}
+	for i, tag := range []string{"abends", "bad", "flur", "kueche", "morgens"} {
+		description, pin := tag, i+2
+		id, err := store.CreateLighting(&model.Lighting{Description: &description, SwitchPin: &pin, FloorID: &floorID, Tags: []string{tag}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		want[id] = tag
+	}
+
+	// the tags of five lightings are queried in three statements
+	for _, opts := range []*model.ListOptions{{}, {Limit: 3}} {
+		lightings, err := store.FindLightings(opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, l := range lightings {
+			if len(l.Tags) != 1 || l.Tags[0] != want[l.ID] {
+				t.Errorf("Expected lighting %d to have the tag %s but got %v", l.ID, want[l.ID], l.Tags)
+			}
+		}
+	}
+}
+
+func TestFindPagesOverNullValues(t *testing.T) {
+	clearTable()
+
+	floorDescr := "erdgeschoss"
+	floorID, err := store.CreateFloor(&model.Floor{Description: &floorDescr})
+	if err != nil {
+		t.Fatal(err)
+	}
+	bath, hall := "bad", "flur"
+	for i, description := range []*string{&hall, nil, &bath, nil} {
+		pin := i + 2
+		if _, err := store.CreateLighting(&model.Lighting{Description: description, SwitchPin: &pin, FloorID: &floorID}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, descending := range []bool{false, true} {
+		all, err := store.FindLightings(&model.ListOptions{Sort: "description", Descending: descending})
+		if err != nil {
+			t.Fatal(err)
+		}
+		// the cursors of the pages of one lighting lead over the whole list and back
+		var cursor *model.ListCursor
+		for i := range all {
+			page, err := store.FindLightings(&model.ListOptions{Sort: "description", Descending: descending, Limit: 1, Cursor: cursor})
+			if err != nil {
+				t.Fatalf("Could not find page %d of the descending %t list: %v", i, descending, err)
+			}
+			if len(page) != 1 || page[0].ID != all[i].ID {
+				t.Fatalf("Expected lighting %d on page %d of the descending %t list but got %v", all[i].ID, i, descending, page)
+			}
+			cursor = lightingCursor(t, page[0], false)
+		}
+		cursor.Backward = true
+		for i := len(all) - 2; i >= 0; i-- {
+			page, err := store.FindLightings(&model.ListOptions{Sort: "description", Descending: descending, Limit: 1, Cursor: cursor})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(page) != 1 || page[0].ID != all[i].ID {
+				t.Fatalf("Expected lighting %d on the backward page %d of the descending %t list but got %v", all[i].ID, i, descending, page)
+			}
+			cursor = lightingCursor(t, page[0], true)
+		}
+	}
+}
+
+func lightingCursor(t *testing.T, l *model.Lighting, backward bool) *model.ListCursor {
+	value, err := json.Marshal(l.Description)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &model.ListCursor{Value: value, ID: l.ID, Backward: backward}
+}
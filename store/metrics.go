@@ -0,0 +1,74 @@
+package store
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/he4d/almue-backend/metrics"
+)
+
+var queryDuration = metrics.Default.NewHistogram("almue_store_query_duration_seconds",
+	"Duration of the queries of the sqlite store by operation and table.", metrics.DefaultBuckets, "operation", "table")
+
+// timedQueryer observes the duration of every statement. The duration of a query
+// ends when its rows are returned, reading the rows is not included
+type timedQueryer struct {
+	q queryer
+}
+
+func (t timedQueryer) Exec(query string, args ...interface{}) (sql.Result, error) {
+	defer observeQuery(query, time.Now())
+	return t.q.Exec(query, args...)
+}
+
+func (t timedQueryer) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	defer observeQuery(query, time.Now())
+	return t.q.Query(query, args...)
+}
+
+func (t timedQueryer) QueryRow(query string, args ...interface{}) *sql.Row {
+	defer observeQuery(query, time.Now())
+	return t.q.QueryRow(query, args...)
+}
+
+func observeQuery(query string, start time.Time) {
+	operation, table := describeQuery(query)
+	queryDuration.Observe(time.Since(start).Seconds(), operation, table)
+}
+
+// describeQuery returns the operation and the table of the statement,
+// e.g. "select" and "shutters" for SELECT id FROM shutters WHERE id = ?
+func describeQuery(query string) (string, string) {
+	words := strings.FieldsFunc(query, func(r rune) bool {
+		return r == ' ' || r == '\n' || r == '\t' || r == '(' || r == ')' || r == ','
+	})
+	if len(words) == 0 {
+		return "unknown", "unknown"
+	}
+	operation := strings.ToLower(words[0])
+	keyword := ""
+	switch operation {
+	case "select", "delete":
+		keyword = "from"
+	case "insert":
+		keyword = "into"
+	case "update":
+		return operation, tableName(words, 1)
+	default:
+		return operation, "unknown"
+	}
+	for i, word := range words {
+		if strings.ToLower(word) == keyword {
+			return operation, tableName(words, i+1)
+		}
+	}
+	return operation, "unknown"
+}
+
+func tableName(words []string, i int) string {
+	if i >= len(words) {
+		return "unknown"
+	}
+	return strings.ToLower(words[i])
+}
@@ -0,0 +1,51 @@
+package store
+
+import (
+	"testing"
+
+	"github.com/he4d/almue-backend/model"
+)
+
+func TestDescribeQuery(t *testing.T) {
+	tests := []struct {
+		query, operation, table string
+	}{
+		{shutterByIDStmt, "select", "shutters"},
+		{shutterStateUpdateStmt, "update", "shutters"},
+		{shutterCreateStmt, "insert", "shutters"},
+		{"\nINSERT OR IGNORE INTO tags(name) VALUES(?)", "insert", "tags"},
+		{"DELETE FROM device_events WHERE time < ?", "delete", "device_events"},
+		{"SELECT COUNT(*) FROM migrations", "select", "migrations"},
+		{"PRAGMA foreign_keys = ON", "pragma", "unknown"},
+		{"", "unknown", "unknown"},
+	}
+	for _, test := range tests {
+		if operation, table := describeQuery(test.query); operation != test.operation || table != test.table {
+			t.Errorf("Expected %s %s for %q but got %s %s", test.operation, test.table, test.query, operation, table)
+		}
+	}
+}
+
+func TestQueryDuration(t *testing.T) {
+	clearTable()
+	selects := queryDuration.Count("select", "floors")
+	inserts := queryDuration.Count("insert", "floors")
+
+	description := "keller"
+	if _, err := store.CreateFloor(&model.Floor{Description: &description}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.GetFloorList(); err != nil {
+		t.Fatal(err)
+	}
+	// the transaction of WithTx is timed as well
+	if err := store.WithTx(func(tx *Datastore) error {
+		_, err := tx.GetFloorList()
+		return err
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if queryDuration.Count("insert", "floors") <= inserts || queryDuration.Count("select", "floors") < selects+2 {
+		t.Error("Expected the durations of the floor queries to be observed")
+	}
+}
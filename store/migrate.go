@@ -1,104 +1,430 @@
 package store
 
-import "database/sql"
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
 
-var migrations = []struct {
-	name string
-	stmt string
-}{
+	"github.com/he4d/almue-backend/model"
+)
+
+// migration changes the schema with its statement, the down statement reverts it.
+// The statement of a migration must not be changed after it was released,
+// changes of the schema are always done by a new migration.
+// The check runs before the statement and stops the migration if the data can not be migrated
+type migration struct {
+	name  string
+	stmt  string
+	down  string
+	check func(tx *sql.Tx) error
+}
+
+var migrations = []migration{
 	{
 		name: "create-table-floors",
 		stmt: createTableFloors,
+		down: dropTableFloors,
 	},
 	{
 		name: "create-table-shutters",
 		stmt: createTableShutters,
+		down: dropTableShutters,
 	},
 	{
 		name: "create-table-lightings",
 		stmt: createTableLightings,
+		down: dropTableLightings,
 	},
 	{
 		name: "create-update-trigger-floors",
 		stmt: createUpdateTriggerFloors,
+		down: dropUpdateTriggerFloors,
 	},
 	{
 		name: "create-update-trigger-shutters",
 		stmt: createUpdateTriggerShutters,
+		down: dropUpdateTriggerShutters,
 	},
 	{
 		name: "create-update-trigger-lightings",
 		stmt: createUpdateTriggerLightings,
+		down: dropUpdateTriggerLightings,
+	},
+	{
+		name: "create-table-pins",
+		stmt: createTablePins,
+		down: dropTablePins,
+	},
+	{
+		name:  "migrate-shutter-pins",
+		stmt:  migrateShutterPins,
+		down:  removeShutterPins,
+		check: checkPinClashes,
+	},
+	{
+		name:  "migrate-lighting-pins",
+		stmt:  migrateLightingPins,
+		down:  removeLightingPins,
+		check: checkPinClashes,
+	},
+	{
+		name: "create-pin-triggers-shutters",
+		stmt: createPinTriggersShutters,
+		down: dropPinTriggersShutters,
+	},
+	{
+		name: "create-pin-triggers-lightings",
+		stmt: createPinTriggersLightings,
+		down: dropPinTriggersLightings,
+	},
+	{
+		name: "add-version-floors",
+		stmt: addVersionFloors,
+		down: dropVersionFloors,
+	},
+	{
+		name: "add-version-shutters",
+		stmt: addVersionShutters,
+		down: dropVersionShutters,
+	},
+	{
+		name: "add-version-lightings",
+		stmt: addVersionLightings,
+		down: dropVersionLightings,
+	},
+	{
+		name: "create-table-rooms",
+		stmt: createTableRooms,
+		down: dropTableRooms,
+	},
+	{
+		name: "create-update-trigger-rooms",
+		stmt: createUpdateTriggerRooms,
+		down: dropUpdateTriggerRooms,
+	},
+	{
+		name: "add-room-shutters",
+		stmt: addRoomShutters,
+		down: dropRoomShutters,
+	},
+	{
+		name: "add-room-lightings",
+		stmt: addRoomLightings,
+		down: dropRoomLightings,
+	},
+	{
+		name: "create-room-triggers-shutters",
+		stmt: createRoomTriggersShutters,
+		down: dropRoomTriggersShutters,
+	},
+	{
+		name: "create-room-triggers-lightings",
+		stmt: createRoomTriggersLightings,
+		down: dropRoomTriggersLightings,
+	},
+	{
+		name: "create-delete-trigger-rooms",
+		stmt: createDeleteTriggerRooms,
+		down: dropDeleteTriggerRooms,
+	},
+	{
+		name: "create-table-tags",
+		stmt: createTableTags,
+		down: dropTableTags,
+	},
+	{
+		name: "create-table-shutter-tags",
+		stmt: createTableShutterTags,
+		down: dropTableShutterTags,
+	},
+	{
+		name: "create-table-lighting-tags",
+		stmt: createTableLightingTags,
+		down: dropTableLightingTags,
+	},
+	{
+		name: "create-unused-tag-triggers",
+		stmt: createUnusedTagTriggers,
+		down: dropUnusedTagTriggers,
+	},
+	{
+		name: "create-table-device-events",
+		stmt: createTableDeviceEvents,
+		down: dropTableDeviceEvents,
+	},
+	{
+		name: "create-table-calendar-exceptions",
+		stmt: createTableCalendarExceptions,
+		down: dropTableCalendarExceptions,
+	},
+	{
+		name: "create-update-trigger-calendar-exceptions",
+		stmt: createUpdateTriggerCalendarExceptions,
+		down: dropUpdateTriggerCalendarExceptions,
+	},
+	{
+		name: "create-table-calendar-shutters",
+		stmt: createTableCalendarShutters,
+		down: dropTableCalendarShutters,
+	},
+	{
+		name: "create-table-calendar-lightings",
+		stmt: createTableCalendarLightings,
+		down: dropTableCalendarLightings,
+	},
+	{
+		name: "add-fault-shutters",
+		stmt: addFaultShutters,
+		down: dropFaultShutters,
+	},
+	{
+		name: "add-fault-lightings",
+		stmt: addFaultLightings,
+		down: dropFaultLightings,
 	},
 }
 
+// appliedMigration is the record of a migration in the migrations table
+type appliedMigration struct {
+	name      string
+	appliedAt *time.Time
+	checksum  string
+}
+
+func checksum(stmt string) string {
+	sum := sha256.Sum256([]byte(stmt))
+	return hex.EncodeToString(sum[:])
+}
+
 // Migrate performs the database migration. If the migration fails
-// and error is returned.
+// and error is returned. It also fails if the statement of an already
+// applied migration was modified.
 func Migrate(db *sql.DB) error {
-	if err := createTable(db); err != nil {
+	return migrate(db, migrations)
+}
+
+// migrate performs the given migrations that are not completed yet
+func migrate(db *sql.DB, migrations []migration) error {
+	applied, err := selectApplied(db)
+	if err != nil {
 		return err
 	}
-	completed, err := selectCompleted(db)
-	if err != nil && err != sql.ErrNoRows {
-		return err
+	completed := map[string]*appliedMigration{}
+	for _, a := range applied {
+		completed[a.name] = a
 	}
-	for _, migration := range migrations {
-		if _, ok := completed[migration.name]; ok {
 
+	for _, migration := range migrations {
+		if a, ok := completed[migration.name]; ok {
+			if a.checksum != checksum(migration.stmt) {
+				return fmt.Errorf("The statement of the applied migration %s was modified", migration.name)
+			}
 			continue
 		}
 
-		if _, err := db.Exec(migration.stmt); err != nil {
+		if err := inTx(db, func(tx *sql.Tx) error {
+			if migration.check != nil {
+				if err := migration.check(tx); err != nil {
+					return err
+				}
+			}
+			if _, err := tx.Exec(migration.stmt); err != nil {
+				return err
+			}
+			_, err := tx.Exec(migrationInsert, migration.name, time.Now().UTC(), checksum(migration.stmt))
 			return err
+		}); err != nil {
+			return fmt.Errorf("Migration %s failed: %v", migration.name, err)
 		}
-		if err := insertMigration(db, migration.name); err != nil {
+	}
+	return nil
+}
+
+// MigrateDown reverts the last n applied migrations in the reverse order they were applied
+func MigrateDown(db *sql.DB, n int) error {
+	applied, err := selectApplied(db)
+	if err != nil {
+		return err
+	}
+	if n < 1 || n > len(applied) {
+		return fmt.Errorf("Can only revert between 1 and %d migrations", len(applied))
+	}
+
+	known := map[string]migration{}
+	for _, m := range migrations {
+		known[m.name] = m
+	}
+	for i := len(applied) - 1; i >= len(applied)-n; i-- {
+		m, ok := known[applied[i].name]
+		if !ok {
+			return fmt.Errorf("The migration %s is unknown and can not be reverted", applied[i].name)
+		}
+		if err := inTx(db, func(tx *sql.Tx) error {
+			if _, err := tx.Exec(m.down); err != nil {
+				return err
+			}
+			_, err := tx.Exec(migrationDelete, m.name)
 			return err
+		}); err != nil {
+			return fmt.Errorf("Reverting the migration %s failed: %v", m.name, err)
 		}
-
 	}
 	return nil
 }
 
-func createTable(db *sql.DB) error {
-	_, err := db.Exec(migrationTableCreate)
-	return err
+// SchemaStatus returns the version of the schema and the state of all migrations
+func SchemaStatus(db *sql.DB) (*model.Schema, error) {
+	applied, err := selectApplied(db)
+	if err != nil {
+		return nil, err
+	}
+	completed := map[string]*appliedMigration{}
+	for _, a := range applied {
+		completed[a.name] = a
+	}
+
+	schema := &model.Schema{Version: len(applied), Latest: len(migrations), Migrations: []*model.Migration{}}
+	if len(applied) > 0 {
+		schema.Current = applied[len(applied)-1].name
+	}
+	for _, m := range migrations {
+		state := &model.Migration{Name: m.name, Checksum: checksum(m.stmt)}
+		if a, ok := completed[m.name]; ok {
+			state.Applied = true
+			state.AppliedAt = a.appliedAt
+			state.Modified = a.checksum != state.Checksum
+			delete(completed, m.name)
+		}
+		schema.Migrations = append(schema.Migrations, state)
+	}
+	// migrations of a newer build that was downgraded
+	for _, a := range applied {
+		if _, ok := completed[a.name]; ok {
+			schema.Migrations = append(schema.Migrations, &model.Migration{
+				Name: a.name, Applied: true, AppliedAt: a.appliedAt, Checksum: a.checksum, Unknown: true})
+		}
+	}
+	return schema, nil
 }
 
-func insertMigration(db *sql.DB, name string) error {
-	_, err := db.Exec(migrationInsert, name)
-	return err
+// GetSchema returns the version of the schema and the state of all migrations
+func (d *Datastore) GetSchema() (*model.Schema, error) {
+	return SchemaStatus(d.DB)
 }
 
-func selectCompleted(db *sql.DB) (map[string]struct{}, error) {
-	migrations := map[string]struct{}{}
+// inTx runs fn in a transaction that is committed if fn returns nil and rolled back otherwise
+func inTx(db *sql.DB, fn func(tx *sql.Tx) error) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// selectApplied returns the applied migrations in the order they were applied.
+// The migrations table is created or upgraded before
+func selectApplied(db *sql.DB) ([]*appliedMigration, error) {
+	if err := createTable(db); err != nil {
+		return nil, err
+	}
 	rows, err := db.Query(migrationSelect)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
+	applied := []*appliedMigration{}
+	for rows.Next() {
+		a := &appliedMigration{}
+		var sum sql.NullString
+		if err := rows.Scan(&a.name, &a.appliedAt, &sum); err != nil {
+			return nil, err
+		}
+		a.checksum = sum.String
+		applied = append(applied, a)
+	}
+	return applied, rows.Err()
+}
+
+// createTable creates the migrations table. The table of older versions only
+// had the name column, the other columns are added and the checksums of their
+// migrations are set to the current ones
+func createTable(db *sql.DB) error {
+	if _, err := db.Exec(migrationTableCreate); err != nil {
+		return err
+	}
+	rows, err := db.Query(migrationTableInfo)
+	if err != nil {
+		return err
+	}
+	columns := map[string]bool{}
 	for rows.Next() {
 		var name string
 		if err := rows.Scan(&name); err != nil {
-			return nil, err
+			rows.Close()
+			return err
 		}
-		migrations[name] = struct{}{}
+		columns[name] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if columns["checksum"] {
+		return nil
 	}
-	return migrations, nil
+
+	return inTx(db, func(tx *sql.Tx) error {
+		if _, err := tx.Exec(migrationTableUpgrade); err != nil {
+			return err
+		}
+		for _, m := range migrations {
+			if _, err := tx.Exec(migrationChecksumUpdate, checksum(m.stmt), m.name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
 }
 
 var migrationTableCreate = `
 CREATE TABLE IF NOT EXISTS migrations (
 name VARCHAR(255),
+applied_at datetime,
+checksum varchar(64),
 UNIQUE(name)
 )
 `
 
+var migrationTableInfo = `
+SELECT name FROM pragma_table_info('migrations')
+`
+
+var migrationTableUpgrade = `
+ALTER TABLE migrations ADD COLUMN applied_at datetime;
+ALTER TABLE migrations ADD COLUMN checksum varchar(64);
+`
+
+var migrationChecksumUpdate = `
+UPDATE migrations SET checksum = ? WHERE name = ?
+`
+
 var migrationInsert = `
-INSERT INTO migrations (name) VALUES (?)
+INSERT INTO migrations (name, applied_at, checksum) VALUES (?, ?, ?)
+`
+
+var migrationDelete = `
+DELETE FROM migrations WHERE name = ?
 `
 
 var migrationSelect = `
-SELECT name FROM migrations
+SELECT name, applied_at, checksum FROM migrations ORDER BY rowid
 `
 
 var createTableFloors = `
@@ -110,7 +436,10 @@ description varchar(255) NOT NULL UNIQUE
 )
 `
 
-//TODO: The pins must be unique merged (open_pin and close_pin) TABLE FOR PINS!!
+var dropTableFloors = `
+DROP TABLE IF EXISTS floors
+`
+
 var createTableShutters = `
 CREATE TABLE IF NOT EXISTS shutters (
 id integer primary key,
@@ -131,7 +460,10 @@ floor_id integer NOT NULL REFERENCES floors(id) ON DELETE CASCADE ON UPDATE CASC
 )
 `
 
-//TODO: The pins must be unique merged with shutters (open_pin and close_pin)
+var dropTableShutters = `
+DROP TABLE IF EXISTS shutters
+`
+
 var createTableLightings = `
 CREATE TABLE IF NOT EXISTS lightings (
 id integer primary key,
@@ -149,20 +481,430 @@ floor_id integer NOT NULL REFERENCES floors(id) ON DELETE CASCADE ON UPDATE CASC
 )
 `
 
+var dropTableLightings = `
+DROP TABLE IF EXISTS lightings
+`
+
 var createUpdateTriggerFloors = `
 CREATE TRIGGER IF NOT EXISTS 
 update_floor AFTER UPDATE ON floors FOR EACH ROW BEGIN UPDATE floors 
 SET modified = current_timestamp WHERE ID = OLD.ID; END;
 `
 
+var dropUpdateTriggerFloors = `
+DROP TRIGGER IF EXISTS update_floor
+`
+
 var createUpdateTriggerShutters = `
 CREATE TRIGGER IF NOT EXISTS 
 update_shutter AFTER UPDATE ON shutters FOR EACH ROW BEGIN UPDATE shutters 
 SET modified = current_timestamp WHERE ID = OLD.ID; END;
 `
 
+var dropUpdateTriggerShutters = `
+DROP TRIGGER IF EXISTS update_shutter
+`
+
 var createUpdateTriggerLightings = `
 CREATE TRIGGER IF NOT EXISTS 
 update_lighting AFTER UPDATE ON lightings FOR EACH ROW BEGIN UPDATE lightings 
 SET modified = current_timestamp WHERE ID = OLD.ID; END;
 `
+
+var dropUpdateTriggerLightings = `
+DROP TRIGGER IF EXISTS update_lighting
+`
+
+// The pins table holds every gpio pin that is assigned to a device. It is derived from the
+// pin columns of the device tables and only maintained by their triggers, it must never be
+// written directly. Its primary key is the unique constraint on the pin and the single place
+// that enforces that a pin is assigned to one device only regardless of their type, it makes
+// the trigger fail if a pin is assigned to a second device.
+var createTablePins = `
+CREATE TABLE IF NOT EXISTS pins (
+pin integer primary key,
+device_type varchar(10) NOT NULL,
+device_id integer NOT NULL,
+function varchar(10) NOT NULL,
+UNIQUE(device_type, device_id, function)
+)
+`
+
+var dropTablePins = `
+DROP TABLE IF EXISTS pins
+`
+
+// The pins of the existing devices are copied by the statements below. checkPinClashes runs
+// before them and names the devices of a pin that is assigned twice, a clash that slips through
+// still fails the migration on the primary key instead of dropping an assignment.
+var migrateShutterPins = `
+INSERT INTO pins (pin, device_type, device_id, function)
+SELECT open_pin, 'shutter', id, 'open' FROM shutters
+UNION ALL
+SELECT close_pin, 'shutter', id, 'close' FROM shutters
+`
+
+var removeShutterPins = `
+DELETE FROM pins WHERE device_type = 'shutter'
+`
+
+var migrateLightingPins = `
+INSERT INTO pins (pin, device_type, device_id, function)
+SELECT switch_pin, 'lighting', id, 'switch' FROM lightings
+`
+
+var removeLightingPins = `
+DELETE FROM pins WHERE device_type = 'lighting'
+`
+
+// checkPinClashes fails if a pin is assigned to more than one device or function,
+// the message names all devices of the clashing pins so they can be fixed before the upgrade
+func checkPinClashes(tx *sql.Tx) error {
+	rows, err := tx.Query(pinClashesStmt)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	pins := []int{}
+	owners := map[int][]string{}
+	for rows.Next() {
+		var pin int
+		var deviceType, function string
+		var deviceID int64
+		if err := rows.Scan(&pin, &deviceType, &deviceID, &function); err != nil {
+			return err
+		}
+		if _, ok := owners[pin]; !ok {
+			pins = append(pins, pin)
+		}
+		owners[pin] = append(owners[pin], fmt.Sprintf("%s %d (%s)", deviceType, deviceID, function))
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if len(pins) == 0 {
+		return nil
+	}
+	clashes := []string{}
+	for _, pin := range pins {
+		clashes = append(clashes, fmt.Sprintf("pin %d is used by %s", pin, strings.Join(owners[pin], ", ")))
+	}
+	return fmt.Errorf("The gpio pins of the devices clash, change them before upgrading: %s", strings.Join(clashes, "; "))
+}
+
+var pinClashesStmt = `
+WITH device_pins (pin, device_type, device_id, function) AS (
+SELECT open_pin, 'shutter', id, 'open' FROM shutters
+UNION ALL
+SELECT close_pin, 'shutter', id, 'close' FROM shutters
+UNION ALL
+SELECT switch_pin, 'lighting', id, 'switch' FROM lightings
+)
+SELECT pin, device_type, device_id, function FROM device_pins
+WHERE pin IN (SELECT pin FROM device_pins GROUP BY pin HAVING COUNT(*) > 1)
+ORDER BY pin, device_type DESC, device_id, function DESC
+`
+
+var createPinTriggersShutters = `
+CREATE TRIGGER IF NOT EXISTS
+insert_shutter_pins AFTER INSERT ON shutters FOR EACH ROW BEGIN
+INSERT INTO pins (pin, device_type, device_id, function) VALUES (NEW.open_pin, 'shutter', NEW.id, 'open');
+INSERT INTO pins (pin, device_type, device_id, function) VALUES (NEW.close_pin, 'shutter', NEW.id, 'close'); END;
+CREATE TRIGGER IF NOT EXISTS
+update_shutter_pins AFTER UPDATE OF open_pin, close_pin ON shutters FOR EACH ROW BEGIN
+DELETE FROM pins WHERE device_type = 'shutter' AND device_id = OLD.id;
+INSERT INTO pins (pin, device_type, device_id, function) VALUES (NEW.open_pin, 'shutter', NEW.id, 'open');
+INSERT INTO pins (pin, device_type, device_id, function) VALUES (NEW.close_pin, 'shutter', NEW.id, 'close'); END;
+CREATE TRIGGER IF NOT EXISTS
+delete_shutter_pins AFTER DELETE ON shutters FOR EACH ROW BEGIN
+DELETE FROM pins WHERE device_type = 'shutter' AND device_id = OLD.id; END;
+`
+
+var dropPinTriggersShutters = `
+DROP TRIGGER IF EXISTS insert_shutter_pins;
+DROP TRIGGER IF EXISTS update_shutter_pins;
+DROP TRIGGER IF EXISTS delete_shutter_pins;
+`
+
+var createPinTriggersLightings = `
+CREATE TRIGGER IF NOT EXISTS
+insert_lighting_pins AFTER INSERT ON lightings FOR EACH ROW BEGIN
+INSERT INTO pins (pin, device_type, device_id, function) VALUES (NEW.switch_pin, 'lighting', NEW.id, 'switch'); END;
+CREATE TRIGGER IF NOT EXISTS
+update_lighting_pins AFTER UPDATE OF switch_pin ON lightings FOR EACH ROW BEGIN
+DELETE FROM pins WHERE device_type = 'lighting' AND device_id = OLD.id;
+INSERT INTO pins (pin, device_type, device_id, function) VALUES (NEW.switch_pin, 'lighting', NEW.id, 'switch'); END;
+CREATE TRIGGER IF NOT EXISTS
+delete_lighting_pins AFTER DELETE ON lightings FOR EACH ROW BEGIN
+DELETE FROM pins WHERE device_type = 'lighting' AND device_id = OLD.id; END;
+`
+
+var dropPinTriggersLightings = `
+DROP TRIGGER IF EXISTS insert_lighting_pins;
+DROP TRIGGER IF EXISTS update_lighting_pins;
+DROP TRIGGER IF EXISTS delete_lighting_pins;
+`
+
+// The version of a device is only increased by updates of its configuration,
+// state changes like the opening of a shutter keep the version
+var addVersionFloors = `
+ALTER TABLE floors ADD COLUMN version integer NOT NULL DEFAULT 1
+`
+
+var dropVersionFloors = `
+ALTER TABLE floors DROP COLUMN version
+`
+
+var addVersionShutters = `
+ALTER TABLE shutters ADD COLUMN version integer NOT NULL DEFAULT 1
+`
+
+var dropVersionShutters = `
+ALTER TABLE shutters DROP COLUMN version
+`
+
+var addVersionLightings = `
+ALTER TABLE lightings ADD COLUMN version integer NOT NULL DEFAULT 1
+`
+
+var dropVersionLightings = `
+ALTER TABLE lightings DROP COLUMN version
+`
+
+// A room belongs to a floor and is deleted together with it
+var createTableRooms = `
+CREATE TABLE IF NOT EXISTS rooms (
+id integer primary key,
+created datetime NOT NULL DEFAULT current_timestamp,
+modified datetime NOT NULL DEFAULT current_timestamp,
+description varchar(255) NOT NULL,
+floor_id integer NOT NULL REFERENCES floors(id) ON DELETE CASCADE ON UPDATE CASCADE,
+version integer NOT NULL DEFAULT 1,
+UNIQUE(floor_id, description)
+)
+`
+
+var dropTableRooms = `
+DROP TABLE IF EXISTS rooms
+`
+
+var createUpdateTriggerRooms = `
+CREATE TRIGGER IF NOT EXISTS 
+update_room AFTER UPDATE ON rooms FOR EACH ROW BEGIN UPDATE rooms 
+SET modified = current_timestamp WHERE ID = OLD.ID; END;
+`
+
+var dropUpdateTriggerRooms = `
+DROP TRIGGER IF EXISTS update_room
+`
+
+// The room of a device is optional. The column has no foreign key, as sqlite can not drop
+// such a column again, the room triggers keep it consistent with the rooms table instead
+var addRoomShutters = `
+ALTER TABLE shutters ADD COLUMN room_id integer
+`
+
+var dropRoomShutters = `
+ALTER TABLE shutters DROP COLUMN room_id
+`
+
+var addRoomLightings = `
+ALTER TABLE lightings ADD COLUMN room_id integer
+`
+
+var dropRoomLightings = `
+ALTER TABLE lightings DROP COLUMN room_id
+`
+
+// The room of a device must exist and belong to the floor of the device
+var createRoomTriggersShutters = `
+CREATE TRIGGER IF NOT EXISTS
+insert_shutter_room BEFORE INSERT ON shutters FOR EACH ROW
+WHEN NEW.room_id IS NOT NULL AND NOT EXISTS (SELECT 1 FROM rooms WHERE id = NEW.room_id AND floor_id = NEW.floor_id)
+BEGIN SELECT RAISE(ABORT, 'The room of the shutter does not exist on its floor'); END;
+CREATE TRIGGER IF NOT EXISTS
+update_shutter_room BEFORE UPDATE OF room_id, floor_id ON shutters FOR EACH ROW
+WHEN NEW.room_id IS NOT NULL AND NOT EXISTS (SELECT 1 FROM rooms WHERE id = NEW.room_id AND floor_id = NEW.floor_id)
+BEGIN SELECT RAISE(ABORT, 'The room of the shutter does not exist on its floor'); END;
+`
+
+var dropRoomTriggersShutters = `
+DROP TRIGGER IF EXISTS insert_shutter_room;
+DROP TRIGGER IF EXISTS update_shutter_room;
+`
+
+var createRoomTriggersLightings = `
+CREATE TRIGGER IF NOT EXISTS
+insert_lighting_room BEFORE INSERT ON lightings FOR EACH ROW
+WHEN NEW.room_id IS NOT NULL AND NOT EXISTS (SELECT 1 FROM rooms WHERE id = NEW.room_id AND floor_id = NEW.floor_id)
+BEGIN SELECT RAISE(ABORT, 'The room of the lighting does not exist on its floor'); END;
+CREATE TRIGGER IF NOT EXISTS
+update_lighting_room BEFORE UPDATE OF room_id, floor_id ON lightings FOR EACH ROW
+WHEN NEW.room_id IS NOT NULL AND NOT EXISTS (SELECT 1 FROM rooms WHERE id = NEW.room_id AND floor_id = NEW.floor_id)
+BEGIN SELECT RAISE(ABORT, 'The room of the lighting does not exist on its floor'); END;
+`
+
+var dropRoomTriggersLightings = `
+DROP TRIGGER IF EXISTS insert_lighting_room;
+DROP TRIGGER IF EXISTS update_lighting_room;
+`
+
+// The devices of a deleted room stay on their floor without a room, which is a change of their configuration
+var createDeleteTriggerRooms = `
+CREATE TRIGGER IF NOT EXISTS
+delete_room AFTER DELETE ON rooms FOR EACH ROW BEGIN
+UPDATE shutters SET room_id = NULL, version = version + 1 WHERE room_id = OLD.id;
+UPDATE lightings SET room_id = NULL, version = version + 1 WHERE room_id = OLD.id; END;
+`
+
+var dropDeleteTriggerRooms = `
+DROP TRIGGER IF EXISTS delete_room
+`
+
+// A tag only exists as long as it is linked to a device, the links are
+// deleted with their devices and the unused tag triggers delete the tag then
+var createTableTags = `
+CREATE TABLE IF NOT EXISTS tags (
+id integer primary key,
+name varchar(50) NOT NULL UNIQUE
+)
+`
+
+var dropTableTags = `
+DROP TABLE IF EXISTS tags
+`
+
+var createTableShutterTags = `
+CREATE TABLE IF NOT EXISTS shutter_tags (
+shutter_id integer NOT NULL REFERENCES shutters(id) ON DELETE CASCADE ON UPDATE CASCADE,
+tag_id integer NOT NULL REFERENCES tags(id) ON DELETE CASCADE ON UPDATE CASCADE,
+PRIMARY KEY(shutter_id, tag_id)
+)
+`
+
+var dropTableShutterTags = `
+DROP TABLE IF EXISTS shutter_tags
+`
+
+var createTableLightingTags = `
+CREATE TABLE IF NOT EXISTS lighting_tags (
+lighting_id integer NOT NULL REFERENCES lightings(id) ON DELETE CASCADE ON UPDATE CASCADE,
+tag_id integer NOT NULL REFERENCES tags(id) ON DELETE CASCADE ON UPDATE CASCADE,
+PRIMARY KEY(lighting_id, tag_id)
+)
+`
+
+var dropTableLightingTags = `
+DROP TABLE IF EXISTS lighting_tags
+`
+
+var createUnusedTagTriggers = `
+CREATE TRIGGER IF NOT EXISTS
+delete_unused_shutter_tag AFTER DELETE ON shutter_tags FOR EACH ROW BEGIN
+DELETE FROM tags WHERE id = OLD.tag_id
+AND NOT EXISTS (SELECT 1 FROM shutter_tags WHERE tag_id = OLD.tag_id)
+AND NOT EXISTS (SELECT 1 FROM lighting_tags WHERE tag_id = OLD.tag_id); END;
+CREATE TRIGGER IF NOT EXISTS
+delete_unused_lighting_tag AFTER DELETE ON lighting_tags FOR EACH ROW BEGIN
+DELETE FROM tags WHERE id = OLD.tag_id
+AND NOT EXISTS (SELECT 1 FROM shutter_tags WHERE tag_id = OLD.tag_id)
+AND NOT EXISTS (SELECT 1 FROM lighting_tags WHERE tag_id = OLD.tag_id); END;
+`
+
+var dropUnusedTagTriggers = `
+DROP TRIGGER IF EXISTS delete_unused_shutter_tag;
+DROP TRIGGER IF EXISTS delete_unused_lighting_tag;
+`
+
+var createTableDeviceEvents = `
+CREATE TABLE IF NOT EXISTS device_events (
+id integer primary key,
+device_type varchar(10) NOT NULL CHECK(device_type IN ('shutter', 'lighting')),
+device_id integer NOT NULL,
+state varchar(20) NOT NULL,
+time datetime NOT NULL
+);
+CREATE INDEX IF NOT EXISTS device_events_time ON device_events(time);
+`
+
+var dropTableDeviceEvents = `
+DROP INDEX IF EXISTS device_events_time;
+DROP TABLE IF EXISTS device_events;
+`
+
+var createTableCalendarExceptions = `
+CREATE TABLE IF NOT EXISTS calendar_exceptions (
+id integer primary key,
+created datetime NOT NULL DEFAULT current_timestamp,
+modified datetime NOT NULL DEFAULT current_timestamp,
+description varchar(255) NOT NULL,
+start_date varchar(10) NOT NULL,
+end_date varchar(10) NOT NULL CHECK(end_date >= start_date),
+action varchar(10) NOT NULL CHECK(action IN ('skip', 'shift')),
+shift_minutes integer NOT NULL DEFAULT 0,
+jobs varchar(50) NOT NULL DEFAULT '',
+all_devices boolean NOT NULL DEFAULT 0,
+source varchar(255) NOT NULL DEFAULT '',
+version integer NOT NULL DEFAULT 1
+)
+`
+
+var dropTableCalendarExceptions = `
+DROP TABLE IF EXISTS calendar_exceptions
+`
+
+var createUpdateTriggerCalendarExceptions = `
+CREATE TRIGGER IF NOT EXISTS
+update_calendar_exception AFTER UPDATE ON calendar_exceptions FOR EACH ROW BEGIN UPDATE calendar_exceptions
+SET modified = current_timestamp WHERE ID = OLD.ID; END;
+`
+
+var dropUpdateTriggerCalendarExceptions = `
+DROP TRIGGER IF EXISTS update_calendar_exception
+`
+
+var createTableCalendarShutters = `
+CREATE TABLE IF NOT EXISTS calendar_shutters (
+exception_id integer NOT NULL REFERENCES calendar_exceptions(id) ON DELETE CASCADE ON UPDATE CASCADE,
+shutter_id integer NOT NULL REFERENCES shutters(id) ON DELETE CASCADE ON UPDATE CASCADE,
+PRIMARY KEY(exception_id, shutter_id)
+)
+`
+
+var dropTableCalendarShutters = `
+DROP TABLE IF EXISTS calendar_shutters
+`
+
+var createTableCalendarLightings = `
+CREATE TABLE IF NOT EXISTS calendar_lightings (
+exception_id integer NOT NULL REFERENCES calendar_exceptions(id) ON DELETE CASCADE ON UPDATE CASCADE,
+lighting_id integer NOT NULL REFERENCES lightings(id) ON DELETE CASCADE ON UPDATE CASCADE,
+PRIMARY KEY(exception_id, lighting_id)
+)
+`
+
+var dropTableCalendarLightings = `
+DROP TABLE IF EXISTS calendar_lightings
+`
+
+// The fault of a device is set by the device controller when a background operation fails
+// and stays until the device is reset. Both columns are NULL while the device has no fault
+var addFaultShutters = `
+ALTER TABLE shutters ADD COLUMN fault_message varchar(255);
+ALTER TABLE shutters ADD COLUMN fault_time datetime;
+`
+
+var dropFaultShutters = `
+ALTER TABLE shutters DROP COLUMN fault_time;
+ALTER TABLE shutters DROP COLUMN fault_message;
+`
+
+var addFaultLightings = `
+ALTER TABLE lightings ADD COLUMN fault_message varchar(255);
+ALTER TABLE lightings ADD COLUMN fault_time datetime;
+`
+
+var dropFaultLightings = `
+ALTER TABLE lightings DROP COLUMN fault_time;
+ALTER TABLE lightings DROP COLUMN fault_message;
+`
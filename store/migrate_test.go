@@ -0,0 +1,306 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"io/ioutil"
+	"testing"
+
+	"github.com/he4d/simplejack"
+)
+
+// openMigrated opens a new in-memory database that only ran the first count migrations
+func openMigrated(t *testing.T, name string, count int) *sql.DB {
+	db, err := sql.Open("sqlite3", fmt.Sprintf("file:%s?mode=memory&cache=shared", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := migrate(db, migrations[:count]); err != nil {
+		t.Fatalf("Could not run the first %d migrations: %v", count, err)
+	}
+	return db
+}
+
+// checkGetters checks that all getters read the floor, shutter and lighting
+// that were inserted by the upgrade tests
+func checkGetters(t *testing.T, d *Datastore) {
+	floor, err := d.GetFloor(1)
+	if err != nil || *floor.Description != "erdgeschoss" || floor.Version != 1 {
+		t.Fatalf("GetFloor: got %v, %v", floor, err)
+	}
+	if floors, err := d.GetFloorList(); err != nil || len(floors) != 1 {
+		t.Errorf("GetFloorList: got %v, %v", floors, err)
+	}
+
+	shutter, err := d.GetShutter(1)
+	if err != nil {
+		t.Fatalf("GetShutter: %v", err)
+	}
+	if *shutter.Description != "kueche" || *shutter.OpenPin != 17 || *shutter.ClosePin != 27 ||
+		*shutter.CompleteWayInSeconds != 20 || shutter.DeviceStatus != "stopped" || *shutter.FloorID != 1 || shutter.Version != 1 {
+		t.Errorf("GetShutter: got %+v", shutter)
+	}
+	if shutters, err := d.GetShutterList(); err != nil || len(shutters) != 1 {
+		t.Errorf("GetShutterList: got %v, %v", shutters, err)
+	}
+	if shutters, err := d.GetShutterListOfFloor(1); err != nil || len(shutters) != 1 {
+		t.Errorf("GetShutterListOfFloor: got %v, %v", shutters, err)
+	}
+
+	lighting, err := d.GetLighting(1)
+	if err != nil {
+		t.Fatalf("GetLighting: %v", err)
+	}
+	if *lighting.Description != "flur" || *lighting.SwitchPin != 4 || lighting.DeviceStatus != "off" ||
+		*lighting.FloorID != 1 || lighting.Version != 1 {
+		t.Errorf("GetLighting: got %+v", lighting)
+	}
+	if lightings, err := d.GetLightingList(); err != nil || len(lightings) != 1 {
+		t.Errorf("GetLightingList: got %v, %v", lightings, err)
+	}
+	if lightings, err := d.GetLightingListOfFloor(1); err != nil || len(lightings) != 1 {
+		t.Errorf("GetLightingListOfFloor: got %v, %v", lightings, err)
+	}
+
+	if pin, err := d.GetPin(17); err != nil || pin.DeviceID != 1 || pin.Function != "open" {
+		t.Errorf("GetPin: got %v, %v", pin, err)
+	}
+	if pins, err := d.GetPinList(); err != nil || len(pins) != 3 {
+		t.Errorf("GetPinList: got %v, %v", pins, err)
+	}
+	if config, err := d.GetConfiguration(); err != nil ||
+		len(config.Floors) != 1 || len(config.Shutters) != 1 || len(config.Lightings) != 1 {
+		t.Errorf("GetConfiguration: got %v, %v", config, err)
+	}
+}
+
+func TestUpgradedDatabase(t *testing.T) {
+	// the schemas of earlier releases end with these migrations,
+	// the devices are inserted with the columns of the first schema
+	releases := []string{
+		"create-update-trigger-lightings",
+		"create-pin-triggers-lightings",
+		"add-version-lightings",
+	}
+
+	for _, release := range releases {
+		count := 0
+		for i, m := range migrations {
+			if m.name == release {
+				count = i + 1
+			}
+		}
+		if count == 0 {
+			t.Fatalf("The migration %s does not exist", release)
+		}
+
+		t.Run(release, func(t *testing.T) {
+			db := openMigrated(t, fmt.Sprintf("migrate_test_%d", count), count)
+			defer db.Close()
+
+			for _, stmt := range []string{
+				`INSERT INTO floors (id, description) VALUES (1, 'erdgeschoss')`,
+				`INSERT INTO shutters (id, description, open_pin, close_pin, complete_way_in_seconds,
+				jobs_enabled, emergency_enabled, device_status, disabled, floor_id)
+				VALUES (1, 'kueche', 17, 27, 20, 0, 0, 'stopped', 0, 1)`,
+				`INSERT INTO lightings (id, description, switch_pin,
+				jobs_enabled, emergency_enabled, device_status, disabled, floor_id)
+				VALUES (1, 'flur', 4, 0, 0, 'off', 0, 1)`,
+			} {
+				if _, err := db.Exec(stmt); err != nil {
+					t.Fatalf("Could not insert the devices: %v", err)
+				}
+			}
+
+			if err := Migrate(db); err != nil {
+				t.Fatalf("Could not upgrade the database: %v", err)
+			}
+			checkGetters(t, &Datastore{DB: db, q: db, logger: simplejack.New(simplejack.TRACE, ioutil.Discard)})
+		})
+	}
+}
+
+func TestPinClashesStopTheUpgrade(t *testing.T) {
+	count := 0
+	for i, m := range migrations {
+		if m.name == "migrate-shutter-pins" {
+			count = i
+		}
+	}
+	db := openMigrated(t, "migrate_test_pin_clashes", count)
+	defer db.Close()
+
+	// databases of earlier releases could assign a pin to several devices
+	for _, stmt := range []string{
+		`INSERT INTO floors (id, description) VALUES (1, 'erdgeschoss')`,
+		`INSERT INTO shutters (id, description, open_pin, close_pin, complete_way_in_seconds,
+		jobs_enabled, emergency_enabled, device_status, disabled, floor_id)
+		VALUES (1, 'kueche', 17, 27, 20, 0, 0, 'stopped', 0, 1), (2, 'bad', 27, 22, 20, 0, 0, 'stopped', 0, 1)`,
+		`INSERT INTO lightings (id, description, switch_pin,
+		jobs_enabled, emergency_enabled, device_status, disabled, floor_id)
+		VALUES (1, 'flur', 17, 0, 0, 'off', 0, 1), (2, 'keller', 4, 0, 0, 'off', 0, 1)`,
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatalf("Could not insert the devices: %v", err)
+		}
+	}
+
+	err := Migrate(db)
+	expected := "Migration migrate-shutter-pins failed: The gpio pins of the devices clash, change them before upgrading: " +
+		"pin 17 is used by shutter 1 (open), lighting 1 (switch); pin 27 is used by shutter 1 (close), shutter 2 (open)"
+	if err == nil || err.Error() != expected {
+		t.Fatalf("Expected the error\n%s\nbut got\n%v", expected, err)
+	}
+	var pins int
+	if err := db.QueryRow("SELECT COUNT(*) FROM pins").Scan(&pins); err != nil || pins != 0 {
+		t.Errorf("Expected no pins to be migrated but got %d, %v", pins, err)
+	}
+
+	// after the clashes are fixed the upgrade completes
+	if _, err := db.Exec(`UPDATE shutters SET open_pin = 23 WHERE id = 2; UPDATE lightings SET switch_pin = 5 WHERE id = 1`); err != nil {
+		t.Fatal(err)
+	}
+	if err := Migrate(db); err != nil {
+		t.Fatalf("Could not upgrade the fixed database: %v", err)
+	}
+	if err := db.QueryRow("SELECT COUNT(*) FROM pins").Scan(&pins); err != nil || pins != 6 {
+		t.Errorf("Expected the 6 pins of all devices but got %d, %v", pins, err)
+	}
+}
+
+func TestAddedColumnsAreIgnored(t *testing.T) {
+	db := openMigrated(t, "migrate_test_columns", len(migrations))
+	defer db.Close()
+	d := &Datastore{DB: db, q: db, logger: simplejack.New(simplejack.TRACE, ioutil.Discard)}
+
+	// a later migration may add columns in front of the ones that are scanned
+	for _, stmt := range []string{
+		`INSERT INTO floors (id, description) VALUES (1, 'erdgeschoss')`,
+		`INSERT INTO shutters (id, description, open_pin, close_pin, complete_way_in_seconds,
+		jobs_enabled, emergency_enabled, device_status, disabled, floor_id)
+		VALUES (1, 'kueche', 17, 27, 20, 0, 0, 'stopped', 0, 1)`,
+		`INSERT INTO lightings (id, description, switch_pin,
+		jobs_enabled, emergency_enabled, device_status, disabled, floor_id)
+		VALUES (1, 'flur', 4, 0, 0, 'off', 0, 1)`,
+		`ALTER TABLE floors ADD COLUMN future_text varchar(10) DEFAULT 'x'`,
+		`ALTER TABLE shutters ADD COLUMN future_text varchar(10) DEFAULT 'x'`,
+		`ALTER TABLE lightings ADD COLUMN future_text varchar(10) DEFAULT 'x'`,
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	checkGetters(t, d)
+}
+
+func TestMigrateDown(t *testing.T) {
+	db := openMigrated(t, "migrate_test_down", len(migrations))
+	defer db.Close()
+
+	// revert everything after the version columns of the devices, including the version column of the floors
+	version := 0
+	for i, m := range migrations {
+		if m.name == "add-version-floors" {
+			version = i
+		}
+	}
+	reverted := len(migrations) - version
+	if err := MigrateDown(db, reverted); err != nil {
+		t.Fatalf("Could not revert the last %d migrations: %v", reverted, err)
+	}
+	schema, err := SchemaStatus(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if schema.Version != version || schema.Current != migrations[version-1].name {
+		t.Errorf("Expected the version %d after %s but got %d after %s",
+			version, migrations[version-1].name, schema.Version, schema.Current)
+	}
+	if _, err := db.Exec("SELECT version FROM floors"); err == nil {
+		t.Error("Expected the version column of the floors to be dropped")
+	}
+	if _, err := db.Exec("SELECT room_id FROM shutters"); err == nil {
+		t.Error("Expected the room column of the shutters to be dropped")
+	}
+
+	if err := MigrateDown(db, len(migrations)); err == nil {
+		t.Error("Expected an error on reverting more migrations than applied")
+	}
+	if err := MigrateDown(db, version); err != nil {
+		t.Fatalf("Could not revert all migrations: %v", err)
+	}
+	var tables int
+	if err := db.QueryRow("SELECT count(*) FROM sqlite_master WHERE tbl_name != 'migrations'").Scan(&tables); err != nil {
+		t.Fatal(err)
+	}
+	if tables != 0 {
+		t.Errorf("Expected no tables, triggers or indexes after reverting all migrations but found %d", tables)
+	}
+
+	if err := Migrate(db); err != nil {
+		t.Fatalf("Could not migrate again after reverting: %v", err)
+	}
+	if schema, err := SchemaStatus(db); err != nil || schema.Version != schema.Latest {
+		t.Errorf("Expected the latest version after migrating again but got %v, %v", schema, err)
+	}
+}
+
+func TestModifiedMigration(t *testing.T) {
+	db := openMigrated(t, "migrate_test_modified", len(migrations))
+	defer db.Close()
+
+	modified := make([]migration, len(migrations))
+	copy(modified, migrations)
+	modified[0].stmt += " "
+	if err := migrate(db, modified); err == nil {
+		t.Error("Expected an error for a modified migration")
+	}
+
+	if _, err := db.Exec("UPDATE migrations SET checksum = 'abc' WHERE name = ?", migrations[0].name); err != nil {
+		t.Fatal(err)
+	}
+	schema, err := SchemaStatus(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !schema.Migrations[0].Modified || schema.Migrations[1].Modified {
+		t.Errorf("Expected only the first migration to be modified but got %+v and %+v", schema.Migrations[0], schema.Migrations[1])
+	}
+}
+
+func TestUpgradeMigrationsTable(t *testing.T) {
+	db := openMigrated(t, "migrate_test_table", len(migrations))
+	defer db.Close()
+
+	// earlier versions only recorded the names of the applied migrations
+	if _, err := db.Exec(`
+CREATE TABLE old_migrations AS SELECT name FROM migrations;
+DROP TABLE migrations;
+ALTER TABLE old_migrations RENAME TO migrations;
+INSERT INTO migrations (name) VALUES ('from-a-newer-build');
+`); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Migrate(db); err != nil {
+		t.Fatalf("Could not migrate with the migrations table of an earlier version: %v", err)
+	}
+	schema, err := SchemaStatus(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if schema.Version != len(migrations)+1 || len(schema.Migrations) != len(migrations)+1 {
+		t.Fatalf("Expected all migrations and the unknown one to be applied but got %+v", schema)
+	}
+	for _, m := range schema.Migrations[:len(migrations)] {
+		if !m.Applied || m.Modified || m.Unknown || m.AppliedAt != nil {
+			t.Errorf("Expected an applied migration without a time but got %+v", m)
+		}
+	}
+	if unknown := schema.Migrations[len(migrations)]; !unknown.Unknown || unknown.Name != "from-a-newer-build" {
+		t.Errorf("Expected the unknown migration last but got %+v", unknown)
+	}
+	if err := MigrateDown(db, 1); err == nil {
+		t.Error("Expected an error on reverting an unknown migration")
+	}
+}
@@ -0,0 +1,71 @@
+package store
+
+import (
+	"github.com/he4d/almue-backend/model"
+	sqlite3 "github.com/mattn/go-sqlite3"
+)
+
+// GetPin returns the assignment of the pin with the given number.
+// If the pin is not assigned to any device model.ErrNotFound is returned
+func (d *Datastore) GetPin(pin int) (*model.Pin, error) {
+	p := new(model.Pin)
+	err := d.q.QueryRow(pinByNumberStmt, pin).Scan(&p.Number, &p.DeviceType, &p.DeviceID, &p.Function)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return p, err
+}
+
+// GetPinList returns all pins that are assigned to a device
+func (d *Datastore) GetPinList() ([]*model.Pin, error) {
+	rows, err := d.q.Query(pinsFindAllStmt)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	pins := []*model.Pin{}
+
+	for rows.Next() {
+		p := new(model.Pin)
+		if err := rows.Scan(&p.Number, &p.DeviceType, &p.DeviceID, &p.Function); err != nil {
+			return nil, err
+		}
+		pins = append(pins, p)
+	}
+
+	return pins, err
+}
+
+// pinConflict turns the error of a statement that saved the pins of a device into a *model.PinConflictError
+// if a constraint failed because of them. The pins table is the single place that enforces that a pin is
+// assigned to one device only, the assignments in it tell which device uses the pin. Other errors are returned as they are
+func (d *Datastore) pinConflict(err error, deviceType string, deviceID int64, pins ...*int) error {
+	if sqliteErr, ok := err.(sqlite3.Error); !ok || sqliteErr.Code != sqlite3.ErrConstraint {
+		return err
+	}
+	assigned, listErr := d.GetPinList()
+	if listErr != nil {
+		return err
+	}
+	numbers := []int{}
+	for _, pin := range pins {
+		if pin != nil {
+			numbers = append(numbers, *pin)
+		}
+	}
+	if conflict := model.FindPinConflict(assigned, deviceType, deviceID, numbers...); conflict != nil {
+		return conflict
+	}
+	return err
+}
+
+var pinByNumberStmt = `
+SELECT pin, device_type, device_id, function FROM pins WHERE pin = ?
+`
+
+var pinsFindAllStmt = `
+SELECT pin, device_type, device_id, function FROM pins ORDER BY pin
+`
@@ -0,0 +1,67 @@
+package store
+
+import (
+	"testing"
+
+	"github.com/he4d/almue-backend/model"
+)
+
+func TestPinsFollowDevices(t *testing.T) {
+	clearTable()
+
+	floorDescr := "erdgeschoss"
+	floorID, err := store.CreateFloor(&model.Floor{Description: &floorDescr})
+	if err != nil {
+		t.Fatalf("Could not create the init floor: %v", err)
+	}
+
+	descr := "wohnzimmer"
+	openPin, closePin, completeWay := 5, 6, 20
+	shutter := &model.Shutter{Description: &descr, OpenPin: &openPin, ClosePin: &closePin,
+		CompleteWayInSeconds: &completeWay, FloorID: &floorID}
+	shutterID, err := store.CreateShutter(shutter)
+	if err != nil {
+		t.Fatalf("Could not create the shutter: %v", err)
+	}
+	shutter, err = store.GetShutter(shutterID)
+	if err != nil {
+		t.Fatalf("Could not get the created shutter: %v", err)
+	}
+
+	pin, err := store.GetPin(openPin)
+	if err != nil {
+		t.Fatalf("Could not get the open pin of the shutter: %v", err)
+	}
+	if pin.DeviceType != model.DeviceTypeShutter || pin.DeviceID != shutter.ID || pin.Function != "open" {
+		t.Errorf("Got a wrong pin assignment: %+v", pin)
+	}
+
+	lighting := &model.Lighting{Description: &descr, SwitchPin: &closePin, FloorID: &floorID}
+	if _, err := store.CreateLighting(lighting); err == nil {
+		t.Error("Expected an error on creating a lighting with a pin used by a shutter")
+	}
+
+	newOpenPin, newClosePin := closePin, openPin
+	shutter.OpenPin, shutter.ClosePin = &newOpenPin, &newClosePin
+	if err := store.UpdateShutter(shutter); err != nil {
+		t.Fatalf("Could not swap the pins of the shutter: %v", err)
+	}
+	pin, err = store.GetPin(openPin)
+	if err != nil {
+		t.Fatalf("Could not get the swapped pin of the shutter: %v", err)
+	}
+	if pin.Function != "close" {
+		t.Errorf("Expected pin %d to be the close pin after swapping but got %s", openPin, pin.Function)
+	}
+
+	if err := store.DeleteShutter(shutter.ID); err != nil {
+		t.Fatalf("Could not delete the shutter: %v", err)
+	}
+	pins, err := store.GetPinList()
+	if err != nil {
+		t.Fatalf("Could not get the pin list: %v", err)
+	}
+	if len(pins) != 0 {
+		t.Errorf("Expected no assigned pins after deleting the shutter but got %d", len(pins))
+	}
+}
@@ -0,0 +1,119 @@
+package store
+
+import (
+	"fmt"
+
+	"github.com/he4d/almue-backend/model"
+)
+
+// GetRoom returns the room with the given id
+func (d *Datastore) GetRoom(roomID int64) (*model.Room, error) {
+	return scanRoom(d.q.QueryRow(roomByIDStmt, roomID))
+}
+
+// GetRoomList returns the rooms of all floors
+func (d *Datastore) GetRoomList() ([]*model.Room, error) {
+	return d.FindRooms(&model.ListOptions{})
+}
+
+// GetRoomListOfFloor returns the rooms of the floor with the given id
+func (d *Datastore) GetRoomListOfFloor(floorID int64) ([]*model.Room, error) {
+	return d.FindRooms(&model.ListOptions{FloorID: &floorID})
+}
+
+// FindRooms returns the rooms in the order and page of the list options.
+// Rooms can only be filtered by their floors and searched by their description
+func (d *Datastore) FindRooms(opts *model.ListOptions) ([]*model.Room, error) {
+	roomOpts := &model.ListOptions{
+		FloorID:    opts.FloorID,
+		FloorIDs:   opts.FloorIDs,
+		Search:     opts.Search,
+		Sort:       opts.Sort,
+		Descending: opts.Descending,
+		Limit:      opts.Limit,
+		Cursor:     opts.Cursor,
+	}
+	stmt, args, err := listStmt(roomsFindAllStmt, roomOpts, roomSortColumns, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := d.q.Query(stmt, args...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	rooms := []*model.Room{}
+
+	for rows.Next() {
+		r, err := scanRoom(rows)
+		if err != nil {
+			return nil, err
+		}
+		rooms = append(rooms, r)
+	}
+	return rooms, rows.Err()
+}
+
+// CreateRoom creates a room in the database and returns the generated id
+func (d *Datastore) CreateRoom(r *model.Room) (int64, error) {
+	res, err := d.q.Exec(roomCreateStmt, r.Description, r.FloorID)
+	if err != nil {
+		return 0, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	return id, err
+}
+
+// DeleteRoom deletes the room with the given id, its devices stay on the floor without a room
+func (d *Datastore) DeleteRoom(roomID int64) error {
+	res, err := d.q.Exec(roomDeleteStmt, roomID)
+	if err != nil {
+		return err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return fmt.Errorf("Room with id %d didnt exist", roomID)
+	}
+	return err
+}
+
+// UpdateRoom updates the description of an existing room, a room can not be moved to another floor.
+// The version of the model must match the stored one, otherwise model.ErrVersionConflict is returned
+func (d *Datastore) UpdateRoom(r *model.Room) error {
+	res, err :=
+		d.q.Exec(roomUpdateStmt, r.Description, r.ID, r.Version)
+	if err != nil {
+		return err
+	}
+	return checkVersion(res)
+}
+
+var roomByIDStmt = `
+SELECT ` + roomColumns + ` FROM rooms WHERE id = ?
+`
+
+var roomsFindAllStmt = `
+SELECT ` + roomColumns + ` FROM rooms
+`
+
+var roomCreateStmt = `
+INSERT INTO rooms(description, floor_id) VALUES(?, ?)
+`
+
+var roomUpdateStmt = `
+UPDATE rooms SET description = ?, version = version + 1 WHERE id = ? AND version = ?
+`
+
+var roomDeleteStmt = `
+DELETE FROM rooms WHERE id = ?
+`
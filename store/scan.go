@@ -0,0 +1,123 @@
+package store
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/he4d/almue-backend/model"
+)
+
+// rowScanner is implemented by *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// The column lists are selected by every query of a model and scanned in the same order
+// by its scan function. New columns must be added to both, columns that are not listed are
+// ignored so adding them by a migration does not break older queries
+const (
+	floorColumns = `id, created, modified, description, version`
+
+	shutterColumns = `id, created, modified, description,
+open_pin, close_pin, complete_way_in_seconds,
+opening_in_prc, jobs_enabled, open_time, close_time,
+emergency_enabled, device_status, disabled,
+floor_id, room_id, version, fault_message, fault_time`
+
+	roomColumns = `id, created, modified, description, floor_id, version`
+
+	calendarExceptionColumns = `id, created, modified, description,
+start_date, end_date, action, shift_minutes, jobs, all_devices, source, version`
+
+	lightingColumns = `id, created, modified, description,
+switch_pin, jobs_enabled, on_time, off_time,
+emergency_enabled, device_status, disabled,
+floor_id, room_id, version, fault_message, fault_time`
+)
+
+// notFound replaces sql.ErrNoRows of a single row query by model.ErrNotFound
+func notFound(err error) error {
+	if err == sql.ErrNoRows {
+		return model.ErrNotFound
+	}
+	return err
+}
+
+// scanFloor scans the floorColumns of a row
+func scanFloor(row rowScanner) (*model.Floor, error) {
+	f := new(model.Floor)
+	if err := row.Scan(&f.ID, &f.Created, &f.Modified, &f.Description, &f.Version); err != nil {
+		return nil, notFound(err)
+	}
+	return f, nil
+}
+
+// scanRoom scans the roomColumns of a row
+func scanRoom(row rowScanner) (*model.Room, error) {
+	r := new(model.Room)
+	if err := row.Scan(&r.ID, &r.Created, &r.Modified, &r.Description, &r.FloorID, &r.Version); err != nil {
+		return nil, notFound(err)
+	}
+	return r, nil
+}
+
+// scanCalendarException scans the calendarExceptionColumns of a row.
+// The devices of the exception are stored in link tables and not scanned
+func scanCalendarException(row rowScanner) (*model.CalendarException, error) {
+	e := new(model.CalendarException)
+	var jobs string
+	if err := row.Scan(
+		&e.ID, &e.Created, &e.Modified, &e.Description,
+		&e.StartDate, &e.EndDate, &e.Action, &e.ShiftMinutes, &jobs, &e.AllDevices, &e.Source, &e.Version); err != nil {
+		return nil, notFound(err)
+	}
+	e.Jobs = []string{}
+	if jobs != "" {
+		e.Jobs = strings.Split(jobs, ",")
+	}
+	e.Shutters = []int64{}
+	e.Lightings = []int64{}
+	return e, nil
+}
+
+// scanShutter scans the shutterColumns of a row
+func scanShutter(row rowScanner) (*model.Shutter, error) {
+	s := new(model.Shutter)
+	var faultMessage sql.NullString
+	var faultTime *time.Time
+	if err := row.Scan(
+		&s.ID, &s.Created, &s.Modified, &s.Description,
+		&s.OpenPin, &s.ClosePin, &s.CompleteWayInSeconds,
+		&s.OpeningInPrc, &s.JobsEnabled, &s.OpenTime, &s.CloseTime,
+		&s.EmergencyEnabled, &s.DeviceStatus, &s.Disabled,
+		&s.FloorID, &s.RoomID, &s.Version, &faultMessage, &faultTime); err != nil {
+		return nil, notFound(err)
+	}
+	s.Fault = newFault(faultMessage, faultTime)
+	return s, nil
+}
+
+// scanLighting scans the lightingColumns of a row
+func scanLighting(row rowScanner) (*model.Lighting, error) {
+	l := new(model.Lighting)
+	var faultMessage sql.NullString
+	var faultTime *time.Time
+	if err := row.Scan(
+		&l.ID, &l.Created, &l.Modified, &l.Description,
+		&l.SwitchPin, &l.JobsEnabled, &l.OnTime, &l.OffTime,
+		&l.EmergencyEnabled, &l.DeviceStatus, &l.Disabled,
+		&l.FloorID, &l.RoomID, &l.Version, &faultMessage, &faultTime); err != nil {
+		return nil, notFound(err)
+	}
+	l.Fault = newFault(faultMessage, faultTime)
+	return l, nil
+}
+
+// newFault returns the fault of the scanned fault columns or nil if the device has no fault
+func newFault(message sql.NullString, at *time.Time) *model.DeviceFault {
+	if !message.Valid || at == nil {
+		return nil
+	}
+	return &model.DeviceFault{Message: message.String, Time: *at}
+}
@@ -8,52 +8,36 @@ import (
 
 // GetShutter returns the shutter with the given id
 func (d *Datastore) GetShutter(shutterID int64) (*model.Shutter, error) {
-	s := new(model.Shutter)
-
-	err := d.QueryRow(shutterByIDStmt, shutterID).Scan(
-		&s.ID, &s.Created, &s.Modified, &s.Description,
-		&s.OpenPin, &s.ClosePin, &s.CompleteWayInSeconds,
-		&s.OpeningInPrc, &s.JobsEnabled, &s.OpenTime, &s.CloseTime,
-		&s.EmergencyEnabled, &s.DeviceStatus, &s.Disabled,
-		&s.FloorID)
-
+	s, err := scanShutter(d.q.QueryRow(shutterByIDStmt, shutterID))
+	if err != nil {
+		return nil, err
+	}
+	tags, err := d.tagsOf(shutterTagLinks.selectDevice, shutterID)
 	if err != nil {
 		return nil, err
 	}
-	return s, err
+	s.Tags = model.SortTags(tags[shutterID])
+	return s, nil
 }
 
 // GetShutterListOfFloor returns all shutters of the floor with the provided floorId
 func (d *Datastore) GetShutterListOfFloor(floorID int64) ([]*model.Shutter, error) {
-	rows, err := d.Query(shuttersOfFloorStmt, floorID)
+	return d.FindShutters(&model.ListOptions{FloorID: &floorID})
+}
+
+// GetShutterList returns all shutters that exist in the store
+func (d *Datastore) GetShutterList() ([]*model.Shutter, error) {
+	return d.FindShutters(&model.ListOptions{})
+}
 
+// FindShutters returns the shutters that match the filters of the list options in their order and page
+func (d *Datastore) FindShutters(opts *model.ListOptions) ([]*model.Shutter, error) {
+	stmt, args, err := listStmt(shuttersFindAllStmt, opts, shutterSortColumns, shutterTagLinks)
 	if err != nil {
 		return nil, err
 	}
 
-	defer rows.Close()
-
-	shutters := []*model.Shutter{}
-
-	for rows.Next() {
-		s := new(model.Shutter)
-		if err := rows.Scan(
-			&s.ID, &s.Created, &s.Modified, &s.Description,
-			&s.OpenPin, &s.ClosePin, &s.CompleteWayInSeconds,
-			&s.OpeningInPrc, &s.JobsEnabled, &s.OpenTime, &s.CloseTime,
-			&s.EmergencyEnabled, &s.DeviceStatus, &s.Disabled,
-			&s.FloorID); err != nil {
-			return nil, err
-		}
-		shutters = append(shutters, s)
-	}
-
-	return shutters, err
-}
-
-// GetShutterList returns all shutters that exist in the store
-func (d *Datastore) GetShutterList() ([]*model.Shutter, error) {
-	rows, err := d.Query(shuttersFindAllStmt)
+	rows, err := d.q.Query(stmt, args...)
 
 	if err != nil {
 		return nil, err
@@ -64,41 +48,58 @@ func (d *Datastore) GetShutterList() ([]*model.Shutter, error) {
 	shutters := []*model.Shutter{}
 
 	for rows.Next() {
-		s := new(model.Shutter)
-		if err := rows.Scan(
-			&s.ID, &s.Created, &s.Modified, &s.Description,
-			&s.OpenPin, &s.ClosePin, &s.CompleteWayInSeconds,
-			&s.OpeningInPrc, &s.JobsEnabled, &s.OpenTime, &s.CloseTime,
-			&s.EmergencyEnabled, &s.DeviceStatus, &s.Disabled,
-			&s.FloorID); err != nil {
+		s, err := scanShutter(rows)
+		if err != nil {
 			return nil, err
 		}
 		shutters = append(shutters, s)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
 
-	return shutters, err
+	ids := []int64{}
+	for _, s := range shutters {
+		ids = append(ids, s.ID)
+	}
+	tags, err := d.tagsOfDevices(shutterTagLinks, ids)
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range shutters {
+		s.Tags = model.SortTags(tags[s.ID])
+	}
+	return shutters, nil
 }
 
-// CreateShutter creates a new shutter in the store and returns the generated id
+// CreateShutter creates a new shutter with its tags in the store and returns the generated id.
+// If a pin of the shutter is assigned to another device a *model.PinConflictError is returned
 func (d *Datastore) CreateShutter(s *model.Shutter) (int64, error) {
-	res, err := d.Exec(
-		shutterCreateStmt,
-		s.Description, s.OpenPin, s.ClosePin, s.CompleteWayInSeconds,
-		s.JobsEnabled, s.OpenTime.UTC(), s.CloseTime.UTC(), s.EmergencyEnabled,
-		"stopped", s.Disabled, s.FloorID)
-	if err != nil {
-		return 0, err
-	}
-	id, err := res.LastInsertId()
+	var id int64
+	err := d.WithTx(func(tx *Datastore) error {
+		res, err := tx.q.Exec(
+			shutterCreateStmt,
+			s.Description, s.OpenPin, s.ClosePin, s.CompleteWayInSeconds,
+			s.JobsEnabled, s.OpenTime.UTC(), s.CloseTime.UTC(), s.EmergencyEnabled,
+			"stopped", s.Disabled, s.FloorID, s.RoomID)
+		if err != nil {
+			return tx.pinConflict(err, model.DeviceTypeShutter, 0, s.OpenPin, s.ClosePin)
+		}
+		if id, err = res.LastInsertId(); err != nil {
+			return err
+		}
+		return tx.setTags(shutterTagLinks, id, s.Tags)
+	})
 	if err != nil {
 		return 0, err
 	}
-	return id, err
+	return id, nil
 }
 
 // DeleteShutter deletes a shutter from the store with the given id
 func (d *Datastore) DeleteShutter(shutterID int64) error {
-	res, err := d.Exec(shutterDeleteStmt, shutterID)
+	res, err := d.q.Exec(shutterDeleteStmt, shutterID)
 	if err != nil {
 		return err
 	}
@@ -112,41 +113,60 @@ func (d *Datastore) DeleteShutter(shutterID int64) error {
 	return err
 }
 
-// UpdateShutter updates a shutter in the store with the given model
+// UpdateShutter updates a shutter and replaces its tags in the store with the given model.
+// The state, the opening and the fault are kept, they are only changed by the device controller.
+// The version of the model must match the stored one, otherwise model.ErrVersionConflict is returned.
+// If a pin of the shutter is assigned to another device a *model.PinConflictError is returned
 func (d *Datastore) UpdateShutter(s *model.Shutter) error {
-	_, err :=
-		d.Exec(
-			shutterUpdateStmt,
-			s.Description, s.OpenPin, s.ClosePin, s.CompleteWayInSeconds,
-			s.JobsEnabled, s.OpenTime.UTC(), s.CloseTime.UTC(), s.EmergencyEnabled,
-			s.DeviceStatus, s.Disabled, s.FloorID, s.ID)
-	return err
+	return d.WithTx(func(tx *Datastore) error {
+		res, err :=
+			tx.q.Exec(
+				shutterUpdateStmt,
+				s.Description, s.OpenPin, s.ClosePin, s.CompleteWayInSeconds,
+				s.JobsEnabled, s.OpenTime.UTC(), s.CloseTime.UTC(), s.EmergencyEnabled,
+				s.Disabled, s.FloorID, s.RoomID, s.ID, s.Version)
+		if err != nil {
+			return tx.pinConflict(err, model.DeviceTypeShutter, s.ID, s.OpenPin, s.ClosePin)
+		}
+		if err := checkVersion(res); err != nil {
+			return err
+		}
+		return tx.setTags(shutterTagLinks, s.ID, s.Tags)
+	})
 }
 
 // UpdateShutterState updates the state of the shutter with the given id
 func (d *Datastore) UpdateShutterState(shutterID int64, newState string) error {
 	_, err :=
-		d.Exec(shutterStateUpdateStmt, newState, shutterID)
+		d.q.Exec(shutterStateUpdateStmt, newState, shutterID)
 	return err
 }
 
 // UpdateShutterOpening updates the current openingwidth of the shutter with the provided idd
 func (d *Datastore) UpdateShutterOpening(shutterID int64, openingInPrc int) error {
 	_, err :=
-		d.Exec(shutterOpeningInPrcUpdateStmt, openingInPrc, shutterID)
+		d.q.Exec(shutterOpeningInPrcUpdateStmt, openingInPrc, shutterID)
 	return err
 }
 
-var shutterByIDStmt = `
-SELECT * FROM shutters WHERE id = ?
-`
+// UpdateShutterFault sets the fault of the shutter with the given id and its state to fault.
+// A nil fault clears the fault, the state is then set by the next state update
+func (d *Datastore) UpdateShutterFault(shutterID int64, fault *model.DeviceFault) error {
+	if fault == nil {
+		_, err := d.q.Exec(shutterFaultClearStmt, shutterID)
+		return err
+	}
+	_, err :=
+		d.q.Exec(shutterFaultUpdateStmt, model.DeviceStatusFault, fault.Message, fault.Time.UTC(), shutterID)
+	return err
+}
 
-var shuttersOfFloorStmt = `
-SELECT * FROM shutters WHERE floor_id = ?
+var shutterByIDStmt = `
+SELECT ` + shutterColumns + ` FROM shutters WHERE id = ?
 `
 
 var shuttersFindAllStmt = `
-SELECT * FROM shutters
+SELECT ` + shutterColumns + ` FROM shutters
 `
 
 var shutterStateUpdateStmt = `
@@ -155,6 +175,21 @@ device_status = ?
 WHERE id = ?
 `
 
+var shutterFaultUpdateStmt = `
+UPDATE shutters SET
+device_status = ?,
+fault_message = ?,
+fault_time = ?
+WHERE id = ?
+`
+
+var shutterFaultClearStmt = `
+UPDATE shutters SET
+fault_message = NULL,
+fault_time = NULL
+WHERE id = ?
+`
+
 var shutterOpeningInPrcUpdateStmt = `
 UPDATE shutters SET
 opening_in_prc = ?
@@ -173,9 +208,10 @@ close_time,
 emergency_enabled,
 device_status,
 disabled,
-floor_id
+floor_id,
+room_id
 ) 
-VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 `
 
 var shutterUpdateStmt = `
@@ -188,10 +224,11 @@ jobs_enabled = ?,
 open_time = ?,
 close_time = ?,
 emergency_enabled = ?,
-device_status = ?,
 disabled = ?,
-floor_id = ? 
-WHERE id = ?
+floor_id = ?,
+room_id = ?,
+version = version + 1
+WHERE id = ? AND version = ?
 `
 
 var shutterDeleteStmt = `
@@ -4,10 +4,12 @@ import (
 	"database/sql"
 	"fmt"
 	"os"
+	"strings"
 	"time"
 
 	"io/ioutil"
 
+	"github.com/he4d/almue-backend/model"
 	"github.com/he4d/simplejack"
 	sqlite3 "github.com/mattn/go-sqlite3"
 )
@@ -15,29 +17,58 @@ import (
 // Datastore contains all necessary objects for store handling
 type Datastore struct {
 	*sql.DB
+	q      queryer
 	logger *simplejack.Logger
 }
 
 // New returns a new datastore that is completely initialized
 func New(path string, logger *simplejack.Logger) (*Datastore, error) {
-	db, err := sql.Open("sqlite3", path)
+	db, err := Open(path)
 	if err != nil {
 		return nil, err
 	}
 
-	if err := setupDatabase(db); err != nil {
+	if err := Migrate(db); err != nil {
+		db.Close()
 		return nil, err
 	}
-	return &Datastore{DB: db, logger: logger}, nil
+	return &Datastore{DB: db, q: timedQueryer{db}, logger: logger}, nil
 }
 
-func setupDatabase(db *sql.DB) error {
-	if _, err := db.Exec("PRAGMA foreign_keys = ON"); err != nil {
+// Open opens the database without migrating it. The foreign keys are turned on by the
+// parameters of the path, so every connection of the pool enforces them and runs the cascades
+func Open(path string) (*sql.DB, error) {
+	separator := "?"
+	if strings.Contains(path, "?") {
+		separator = "&"
+	}
+	return sql.Open("sqlite3", path+separator+"_foreign_keys=1")
+}
+
+// checkVersion returns model.ErrVersionConflict if the versioned update did not affect any row,
+// because the row was updated or deleted in the meantime
+func checkVersion(res sql.Result) error {
+	affected, err := res.RowsAffected()
+	if err != nil {
 		return err
 	}
-	return Migrate(db)
+	if affected == 0 {
+		return model.ErrVersionConflict
+	}
+	return nil
+}
+
+// Ping checks that the database can be queried. The query reads the migrations table,
+// as the ping of the connection does not touch the database file of sqlite
+func (d *Datastore) Ping() error {
+	var count int
+	return d.DB.QueryRow(pingStmt).Scan(&count)
 }
 
+var pingStmt = `
+SELECT COUNT(*) FROM migrations
+`
+
 // GetBackup creates a database backup and returns it as a byte array
 func (d *Datastore) GetBackup() ([]byte, error) {
 	var driverName = fmt.Sprintf("sqlite3_backup_%v", time.Now().UnixNano())
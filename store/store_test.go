@@ -1,22 +1,24 @@
 package store
 
 import (
+	"context"
 	"io/ioutil"
 	"log"
 	"os"
+	"path/filepath"
 	"testing"
 
+	"github.com/he4d/almue-backend/model"
 	"github.com/he4d/simplejack"
 	_ "github.com/mattn/go-sqlite3"
 )
 
-const dbPath = "../test.db"
+// dbPath is a shared in-memory database so that the tests do not touch the disk
+const dbPath = "file:store_test?mode=memory&cache=shared"
 
 var store *Datastore
 
 func TestMain(m *testing.M) {
-	os.Remove(dbPath)
-
 	var err error
 	store, err = New(dbPath, simplejack.New(simplejack.TRACE, ioutil.Discard))
 
@@ -33,8 +35,6 @@ func TestMain(m *testing.M) {
 
 	store.Close()
 
-	os.Remove(dbPath)
-
 	os.Exit(code)
 }
 
@@ -48,3 +48,51 @@ func TestMigration(t *testing.T) {
 		t.Error("Store is nil but New didnt return an error")
 	}
 }
+
+func TestForeignKeysOnEveryConnection(t *testing.T) {
+	dir, err := ioutil.TempDir("", "almue")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	d, err := New(filepath.Join(dir, "almue.db"), simplejack.New(simplejack.TRACE, ioutil.Discard))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	d.SetMaxOpenConns(2)
+
+	// the held connection is the one that migrated the database, the store has to use another one
+	conn, err := d.Conn(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	floorDescr, descr, pin := "erdgeschoss", "flur", 4
+	floorID, err := d.CreateFloor(&model.Floor{Description: &floorDescr})
+	if err != nil {
+		t.Fatal(err)
+	}
+	lightingID, err := d.CreateLighting(&model.Lighting{Description: &descr, SwitchPin: &pin, FloorID: &floorID, Tags: []string{"abends"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.DeleteLighting(lightingID); err != nil {
+		t.Fatal(err)
+	}
+
+	var links, enabled int
+	if err := conn.QueryRowContext(context.Background(), "SELECT count(*) FROM lighting_tags").Scan(&links); err != nil {
+		t.Fatal(err)
+	}
+	if links != 0 {
+		t.Errorf("Expected the tag links of the deleted lighting to be deleted but found %d", links)
+	}
+	if tags, err := d.GetTagList(); err != nil || len(tags) != 0 {
+		t.Errorf("Expected the unused tag to be deleted but got %v, %v", tags, err)
+	}
+	if err := conn.QueryRowContext(context.Background(), "PRAGMA foreign_keys").Scan(&enabled); err != nil || enabled != 1 {
+		t.Errorf("Expected the foreign keys on the held connection but got %d, %v", enabled, err)
+	}
+}
@@ -0,0 +1,145 @@
+package store
+
+import (
+	"fmt"
+
+	"github.com/he4d/almue-backend/model"
+)
+
+// tagLinks are the statements of the link table between the tags and one type of devices
+type tagLinks struct {
+	// selectDevices selects the device id and tag names of the devices, the %s is replaced by the placeholders of their ids
+	selectDevices string
+	// selectDevice selects the device id and tag names of one device
+	selectDevice string
+	deleteDevice string
+	// insert links the device with the id to the tag with the name
+	insert string
+	// filter is the condition of listStmt that keeps the devices with a tag
+	filter string
+}
+
+var shutterTagLinks = &tagLinks{
+	selectDevices: `
+SELECT l.shutter_id, t.name FROM shutter_tags l JOIN tags t ON t.id = l.tag_id WHERE l.shutter_id IN (%s) ORDER BY t.name
+`,
+	selectDevice: `
+SELECT l.shutter_id, t.name FROM shutter_tags l JOIN tags t ON t.id = l.tag_id WHERE l.shutter_id = ? ORDER BY t.name
+`,
+	deleteDevice: `
+DELETE FROM shutter_tags WHERE shutter_id = ?
+`,
+	insert: `
+INSERT INTO shutter_tags (shutter_id, tag_id) SELECT ?, id FROM tags WHERE name = ?
+`,
+	filter: `id IN (SELECT l.shutter_id FROM shutter_tags l JOIN tags t ON t.id = l.tag_id WHERE t.name = ?)`,
+}
+
+var lightingTagLinks = &tagLinks{
+	selectDevices: `
+SELECT l.lighting_id, t.name FROM lighting_tags l JOIN tags t ON t.id = l.tag_id WHERE l.lighting_id IN (%s) ORDER BY t.name
+`,
+	selectDevice: `
+SELECT l.lighting_id, t.name FROM lighting_tags l JOIN tags t ON t.id = l.tag_id WHERE l.lighting_id = ? ORDER BY t.name
+`,
+	deleteDevice: `
+DELETE FROM lighting_tags WHERE lighting_id = ?
+`,
+	insert: `
+INSERT INTO lighting_tags (lighting_id, tag_id) SELECT ?, id FROM tags WHERE name = ?
+`,
+	filter: `id IN (SELECT l.lighting_id FROM lighting_tags l JOIN tags t ON t.id = l.tag_id WHERE t.name = ?)`,
+}
+
+// GetTagList returns all tags with the number of their devices
+func (d *Datastore) GetTagList() ([]*model.Tag, error) {
+	rows, err := d.q.Query(tagsFindAllStmt)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := []*model.Tag{}
+	for rows.Next() {
+		t := new(model.Tag)
+		if err := rows.Scan(&t.Name, &t.Shutters, &t.Lightings); err != nil {
+			return nil, err
+		}
+		tags = append(tags, t)
+	}
+	return tags, rows.Err()
+}
+
+// tagsOf returns the tag names by device id of the links the statement selects
+func (d *Datastore) tagsOf(stmt string, args ...interface{}) (map[int64][]string, error) {
+	rows, err := d.q.Query(stmt, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := map[int64][]string{}
+	for rows.Next() {
+		var deviceID int64
+		var name string
+		if err := rows.Scan(&deviceID, &name); err != nil {
+			return nil, err
+		}
+		tags[deviceID] = append(tags[deviceID], name)
+	}
+	return tags, rows.Err()
+}
+
+// maxTagQueryDevices is the number of devices whose tags are queried with one statement,
+// it keeps the statements below the parameter limit of sqlite
+var maxTagQueryDevices = 500
+
+// tagsOfDevices returns the tag names by device id of the devices with the given ids
+func (d *Datastore) tagsOfDevices(links *tagLinks, ids []int64) (map[int64][]string, error) {
+	tags := map[int64][]string{}
+	for start := 0; start < len(ids); start += maxTagQueryDevices {
+		end := start + maxTagQueryDevices
+		if end > len(ids) {
+			end = len(ids)
+		}
+		args := []interface{}{}
+		for _, id := range ids[start:end] {
+			args = append(args, id)
+		}
+		chunk, err := d.tagsOf(fmt.Sprintf(links.selectDevices, placeholders(len(args))), args...)
+		if err != nil {
+			return nil, err
+		}
+		for id, names := range chunk {
+			tags[id] = names
+		}
+	}
+	return tags, nil
+}
+
+// setTags replaces the tags of the device, it must be called in a transaction
+func (d *Datastore) setTags(links *tagLinks, deviceID int64, tags []string) error {
+	if _, err := d.q.Exec(links.deleteDevice, deviceID); err != nil {
+		return err
+	}
+	for _, tag := range model.SortTags(tags) {
+		if _, err := d.q.Exec(tagCreateStmt, tag); err != nil {
+			return err
+		}
+		if _, err := d.q.Exec(links.insert, deviceID, tag); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var tagsFindAllStmt = `
+SELECT t.name,
+(SELECT count(*) FROM shutter_tags WHERE tag_id = t.id),
+(SELECT count(*) FROM lighting_tags WHERE tag_id = t.id)
+FROM tags t ORDER BY t.name
+`
+
+var tagCreateStmt = `
+INSERT OR IGNORE INTO tags (name) VALUES (?)
+`
@@ -0,0 +1,44 @@
+package store
+
+import "database/sql"
+
+// queryer is implemented by *sql.DB and *sql.Tx,
+// so the store methods work the same with or without a transaction
+type queryer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// WithTx calls fn with a datastore whose methods all run in one transaction.
+// The transaction is committed if fn returns nil and rolled back otherwise.
+// Calling WithTx on the datastore of a transaction runs fn in the same transaction.
+//
+// SQLite allows only one writer at a time, so fn must not write with another
+// datastore than the given one. Such a write waits until the transaction ends.
+func (d *Datastore) WithTx(fn func(tx *Datastore) error) error {
+	if runsInTx(d.q) {
+		return fn(d)
+	}
+
+	tx, err := d.Begin()
+	if err != nil {
+		return err
+	}
+	if err := fn(&Datastore{DB: d.DB, q: timedQueryer{tx}, logger: d.logger}); err != nil {
+		if rollbackErr := tx.Rollback(); rollbackErr != nil {
+			d.logger.Error.Printf("Could not roll back the transaction: %v", rollbackErr)
+		}
+		return err
+	}
+	return tx.Commit()
+}
+
+// runsInTx reports whether the queryer runs its statements in a transaction
+func runsInTx(q queryer) bool {
+	if t, ok := q.(timedQueryer); ok {
+		q = t.q
+	}
+	_, ok := q.(*sql.Tx)
+	return ok
+}
@@ -0,0 +1,49 @@
+package store
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/he4d/almue-backend/model"
+)
+
+func TestWithTx(t *testing.T) {
+	clearTable()
+
+	committed, rolledBack := "erdgeschoss", "obergeschoss"
+	if err := store.WithTx(func(tx *Datastore) error {
+		_, err := tx.CreateFloor(&model.Floor{Description: &committed})
+		return err
+	}); err != nil {
+		t.Fatalf("Could not create the floor in a transaction: %v", err)
+	}
+
+	errAbort := errors.New("abort")
+	err := store.WithTx(func(tx *Datastore) error {
+		if _, err := tx.CreateFloor(&model.Floor{Description: &rolledBack}); err != nil {
+			return err
+		}
+		// a nested transaction joins the outer one
+		return tx.WithTx(func(nested *Datastore) error {
+			floors, err := nested.GetFloorList()
+			if err != nil {
+				return err
+			}
+			if len(floors) != 2 {
+				t.Errorf("Expected the nested transaction to see 2 floors but got %d", len(floors))
+			}
+			return errAbort
+		})
+	})
+	if err != errAbort {
+		t.Fatalf("Expected the error of the transaction but got %v", err)
+	}
+
+	floors, err := store.GetFloorList()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(floors) != 1 || *floors[0].Description != committed {
+		t.Errorf("Expected only the committed floor but got %v", floors)
+	}
+}
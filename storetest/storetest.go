@@ -0,0 +1,925 @@
+// Package storetest provides the conformance tests that every storage backend of almue has to pass
+package storetest
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/he4d/almue-backend/almue"
+	"github.com/he4d/almue-backend/embedded"
+	"github.com/he4d/almue-backend/model"
+)
+
+// Store is the interface a storage backend has to implement
+type Store interface {
+	almue.DeviceStore
+	embedded.DeviceStateStore
+}
+
+// Run runs the conformance tests. open must return a new and empty store for every call
+func Run(t *testing.T, open func(t *testing.T) Store) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, s Store)
+	}{
+		{"Floors", testFloors},
+		{"Rooms", testRooms},
+		{"Shutters", testShutters},
+		{"Lightings", testLightings},
+		{"DeviceStates", testDeviceStates},
+		{"DeviceEvents", testDeviceEvents},
+		{"Constraints", testConstraints},
+		{"DeleteFloorCascades", testDeleteFloorCascades},
+		{"Pins", testPins},
+		{"Tags", testTags},
+		{"CalendarExceptions", testCalendarExceptions},
+		{"Find", testFind},
+		{"Configuration", testConfiguration},
+		{"Transactions", testTransactions},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			test.test(t, open(t))
+		})
+	}
+}
+
+func strPtr(s string) *string { return &s }
+func intPtr(i int) *int       { return &i }
+func idPtr(i int64) *int64    { return &i }
+
+func cursor(value string, id int64, backward bool) *model.ListCursor {
+	return &model.ListCursor{Value: []byte(value), ID: id, Backward: backward}
+}
+
+func timeOfDay(hour, minute int) time.Time {
+	return time.Date(0, 1, 1, hour, minute, 0, 0, time.UTC)
+}
+
+func createFloor(t *testing.T, s Store, description string) int64 {
+	t.Helper()
+	id, err := s.CreateFloor(&model.Floor{Description: strPtr(description)})
+	if err != nil {
+		t.Fatalf("Could not create the floor %s: %v", description, err)
+	}
+	return id
+}
+
+func newShutter(floorID int64, description string, openPin, closePin int) *model.Shutter {
+	return &model.Shutter{
+		Description:          strPtr(description),
+		OpenPin:              intPtr(openPin),
+		ClosePin:             intPtr(closePin),
+		CompleteWayInSeconds: intPtr(20),
+		JobsEnabled:          true,
+		OpenTime:             timeOfDay(7, 30),
+		CloseTime:            timeOfDay(20, 0),
+		FloorID:              idPtr(floorID),
+	}
+}
+
+func newLighting(floorID int64, description string, switchPin int) *model.Lighting {
+	return &model.Lighting{
+		Description: strPtr(description),
+		SwitchPin:   intPtr(switchPin),
+		OnTime:      timeOfDay(18, 0),
+		OffTime:     timeOfDay(23, 0),
+		FloorID:     idPtr(floorID),
+	}
+}
+
+func createShutter(t *testing.T, s Store, floorID int64, description string, openPin, closePin int) int64 {
+	t.Helper()
+	id, err := s.CreateShutter(newShutter(floorID, description, openPin, closePin))
+	if err != nil {
+		t.Fatalf("Could not create the shutter %s: %v", description, err)
+	}
+	return id
+}
+
+func createLighting(t *testing.T, s Store, floorID int64, description string, switchPin int) int64 {
+	t.Helper()
+	id, err := s.CreateLighting(newLighting(floorID, description, switchPin))
+	if err != nil {
+		t.Fatalf("Could not create the lighting %s: %v", description, err)
+	}
+	return id
+}
+
+func testFloors(t *testing.T, s Store) {
+	if floors, err := s.GetFloorList(); err != nil || len(floors) != 0 {
+		t.Fatalf("Expected no floors in a new store but got %v, %v", floors, err)
+	}
+
+	id := createFloor(t, s, "erdgeschoss")
+	floor, err := s.GetFloor(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if floor.ID != id || *floor.Description != "erdgeschoss" || floor.Version != 1 || floor.Created.IsZero() {
+		t.Errorf("Expected the created floor but got %+v", floor)
+	}
+
+	floor.Description = strPtr("keller")
+	if err := s.UpdateFloor(floor); err != nil {
+		t.Fatal(err)
+	}
+	updated, err := s.GetFloor(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *updated.Description != "keller" || updated.Version != 2 {
+		t.Errorf("Expected the updated floor with version 2 but got %+v", updated)
+	}
+	if err := s.UpdateFloor(floor); err != model.ErrVersionConflict {
+		t.Errorf("Expected a version conflict on updating a stale floor but got %v", err)
+	}
+
+	if err := s.DeleteFloor(id); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.GetFloor(id); err != model.ErrNotFound {
+		t.Errorf("Expected model.ErrNotFound for a deleted floor but got %v", err)
+	}
+	if err := s.DeleteFloor(id); err == nil {
+		t.Error("Expected an error on deleting a missing floor")
+	}
+}
+
+func createRoom(t *testing.T, s Store, floorID int64, description string) int64 {
+	t.Helper()
+	id, err := s.CreateRoom(&model.Room{Description: strPtr(description), FloorID: idPtr(floorID)})
+	if err != nil {
+		t.Fatalf("Could not create the room %s: %v", description, err)
+	}
+	return id
+}
+
+func testRooms(t *testing.T, s Store) {
+	groundFloor := createFloor(t, s, "erdgeschoss")
+	upperFloor := createFloor(t, s, "obergeschoss")
+
+	id := createRoom(t, s, groundFloor, "kueche")
+	room, err := s.GetRoom(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if room.ID != id || *room.Description != "kueche" || *room.FloorID != groundFloor || room.Version != 1 {
+		t.Errorf("Expected the created room but got %+v", room)
+	}
+	if _, err := s.CreateRoom(&model.Room{Description: strPtr("kueche"), FloorID: idPtr(groundFloor)}); err == nil {
+		t.Error("Expected an error for a duplicate room description on the same floor")
+	}
+	createRoom(t, s, upperFloor, "kueche")
+	if _, err := s.CreateRoom(&model.Room{Description: strPtr("bad"), FloorID: idPtr(upperFloor + 1)}); err == nil {
+		t.Error("Expected an error for a room on a missing floor")
+	}
+	if rooms, err := s.GetRoomListOfFloor(groundFloor); err != nil || len(rooms) != 1 || rooms[0].ID != id {
+		t.Errorf("Expected the room of the ground floor but got %v, %v", rooms, err)
+	}
+
+	room.Description = strPtr("esszimmer")
+	if err := s.UpdateRoom(room); err != nil {
+		t.Fatal(err)
+	}
+	if updated, err := s.GetRoom(id); err != nil || *updated.Description != "esszimmer" || updated.Version != 2 {
+		t.Errorf("Expected the updated room with version 2 but got %+v, %v", updated, err)
+	}
+	if err := s.UpdateRoom(room); err != model.ErrVersionConflict {
+		t.Errorf("Expected a version conflict on updating a stale room but got %v", err)
+	}
+
+	shutter := newShutter(groundFloor, "fenster", 17, 27)
+	shutter.RoomID = idPtr(id)
+	shutterID, err := s.CreateShutter(shutter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	createLighting(t, s, groundFloor, "flur", 4)
+	lighting := newLighting(upperFloor, "decke", 5)
+	lighting.RoomID = idPtr(id)
+	if _, err := s.CreateLighting(lighting); err == nil {
+		t.Error("Expected an error for a room on another floor than the device")
+	}
+	if shutters, err := s.FindShutters(&model.ListOptions{RoomID: idPtr(id)}); err != nil ||
+		len(shutters) != 1 || shutters[0].ID != shutterID || *shutters[0].RoomID != id {
+		t.Errorf("Expected the shutter of the room but got %v, %v", shutters, err)
+	}
+	if lightings, err := s.FindLightings(&model.ListOptions{RoomID: idPtr(id)}); err != nil || len(lightings) != 0 {
+		t.Errorf("Expected no lightings in the room but got %v, %v", lightings, err)
+	}
+
+	if err := s.DeleteRoom(id); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.GetRoom(id); err != model.ErrNotFound {
+		t.Errorf("Expected model.ErrNotFound for a deleted room but got %v", err)
+	}
+	// the devices of a deleted room stay on their floor
+	if shutter, err := s.GetShutter(shutterID); err != nil || shutter.RoomID != nil || shutter.Version != 2 {
+		t.Errorf("Expected the shutter without a room and with version 2 but got %+v, %v", shutter, err)
+	}
+	if err := s.DeleteRoom(id); err == nil {
+		t.Error("Expected an error on deleting a missing room")
+	}
+
+	if err := s.DeleteFloor(upperFloor); err != nil {
+		t.Fatal(err)
+	}
+	if rooms, err := s.GetRoomList(); err != nil || len(rooms) != 0 {
+		t.Errorf("Expected the rooms to be deleted with their floor but got %v, %v", rooms, err)
+	}
+}
+
+func testShutters(t *testing.T, s Store) {
+	floorID := createFloor(t, s, "erdgeschoss")
+	id := createShutter(t, s, floorID, "kueche", 17, 27)
+
+	shutter, err := s.GetShutter(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if shutter.ID != id || *shutter.Description != "kueche" || *shutter.OpenPin != 17 || *shutter.ClosePin != 27 ||
+		*shutter.CompleteWayInSeconds != 20 || !shutter.JobsEnabled || *shutter.FloorID != floorID ||
+		shutter.DeviceStatus != "stopped" || shutter.Version != 1 || shutter.Created.IsZero() {
+		t.Errorf("Expected the created shutter but got %+v", shutter)
+	}
+	if !shutter.OpenTime.Equal(timeOfDay(7, 30)) || !shutter.CloseTime.Equal(timeOfDay(20, 0)) {
+		t.Errorf("Expected the times 07:30 and 20:00 but got %v and %v", shutter.OpenTime, shutter.CloseTime)
+	}
+
+	shutter.Description = strPtr("bad")
+	shutter.OpenPin = intPtr(5)
+	shutter.CloseTime = timeOfDay(21, 15)
+	shutter.Disabled = true
+	if err := s.UpdateShutter(shutter); err != nil {
+		t.Fatal(err)
+	}
+	updated, err := s.GetShutter(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *updated.Description != "bad" || *updated.OpenPin != 5 || !updated.Disabled ||
+		!updated.CloseTime.Equal(timeOfDay(21, 15)) || updated.Version != 2 {
+		t.Errorf("Expected the updated shutter with version 2 but got %+v", updated)
+	}
+	if err := s.UpdateShutter(shutter); err != model.ErrVersionConflict {
+		t.Errorf("Expected a version conflict on updating a stale shutter but got %v", err)
+	}
+
+	if shutters, err := s.GetShutterListOfFloor(floorID); err != nil || len(shutters) != 1 {
+		t.Errorf("Expected the shutter of the floor but got %v, %v", shutters, err)
+	}
+	if err := s.DeleteShutter(id); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.GetShutter(id); err != model.ErrNotFound {
+		t.Errorf("Expected model.ErrNotFound for a deleted shutter but got %v", err)
+	}
+	if err := s.DeleteShutter(id); err == nil {
+		t.Error("Expected an error on deleting a missing shutter")
+	}
+}
+
+func testLightings(t *testing.T, s Store) {
+	floorID := createFloor(t, s, "erdgeschoss")
+	id := createLighting(t, s, floorID, "flur", 4)
+
+	lighting, err := s.GetLighting(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lighting.ID != id || *lighting.Description != "flur" || *lighting.SwitchPin != 4 ||
+		*lighting.FloorID != floorID || lighting.DeviceStatus != "off" || lighting.Version != 1 {
+		t.Errorf("Expected the created lighting but got %+v", lighting)
+	}
+	if !lighting.OnTime.Equal(timeOfDay(18, 0)) || !lighting.OffTime.Equal(timeOfDay(23, 0)) {
+		t.Errorf("Expected the times 18:00 and 23:00 but got %v and %v", lighting.OnTime, lighting.OffTime)
+	}
+
+	lighting.SwitchPin = intPtr(5)
+	lighting.JobsEnabled = true
+	if err := s.UpdateLighting(lighting); err != nil {
+		t.Fatal(err)
+	}
+	updated, err := s.GetLighting(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *updated.SwitchPin != 5 || !updated.JobsEnabled || updated.Version != 2 {
+		t.Errorf("Expected the updated lighting with version 2 but got %+v", updated)
+	}
+	if err := s.UpdateLighting(lighting); err != model.ErrVersionConflict {
+		t.Errorf("Expected a version conflict on updating a stale lighting but got %v", err)
+	}
+
+	if lightings, err := s.GetLightingListOfFloor(floorID); err != nil || len(lightings) != 1 {
+		t.Errorf("Expected the lighting of the floor but got %v, %v", lightings, err)
+	}
+	if err := s.DeleteLighting(id); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.GetLighting(id); err != model.ErrNotFound {
+		t.Errorf("Expected model.ErrNotFound for a deleted lighting but got %v", err)
+	}
+}
+
+func testDeviceStates(t *testing.T, s Store) {
+	floorID := createFloor(t, s, "erdgeschoss")
+	shutterID := createShutter(t, s, floorID, "kueche", 17, 27)
+	lightingID := createLighting(t, s, floorID, "flur", 4)
+
+	if err := s.UpdateShutterState(shutterID, "opening"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.UpdateShutterOpening(shutterID, 35); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.UpdateLightingState(lightingID, "on"); err != nil {
+		t.Fatal(err)
+	}
+
+	shutter, err := s.GetShutter(shutterID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the state is no change of the configuration, so the version stays the same
+	if shutter.DeviceStatus != "opening" || shutter.OpeningInPrc != 35 || shutter.Version != 1 {
+		t.Errorf("Expected the state opening at 35%% with version 1 but got %+v", shutter)
+	}
+	lighting, err := s.GetLighting(lightingID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lighting.DeviceStatus != "on" || lighting.Version != 1 {
+		t.Errorf("Expected the state on with version 1 but got %+v", lighting)
+	}
+
+	// updating the configuration keeps the opening of the device controller
+	shutter.OpeningInPrc = 80
+	if err := s.UpdateShutter(shutter); err != nil {
+		t.Fatal(err)
+	}
+	if shutter, err = s.GetShutter(shutterID); err != nil || shutter.OpeningInPrc != 35 {
+		t.Errorf("Expected the opening 35%% after an update but got %+v, %v", shutter, err)
+	}
+
+	// a fault sets the state to fault and stays until it is cleared, an update of the configuration keeps it
+	fault := &model.DeviceFault{Message: "relay stuck", Time: time.Date(2017, time.October, 2, 18, 0, 0, 0, time.UTC)}
+	if err := s.UpdateShutterFault(shutterID, fault); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.UpdateLightingFault(lightingID, fault); err != nil {
+		t.Fatal(err)
+	}
+	if shutter, err = s.GetShutter(shutterID); err != nil {
+		t.Fatal(err)
+	}
+	shutter.Fault = nil
+	shutter.DeviceStatus = "stopped"
+	if err := s.UpdateShutter(shutter); err != nil {
+		t.Fatal(err)
+	}
+	lighting.DeviceStatus = "on"
+	if err := s.UpdateLighting(lighting); err != nil {
+		t.Fatal(err)
+	}
+	if shutter, err = s.GetShutter(shutterID); err != nil || shutter.DeviceStatus != model.DeviceStatusFault ||
+		shutter.Fault == nil || shutter.Fault.Message != fault.Message || !shutter.Fault.Time.Equal(fault.Time) {
+		t.Errorf("Expected the fault of the shutter but got %+v, %v", shutter, err)
+	}
+	if lighting, err = s.GetLighting(lightingID); err != nil || lighting.DeviceStatus != model.DeviceStatusFault ||
+		lighting.Fault == nil || lighting.Fault.Message != fault.Message {
+		t.Errorf("Expected the fault of the lighting but got %+v, %v", lighting, err)
+	}
+	if err := s.UpdateShutterFault(shutterID, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.UpdateShutterState(shutterID, "stopped"); err != nil {
+		t.Fatal(err)
+	}
+	if shutter, err = s.GetShutter(shutterID); err != nil || shutter.DeviceStatus != "stopped" || shutter.Fault != nil {
+		t.Errorf("Expected the cleared fault but got %+v, %v", shutter, err)
+	}
+}
+
+func testDeviceEvents(t *testing.T, s Store) {
+	start := time.Date(2017, time.October, 2, 18, 0, 0, 0, time.UTC)
+	events := []*model.DeviceEvent{
+		{DeviceType: "lighting", DeviceID: 1, State: "on", Time: start},
+		{DeviceType: "shutter", DeviceID: 2, State: "closing", Time: start.Add(30 * time.Minute)},
+		{DeviceType: "lighting", DeviceID: 1, State: "off", Time: start.Add(4*time.Hour + 500*time.Millisecond)},
+	}
+	for _, e := range events {
+		if err := s.AddDeviceEvent(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.AddDeviceEvent(&model.DeviceEvent{DeviceType: "floor", DeviceID: 1, State: "on", Time: start}); err == nil {
+		t.Error("Expected an error on recording an event of an unknown device type")
+	}
+
+	// the time of the events is compared as instant, regardless of its location
+	since := start.Add(time.Minute).In(time.FixedZone("CEST", 2*60*60))
+	found, err := s.FindDeviceEvents(since)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(found) != 2 || found[0].State != "closing" || found[0].DeviceType != "shutter" || found[0].DeviceID != 2 ||
+		found[1].State != "off" || !found[1].Time.Equal(start.Add(4*time.Hour)) {
+		t.Errorf("Expected the last two events in their order with times in seconds but got %+v", found)
+	}
+
+	if err := s.DeleteDeviceEvents(start.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if found, err := s.FindDeviceEvents(start.Add(-time.Hour)); err != nil || len(found) != 1 || found[0].State != "off" {
+		t.Errorf("Expected only the last event after deleting the older ones but got %v, %v", found, err)
+	}
+}
+
+func testConstraints(t *testing.T, s Store) {
+	floorID := createFloor(t, s, "erdgeschoss")
+	createShutter(t, s, floorID, "kueche", 17, 27)
+
+	if _, err := s.CreateFloor(&model.Floor{Description: strPtr("erdgeschoss")}); err == nil {
+		t.Error("Expected an error for a duplicate floor description")
+	}
+	if _, err := s.CreateShutter(newShutter(floorID, "bad", 27, 5)); err == nil {
+		t.Error("Expected an error for a pin that is assigned to another shutter")
+	}
+	if _, err := s.CreateLighting(newLighting(floorID, "flur", 17)); err == nil {
+		t.Error("Expected an error for a pin that is assigned to a shutter")
+	}
+	if _, err := s.CreateLighting(newLighting(floorID+1, "flur", 4)); err == nil {
+		t.Error("Expected an error for a missing floor")
+	}
+
+	if shutters, err := s.GetShutterList(); err != nil || len(shutters) != 1 {
+		t.Errorf("Expected only the first shutter but got %v, %v", shutters, err)
+	}
+	if lightings, err := s.GetLightingList(); err != nil || len(lightings) != 0 {
+		t.Errorf("Expected no lightings but got %v, %v", lightings, err)
+	}
+}
+
+func testDeleteFloorCascades(t *testing.T, s Store) {
+	groundFloor := createFloor(t, s, "erdgeschoss")
+	upperFloor := createFloor(t, s, "obergeschoss")
+	shutterID := createShutter(t, s, groundFloor, "kueche", 17, 27)
+	lightingID := createLighting(t, s, groundFloor, "flur", 4)
+	createLighting(t, s, upperFloor, "bad", 5)
+
+	if err := s.DeleteFloor(groundFloor); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.GetShutter(shutterID); err != model.ErrNotFound {
+		t.Errorf("Expected the shutter to be deleted with its floor but got %v", err)
+	}
+	if _, err := s.GetLighting(lightingID); err != model.ErrNotFound {
+		t.Errorf("Expected the lighting to be deleted with its floor but got %v", err)
+	}
+	if pins, err := s.GetPinList(); err != nil || len(pins) != 1 || pins[0].Number != 5 {
+		t.Errorf("Expected only the pin of the other floor but got %v, %v", pins, err)
+	}
+	// the pins of the deleted devices are free again
+	createShutter(t, s, upperFloor, "kueche", 17, 27)
+}
+
+func checkTags(t *testing.T, s Store, expected []*model.Tag) {
+	t.Helper()
+	tags, err := s.GetTagList()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(tags, expected) {
+		got := []model.Tag{}
+		for _, tag := range tags {
+			got = append(got, *tag)
+		}
+		t.Errorf("Expected other tags but got %+v", got)
+	}
+}
+
+func testTags(t *testing.T, s Store) {
+	floorID := createFloor(t, s, "erdgeschoss")
+	shutter := newShutter(floorID, "schlafzimmer", 17, 27)
+	shutter.Tags = []string{"south", "bedrooms", "south"}
+	shutterID, err := s.CreateShutter(shutter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lighting := newLighting(floorID, "terrasse", 4)
+	lighting.Tags = []string{"south"}
+	lightingID, err := s.CreateLighting(lighting)
+	if err != nil {
+		t.Fatal(err)
+	}
+	untaggedID := createShutter(t, s, floorID, "kueche", 5, 6)
+
+	if shutter, err := s.GetShutter(shutterID); err != nil || !reflect.DeepEqual(shutter.Tags, []string{"bedrooms", "south"}) {
+		t.Errorf("Expected the sorted tags without duplicates but got %+v, %v", shutter, err)
+	}
+	if untagged, err := s.GetShutter(untaggedID); err != nil || untagged.Tags == nil || len(untagged.Tags) != 0 {
+		t.Errorf("Expected an empty list of tags but got %+v, %v", untagged, err)
+	}
+	checkTags(t, s, []*model.Tag{{Name: "bedrooms", Shutters: 1}, {Name: "south", Shutters: 1, Lightings: 1}})
+
+	if shutters, err := s.FindShutters(&model.ListOptions{Tag: "south"}); err != nil || len(shutters) != 1 || shutters[0].ID != shutterID {
+		t.Errorf("Expected the shutter with the tag but got %v, %v", shutters, err)
+	}
+	if lightings, err := s.FindLightings(&model.ListOptions{Tag: "south"}); err != nil || len(lightings) != 1 || lightings[0].ID != lightingID {
+		t.Errorf("Expected the lighting with the tag but got %v, %v", lightings, err)
+	}
+	if shutters, err := s.FindShutters(&model.ListOptions{Tag: "north"}); err != nil || len(shutters) != 0 {
+		t.Errorf("Expected no shutters with an unknown tag but got %v, %v", shutters, err)
+	}
+
+	updated, err := s.GetShutter(shutterID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	updated.Tags = []string{"north"}
+	if err := s.UpdateShutter(updated); err != nil {
+		t.Fatal(err)
+	}
+	// a failed update does not change the tags
+	updated.Tags = []string{"west"}
+	if err := s.UpdateShutter(updated); err != model.ErrVersionConflict {
+		t.Errorf("Expected a version conflict on updating a stale shutter but got %v", err)
+	}
+	checkTags(t, s, []*model.Tag{{Name: "north", Shutters: 1}, {Name: "south", Lightings: 1}})
+
+	if err := s.DeleteLighting(lightingID); err != nil {
+		t.Fatal(err)
+	}
+	checkTags(t, s, []*model.Tag{{Name: "north", Shutters: 1}})
+	if err := s.DeleteFloor(floorID); err != nil {
+		t.Fatal(err)
+	}
+	checkTags(t, s, []*model.Tag{})
+}
+
+func testCalendarExceptions(t *testing.T, s Store) {
+	floorID := createFloor(t, s, "erdgeschoss")
+	shutterID := createShutter(t, s, floorID, "kueche", 17, 27)
+	otherShutterID := createShutter(t, s, floorID, "bad", 5, 6)
+	lightingID := createLighting(t, s, floorID, "flur", 4)
+
+	holiday := &model.CalendarException{
+		Description:  strPtr("Weihnachten"),
+		StartDate:    "2017-12-25",
+		EndDate:      "2017-12-26",
+		Action:       model.CalendarShift,
+		ShiftMinutes: 90,
+		Jobs:         []string{"open", "on", "open"},
+		Shutters:     []int64{otherShutterID, shutterID},
+		Lightings:    []int64{lightingID},
+		Source:       "holidays.ics",
+	}
+	holidayID, err := s.CreateCalendarException(holiday)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vacationID, err := s.CreateCalendarException(&model.CalendarException{
+		Description: strPtr("Urlaub"),
+		StartDate:   "2017-08-01",
+		Action:      model.CalendarSkip,
+		AllDevices:  true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.CreateCalendarException(&model.CalendarException{
+		Description: strPtr("Unbekannt"), StartDate: "2017-08-01", Action: model.CalendarSkip, Shutters: []int64{999},
+	}); err == nil {
+		t.Error("Expected an error on creating an exception with an unknown shutter")
+	}
+	if _, err := s.CreateCalendarException(&model.CalendarException{
+		Description: strPtr("Rueckwaerts"), StartDate: "2017-08-02", EndDate: "2017-08-01", Action: model.CalendarSkip,
+	}); err == nil {
+		t.Error("Expected an error on creating an exception that ends before it starts")
+	}
+
+	exception, err := s.GetCalendarException(holidayID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *exception.Description != "Weihnachten" || exception.EndDate != "2017-12-26" || exception.ShiftMinutes != 90 ||
+		!reflect.DeepEqual(exception.Jobs, []string{"on", "open"}) ||
+		!reflect.DeepEqual(exception.Shutters, []int64{shutterID, otherShutterID}) ||
+		!reflect.DeepEqual(exception.Lightings, []int64{lightingID}) ||
+		exception.Source != "holidays.ics" || exception.Version != 1 {
+		t.Errorf("Expected the created exception with sorted jobs and devices but got %+v", exception)
+	}
+	if _, err := s.GetCalendarException(999); err != model.ErrNotFound {
+		t.Errorf("Expected model.ErrNotFound for an unknown exception but got %v", err)
+	}
+
+	exceptions, err := s.GetCalendarExceptionList()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(exceptions) != 2 || exceptions[0].ID != vacationID || exceptions[0].EndDate != "2017-08-01" ||
+		exceptions[0].Jobs == nil || exceptions[0].Shutters == nil || !exceptions[0].AllDevices || exceptions[1].ID != holidayID {
+		t.Errorf("Expected the exceptions ordered by their start date but got %v", exceptions)
+	}
+
+	exception.Action = model.CalendarSkip
+	exception.Shutters = []int64{otherShutterID}
+	if err := s.UpdateCalendarException(exception); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.UpdateCalendarException(exception); err != model.ErrVersionConflict {
+		t.Errorf("Expected a version conflict on updating a stale exception but got %v", err)
+	}
+	if updated, err := s.GetCalendarException(holidayID); err != nil || updated.Action != model.CalendarSkip ||
+		!reflect.DeepEqual(updated.Shutters, []int64{otherShutterID}) || updated.Version != 2 {
+		t.Errorf("Expected the updated exception but got %+v, %v", updated, err)
+	}
+
+	// deleted devices are removed from the exceptions
+	if err := s.DeleteShutter(otherShutterID); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.DeleteFloor(floorID); err != nil {
+		t.Fatal(err)
+	}
+	if updated, err := s.GetCalendarException(holidayID); err != nil || len(updated.Shutters) != 0 || len(updated.Lightings) != 0 {
+		t.Errorf("Expected the exception without devices but got %+v, %v", updated, err)
+	}
+
+	if err := s.DeleteCalendarException(vacationID); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.DeleteCalendarException(vacationID); err == nil {
+		t.Error("Expected an error on deleting an unknown exception")
+	}
+}
+
+func testPins(t *testing.T, s Store) {
+	floorID := createFloor(t, s, "erdgeschoss")
+	shutterID := createShutter(t, s, floorID, "kueche", 17, 27)
+	lightingID := createLighting(t, s, floorID, "flur", 4)
+
+	pins, err := s.GetPinList()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []model.Pin{
+		{Number: 4, DeviceType: model.DeviceTypeLighting, DeviceID: lightingID, Function: "switch"},
+		{Number: 17, DeviceType: model.DeviceTypeShutter, DeviceID: shutterID, Function: "open"},
+		{Number: 27, DeviceType: model.DeviceTypeShutter, DeviceID: shutterID, Function: "close"},
+	}
+	if len(pins) != len(expected) {
+		t.Fatalf("Expected the pins %v but got %v", expected, pins)
+	}
+	for i := range pins {
+		if *pins[i] != expected[i] {
+			t.Errorf("Expected the pin %+v but got %+v", expected[i], *pins[i])
+		}
+	}
+
+	if pin, err := s.GetPin(27); err != nil || *pin != expected[2] {
+		t.Errorf("Expected the close pin of the shutter but got %v, %v", pin, err)
+	}
+	if _, err := s.GetPin(22); err != model.ErrNotFound {
+		t.Errorf("Expected model.ErrNotFound for a free pin but got %v", err)
+	}
+
+	shutter, err := s.GetShutter(shutterID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	shutter.ClosePin = intPtr(22)
+	if err := s.UpdateShutter(shutter); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.GetPin(27); err != model.ErrNotFound {
+		t.Errorf("Expected the old pin to be free after the update but got %v", err)
+	}
+
+	// the store rejects a pin that is assigned to another device and names the device
+	_, err = s.CreateLighting(newLighting(floorID, "bad", 17))
+	if conflict, ok := err.(*model.PinConflictError); !ok || conflict.Assigned == nil || *conflict.Assigned != expected[1] {
+		t.Errorf("Expected a conflict with the open pin of the shutter but got %v", err)
+	}
+	shutter, err = s.GetShutter(shutterID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	shutter.OpenPin = intPtr(4)
+	err = s.UpdateShutter(shutter)
+	if conflict, ok := err.(*model.PinConflictError); !ok || conflict.Assigned == nil || *conflict.Assigned != expected[0] {
+		t.Errorf("Expected a conflict with the pin of the lighting but got %v", err)
+	}
+	shutter.OpenPin = intPtr(22)
+	err = s.UpdateShutter(shutter)
+	if conflict, ok := err.(*model.PinConflictError); !ok || conflict.Number != 22 || conflict.Assigned != nil {
+		t.Errorf("Expected a conflict for the pin used twice by the shutter but got %v", err)
+	}
+
+	// swapping the pins of a device is no conflict
+	shutter.OpenPin, shutter.ClosePin = intPtr(22), intPtr(17)
+	if err := s.UpdateShutter(shutter); err != nil {
+		t.Errorf("Expected the pins of the shutter to be swapped but got %v", err)
+	}
+}
+
+func testFind(t *testing.T, s Store) {
+	groundFloor := createFloor(t, s, "erdgeschoss")
+	upperFloor := createFloor(t, s, "obergeschoss")
+	kitchen := createShutter(t, s, groundFloor, "Kueche", 17, 27)
+	living := createShutter(t, s, groundFloor, "Wohnzimmer", 5, 6)
+	bath := createShutter(t, s, upperFloor, "Bad_oben", 12, 13)
+	if err := s.UpdateShutterState(living, "opening"); err != nil {
+		t.Fatal(err)
+	}
+
+	disabled := true
+	shutter, err := s.GetShutter(bath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	shutter.Disabled = true
+	if err := s.UpdateShutter(shutter); err != nil {
+		t.Fatal(err)
+	}
+
+	status := "opening"
+	tests := []struct {
+		name string
+		opts model.ListOptions
+		want []int64
+	}{
+		{"all", model.ListOptions{}, []int64{kitchen, living, bath}},
+		{"floor", model.ListOptions{FloorID: &groundFloor}, []int64{kitchen, living}},
+		{"floors", model.ListOptions{FloorIDs: []int64{upperFloor, upperFloor + 10}}, []int64{bath}},
+		{"floor and floors", model.ListOptions{FloorID: &groundFloor, FloorIDs: []int64{upperFloor}}, []int64{}},
+		{"disabled", model.ListOptions{Disabled: &disabled}, []int64{bath}},
+		{"device status", model.ListOptions{DeviceStatus: &status}, []int64{living}},
+		{"search ignores the case", model.ListOptions{Search: "WOHN"}, []int64{living}},
+		{"search is no pattern", model.ListOptions{Search: "_"}, []int64{bath}},
+		{"sort", model.ListOptions{Sort: "description"}, []int64{bath, kitchen, living}},
+		{"sort descending with ties", model.ListOptions{Sort: "floorId", Descending: true}, []int64{bath, living, kitchen}},
+		{"page", model.ListOptions{Sort: "description", Limit: 1, Cursor: cursor(`"Bad_oben"`, bath, false)}, []int64{kitchen}},
+		{"page before the cursor", model.ListOptions{Sort: "description", Limit: 1, Cursor: cursor(`"Wohnzimmer"`, living, true)}, []int64{kitchen}},
+		{"page before the cursor keeps the order", model.ListOptions{Sort: "floorId", Descending: true, Limit: 2,
+			Cursor: cursor(fmt.Sprint(groundFloor), kitchen, true)}, []int64{bath, living}},
+		{"page of a time", model.ListOptions{Sort: "created", Descending: true, Limit: 1,
+			Cursor: cursor(`"2999-01-01T00:00:00Z"`, 0, false)}, []int64{bath}},
+		{"page after the end", model.ListOptions{Limit: 2, Cursor: cursor(fmt.Sprint(bath+5), bath+5, false)}, []int64{}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			shutters, err := s.FindShutters(&test.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(shutters) != len(test.want) {
+				t.Fatalf("Expected the shutters %v but got %d shutters", test.want, len(shutters))
+			}
+			for i, s := range shutters {
+				if s.ID != test.want[i] {
+					t.Fatalf("Expected the shutters %v but got %d at %d", test.want, s.ID, i)
+				}
+			}
+		})
+	}
+
+	upperRoom := createRoom(t, s, upperFloor, "bad")
+	createRoom(t, s, groundFloor, "kueche")
+	if rooms, err := s.FindRooms(&model.ListOptions{FloorIDs: []int64{upperFloor}}); err != nil || len(rooms) != 1 || rooms[0].ID != upperRoom {
+		t.Errorf("Expected only the room of the upper floor but got %v, %v", rooms, err)
+	}
+	if floors, err := s.FindFloors(&model.ListOptions{Sort: "description", Descending: true, Limit: 1}); err != nil ||
+		len(floors) != 1 || floors[0].ID != upperFloor {
+		t.Errorf("Expected the upper floor first but got %v, %v", floors, err)
+	}
+	invalid := []*model.ListOptions{
+		{Sort: "openPin"},
+		{Limit: -1},
+		{Sort: "created", Cursor: cursor(`"yesterday"`, kitchen, false)},
+		{Cursor: cursor(`[1]`, kitchen, false)},
+		{Cursor: cursor(`{`, kitchen, true)},
+	}
+	for _, opts := range invalid {
+		if _, err := s.FindShutters(opts); err == nil {
+			t.Errorf("Expected a model.ListOptionsError for %+v", opts)
+		} else if _, ok := err.(*model.ListOptionsError); !ok {
+			t.Errorf("Expected a model.ListOptionsError for %+v but got %v", opts, err)
+		}
+	}
+	if _, err := s.FindLightings(&model.ListOptions{Sort: "openingInPrc"}); err == nil {
+		t.Error("Expected an error for a shutter field as sort of the lightings")
+	}
+}
+
+func testConfiguration(t *testing.T, s Store) {
+	floorID := createFloor(t, s, "erdgeschoss")
+	createShutter(t, s, floorID, "kueche", 17, 27)
+	createLighting(t, s, floorID, "flur", 4)
+
+	config, err := s.GetConfiguration()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(config.Floors) != 1 || len(config.Shutters) != 1 || len(config.Lightings) != 1 {
+		t.Fatalf("Expected one floor, shutter and lighting but got %+v", config)
+	}
+
+	imported := &model.Configuration{
+		Floors:    []*model.Floor{{Base: model.Base{ID: 7}, Description: strPtr("obergeschoss")}},
+		Rooms:     []*model.Room{{Base: model.Base{ID: 4}, Description: strPtr("bad"), FloorID: idPtr(7)}},
+		Shutters:  []*model.Shutter{newShutter(7, "bad", 5, 6)},
+		Lightings: []*model.Lighting{newLighting(7, "flur", 17)},
+	}
+	imported.Shutters[0].ID = 3
+	imported.Shutters[0].RoomID = idPtr(4)
+	imported.Shutters[0].Tags = []string{"south"}
+	imported.Lightings[0].ID = 9
+	imported.CalendarExceptions = []*model.CalendarException{{
+		Base: model.Base{ID: 5}, Description: strPtr("Urlaub"), StartDate: "2017-08-01", EndDate: "2017-08-14",
+		Action: model.CalendarSkip, Jobs: []string{"open"}, Shutters: []int64{3},
+	}}
+	if err := s.ImportConfiguration(imported); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.GetFloor(floorID); err != model.ErrNotFound {
+		t.Errorf("Expected the old floor to be replaced but got %v", err)
+	}
+	if shutter, err := s.GetShutter(3); err != nil || *shutter.FloorID != 7 || *shutter.RoomID != 4 ||
+		!reflect.DeepEqual(shutter.Tags, []string{"south"}) || shutter.DeviceStatus != "stopped" {
+		t.Errorf("Expected the imported shutter with its id but got %+v, %v", shutter, err)
+	}
+	if lighting, err := s.GetLighting(9); err != nil || *lighting.SwitchPin != 17 {
+		t.Errorf("Expected the imported lighting with its id but got %+v, %v", lighting, err)
+	}
+	if exception, err := s.GetCalendarException(5); err != nil || *exception.Description != "Urlaub" ||
+		exception.EndDate != "2017-08-14" || !reflect.DeepEqual(exception.Shutters, []int64{3}) {
+		t.Errorf("Expected the imported calendar exception with its id but got %+v, %v", exception, err)
+	}
+
+	// an invalid configuration changes nothing
+	invalid := &model.Configuration{
+		Floors:    []*model.Floor{{Base: model.Base{ID: 1}, Description: strPtr("keller")}},
+		Lightings: []*model.Lighting{newLighting(2, "flur", 4)},
+	}
+	if err := s.ImportConfiguration(invalid); err == nil {
+		t.Fatal("Expected an error for a lighting on a missing floor")
+	}
+	config, err = s.GetConfiguration()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(config.Floors) != 1 || config.Floors[0].ID != 7 || len(config.Rooms) != 1 ||
+		len(config.Shutters) != 1 || len(config.Lightings) != 1 || len(config.CalendarExceptions) != 1 {
+		t.Errorf("Expected the previous configuration after a failed import but got %+v", config)
+	}
+}
+
+func testTransactions(t *testing.T, s Store) {
+	if err := s.WithTx(func(tx almue.DeviceStore) error {
+		_, err := tx.CreateFloor(&model.Floor{Description: strPtr("erdgeschoss")})
+		return err
+	}); err != nil {
+		t.Fatalf("Could not create the floor in a transaction: %v", err)
+	}
+
+	errAbort := errors.New("abort")
+	err := s.WithTx(func(tx almue.DeviceStore) error {
+		if _, err := tx.CreateFloor(&model.Floor{Description: strPtr("obergeschoss")}); err != nil {
+			return err
+		}
+		// a failing statement does not end the transaction
+		if _, err := tx.CreateFloor(&model.Floor{Description: strPtr("obergeschoss")}); err == nil {
+			t.Error("Expected an error for a duplicate floor description in the transaction")
+		}
+		// a nested transaction joins the outer one
+		return tx.WithTx(func(nested almue.DeviceStore) error {
+			floors, err := nested.GetFloorList()
+			if err != nil {
+				return err
+			}
+			if len(floors) != 2 {
+				t.Errorf("Expected the nested transaction to see 2 floors but got %d", len(floors))
+			}
+			return errAbort
+		})
+	})
+	if err != errAbort {
+		t.Fatalf("Expected the error of the transaction but got %v", err)
+	}
+
+	floors, err := s.GetFloorList()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(floors) != 1 || *floors[0].Description != "erdgeschoss" {
+		t.Errorf("Expected only the committed floor but got %v", floors)
+	}
+}